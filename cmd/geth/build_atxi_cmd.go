@@ -5,6 +5,7 @@ import (
 
 	"github.com/ethereumproject/go-ethereum/core"
 	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -20,6 +21,9 @@ var buildAddrTxIndexCommand = cli.Command{
 	run the command on multiple occasions and pick up indexing progress where the last session
 	left off.
 	To enable address-transaction indexing during block sync and import, use the '--atxi' flag.
+	Use the global '--atxi.logs' flag to also build the index of contract event logs.
+	Use the global '--atxi.internal' flag to also build the index of internal transactions.
+	Blocks imported without it are re-executed, which requires the state of their parent.
 			`,
 	Flags: []cli.Flag{
 		cli.IntFlag{
@@ -65,6 +69,75 @@ func buildAddrTxIndexCmd(ctx *cli.Context) error {
 	}
 	defer chainDB.Close()
 
-	bc.SetAtxi(&core.AtxiT{Db: indexDB, AutoMode: false, Progress: &core.AtxiProgressT{}})
+	bc.SetAtxi(&core.AtxiT{
+		Db:       indexDB,
+		AutoMode: false,
+		Progress: &core.AtxiProgressT{},
+		Logs:     ctx.GlobalBool(aliasableName(AddrTxIndexLogsFlag.Name, ctx)),
+		Internal: ctx.GlobalBool(aliasableName(AddrTxIndexInternalFlag.Name, ctx)),
+	})
 	return core.BuildAddrTxIndex(bc, chainDB, indexDB, startIndex, stopIndex, step)
 }
+
+var verifyAddrTxIndexCommand = cli.Command{
+	Action: verifyAddrTxIndexCmd,
+	Name:   "atxi-verify",
+	Usage:  "Check index for transactions by address against the canonical chain",
+	Description: `
+	Walks a range of blocks and reports index entries missing for canonical transactions,
+	as well as stale entries left for transactions of blocks which are no longer canonical,
+	eg. after a reorg or rollback.
+	The internal transaction and log indexes are checked too. Use the global '--atxi.logs'
+	flag to also report log index entries missing up to the log index bookmark.
+	With --repair, missing entries are written and stale entries are removed.
+	The command exits with an error if inconsistencies were found and not repaired.
+			`,
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "start",
+			Usage: "Block number at which to begin checking index",
+		},
+		cli.IntFlag{
+			Name:  "stop",
+			Usage: "Block number at which to stop checking index (default: head)",
+		},
+		cli.BoolFlag{
+			Name:  "repair",
+			Usage: "Write missing and remove stale index entries",
+		},
+	},
+}
+
+func verifyAddrTxIndexCmd(ctx *cli.Context) error {
+	ethdb.SetCacheRatio("chaindata", 0.5)
+	ethdb.SetHandleRatio("chaindata", 1)
+	ethdb.SetCacheRatio("indexes", 0.5)
+	ethdb.SetHandleRatio("indexes", 1)
+
+	indexDB := MakeIndexDatabase(ctx)
+	if indexDB == nil {
+		glog.Fatalln("can't open index database")
+	}
+	defer indexDB.Close()
+
+	bc, chainDB := MakeChain(ctx)
+	if bc == nil || chainDB == nil {
+		glog.Fatalln("can't open chain database")
+	}
+	defer chainDB.Close()
+
+	bc.SetAtxi(&core.AtxiT{
+		Db:       indexDB,
+		Progress: &core.AtxiProgressT{},
+		Logs:     ctx.GlobalBool(aliasableName(AddrTxIndexLogsFlag.Name, ctx)),
+	})
+	res, err := core.VerifyAddrTxIndex(bc, indexDB, uint64(ctx.Int("start")), uint64(ctx.Int("stop")), ctx.Bool("repair"))
+	if res != nil {
+		action := "found"
+		if res.Repaired {
+			action = "repaired"
+		}
+		glog.D(logger.Error).Infof("atxi-verify: blocks %d-%d txs: %d, %s missing: %d stale: %d", res.Start, res.Stop, res.Txs, action, res.Missing, res.Stale)
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ethereumproject/go-ethereum/core"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var chainConfigCommand = cli.Command{
+	Name:  "chain-config",
+	Usage: "Validate and compare external chain configurations",
+	Description: `
+	Checks external chain configuration files, as given with '--chain', before they
+	are used by a node, and compares them, e.g. when maintaining several private networks.
+	`,
+	Subcommands: []cli.Command{
+		{
+			Action: validateChainConfig,
+			Name:   "validate",
+			Usage:  "Deeply validate a chain configuration file",
+			Description: `
+geth chain-config validate <file>
+
+	Reads the chain configuration file along with the files it includes, and reports
+	every problem found: missing or malformed required fields, genesis allocations
+	which cannot be parsed, malformed bootstrap node URLs, forks which are unnamed or
+	not in chronological order, fork features which are unknown or have options of
+	the wrong type, and required or bad hashes which contradict each other or the
+	genesis block. Exits with an error if any problem was found.
+			`,
+		},
+		{
+			Action: diffChainConfigs,
+			Name:   "diff",
+			Usage:  "Print the differences between two chain configurations",
+			Description: `
+geth chain-config diff <a> <b>
+
+	Prints the differences from chain configuration a to b, one per line: lines
+	starting with '-' for what only a has, '+' for what only b has and '~' for what
+	changed. Forks are matched by name and their features by id. Either configuration
+	can be a file or the name of a default one, 'mainnet' or 'morden'.
+			`,
+		},
+	},
+}
+
+func validateChainConfig(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("%v: use: $ geth chain-config validate <file>", ErrInvalidFlag)
+	}
+	path := ctx.Args().First()
+
+	errs, err := core.ValidateExternalChainConfigFile(path)
+	if err != nil {
+		return err
+	}
+	for _, err := range errs {
+		fmt.Printf("%s: %v\n", path, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %d problem(s) found", path, len(errs))
+	}
+	fmt.Printf("%s: OK\n", path)
+	return nil
+}
+
+func diffChainConfigs(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("%v: use: $ geth chain-config diff <a> <b>", ErrInvalidFlag)
+	}
+	a, err := readChainConfigArg(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	b, err := readChainConfigArg(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	for _, line := range core.DiffChainConfigs(a, b) {
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// readChainConfigArg reads the chain configuration file at the given path,
+// or returns the default configuration of that name if there is no such file.
+func readChainConfigArg(arg string) (*core.SufficientChainConfig, error) {
+	if arg == "" {
+		return nil, errors.New("missing chain configuration")
+	}
+	if _, err := os.Stat(arg); os.IsNotExist(err) {
+		switch {
+		case core.ChainIdentitiesMain[arg]:
+			return core.DefaultConfigMainnet, nil
+		case core.ChainIdentitiesMorden[arg]:
+			return core.DefaultConfigMorden, nil
+		}
+	}
+	return core.ReadExternalChainConfigFromFile(arg)
+}
@@ -18,6 +18,7 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -26,11 +27,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ethereumproject/ethash"
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/core"
 	"github.com/ethereumproject/go-ethereum/core/state"
 	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/core/vm"
+	"github.com/ethereumproject/go-ethereum/eth"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/pow"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -39,6 +44,42 @@ var (
 		Action: importChain,
 		Name:   "import",
 		Usage:  `Import a blockchain file`,
+		Description: `
+	geth import [--dry-run] <file|directory|pattern>
+	geth import --receipts --checkpoint <hash> <file|directory|pattern>
+
+	Imports a chain file, or the segment files of a directory or matching a glob
+	pattern in name order. Files may be gzip compressed. The checksums of segment
+	files written by 'geth export --split-every' are verified, and imported files
+	are recorded in the chain database so that an interrupted import resumes from
+	the first file not yet imported.
+
+	With --receipts, the files are receipt chain files written by 'geth export
+	--receipts', imported the way fast sync does: headers, bodies and receipts
+	are inserted without executing the transactions, trusting the chain up to
+	the block of the given checkpoint hash. The head header and fast block move
+	to the checkpoint, the state of which can be imported with 'geth import-state'.
+
+	With --dry-run, the blocks are validated against the chain database, headers,
+	bodies and state transitions, without writing anything to it. A report line is
+	written to stdout for every block, with its gas used and computed state root,
+	and the command fails if any block is invalid. The state of the parent of the
+	first block must be available.
+		`,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Validate the blocks without importing them",
+			},
+			cli.BoolFlag{
+				Name:  "receipts",
+				Usage: "Import receipt chain files without executing the transactions",
+			},
+			cli.StringFlag{
+				Name:  "checkpoint",
+				Usage: "Hash of the trusted last block to import with --receipts",
+			},
+		},
 	}
 	exportCommand = cli.Command{
 		Action: exportChain,
@@ -49,6 +90,63 @@ var (
 	Optional second and third arguments control the first and
 	last block to write. In this mode, the file will be appended
 	if already existing.
+
+	geth export [--from N] [--to M] [--split-every K] [--gzip] [--receipts] <file>
+
+	Writes the blocks N (default 0) to M (default the head block) to the file,
+	gzip compressed with --gzip. With --split-every, the blocks are written to
+	segment files of K blocks named <file>-<first>-<last>.rlp[.gz], each along
+	with a sha256 checksum file, which 'geth import' accepts as a directory or a
+	glob pattern. With --receipts, every block is written along with its receipts,
+	for 'geth import --receipts' to bootstrap a node without executing them.
+		`,
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "from",
+				Usage: "First block to export",
+			},
+			cli.IntFlag{
+				Name:  "to",
+				Usage: "Last block to export (default: head block)",
+			},
+			cli.IntFlag{
+				Name:  "split-every",
+				Usage: "Number of blocks per segment file (0 = single file)",
+			},
+			cli.BoolFlag{
+				Name:  "gzip",
+				Usage: "Compress the exported files with gzip",
+			},
+			cli.BoolFlag{
+				Name:  "receipts",
+				Usage: "Export the receipts of the blocks too",
+			},
+		},
+	}
+	exportStateCommand = cli.Command{
+		Action: exportState,
+		Name:   "export-state",
+		Usage:  `Export the state of a block into a snapshot file`,
+		Description: `
+	geth export-state <block> <file>
+
+	Writes the state of the given canonical block, a number or hash, to a compressed
+	snapshot file, along with the block and its recent ancestors. The snapshot can be
+	imported with 'geth import-state' to bootstrap a node from that block without a
+	fast sync. The state of the block must be available.
+		`,
+	}
+	importStateCommand = cli.Command{
+		Action: importState,
+		Name:   "import-state",
+		Usage:  `Import a state snapshot file`,
+		Description: `
+	geth import-state <file>
+
+	Imports a snapshot written by 'geth export-state'. The imported state is checked
+	against the state root of the snapshot block. Unless the block is already known,
+	the chain database must be fresh: the block then becomes the head of the chain
+	and the node syncs on from it. Geth must not be running.
 		`,
 	}
 	upgradedbCommand = cli.Command{
@@ -66,6 +164,39 @@ var (
 	Use "$ geth dump 0" to dump the genesis block.
 		`,
 	}
+	traceCommand = cli.Command{
+		Action: traceBlock,
+		Name:   "trace",
+		Usage:  `Trace the transactions of a specific block from storage`,
+		Description: `
+	The argument is interpreted as a block number or hash.
+	Every transaction of the block is replayed on top of the state of its parent
+	block and the resulting traces are written to stdout as JSON.
+	The command works on the chain database directly, so the node must be stopped.
+		`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "tracer",
+				Usage: `Tracer to use: "structLogger" (default) or "callTracer"`,
+			},
+			cli.BoolFlag{
+				Name:  "disable-memory",
+				Usage: "Do not capture EVM memory in struct logs",
+			},
+			cli.BoolFlag{
+				Name:  "disable-stack",
+				Usage: "Do not capture EVM stack in struct logs",
+			},
+			cli.BoolFlag{
+				Name:  "disable-storage",
+				Usage: "Do not capture contract storage in struct logs",
+			},
+			cli.IntFlag{
+				Name:  "limit",
+				Usage: "Maximum number of struct logs per transaction (0 = unlimited)",
+			},
+		},
+	}
 	dumpChainConfigCommand = cli.Command{
 		Action:  dumpChainConfig,
 		Name:    "dump-chain-config",
@@ -122,9 +253,20 @@ func importChain(ctx *cli.Context) error {
 	if len(ctx.Args()) != 1 {
 		log.Fatal("This command requires an argument.")
 	}
+	if ctx.Bool("dry-run") {
+		return dryRunImportChain(ctx)
+	}
+	if ctx.Bool("receipts") {
+		return importReceiptChain(ctx)
+	}
+	files, err := chainFiles(ctx.Args().First())
+	if err != nil {
+		log.Fatal("Import error: ", err)
+	}
 	chain, chainDb := MakeChain(ctx)
 	start := time.Now()
-	err := ImportChain(chain, ctx.Args().First())
+	err = ImportChainFiles(chain, chainDb, files)
+	chain.Stop()
 	chainDb.Close()
 	if err != nil {
 		log.Fatal("Import error: ", err)
@@ -133,6 +275,60 @@ func importChain(ctx *cli.Context) error {
 	return nil
 }
 
+func importReceiptChain(ctx *cli.Context) error {
+	hex := ctx.String("checkpoint")
+	if len(common.FromHex(hex)) != common.HashLength {
+		log.Fatal("--receipts requires the hash of the trusted last block to import with --checkpoint")
+	}
+	files, err := chainFiles(ctx.Args().First())
+	if err != nil {
+		log.Fatal("Import error: ", err)
+	}
+	chain, chainDb := MakeChain(ctx)
+	start := time.Now()
+	block, err := ImportReceiptChainFiles(chain, files, common.HexToHash(hex))
+	chain.Stop()
+	chainDb.Close()
+	if err != nil {
+		log.Fatal("Import error: ", err)
+	}
+	fmt.Printf("Import done in %v, head fast block #%d [%x…]\n", time.Since(start), block.NumberU64(), block.Hash().Bytes()[:4])
+	return nil
+}
+
+func dryRunImportChain(ctx *cli.Context) error {
+	sconf := mustMakeSufficientChainConfig(ctx)
+	chainDb := MakeChainDatabase(ctx)
+	defer chainDb.Close()
+
+	pow := pow.PoW(core.FakePow{})
+	if !ctx.GlobalBool(aliasableName(FakePoWFlag.Name, ctx)) {
+		pow = ethash.New()
+	}
+	chain, err := core.NewDryRunChain(chainDb, sconf.ChainConfig, pow)
+	if err != nil {
+		log.Fatal("Could not start chain manager: ", err)
+	}
+	files, err := chainFiles(ctx.Args().First())
+	if err != nil {
+		log.Fatal("Import error: ", err)
+	}
+	start := time.Now()
+	invalid := 0
+	for _, fn := range files {
+		n, err := DryRunImportChain(chain, fn, os.Stdout)
+		if err != nil {
+			log.Fatal("Import error: ", err)
+		}
+		invalid += n
+	}
+	if invalid > 0 {
+		log.Fatalf("Dry run found %d invalid blocks", invalid)
+	}
+	fmt.Printf("Dry run done in %v, all blocks valid\n", time.Since(start))
+	return nil
+}
+
 func exportChain(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
 		log.Fatal("This command requires an argument.")
@@ -141,7 +337,24 @@ func exportChain(ctx *cli.Context) error {
 	start := time.Now()
 
 	fp := ctx.Args().First()
-	if len(ctx.Args()) < 3 {
+	if ctx.IsSet("from") || ctx.IsSet("to") || ctx.IsSet("split-every") || ctx.Bool("gzip") || ctx.Bool("receipts") {
+		if ctx.Int("from") < 0 || ctx.Int("to") < 0 || ctx.Int("split-every") < 0 {
+			log.Fatal("export parameters must not be negative")
+		}
+		first, last := uint64(ctx.Int("from")), chain.CurrentBlock().NumberU64()
+		if ctx.IsSet("to") {
+			last = uint64(ctx.Int("to"))
+		}
+		var err error
+		if every := ctx.Int("split-every"); every > 0 {
+			err = ExportChainSegments(chain, fp, first, last, uint64(every), ctx.Bool("gzip"), ctx.Bool("receipts"))
+		} else {
+			err = ExportChainRange(chain, fp, first, last, ctx.Bool("gzip"), ctx.Bool("receipts"))
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if len(ctx.Args()) < 3 {
 		if err := ExportChain(chain, fp); err != nil {
 			log.Fatal(err)
 		}
@@ -164,6 +377,54 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+func exportState(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		log.Fatal("This command requires two arguments.")
+	}
+	chain, chainDb := MakeChain(ctx)
+	defer chainDb.Close()
+
+	b := strings.TrimSpace(ctx.Args().First())
+	var block *types.Block
+	if hashish(b) {
+		block = chain.GetBlock(common.HexToHash(b))
+	} else {
+		num, err := strconv.ParseUint(b, 10, 64)
+		if err != nil {
+			log.Fatal("export-state parameter: ", err)
+		}
+		block = chain.GetBlockByNumber(num)
+	}
+	if block == nil {
+		log.Fatal("Block not found: ", b)
+	}
+	start := time.Now()
+	if err := ExportState(chain, block, ctx.Args().Get(1)); err != nil {
+		log.Fatal("Export error: ", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
+func importState(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		log.Fatal("This command requires an argument.")
+	}
+	// Set up the chain to write the genesis block of a fresh database, the
+	// snapshot being imported into the database directly.
+	chain, chainDb := MakeChain(ctx)
+	chain.Stop()
+	defer chainDb.Close()
+
+	start := time.Now()
+	block, err := ImportState(chainDb, ctx.Args().First())
+	if err != nil {
+		log.Fatal("Import error: ", err)
+	}
+	fmt.Printf("Imported state of block #%d [%x] in %v\n", block.NumberU64(), block.Hash(), time.Since(start))
+	return nil
+}
+
 func upgradeDB(ctx *cli.Context) error {
 	glog.Infoln("Upgrading blockchain database")
 
@@ -186,6 +447,7 @@ func upgradeDB(ctx *cli.Context) error {
 	chain, chainDb = MakeChain(ctx)
 	core.WriteBlockChainVersion(chainDb, core.BlockChainVersion)
 	err := ImportChain(chain, exportFile)
+	chain.Stop()
 	chainDb.Close()
 	if err != nil {
 		log.Fatalf("Import error %v (a backup is made in %s, use the import command to import it)", err, exportFile)
@@ -291,6 +553,57 @@ func dump(ctx *cli.Context) error {
 	return nil
 }
 
+// traceBlock replays the transactions of the block given as first argument
+// and prints their traces.
+// $ geth trace [--tracer callTracer] [hash|num]
+func traceBlock(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("%v: use: $ geth trace [blockHash|blockNum]", ErrInvalidFlag)
+	}
+
+	chain, chainDb := MakeChain(ctx)
+	defer chainDb.Close()
+
+	b := strings.TrimSpace(ctx.Args().First())
+	var block *types.Block
+	if hashish(b) {
+		block = chain.GetBlock(common.HexToHash(b))
+	} else {
+		num, err := strconv.ParseUint(b, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%v: invalid block number: %v", ErrInvalidFlag, err)
+		}
+		block = chain.GetBlockByNumber(num)
+	}
+	if block == nil {
+		return fmt.Errorf("block not found: %s", b)
+	}
+
+	args := &eth.TraceArgs{
+		LogConfig: &vm.LogConfig{
+			DisableMemory:  ctx.Bool("disable-memory"),
+			DisableStack:   ctx.Bool("disable-stack"),
+			DisableStorage: ctx.Bool("disable-storage"),
+			Limit:          ctx.Int("limit"),
+		},
+	}
+	if tracer := ctx.String("tracer"); tracer != "" {
+		args.Tracer = &tracer
+	}
+
+	results, err := eth.TraceBlock(chain, chain.Config(), block, args)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "    ")
+	return enc.Encode(results)
+}
+
 // hashish returns true for strings that look like hashes.
 func hashish(x string) bool {
 	_, err := strconv.Atoi(x)
@@ -0,0 +1,296 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+)
+
+// checksumSuffix is the suffix of the file holding the sha256 checksum of a
+// chain segment file, in the format of sha256sum.
+const checksumSuffix = ".sha256"
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// chainFile is an open chain file, decompressed on the fly if gzip compressed.
+type chainFile struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (f *chainFile) Close() error {
+	var err error
+	for i := len(f.closers) - 1; i >= 0; i-- {
+		if e := f.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// openChainFile opens a chain file for reading, plain or gzip compressed.
+func openChainFile(fn string) (io.ReadCloser, error) {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(fh)
+	if magic, err := r.Peek(len(gzipMagic)); err != nil || !bytes.Equal(magic, gzipMagic) {
+		return &chainFile{r, []io.Closer{fh}}, nil
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return &chainFile{gz, []io.Closer{fh, gz}}, nil
+}
+
+// segmentName returns the name of the chain segment file holding the blocks
+// first to last. Block numbers are zero padded for the names to sort in order.
+func segmentName(prefix string, first, last uint64, compress bool) string {
+	fn := fmt.Sprintf("%s-%010d-%010d.rlp", prefix, first, last)
+	if compress {
+		fn += ".gz"
+	}
+	return fn
+}
+
+// ExportChainRange writes the blocks first to last of the chain to a file,
+// gzip compressed if compress is set, as receipt chain records if receipts is.
+func ExportChainRange(blockchain *core.BlockChain, fn string, first, last uint64, compress, receipts bool) error {
+	glog.D(logger.Warn).Infoln("Exporting blocks", first, "to", last, "to", fn)
+	_, err := exportChainFile(blockchain, fn, first, last, compress, receipts)
+	return err
+}
+
+// ExportChainSegments writes the blocks first to last of the chain to segment
+// files of at most every blocks, named after prefix and the block range they
+// hold, each one along with a checksum file.
+func ExportChainSegments(blockchain *core.BlockChain, prefix string, first, last, every uint64, compress, receipts bool) error {
+	if every == 0 {
+		return fmt.Errorf("invalid segment size 0")
+	}
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	for from := first; ; from += every {
+		to := from + every - 1
+		if to > last || to < from {
+			to = last
+		}
+		fn := segmentName(prefix, from, to, compress)
+		glog.D(logger.Warn).Infoln("Exporting blocks", from, "to", to, "to", fn)
+
+		sum, err := exportChainFile(blockchain, fn, from, to, compress, receipts)
+		if err != nil {
+			return err
+		}
+		line := fmt.Sprintf("%x  %s\n", sum, filepath.Base(fn))
+		if err := ioutil.WriteFile(fn+checksumSuffix, []byte(line), 0644); err != nil {
+			return err
+		}
+		if to == last {
+			break
+		}
+	}
+	glog.D(logger.Error).Infoln("Exported blockchain segments to", prefix)
+	return nil
+}
+
+// exportChainFile writes the blocks first to last of the chain to a file, gzip
+// compressed if compress is set, as receipt chain records if receipts is, and
+// returns the sha256 checksum of the file.
+func exportChainFile(blockchain *core.BlockChain, fn string, first, last uint64, compress, receipts bool) (common.Hash, error) {
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer fh.Close()
+
+	var (
+		hasher = sha256.New()
+		buf    = bufio.NewWriter(io.MultiWriter(fh, hasher))
+		w      io.Writer
+		gz     *gzip.Writer
+	)
+	w = buf
+	if compress {
+		gz = gzip.NewWriter(buf)
+		w = gz
+	}
+	if receipts {
+		err = blockchain.ExportReceiptChainN(w, first, last)
+	} else {
+		err = blockchain.ExportN(w, first, last)
+	}
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return common.Hash{}, err
+	}
+	if err := fh.Close(); err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(hasher.Sum(nil)), nil
+}
+
+// chainFiles resolves the chain files to import from a command line argument:
+// a single file, a directory of segment files or a glob pattern. Segment
+// files are returned in name order, which is block order.
+func chainFiles(arg string) ([]string, error) {
+	var (
+		matches []string
+		err     error
+	)
+	if info, statErr := os.Stat(arg); statErr == nil && info.IsDir() {
+		matches, err = filepath.Glob(filepath.Join(arg, "*"))
+		if err != nil {
+			return nil, err
+		}
+		var segments []string
+		for _, fn := range matches {
+			if strings.HasSuffix(fn, ".rlp") || strings.HasSuffix(fn, ".rlp.gz") {
+				segments = append(segments, fn)
+			}
+		}
+		matches = segments
+	} else if strings.ContainsAny(arg, "*?[") {
+		matches, err = filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		var segments []string
+		for _, fn := range matches {
+			if !strings.HasSuffix(fn, checksumSuffix) {
+				segments = append(segments, fn)
+			}
+		}
+		matches = segments
+	} else {
+		return []string{arg}, nil
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no chain files found in %s", arg)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// checkChainFile computes the sha256 checksum of a chain file and verifies it
+// against the one of its checksum file, if any.
+func checkChainFile(fn string) (common.Hash, error) {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer fh.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, fh); err != nil {
+		return common.Hash{}, err
+	}
+	sum := common.BytesToHash(hasher.Sum(nil))
+
+	line, err := ioutil.ReadFile(fn + checksumSuffix)
+	if os.IsNotExist(err) {
+		return sum, nil
+	} else if err != nil {
+		return common.Hash{}, err
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return common.Hash{}, fmt.Errorf("%s: empty checksum file", fn)
+	}
+	want, err := hex.DecodeString(fields[0])
+	if err != nil || len(want) != common.HashLength {
+		return common.Hash{}, fmt.Errorf("%s: invalid checksum file", fn)
+	}
+	if common.BytesToHash(want) != sum {
+		return common.Hash{}, fmt.Errorf("%s: checksum mismatch: have %x, want %x", fn, sum, want)
+	}
+	return sum, nil
+}
+
+// ImportChainFiles imports chain files in order, verifying their checksums.
+// The imports are recorded in the chain database, so that an interrupted run
+// resumes from the first file not yet imported.
+func ImportChainFiles(chain *core.BlockChain, chainDb ethdb.Database, files []string) error {
+	for _, fn := range files {
+		sum, err := checkChainFile(fn)
+		if err != nil {
+			return err
+		}
+		if last := core.GetImportedSegment(chainDb, sum); last != (common.Hash{}) && chain.HasBlock(last) {
+			glog.D(logger.Warn).Warnln("Skipping", fn, "already imported")
+			continue
+		}
+		last, err := importChainFile(chain, fn)
+		if err != nil {
+			return fmt.Errorf("%s: %v", fn, err)
+		}
+		if last != (common.Hash{}) {
+			if err := core.WriteImportedSegment(chainDb, sum, last); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ImportReceiptChainFiles imports the receipt chain records of chain files in
+// order, verifying their checksums, up to the trusted checkpoint block.
+func ImportReceiptChainFiles(chain *core.BlockChain, files []string, checkpoint common.Hash) (*types.Block, error) {
+	readers := make([]io.Reader, len(files))
+	for i, fn := range files {
+		if _, err := checkChainFile(fn); err != nil {
+			return nil, err
+		}
+		fh, err := openChainFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		defer fh.Close()
+		readers[i] = fh
+	}
+	glog.D(logger.Error).Infoln("Importing receipt chain up to checkpoint", checkpoint.Hex())
+	return chain.ImportReceiptChain(io.MultiReader(readers...), checkpoint)
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+)
+
+func newSegmentTestChain(t *testing.T, blocks int) (*core.BlockChain, *ethdb.MemDatabase) {
+	db, _ := ethdb.NewMemDatabase()
+	genesis := core.WriteGenesisBlockForTesting(db)
+	chain, err := core.NewBlockChain(db, core.MakeDiehardChainConfig(), core.FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks > 0 {
+		gendb, _ := ethdb.NewMemDatabase()
+		core.WriteGenesisBlockForTesting(gendb)
+		generated, _ := core.GenerateChain(core.MakeDiehardChainConfig(), genesis, gendb, blocks, nil)
+		if res := chain.InsertChain(generated); res.Error != nil {
+			t.Fatalf("failed to insert block %d: %v", res.Index, res.Error)
+		}
+	}
+	return chain, db
+}
+
+// Tests that a chain exported to compressed segment files is imported back from
+// their directory, and that imported segments are skipped on a later run.
+func TestChainSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geth-segments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source, _ := newSegmentTestChain(t, 10)
+	defer source.Stop()
+
+	prefix := filepath.Join(dir, "chain")
+	if err := ExportChainSegments(source, prefix, 0, 10, 4, true, false); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		segmentName(prefix, 0, 3, true),
+		segmentName(prefix, 4, 7, true),
+		segmentName(prefix, 8, 10, true),
+	}
+	files, err := chainFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("segment files mismatch: have %v, want %v", files, want)
+	}
+	if globbed, err := chainFiles(prefix + "-*"); err != nil || !reflect.DeepEqual(globbed, want) {
+		t.Fatalf("globbed segment files mismatch: have %v (%v), want %v", globbed, err, want)
+	}
+	for _, fn := range files {
+		if _, err := checkChainFile(fn); err != nil {
+			t.Fatalf("checksum of %s: %v", fn, err)
+		}
+	}
+
+	chain, db := newSegmentTestChain(t, 0)
+	defer chain.Stop()
+
+	if err := ImportChainFiles(chain, db, files[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 7 {
+		t.Fatalf("head mismatch after partial import: have %d, want 7", head)
+	}
+	for i, fn := range files[:2] {
+		sum, _ := checkChainFile(fn)
+		if last := core.GetImportedSegment(db, sum); last != source.GetBlockByNumber(uint64(4*i+3)).Hash() {
+			t.Errorf("segment %d import record mismatch: have %x", i, last)
+		}
+	}
+	// A corrupted segment fails its checksum, resuming imports the remaining ones
+	if err := ioutil.WriteFile(files[0], []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportChainFiles(chain, db, files); err == nil {
+		t.Fatal("corrupted segment imported")
+	}
+	if err := ImportChainFiles(chain, db, files[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if head := chain.CurrentBlock().Hash(); head != source.CurrentBlock().Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, source.CurrentBlock().Hash())
+	}
+}
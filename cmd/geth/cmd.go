@@ -37,6 +37,7 @@ import (
 	"github.com/ethereumproject/go-ethereum/core/state"
 	"github.com/ethereumproject/go-ethereum/core/types"
 	"github.com/ethereumproject/go-ethereum/eth"
+	"github.com/ethereumproject/go-ethereum/ethdb"
 	"github.com/ethereumproject/go-ethereum/event"
 	"github.com/ethereumproject/go-ethereum/logger"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
@@ -169,6 +170,13 @@ func StartNode(stack *node.Node) {
 
 // Chain imports a blockchain.
 func ImportChain(chain *core.BlockChain, fn string) error {
+	_, err := importChainFile(chain, fn)
+	return err
+}
+
+// importChainFile imports the blocks of a chain file, plain or gzip compressed,
+// returning the hash of the last one.
+func importChainFile(chain *core.BlockChain, fn string) (common.Hash, error) {
 	// Watch for Ctrl-C while the import is running.
 	// If a signal is received, the import will stop at the next batch.
 	interrupt := make(chan os.Signal, 1)
@@ -192,9 +200,9 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 	}
 
 	glog.D(logger.Error).Infoln("Importing blockchain ", fn)
-	fh, err := os.Open(fn)
+	fh, err := openChainFile(fn)
 	if err != nil {
-		return err
+		return common.Hash{}, err
 	}
 	defer fh.Close()
 	stream := rlp.NewStream(fh, 0)
@@ -202,10 +210,11 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 	// Run actual the import.
 	blocks := make(types.Blocks, importBatchSize)
 	n := 0
+	last := common.Hash{}
 	for batch := 0; ; batch++ {
 		// Load a batch of RLP blocks.
 		if checkInterrupt() {
-			return fmt.Errorf("interrupted")
+			return common.Hash{}, fmt.Errorf("interrupted")
 		}
 		i := 0
 		for ; i < importBatchSize; i++ {
@@ -213,7 +222,7 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 			if err := stream.Decode(&b); err == io.EOF {
 				break
 			} else if err != nil {
-				return fmt.Errorf("at block %d: %v", n, err)
+				return common.Hash{}, fmt.Errorf("at block %d: %v", n, err)
 			}
 			// don't import first block
 			if b.NumberU64() == 0 {
@@ -221,6 +230,7 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 				continue
 			}
 			blocks[i] = &b
+			last = b.Hash()
 			n++
 		}
 		if i == 0 {
@@ -228,7 +238,7 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 		}
 		// Import the batch.
 		if checkInterrupt() {
-			return fmt.Errorf("interrupted")
+			return common.Hash{}, fmt.Errorf("interrupted")
 		}
 		if hasAllBlocks(chain, blocks[:i]) {
 			glog.D(logger.Warn).Warnf("skipping batch %d, all blocks present [%x / %x]",
@@ -237,10 +247,70 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 		}
 
 		if res := chain.InsertChain(blocks[:i]); res.Error != nil {
-			return fmt.Errorf("invalid block %d: %v", n, res.Error)
+			return common.Hash{}, fmt.Errorf("invalid block %d: %v", n, res.Error)
 		}
 	}
-	return nil
+	return last, nil
+}
+
+// DryRunImportChain validates the blocks of an exported chain file with the given
+// dry run chain, writing a report line for every block to w. It returns the
+// number of invalid blocks.
+func DryRunImportChain(chain *core.DryRunChain, fn string, w io.Writer) (int, error) {
+	glog.D(logger.Error).Infoln("Validating blockchain ", fn)
+	fh, err := openChainFile(fn)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+	stream := rlp.NewStream(fh, 0)
+
+	var blocks, invalid int
+	for {
+		var b types.Block
+		if err := stream.Decode(&b); err == io.EOF {
+			break
+		} else if err != nil {
+			return invalid, fmt.Errorf("at block %d: %v", blocks, err)
+		}
+		blocks++
+		// don't validate first block
+		if b.NumberU64() == 0 {
+			continue
+		}
+		report := chain.Validate(&b)
+		if report.Err != nil {
+			invalid++
+		}
+		fmt.Fprintln(w, formatDryRunReport(report))
+	}
+	fmt.Fprintf(w, "Validated %d blocks, %d invalid, %v kept in memory\n", blocks, invalid, chain.MemorySize())
+	return invalid, nil
+}
+
+// formatDryRunReport formats the report of a block as a single line.
+func formatDryRunReport(r *core.DryRunReport) string {
+	gas, root := "-", "-"
+	if r.GasUsed != nil {
+		gas = r.GasUsed.String()
+	}
+	if r.StateRoot != (common.Hash{}) {
+		root = r.StateRoot.Hex()
+	}
+	var status string
+	switch {
+	case r.BadHash:
+		status = "BAD HASH"
+	case r.RootMismatch():
+		status = fmt.Sprintf("ROOT MISMATCH (header %s)", r.Root.Hex())
+	case r.Err != nil:
+		status = fmt.Sprintf("INVALID (%v)", r.Err)
+	case r.Known:
+		status = "known"
+	default:
+		status = "ok"
+	}
+	return fmt.Sprintf("#%d [%x…] txs=%d gas=%s root=%s %s", r.Number, r.Hash.Bytes()[:4], r.Txs, gas, root, status)
 }
 
 func hasAllBlocks(chain *core.BlockChain, bs []*types.Block) bool {
@@ -281,6 +351,30 @@ func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, las
 	return nil
 }
 
+func ExportState(blockchain *core.BlockChain, block *types.Block, fn string) error {
+	glog.D(logger.Warn).Infoln("Exporting state of block", block.NumberU64(), "to", fn, "(this may take a while)...")
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	if err := blockchain.ExportState(fh, block); err != nil {
+		return err
+	}
+	glog.D(logger.Error).Infoln("Exported state to", fn)
+	return nil
+}
+
+func ImportState(chainDb ethdb.Database, fn string) (*types.Block, error) {
+	glog.D(logger.Warn).Infoln("Importing state from", fn, "(this may take a while)...")
+	fh, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return core.ImportState(chainDb, fh)
+}
+
 func withLineBreak(s string) string {
 	return s + "\n"
 }
@@ -615,6 +709,13 @@ func rollback(ctx *cli.Context) error {
 	bc, chainDB := MakeChain(ctx)
 	defer chainDB.Close()
 
+	// Indexes of rolled back blocks are removed along with them.
+	if ctx.GlobalBool(aliasableName(AddrTxIndexFlag.Name, ctx)) {
+		indexDB := MakeIndexDatabase(ctx)
+		defer indexDB.Close()
+		bc.SetAtxi(&core.AtxiT{Db: indexDB})
+	}
+
 	glog.D(logger.Warn).Infoln("Rolling back blockchain...")
 
 	if err := bc.SetHead(blockIndex); err != nil {
@@ -705,6 +806,20 @@ func dumpChainConfig(ctx *cli.Context) error {
 	return nil
 }
 
+// reloadChainConfigOnHangup reloads the external chain configuration, its
+// bootstrap nodes and bad hashes, whenever the process receives SIGHUP.
+func reloadChainConfigOnHangup(ethereum *eth.Ethereum) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGHUP)
+	for range sigc {
+		glog.V(logger.Info).Infoln("Got SIGHUP, reloading chain configuration...")
+		if err := ethereum.ReloadChainConfig(); err != nil {
+			glog.V(logger.Error).Errorf("Could not reload chain configuration: %v", err)
+			glog.D(logger.Error).Errorf("Could not reload chain configuration: %v", err)
+		}
+	}
+}
+
 // startNode boots up the system node and all registered protocols, after which
 // it unlocks any requested accounts, and starts the RPC/IPC interfaces and the
 // miner.
@@ -712,6 +827,11 @@ func startNode(ctx *cli.Context, stack *node.Node) *eth.Ethereum {
 	// Start up the node itself
 	StartNode(stack)
 
+	// A light client runs none of the full node services below
+	if ctx.GlobalBool(aliasableName(LightModeFlag.Name, ctx)) {
+		return nil
+	}
+
 	// Unlock any account specifically requested
 	var ethereum *eth.Ethereum
 	if err := stack.Service(&ethereum); err != nil {
@@ -727,6 +847,8 @@ func startNode(ctx *cli.Context, stack *node.Node) *eth.Ethereum {
 		a.AutoMode = true
 		go core.BuildAddrTxIndex(ethereum.BlockChain(), ethereum.ChainDb(), a.Db, math.MaxUint64, math.MaxUint64, 10000)
 	}
+	go reloadChainConfigOnHangup(ethereum)
+
 	if ctx.GlobalBool(aliasableName(MiningEnabledFlag.Name, ctx)) {
 		if err := ethereum.StartMining(ctx.GlobalInt(aliasableName(MinerThreadsFlag.Name, ctx)), ctx.GlobalString(aliasableName(MiningGPUFlag.Name, ctx))); err != nil {
 			glog.Fatalf("Failed to start mining: %v", err)
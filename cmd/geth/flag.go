@@ -40,6 +40,7 @@ import (
 	"github.com/ethereumproject/go-ethereum/eth"
 	"github.com/ethereumproject/go-ethereum/ethdb"
 	"github.com/ethereumproject/go-ethereum/event"
+	"github.com/ethereumproject/go-ethereum/les"
 	"github.com/ethereumproject/go-ethereum/logger"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
 	"github.com/ethereumproject/go-ethereum/miner"
@@ -495,10 +496,33 @@ func MakeSystemNode(version string, ctx *cli.Context) *node.Node {
 	if err != nil {
 		glog.Fatalf("%v: failed to create the protocol stack: %v", ErrStackFail, err)
 	}
-	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
-		return eth.New(ctx, ethConf)
-	}); err != nil {
-		glog.Fatalf("%v: failed to register the Ethereum service: %v", ErrStackFail, err)
+	if ctx.GlobalBool(aliasableName(LightModeFlag.Name, ctx)) {
+		if ctx.GlobalBool(aliasableName(MiningEnabledFlag.Name, ctx)) || ctx.GlobalBool(aliasableName(LightServFlag.Name, ctx)) {
+			glog.Fatalf("--%s cannot be combined with mining or serving light clients", LightModeFlag.Name)
+		}
+		if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			return les.New(ctx, ethConf)
+		}); err != nil {
+			glog.Fatalf("%v: failed to register the light Ethereum service: %v", ErrStackFail, err)
+		}
+	} else {
+		if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			return eth.New(ctx, ethConf)
+		}); err != nil {
+			glog.Fatalf("%v: failed to register the Ethereum service: %v", ErrStackFail, err)
+		}
+	}
+	if ctx.GlobalBool(aliasableName(LightServFlag.Name, ctx)) {
+		maxPeers := ctx.GlobalInt(aliasableName(LightPeersFlag.Name, ctx))
+		if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			var ethereum *eth.Ethereum
+			if err := ctx.Service(&ethereum); err != nil {
+				return nil, err
+			}
+			return les.NewLesServer(ethereum, maxPeers), nil
+		}); err != nil {
+			glog.Fatalf("%v: failed to register the light server service: %v", ErrStackFail, err)
+		}
 	}
 	if shhEnable {
 		if err := stack.Register(func(*node.ServiceContext) (node.Service, error) { return whisper.New(), nil }); err != nil {
@@ -589,14 +613,23 @@ func mustMakeEthConf(ctx *cli.Context, sconf *core.SufficientChainConfig) *eth.C
 
 	ethConf := &eth.Config{
 		ChainConfig:             sconf.ChainConfig,
+		ChainConfigFile:         mustMakeChainConfigFile(ctx),
+		Checkpoint:              sconf.Checkpoint,
 		Genesis:                 sconf.Genesis,
 		UseAddrTxIndex:          ctx.GlobalBool(aliasableName(AddrTxIndexFlag.Name, ctx)),
+		UseInternalTxIndex:      ctx.GlobalBool(aliasableName(AddrTxIndexInternalFlag.Name, ctx)),
+		UseLogIndex:             ctx.GlobalBool(aliasableName(AddrTxIndexLogsFlag.Name, ctx)),
+		UseFreezer:              ctx.GlobalBool(aliasableName(FreezerFlag.Name, ctx)),
+		FreezerDepth:            uint64(ctx.GlobalInt(aliasableName(FreezerDepthFlag.Name, ctx))),
+		StateGC:                 mustMakeGCMode(ctx),
+		VMCrossCheck:            ctx.GlobalString(aliasableName(VMCrossCheckFlag.Name, ctx)),
 		FastSync:                ctx.GlobalBool(aliasableName(FastSyncFlag.Name, ctx)),
 		BlockChainVersion:       ctx.GlobalInt(aliasableName(BlockchainVersionFlag.Name, ctx)),
 		DatabaseCache:           ctx.GlobalInt(aliasableName(CacheFlag.Name, ctx)),
 		DatabaseHandles:         MakeDatabaseHandles(),
 		NetworkId:               sconf.Network,
 		MaxPeers:                ctx.GlobalInt(aliasableName(MaxPeersFlag.Name, ctx)),
+		PeerBanPeriod:           ctx.GlobalDuration(aliasableName(PeerBanPeriodFlag.Name, ctx)),
 		AccountManager:          accman,
 		Etherbase:               MakeEtherbase(accman, ctx),
 		MinerThreads:            ctx.GlobalInt(aliasableName(MinerThreadsFlag.Name, ctx)),
@@ -695,7 +728,7 @@ func mustMakeSufficientChainConfig(ctx *cli.Context) *core.SufficientChainConfig
 
 	// Returns surely valid suff chain config.
 	chainDir := MustMakeChainDataDir(ctx)
-	defaultChainConfigPath := filepath.Join(chainDir, "chain.json")
+	defaultChainConfigPath := mustMakeChainConfigFile(ctx)
 	if _, de := os.Stat(defaultChainConfigPath); de != nil && os.IsNotExist(de) {
 		glog.Fatalf(`%v: %v
 		It looks like you haven't set up your custom chain yet...
@@ -728,6 +761,15 @@ func mustMakeSufficientChainConfig(ctx *cli.Context) *core.SufficientChainConfig
 	return config
 }
 
+// mustMakeChainConfigFile returns the path of the external chain configuration
+// file in use, or an empty string for the default configurations.
+func mustMakeChainConfigFile(ctx *cli.Context) string {
+	if chainIdentity := mustMakeChainIdentity(ctx); core.ChainIdentitiesMain[chainIdentity] || core.ChainIdentitiesMorden[chainIdentity] {
+		return ""
+	}
+	return filepath.Join(MustMakeChainDataDir(ctx), "chain.json")
+}
+
 func logChainConfiguration(ctx *cli.Context, config *core.SufficientChainConfig) {
 	chainIdentity := mustMakeChainIdentity(ctx)
 	chainIsCustom := !(core.ChainIdentitiesMain[chainIdentity] || core.ChainIdentitiesMorden[chainIdentity])
@@ -778,8 +820,9 @@ func logChainConfiguration(ctx *cli.Context, config *core.SufficientChainConfig)
 	glog.V(logger.Info).Infof("Using %d configured bootnodes", len(config.ParsedBootstrap))
 	glog.D(logger.Warn).Infof("Using %d configured bootnodes", len(config.ParsedBootstrap))
 
-	glog.V(logger.Info).Infof("Use Sputnik EVM: %s", logger.ColorGreen(fmt.Sprintf("%v", core.UseSputnikVM)))
-	glog.D(logger.Warn).Infof("Use Sputnik EVM: %s", logger.ColorGreen(fmt.Sprintf("%v", core.UseSputnikVM)))
+	vm, _ := core.CurrentTxExecutor()
+	glog.V(logger.Info).Infof("Ethereum Virtual Machine: %s", logger.ColorGreen(vm))
+	glog.D(logger.Warn).Infof("Ethereum Virtual Machine: %s", logger.ColorGreen(vm))
 
 	glog.V(logger.Info).Info(glog.Separator("-"))
 
@@ -808,6 +851,9 @@ func MakeChainDatabase(ctx *cli.Context) ethdb.Database {
 	if err != nil {
 		glog.Fatal("Could not open database: ", err)
 	}
+	if err := chainDb.OpenFreezer(filepath.Join(chainDb.Path(), "ancient"), false); err != nil {
+		glog.Fatal("Could not open freezer: ", err)
+	}
 	return chainDb
 }
 
@@ -843,9 +889,44 @@ func MakeChain(ctx *cli.Context) (chain *core.BlockChain, chainDb ethdb.Database
 	if err != nil {
 		glog.Fatal("Could not start chainmanager: ", err)
 	}
+	if mustMakeGCMode(ctx) {
+		if err := chain.EnableStateGC(); err != nil {
+			glog.Fatal("Could not enable state garbage collection: ", err)
+		}
+	}
 	return chain, chainDb
 }
 
+// mustMakeGCMode reports whether the --gcmode flag enables state garbage collection.
+func mustMakeGCMode(ctx *cli.Context) bool {
+	switch mode := ctx.GlobalString(aliasableName(GCModeFlag.Name, ctx)); mode {
+	case "full":
+		return true
+	case "archive":
+		return false
+	default:
+		log.Fatalf("invalid %s flag value %q, must be \"full\" or \"archive\"", aliasableName(GCModeFlag.Name, ctx), mode)
+		return false
+	}
+}
+
+// mustMakeVMName returns the name of the Ethereum Virtual Machine implementation
+// selected with --vm, or its deprecated --sputnikvm alias.
+func mustMakeVMName(ctx *cli.Context) string {
+	vm := ctx.GlobalString(aliasableName(VMFlag.Name, ctx))
+	if ctx.GlobalBool(aliasableName(SputnikVMFlag.Name, ctx)) {
+		if ctx.GlobalIsSet(aliasableName(VMFlag.Name, ctx)) && vm != "sputnikvm" {
+			log.Fatalf("conflicting --%s=%s and --%s flags", VMFlag.Name, vm, SputnikVMFlag.Name)
+		}
+		vm = "sputnikvm"
+	}
+	// Internal transactions are only traced by the native EVM
+	if vm != core.NativeTxExecutor && ctx.GlobalBool(aliasableName(AddrTxIndexInternalFlag.Name, ctx)) {
+		log.Fatalf("--%s requires --%s=%s, internal transactions can't be indexed with %s", AddrTxIndexInternalFlag.Name, VMFlag.Name, core.NativeTxExecutor, vm)
+	}
+	return vm
+}
+
 // MakeConsolePreloads retrieves the absolute paths for the console JavaScript
 // scripts to preload before starting.
 func MakeConsolePreloads(ctx *cli.Context) []string {
@@ -11,6 +11,7 @@ import (
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/core"
 	"github.com/ethereumproject/go-ethereum/eth"
+	"github.com/ethereumproject/go-ethereum/eth/peerscore"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
 	"github.com/ethereumproject/go-ethereum/rpc"
 	"gopkg.in/urfave/cli.v1"
@@ -35,9 +36,18 @@ var (
 		Usage: "Set interval in seconds for runtime profiling",
 		Value: 5,
 	}
+	VMFlag = cli.StringFlag{
+		Name:  "vm",
+		Usage: "Ethereum Virtual Machine implementation executing transactions, one of " + strings.Join(core.TxExecutorNames(), ", "),
+		Value: core.NativeTxExecutor,
+	}
 	SputnikVMFlag = cli.BoolFlag{
 		Name:  "sputnikvm",
-		Usage: "Use SputnikVM Ethereum Virtual Machine implementation",
+		Usage: "Use SputnikVM Ethereum Virtual Machine implementation (deprecated, use --vm=sputnikvm)",
+	}
+	VMCrossCheckFlag = cli.StringFlag{
+		Name:  "vm.crosscheck",
+		Usage: "Execute transactions with the given Ethereum Virtual Machine implementation too, reporting divergences",
 	}
 	DataDirFlag = DirectoryFlag{
 		Name:  "data-dir,datadir",
@@ -85,6 +95,11 @@ var (
 		Usage: "Megabytes of memory allocated to internal caching (min 16MB / database forced)",
 		Value: 1024,
 	}
+	GCModeFlag = cli.StringFlag{
+		Name:  "gcmode",
+		Usage: `Blockchain state garbage collection mode ("full", "archive"). In full mode, the states of recent blocks are kept in memory and only periodically written to disk`,
+		Value: "archive",
+	}
 	BlockchainVersionFlag = cli.IntFlag{
 		Name:  "blockchain-version,blockchainversion",
 		Usage: "Blockchain version (integer)",
@@ -94,6 +109,19 @@ var (
 		Name:  "fast",
 		Usage: "Enable fast syncing through state downloads",
 	}
+	LightModeFlag = cli.BoolFlag{
+		Name:  "light",
+		Usage: "Run as a light client, syncing only headers and retrieving everything else on demand from light servers",
+	}
+	LightServFlag = cli.BoolFlag{
+		Name:  "light-serv,lightserv",
+		Usage: "Serve light clients over the les protocol next to the full node",
+	}
+	LightPeersFlag = cli.IntFlag{
+		Name:  "light-peers,lightpeers",
+		Usage: "Maximum number of light clients to serve (requires --light-serv)",
+		Value: 20,
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "light-kdf,lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -106,6 +134,23 @@ var (
 		Name:  "atxi.autobuild,atxi.auto-build",
 		Usage: "Begins automatic concurrent indexes building process that runs alongside a normally running geth.",
 	}
+	AddrTxIndexInternalFlag = cli.BoolFlag{
+		Name:  "atxi.internal",
+		Usage: "Also index internal transactions (value transfers and contract creations made by contracts) of processed blocks. Requires --atxi",
+	}
+	AddrTxIndexLogsFlag = cli.BoolFlag{
+		Name:  "atxi.logs",
+		Usage: "Also index contract event logs by address and first topic, used for eth_getLogs instead of blooms. Requires --atxi",
+	}
+	FreezerFlag = cli.BoolFlag{
+		Name:  "freezer",
+		Usage: "Move the bodies and receipts of ancient blocks out of the chain database into flat files. Pre-existing chaindata can be migrated with command 'freezer migrate'",
+	}
+	FreezerDepthFlag = cli.IntFlag{
+		Name:  "freezer.depth",
+		Usage: "Number of recent blocks whose bodies and receipts are kept in the chain database",
+		Value: core.DefaultFreezerDepth,
+	}
 	// Network Split settings
 	ETFChain = cli.BoolFlag{
 		Name:  "etf",
@@ -336,6 +381,11 @@ var (
 		Usage: "Maximum number of network peers (network disabled if set to 0)",
 		Value: 25,
 	}
+	PeerBanPeriodFlag = cli.DurationFlag{
+		Name:  "peer-ban-period,peerbanperiod",
+		Usage: "Time a misbehaving peer is banned for, growing with every repeated offence",
+		Value: peerscore.DefaultBanPeriod,
+	}
 	MaxPendingPeersFlag = cli.IntFlag{
 		Name:  "max-pend-peers,maxpendpeers",
 		Usage: "Maximum number of pending connection attempts (defaults used if set to 0)",
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var freezerCommand = cli.Command{
+	Name:  "freezer",
+	Usage: "Manage the ancient block freezer",
+	Description: `
+	The freezer holds the bodies and receipts of ancient blocks in append-only flat files
+	alongside the chain database, keeping them out of LevelDB compactions.
+	To freeze ancient blocks during normal operation, use the '--freezer' flag.
+	`,
+	Subcommands: []cli.Command{
+		{
+			Action: freezerMigrate,
+			Name:   "migrate",
+			Usage:  "Move ancient block bodies and receipts from the chain database to the freezer",
+			Description: `
+geth freezer migrate
+
+	Moves the bodies and receipts of the canonical blocks older than '--freezer.depth'
+	blocks from the head into the freezer, creating it if needed, then compacts the
+	chain database. The command can be interrupted and run again, picking up where
+	the last session left off. Geth must not be running.
+			`,
+		},
+	},
+}
+
+func freezerMigrate(ctx *cli.Context) error {
+	chainDb, ok := MakeChainDatabase(ctx).(*ethdb.LDBDatabase)
+	if !ok {
+		glog.Fatal("could not cast chain db to level db")
+	}
+	defer chainDb.Close()
+
+	if err := chainDb.OpenFreezer(filepath.Join(chainDb.Path(), "ancient"), true); err != nil {
+		glog.Fatal("Could not open freezer: ", err)
+	}
+	depth := uint64(ctx.GlobalInt(aliasableName(FreezerDepthFlag.Name, ctx)))
+
+	start := time.Now()
+	before := chainDb.Ancients()
+	frozen, err := core.FreezeAncients(chainDb, depth, nil)
+	if err != nil {
+		glog.Fatal("Could not freeze ancient blocks: ", err)
+	}
+	fmt.Printf("Froze %d blocks in %v, %d blocks in freezer\n", frozen-before, time.Since(start), frozen)
+
+	if frozen > before {
+		fmt.Println("Compacting chain database...")
+		start = time.Now()
+		if err := chainDb.LDB().CompactRange(util.Range{}); err != nil {
+			glog.Fatal("Compaction failed: ", err)
+		}
+		fmt.Printf("Compaction done in %v\n", time.Since(start))
+	}
+	return nil
+}
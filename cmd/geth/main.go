@@ -116,9 +116,13 @@ func makeCLIApp() (app *cli.App) {
 	app.Commands = []cli.Command{
 		importCommand,
 		exportCommand,
+		exportStateCommand,
+		importStateCommand,
 		dumpChainConfigCommand,
+		chainConfigCommand,
 		upgradedbCommand,
 		dumpCommand,
+		traceCommand,
 		rollbackCommand,
 		recoverCommand,
 		resetCommand,
@@ -136,12 +140,17 @@ func makeCLIApp() (app *cli.App) {
 		versionCommand,
 		makeMlogDocCommand,
 		buildAddrTxIndexCommand,
+		verifyAddrTxIndexCommand,
+		freezerCommand,
+		pruneStateCommand,
 	}
 
 	app.Flags = []cli.Flag{
 		PprofFlag,
 		PprofIntervalFlag,
+		VMFlag,
 		SputnikVMFlag,
+		VMCrossCheckFlag,
 		NodeNameFlag,
 		UnlockedAccountFlag,
 		PasswordFileFlag,
@@ -153,14 +162,23 @@ func makeCLIApp() (app *cli.App) {
 		ChainIdentityFlag,
 		BlockchainVersionFlag,
 		FastSyncFlag,
+		LightModeFlag,
+		LightServFlag,
+		LightPeersFlag,
 		AddrTxIndexFlag,
 		AddrTxIndexAutoBuildFlag,
+		AddrTxIndexInternalFlag,
+		AddrTxIndexLogsFlag,
+		FreezerFlag,
+		FreezerDepthFlag,
+		GCModeFlag,
 		CacheFlag,
 		LightKDFFlag,
 		JSpathFlag,
 		ListenPortFlag,
 		MaxPeersFlag,
 		MaxPendingPeersFlag,
+		PeerBanPeriodFlag,
 		EtherbaseFlag,
 		GasPriceFlag,
 		MinerThreadsFlag,
@@ -251,12 +269,8 @@ func makeCLIApp() (app *cli.App) {
 			}
 		}
 
-		if ctx.IsSet(SputnikVMFlag.Name) {
-			if core.SputnikVMExists {
-				core.UseSputnikVM = "true"
-			} else {
-				log.Fatal("This version of geth wasn't built to include SputnikVM. To build with SputnikVM, use -tags=sputnikvm following the go build command.")
-			}
+		if err := core.SetTxExecutor(mustMakeVMName(ctx)); err != nil {
+			log.Fatal(err)
 		}
 
 		// Check for migrations and handle if conditionals are met.
@@ -340,7 +354,7 @@ func geth(ctx *cli.Context) error {
 	n := MakeSystemNode(Version, ctx)
 	ethe := startNode(ctx, n)
 
-	if ctx.GlobalString(LogStatusFlag.Name) != "off" {
+	if ethe != nil && ctx.GlobalString(LogStatusFlag.Name) != "off" {
 		dispatchStatusLogs(ctx, ethe)
 	}
 	logLoggingConfiguration(ctx)
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var pruneStateCommand = cli.Command{
+	Action: pruneStateCmd,
+	Name:   "prune-state",
+	Usage:  "Delete the state trie nodes unreachable from the recent blocks",
+	Description: `
+geth prune-state [--blocks 128]
+
+	Walks the state tries of the last --blocks canonical blocks, head included, whose
+	state is present, and deletes from the chain database every trie node which is
+	not reachable from any of them, then compacts the database. The states of older
+	blocks are no longer available afterwards.
+	Geth must not be running. The state of the head block must be present, and the
+	chain must not be in the middle of a fast sync.
+	`,
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "blocks",
+			Usage: "Number of recent blocks whose state is kept",
+			Value: 128,
+		},
+	},
+}
+
+func pruneStateCmd(ctx *cli.Context) error {
+	chainDb, ok := MakeChainDatabase(ctx).(*ethdb.LDBDatabase)
+	if !ok {
+		glog.Fatal("could not cast chain db to level db")
+	}
+	defer chainDb.Close()
+
+	blocks := uint64(ctx.Int("blocks"))
+	if blocks == 0 {
+		glog.Fatal("--blocks must be at least 1")
+	}
+	roots, err := core.PruneStateRoots(chainDb, blocks)
+	if err != nil {
+		glog.Fatal("Could not find the states to keep: ", err)
+	}
+
+	start := time.Now()
+	res, err := core.PruneState(chainDb, roots)
+	if err != nil {
+		glog.Fatal("Could not prune state: ", err)
+	}
+	fmt.Printf("Kept %d states with %d reachable nodes, deleted %d nodes, %v reclaimed in %v\n", res.Roots, res.Reachable, res.Deleted, res.Reclaimed, time.Since(start))
+
+	if res.Deleted > 0 {
+		fmt.Println("Compacting chain database...")
+		start = time.Now()
+		if err := chainDb.LDB().CompactRange(util.Range{}); err != nil {
+			glog.Fatal("Compaction failed: ", err)
+		}
+		fmt.Printf("Compaction done in %v\n", time.Since(start))
+	}
+	return nil
+}
@@ -64,11 +64,15 @@ var AppHelpFlagAndCommandGroups = []flagGroup{
 		Commands: []cli.Command{
 			importCommand,
 			exportCommand,
+			exportStateCommand,
+			importStateCommand,
 			dumpChainConfigCommand,
 			dumpCommand,
 			rollbackCommand,
 			recoverCommand,
 			resetCommand,
+			freezerCommand,
+			pruneStateCommand,
 		},
 		Flags: []cli.Flag{
 			DataDirFlag,
@@ -77,9 +81,17 @@ var AppHelpFlagAndCommandGroups = []flagGroup{
 			DevModeFlag,
 			NodeNameFlag,
 			FastSyncFlag,
+			LightModeFlag,
+			LightServFlag,
+			LightPeersFlag,
+			FreezerFlag,
+			FreezerDepthFlag,
+			GCModeFlag,
 			CacheFlag,
 			LightKDFFlag,
+			VMFlag,
 			SputnikVMFlag,
+			VMCrossCheckFlag,
 			BlockchainVersionFlag,
 		},
 	},
@@ -89,6 +101,7 @@ var AppHelpFlagAndCommandGroups = []flagGroup{
 			accountCommand,
 			walletCommand,
 			buildAddrTxIndexCommand,
+			verifyAddrTxIndexCommand,
 		},
 		Flags: []cli.Flag{
 			KeyStoreDirFlag,
@@ -97,6 +110,8 @@ var AppHelpFlagAndCommandGroups = []flagGroup{
 			AccountsIndexFlag,
 			AddrTxIndexFlag,
 			AddrTxIndexAutoBuildFlag,
+			AddrTxIndexInternalFlag,
+			AddrTxIndexLogsFlag,
 		},
 	},
 	{
@@ -133,6 +148,7 @@ var AppHelpFlagAndCommandGroups = []flagGroup{
 			ListenPortFlag,
 			MaxPeersFlag,
 			MaxPendingPeersFlag,
+			PeerBanPeriodFlag,
 			NATFlag,
 			NoDiscoverFlag,
 			NodeKeyFileFlag,
@@ -10,6 +10,7 @@ import (
 	"os/signal"
 	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -33,6 +34,14 @@ type AtxiT struct {
 	AutoMode bool
 	Progress *AtxiProgressT
 	Step     uint64
+	// Internal enables indexing of internal transactions (value transfers and
+	// contract creations made by contracts) during block processing.
+	Internal bool
+	// Logs enables indexing of contract event logs by emitter address and topic0,
+	// used by log filters in place of bloom scanning.
+	Logs bool
+
+	logsLock sync.Mutex // Protects the log index bookmarks, moved by both import and atxi-build
 }
 
 type AtxiProgressT struct {
@@ -59,10 +68,34 @@ func dbSetATXIBookmark(db ethdb.Database, i uint64) error {
 	return db.Put(txAddressBookmarkKey, bn)
 }
 
+// SetATXIBookmark sets the bookmark of the atx index, and moves the one of the
+// log index on to i if enabled, once all blocks up to i are indexed.
 func (a *AtxiT) SetATXIBookmark(i uint64) error {
+	if a.Logs {
+		if err := a.extendLogsBookmark(i); err != nil {
+			return err
+		}
+	}
 	return dbSetATXIBookmark(a.Db, i)
 }
 
+// setImported moves the bookmarks on after the indexes of block n were written
+// on import.
+func (a *AtxiT) setImported(n uint64) error {
+	if a.Logs {
+		if err := a.setLogsImported(n); err != nil {
+			return err
+		}
+	}
+	// if buildATXI has been in use (via RPC) and is NOT finished, current < stop
+	// if buildATXI has been in use (via RPC) and IS finished, current == stop
+	// else if builtATXI has not been in use (via RPC), then current == stop == 0
+	if a.AutoMode && a.Progress.Current == a.Progress.Stop {
+		return dbSetATXIBookmark(a.Db, n)
+	}
+	return nil
+}
+
 // formatAddrTxIterator formats the index key prefix iterator, eg. atx-<address>
 func formatAddrTxIterator(address common.Address) (iteratorPrefix []byte) {
 	iteratorPrefix = append(iteratorPrefix, txAddressIndexPrefix...)
@@ -101,18 +134,37 @@ func WriteBlockAddTxIndexes(indexDb ethdb.Database, block *types.Block) error {
 	if _, err := putBlockAddrTxsToBatch(batch, block); err != nil {
 		return err
 	}
+	if _, err := putBlockInternalTxsToBatch(batch, indexDb, block); err != nil {
+		return err
+	}
 	return batch.Write()
 }
 
 // putBlockAddrTxsToBatch formats and puts keys for a given block to a db Batch.
 // Batch can be written afterward if no errors, ie. batch.Write()
 func putBlockAddrTxsToBatch(putBatch ethdb.Batch, block *types.Block) (txsCount int, err error) {
-	for _, tx := range block.Transactions() {
-		txsCount++
+	keys, err := blockAddrTxKeys(block)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := putBatch.Put(key, nil); err != nil {
+			return 0, err
+		}
+	}
+	return block.Transactions().Len(), nil
+}
 
+// blockAddrTxKeys formats the atx- keys for a given block, a 'from' and a 'to' key per transaction.
+func blockAddrTxKeys(block *types.Block) (keys [][]byte, err error) {
+	// Note that len 8 because uint64 guaranteed <= 8 bytes.
+	bn := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bn, block.NumberU64())
+
+	for _, tx := range block.Transactions() {
 		from, err := tx.From()
 		if err != nil {
-			return txsCount, err
+			return nil, err
 		}
 		to := tx.To()
 		// s: standard
@@ -123,18 +175,12 @@ func putBlockAddrTxsToBatch(putBatch ethdb.Batch, block *types.Block) (txsCount
 			txKindOf = []byte("c")
 		}
 
-		// Note that len 8 because uint64 guaranteed <= 8 bytes.
-		bn := make([]byte, 8)
-		binary.LittleEndian.PutUint64(bn, block.NumberU64())
-
-		if err := putBatch.Put(formatAddrTxBytesIndex(from.Bytes(), bn, []byte("f"), txKindOf, tx.Hash().Bytes()), nil); err != nil {
-			return txsCount, err
-		}
-		if err := putBatch.Put(formatAddrTxBytesIndex(to.Bytes(), bn, []byte("t"), txKindOf, tx.Hash().Bytes()), nil); err != nil {
-			return txsCount, err
-		}
+		keys = append(keys,
+			formatAddrTxBytesIndex(from.Bytes(), bn, []byte("f"), txKindOf, tx.Hash().Bytes()),
+			formatAddrTxBytesIndex(to.Bytes(), bn, []byte("t"), txKindOf, tx.Hash().Bytes()),
+		)
 	}
-	return txsCount, nil
+	return keys, nil
 }
 
 type atxi struct {
@@ -177,6 +223,12 @@ func BuildAddrTxIndex(bc *BlockChain, chainDB, indexDB ethdb.Database, startInde
 	// Use persistent placeholder in case start not spec'd
 	if startIndex == math.MaxUint64 {
 		startIndex = dbGetATXIBookmark(indexDB)
+		// logs may have been enabled for an already built index
+		if bc.atxi.Logs {
+			if n := dbGetATXILogsBookmark(indexDB); n < startIndex {
+				startIndex = n
+			}
+		}
 	}
 	if step == math.MaxUint64 {
 		step = 10000
@@ -215,6 +267,9 @@ func BuildAddrTxIndex(bc *BlockChain, chainDB, indexDB ethdb.Database, startInde
 	bc.atxi.Progress.Start = startIndex
 	bc.atxi.Progress.Stop = stopIndex
 	breaker := false
+	// The log index is only known complete up to its bookmark, so only a build
+	// starting at or below it extends it.
+	extendLogs := bc.atxi.Logs && startIndex <= dbGetATXILogsBookmark(indexDB)
 	for i := startIndex; i < stopIndex; i = i + step {
 		if i+step > stopIndex {
 			step = stopIndex - i
@@ -241,6 +296,12 @@ func BuildAddrTxIndex(bc *BlockChain, chainDB, indexDB ethdb.Database, startInde
 				return err
 			}
 		}
+		if extendLogs {
+			if err := bc.atxi.extendLogsBookmark(bc.atxi.Progress.Current); err != nil {
+				bc.atxi.Progress.LastError = err
+				return err
+			}
+		}
 
 		glog.D(logger.Error).Infof("atxi-build: block %d / %d txs: %d took: %v %.2f bps %.2f txps", i+step, stopIndex, txsCount, time.Since(stepStartTime).Round(time.Millisecond), float64(step)/time.Since(stepStartTime).Seconds(), float64(txsCount)/time.Since(stepStartTime).Seconds())
 		glog.V(logger.Info).Infof("atxi-build: block %d / %d txs: %d took: %v %.2f bps %.2f txps", i+step, stopIndex, txsCount, time.Since(stepStartTime).Round(time.Millisecond), float64(step)/time.Since(stepStartTime).Seconds(), float64(txsCount)/time.Since(stepStartTime).Seconds())
@@ -264,6 +325,12 @@ func BuildAddrTxIndex(bc *BlockChain, chainDB, indexDB ethdb.Database, startInde
 			return err
 		}
 	}
+	if extendLogs {
+		if err := bc.atxi.extendLogsBookmark(stopIndex); err != nil {
+			bc.atxi.Progress.LastError = err
+			return err
+		}
+	}
 
 	// Print summary
 	totalBlocksF := float64(stopIndex - startIndex)
@@ -395,6 +462,79 @@ func GetAddrTxs(db ethdb.Database, address common.Address, blockStartN uint64, b
 	return
 }
 
+// rmIndexesAbove removes all index keys for blocks above the given head, eg. in the
+// case of a rollback, and lowers the bookmarks accordingly.
+func (a *AtxiT) rmIndexesAbove(head uint64) error {
+	ldb, ok := a.Db.(*ethdb.LDBDatabase)
+	if !ok {
+		return errors.New("could not cast indexes db to level db")
+	}
+
+	var removals [][]byte
+	deleteRemovals := func() error {
+		for _, r := range removals {
+			if err := ldb.Delete(r); err != nil {
+				return err
+			}
+		}
+		removals = removals[:0]
+		return nil
+	}
+	// blockNumberOf resolves the block number of a key for each of the index prefixes
+	prefixes := []struct {
+		prefix        []byte
+		blockNumberOf func(key []byte) uint64
+	}{
+		{txAddressIndexPrefix, func(key []byte) uint64 {
+			_, bn, _, _, _ := resolveAddrTxBytes(key)
+			return binary.LittleEndian.Uint64(bn)
+		}},
+		{internalTxAddressIndexPrefix, func(key []byte) uint64 {
+			_, bn, _, _, _ := resolveAddrTxBytes(key)
+			return binary.LittleEndian.Uint64(bn)
+		}},
+		{logAddressIndexPrefix, func(key []byte) uint64 {
+			return binary.BigEndian.Uint64(key[len(key)-8:])
+		}},
+		{logTopicIndexPrefix, func(key []byte) uint64 {
+			return binary.BigEndian.Uint64(key[len(key)-8:])
+		}},
+	}
+	for _, p := range prefixes {
+		it := ldb.NewIteratorRange(ethdb.NewBytesPrefix(p.prefix))
+		for it.Next() {
+			key := it.Key()
+			if p.blockNumberOf(key) <= head {
+				continue
+			}
+			removals = append(removals, common.CopyBytes(key))
+			// Prevent removals from getting too massive in case it's a big rollback
+			// 100000 is a guess at a big but not-too-big memory allowance
+			if len(removals) > 100000 {
+				if err := deleteRemovals(); err != nil {
+					it.Release()
+					return err
+				}
+			}
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+		if err := deleteRemovals(); err != nil {
+			return err
+		}
+	}
+
+	// update bookmarks to lower head in the case that their progress was higher than the new head
+	if dbGetATXIBookmark(a.Db) > head {
+		if err := dbSetATXIBookmark(a.Db, head); err != nil {
+			return err
+		}
+	}
+	return a.lowerLogsBookmarks(head)
+}
+
 // RmAddrTx removes all atxi indexes for a given tx in case of a transaction removal, eg.
 // in the case of chain reorg.
 // It isn't an elegant function, but not a top priority for optimization because of
@@ -415,35 +555,26 @@ func RmAddrTx(db ethdb.Database, tx *types.Transaction) error {
 		return err
 	}
 
-	removals := [][]byte{}
-
-	// TODO: not DRY, could be refactored
-	pre := ethdb.NewBytesPrefix(formatAddrTxIterator(from))
-	it := ldb.NewIteratorRange(pre)
-	for it.Next() {
-		key := it.Key()
-		_, _, _, _, txh := resolveAddrTxBytes(key)
-		if bytes.Compare(txH.Bytes(), txh) == 0 {
-			removals = append(removals, key)
-			break // because there can be only one
-		}
-	}
-	it.Release()
-	if e := it.Error(); e != nil {
-		return e
+	// contract creations are indexed with the empty address as recipient
+	to := tx.To()
+	if to == nil || to.IsEmpty() {
+		to = &common.Address{}
 	}
 
-	to := tx.To()
-	if to != nil {
-		toRef := *to
-		pre := ethdb.NewBytesPrefix(formatAddrTxIterator(toRef))
+	// there is one key per direction, so both are under the same address for a self-send
+	wants := map[common.Address]int{from: 1}
+	wants[*to]++
+
+	removals := [][]byte{}
+	for addr, want := range wants {
+		pre := ethdb.NewBytesPrefix(formatAddrTxIterator(addr))
 		it := ldb.NewIteratorRange(pre)
-		for it.Next() {
+		for found := 0; found < want && it.Next(); {
 			key := it.Key()
 			_, _, _, _, txh := resolveAddrTxBytes(key)
 			if bytes.Compare(txH.Bytes(), txh) == 0 {
-				removals = append(removals, key)
-				break // because there can be only one
+				removals = append(removals, common.CopyBytes(key))
+				found++
 			}
 		}
 		it.Release()
@@ -0,0 +1,297 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/core/vm"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/rlp"
+)
+
+var (
+	internalTxAddressIndexPrefix = []byte("itx-")
+	internalTxBlockPrefix        = []byte("itxb-")
+)
+
+// Kinds of internal transactions.
+const (
+	InternalTxCall    = "call"
+	InternalTxCreate  = "create"
+	InternalTxSuicide = "suicide"
+)
+
+// InternalTx is a value transfer or contract creation made by a contract
+// during the execution of a transaction, ie. by a CALL, CREATE or SUICIDE
+// inside the EVM.
+type InternalTx struct {
+	BlockNumber uint64
+	TxHash      common.Hash
+	Index       uint // position among the internal transactions of TxHash
+	Depth       uint // call depth, 1 being a call made by the transaction's own code
+	Kind        string
+	From        common.Address
+	To          common.Address
+	Value       *big.Int
+}
+
+// kindByte returns the index key byte for the kind of the internal transaction.
+// The s|c bytes have the same meaning as for top-level transactions.
+func (itx *InternalTx) kindByte() byte {
+	switch itx.Kind {
+	case InternalTxCreate:
+		return 'c'
+	case InternalTxSuicide:
+		return 'd'
+	default:
+		return 's'
+	}
+}
+
+// internalTxsFromCallTree collects the internal transactions of the call tree
+// of a transaction. Calls without value are not considered internal transactions,
+// nor are frames which failed, since all their effects were reverted.
+func internalTxsFromCallTree(blockNumber uint64, txHash common.Hash, root *vm.CallFrame) []*InternalTx {
+	if root == nil || root.Err != nil {
+		return nil
+	}
+	var (
+		itxs []*InternalTx
+		walk func(frame *vm.CallFrame, depth uint)
+	)
+	walk = func(frame *vm.CallFrame, depth uint) {
+		for _, call := range frame.Calls {
+			if call.Err != nil {
+				continue
+			}
+			var kind string
+			switch call.Type {
+			case vm.CALL:
+				if call.Value.Sign() > 0 {
+					kind = InternalTxCall
+				}
+			case vm.CREATE:
+				kind = InternalTxCreate
+			case vm.SUICIDE:
+				kind = InternalTxSuicide
+			}
+			if kind != "" {
+				itxs = append(itxs, &InternalTx{
+					BlockNumber: blockNumber,
+					TxHash:      txHash,
+					Index:       uint(len(itxs)),
+					Depth:       depth,
+					Kind:        kind,
+					From:        call.From,
+					To:          call.To,
+					Value:       new(big.Int).Set(call.Value),
+				})
+			}
+			walk(call, depth+1)
+		}
+	}
+	walk(root, 1)
+
+	return itxs
+}
+
+// WriteBlockInternalTxs stores the internal transactions made while processing
+// the block with the given hash. They are kept by block hash so that the address
+// indexes can be (re)written once the block becomes canonical. Blocks without
+// internal transactions are recorded too, to tell them apart from blocks which
+// were never traced.
+func WriteBlockInternalTxs(db ethdb.Database, hash common.Hash, itxs []*InternalTx) error {
+	data, err := rlp.EncodeToBytes(itxs)
+	if err != nil {
+		return err
+	}
+	return db.Put(append(internalTxBlockPrefix, hash.Bytes()...), data)
+}
+
+// GetBlockInternalTxs returns the internal transactions stored for the block with
+// the given hash, or nil if none were recorded.
+func GetBlockInternalTxs(db ethdb.Database, hash common.Hash) []*InternalTx {
+	data, _ := db.Get(append(internalTxBlockPrefix, hash.Bytes()...))
+	if len(data) == 0 {
+		return nil
+	}
+	var itxs []*InternalTx
+	if err := rlp.DecodeBytes(data, &itxs); err != nil {
+		return nil
+	}
+	return itxs
+}
+
+// hasBlockInternalTxs returns whether the internal transactions of the block with
+// the given hash were recorded.
+func hasBlockInternalTxs(db ethdb.Database, hash common.Hash) bool {
+	data, _ := db.Get(append(internalTxBlockPrefix, hash.Bytes()...))
+	return len(data) > 0
+}
+
+// formatInternalTxBytesIndex formats the index key, eg. itx-<addr><blockNumber><t|f><s|c|d><txhash><index>
+func formatInternalTxBytesIndex(address common.Address, direction byte, itx *InternalTx) (key []byte) {
+	key = make([]byte, 0, 70) // prefix(4)+addr(20)+blockNumber(8)+dir(1)+kindof(1)+txhash(32)+index(4)
+
+	bn := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bn, itx.BlockNumber)
+	idx := make([]byte, 4)
+	binary.BigEndian.PutUint32(idx, uint32(itx.Index))
+
+	key = append(key, internalTxAddressIndexPrefix...)
+	key = append(key, address.Bytes()...)
+	key = append(key, bn...)
+	key = append(key, direction, itx.kindByte())
+	key = append(key, itx.TxHash.Bytes()...)
+	key = append(key, idx...)
+	return
+}
+
+// putBlockInternalTxsToBatch puts the address index keys for the internal transactions
+// recorded for the given block to a db Batch.
+func putBlockInternalTxsToBatch(putBatch ethdb.Batch, indexDb ethdb.Database, block *types.Block) (itxsCount int, err error) {
+	for _, itx := range GetBlockInternalTxs(indexDb, block.Hash()) {
+		data, err := rlp.EncodeToBytes(itx)
+		if err != nil {
+			return itxsCount, err
+		}
+		if err := putBatch.Put(formatInternalTxBytesIndex(itx.From, 'f', itx), data); err != nil {
+			return itxsCount, err
+		}
+		if err := putBatch.Put(formatInternalTxBytesIndex(itx.To, 't', itx), data); err != nil {
+			return itxsCount, err
+		}
+		itxsCount++
+	}
+	return itxsCount, nil
+}
+
+// RmBlockInternalTxs removes the address index keys of the internal transactions of
+// the given block, eg. in the case of a chain reorg.
+func RmBlockInternalTxs(db ethdb.Database, block *types.Block) error {
+	for _, itx := range GetBlockInternalTxs(db, block.Hash()) {
+		if err := db.Delete(formatInternalTxBytesIndex(itx.From, 'f', itx)); err != nil {
+			return err
+		}
+		if err := db.Delete(formatInternalTxBytesIndex(itx.To, 't', itx)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sortableInternalTxs []*InternalTx
+
+// Len implements sort.Sort interface.
+func (s sortableInternalTxs) Len() int {
+	return len(s)
+}
+
+// Less implements sort.Sort interface.
+// By default newer internal transactions by blockNumber are first.
+func (s sortableInternalTxs) Less(i, j int) bool {
+	return s[i].BlockNumber > s[j].BlockNumber
+}
+
+// Swap implements sort.Sort interface.
+func (s sortableInternalTxs) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// GetInternalTxs gets the indexed internal transactions for a given account address.
+// The parameters have the same semantics as for GetAddrTxs, with 'kindof' additionally
+// accepting 'd' for suicides.
+// 'reverse' means "oldest first"
+func GetInternalTxs(db ethdb.Database, address common.Address, blockStartN uint64, blockEndN uint64, direction string, kindof string, paginationStart int, paginationEnd int, reverse bool) (itxs []*InternalTx, err error) {
+	errWithReason := func(e error, s string) error {
+		return fmt.Errorf("%v: %s", e, s)
+	}
+
+	// validate params
+	if len(direction) > 0 && !strings.Contains("btf", direction[:1]) {
+		return nil, errWithReason(errAtxiInvalidUse, "Internal transactions list signature requires direction param to be empty string or [b|t|f] prefix (eg. both, to, or from)")
+	}
+	if len(kindof) > 0 && !strings.Contains("bscd", kindof[:1]) {
+		return nil, errWithReason(errAtxiInvalidUse, "Internal transactions list signature requires 'kind of' param to be empty string or [s|c|d] prefix (eg. both, standard, contract creation or destruction)")
+	}
+	if paginationStart > 0 && paginationEnd > 0 && paginationStart > paginationEnd {
+		return nil, errWithReason(errAtxiInvalidUse, "Pagination start must be less than or equal to pagination end params")
+	}
+	if paginationStart < 0 {
+		paginationStart = 0
+	}
+
+	ldb, ok := db.(*ethdb.LDBDatabase)
+	if !ok {
+		return nil, errWithReason(errors.New("internal interface error; please file a bug report"), "could not cast eth db to level db")
+	}
+
+	var wantDirectionB byte = 'b'
+	if len(direction) > 0 {
+		wantDirectionB = direction[0]
+	}
+	var wantKindOf byte = 'b'
+	if len(kindof) > 0 {
+		wantKindOf = kindof[0]
+	}
+
+	prefix := make([]byte, 0, len(internalTxAddressIndexPrefix)+common.AddressLength)
+	prefix = append(prefix, internalTxAddressIndexPrefix...)
+	prefix = append(prefix, address.Bytes()...)
+	it := ldb.NewIteratorRange(ethdb.NewBytesPrefix(prefix))
+
+	var found sortableInternalTxs
+	for it.Next() {
+		key := it.Key()
+
+		// key layout is the same as for atxi up to and including the tx hash
+		_, blockNum, torf, k, _ := resolveAddrTxBytes(key)
+		bn := binary.LittleEndian.Uint64(blockNum)
+
+		if blockStartN > 0 && bn < blockStartN {
+			continue
+		}
+		if blockEndN > 0 && bn > blockEndN {
+			continue
+		}
+		if wantDirectionB != 'b' && wantDirectionB != torf[0] {
+			continue
+		}
+		if wantKindOf != 'b' && wantKindOf != k[0] {
+			continue
+		}
+		itx := new(InternalTx)
+		if err := rlp.DecodeBytes(it.Value(), itx); err != nil {
+			it.Release()
+			return nil, err
+		}
+		found = append(found, itx)
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+
+	if len(found) <= 1 {
+		return found, nil
+	}
+	sort.Stable(found) // newest internal txs (by blockNumber) first
+	if reverse {
+		for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+			found[i], found[j] = found[j], found[i]
+		}
+	}
+	if paginationStart > len(found) {
+		paginationStart = len(found)
+	}
+	if paginationEnd < 0 || paginationEnd > len(found) {
+		paginationEnd = len(found)
+	}
+	return found[paginationStart:paginationEnd], nil
+}
@@ -0,0 +1,261 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+)
+
+var (
+	logAddressIndexPrefix = []byte("atl-")
+	logTopicIndexPrefix   = []byte("att-")
+	logIndexBookmarkKey   = []byte("ATXILogsBookmark")
+	logIndexLiveStartKey  = []byte("ATXILogsLiveStart")
+	logIndexLiveEndKey    = []byte("ATXILogsLiveEnd")
+)
+
+func dbGetATXILogsNumber(db ethdb.Database, key []byte) uint64 {
+	v, err := db.Get(key)
+	if err != nil || v == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(v)
+}
+
+func dbSetATXILogsNumber(db ethdb.Database, key []byte, i uint64) error {
+	bn := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bn, i)
+	return db.Put(key, bn)
+}
+
+func dbGetATXILogsBookmark(db ethdb.Database) uint64 {
+	return dbGetATXILogsNumber(db, logIndexBookmarkKey)
+}
+
+func dbSetATXILogsBookmark(db ethdb.Database, i uint64) error {
+	return dbSetATXILogsNumber(db, logIndexBookmarkKey, i)
+}
+
+// GetATXILogsBookmark returns the number of the last block up to which the log
+// index is known to be complete, ie. built from genesis without gaps.
+func (a *AtxiT) GetATXILogsBookmark() uint64 {
+	return dbGetATXILogsBookmark(a.Db)
+}
+
+// The log index is only used up to its bookmark. Blocks indexed on import past
+// the bookmark, eg. while older blocks are still to be indexed by atxi-build,
+// are tracked as a separate live range of consecutive blocks, which joins the
+// bookmark once the gap between them is indexed.
+
+// setLogsImported records the log indexes of block n as written on import.
+func (a *AtxiT) setLogsImported(n uint64) error {
+	a.logsLock.Lock()
+	defer a.logsLock.Unlock()
+
+	bookmark := dbGetATXILogsBookmark(a.Db)
+	start, end := dbGetATXILogsNumber(a.Db, logIndexLiveStartKey), dbGetATXILogsNumber(a.Db, logIndexLiveEndKey)
+	switch {
+	case n <= bookmark+1:
+		bookmark = n
+	case start > 0 && n+1 >= start && n <= end+1:
+		if n < start {
+			start = n
+		}
+		if n > end {
+			end = n
+		}
+	default:
+		start, end = n, n
+	}
+	return a.storeLogsBookmarks(bookmark, start, end)
+}
+
+// extendLogsBookmark moves the log index bookmark on to n, once all the blocks
+// from the bookmark to n are indexed.
+func (a *AtxiT) extendLogsBookmark(n uint64) error {
+	a.logsLock.Lock()
+	defer a.logsLock.Unlock()
+
+	if n <= dbGetATXILogsBookmark(a.Db) {
+		return nil
+	}
+	return a.storeLogsBookmarks(n, dbGetATXILogsNumber(a.Db, logIndexLiveStartKey), dbGetATXILogsNumber(a.Db, logIndexLiveEndKey))
+}
+
+// lowerLogsBookmarks moves the log index bookmark and live range back to head,
+// if beyond it.
+func (a *AtxiT) lowerLogsBookmarks(head uint64) error {
+	a.logsLock.Lock()
+	defer a.logsLock.Unlock()
+
+	bookmark := dbGetATXILogsBookmark(a.Db)
+	start, end := dbGetATXILogsNumber(a.Db, logIndexLiveStartKey), dbGetATXILogsNumber(a.Db, logIndexLiveEndKey)
+	if bookmark > head {
+		bookmark = head
+	}
+	if start > head {
+		start, end = 0, 0
+	} else if end > head {
+		end = head
+	}
+	return a.storeLogsBookmarks(bookmark, start, end)
+}
+
+// storeLogsBookmarks writes the log index bookmark and live range, joining them
+// if adjacent. The logs lock must be held.
+func (a *AtxiT) storeLogsBookmarks(bookmark, start, end uint64) error {
+	if start > 0 && start <= bookmark+1 {
+		if end > bookmark {
+			bookmark = end
+		}
+		start, end = 0, 0
+	}
+	if err := dbSetATXILogsNumber(a.Db, logIndexLiveStartKey, start); err != nil {
+		return err
+	}
+	if err := dbSetATXILogsNumber(a.Db, logIndexLiveEndKey, end); err != nil {
+		return err
+	}
+	return dbSetATXILogsBookmark(a.Db, bookmark)
+}
+
+// formatLogIndexKey formats the log index key, eg. atl-<address><blockNumber> or att-<topic><blockNumber>
+// Unlike atx- keys, the block number is big endian so that a range of blocks can be seeked directly.
+func formatLogIndexKey(prefix, subject []byte, blockNumber uint64) []byte {
+	key := make([]byte, 0, len(prefix)+len(subject)+8)
+	key = append(key, prefix...)
+	key = append(key, subject...)
+	bn := make([]byte, 8)
+	binary.BigEndian.PutUint64(bn, blockNumber)
+	return append(key, bn...)
+}
+
+// blockLogIndexKeys returns the log index keys for the given block, one per distinct
+// emitting address and one per distinct topic0.
+func blockLogIndexKeys(block *types.Block, receipts types.Receipts) [][]byte {
+	var (
+		keys   [][]byte
+		seenA  = make(map[common.Address]bool)
+		seenT0 = make(map[common.Hash]bool)
+	)
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			if !seenA[log.Address] {
+				seenA[log.Address] = true
+				keys = append(keys, formatLogIndexKey(logAddressIndexPrefix, log.Address.Bytes(), block.NumberU64()))
+			}
+			if len(log.Topics) > 0 && !seenT0[log.Topics[0]] {
+				seenT0[log.Topics[0]] = true
+				keys = append(keys, formatLogIndexKey(logTopicIndexPrefix, log.Topics[0].Bytes(), block.NumberU64()))
+			}
+		}
+	}
+	return keys
+}
+
+// putBlockLogsToBatch puts the log index keys for a given block to a db Batch.
+func putBlockLogsToBatch(putBatch ethdb.Batch, block *types.Block, receipts types.Receipts) (logsCount int, err error) {
+	for _, key := range blockLogIndexKeys(block, receipts) {
+		if err := putBatch.Put(key, nil); err != nil {
+			return logsCount, err
+		}
+		logsCount++
+	}
+	return logsCount, nil
+}
+
+// WriteBlockLogIndexes writes the log indexes for a given block.
+func WriteBlockLogIndexes(indexDb ethdb.Database, block *types.Block, receipts types.Receipts) error {
+	batch := indexDb.NewBatch()
+	if _, err := putBlockLogsToBatch(batch, block, receipts); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// RmBlockLogIndexes removes the log indexes of the given block, eg. in the case of
+// a chain reorg.
+func RmBlockLogIndexes(db ethdb.Database, block *types.Block, receipts types.Receipts) error {
+	for _, key := range blockLogIndexKeys(block, receipts) {
+		if err := db.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logIndexBlocks collects the numbers of the blocks in [start, end] indexed under
+// any of the given subjects.
+func logIndexBlocks(ldb *ethdb.LDBDatabase, prefix []byte, subjects [][]byte, start, end uint64, into map[uint64]bool) error {
+	for _, subject := range subjects {
+		it := ldb.NewIteratorRange(ethdb.NewBytesPrefix(append(append([]byte{}, prefix...), subject...)))
+		for ok := it.Seek(formatLogIndexKey(prefix, subject, start)); ok; ok = it.Next() {
+			key := it.Key()
+			n := binary.BigEndian.Uint64(key[len(key)-8:])
+			if n > end {
+				break
+			}
+			into[n] = true
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLogIndexBlocks returns, in ascending order, the numbers of the blocks within
+// [start, end] containing logs emitted by any of the given addresses and having
+// any of the given topics as first topic. An empty addresses or topics list matches
+// everything for that criterion, but at least one of them must be given.
+func GetLogIndexBlocks(db ethdb.Database, addresses []common.Address, topics []common.Hash, start, end uint64) ([]uint64, error) {
+	if len(addresses) == 0 && len(topics) == 0 {
+		return nil, errAtxiInvalidUse
+	}
+	ldb, ok := db.(*ethdb.LDBDatabase)
+	if !ok {
+		return nil, errors.New("could not cast indexes db to level db")
+	}
+
+	var byAddress, byTopic map[uint64]bool
+	if len(addresses) > 0 {
+		subjects := make([][]byte, len(addresses))
+		for i, addr := range addresses {
+			subjects[i] = addr.Bytes()
+		}
+		byAddress = make(map[uint64]bool)
+		if err := logIndexBlocks(ldb, logAddressIndexPrefix, subjects, start, end, byAddress); err != nil {
+			return nil, err
+		}
+	}
+	if len(topics) > 0 {
+		subjects := make([][]byte, len(topics))
+		for i, topic := range topics {
+			subjects[i] = topic.Bytes()
+		}
+		byTopic = make(map[uint64]bool)
+		if err := logIndexBlocks(ldb, logTopicIndexPrefix, subjects, start, end, byTopic); err != nil {
+			return nil, err
+		}
+	}
+
+	// intersect both criteria if given
+	candidates, other := byAddress, byTopic
+	if candidates == nil {
+		candidates, other = byTopic, nil
+	}
+	var blocks []uint64
+	for n := range candidates {
+		if other != nil && !other[n] {
+			continue
+		}
+		blocks = append(blocks, n)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	return blocks, nil
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/rlp"
+	"github.com/hashicorp/golang-lru"
+)
+
+// ErrAtxiInconsistent is returned by VerifyAddrTxIndex when problems were found
+// and not repaired.
+var ErrAtxiInconsistent = errors.New("atxi is inconsistent with the canonical chain")
+
+// AtxiVerifyResult summarizes a consistency check of the address-transaction index.
+type AtxiVerifyResult struct {
+	Start, Stop uint64 // range of blocks checked
+	Txs         int    // number of canonical transactions checked
+	Missing     int    // keys of canonical transactions absent from the index
+	Stale       int    // keys of transactions not in the canonical block of their number
+	Repaired    bool   // whether the missing and stale keys were put and removed
+}
+
+// atxiVerifiedIndex describes one of the indexes kept by atxi to VerifyAddrTxIndex.
+type atxiVerifiedIndex struct {
+	name          string
+	prefix        []byte
+	blockNumberOf func(key []byte) uint64
+	// entries returns the keys (and their values) the index holds for a block.
+	entries func(block *types.Block) (map[string][]byte, error)
+	// built reports whether block n is expected to be indexed at all.
+	built func(n uint64) bool
+}
+
+// atxiVerifiedIndexes returns the indexes checked by VerifyAddrTxIndex.
+func atxiVerifiedIndexes(bc *BlockChain, indexDb ethdb.Database) []*atxiVerifiedIndex {
+	all := func(uint64) bool { return true }
+	logsBuilt := func(n uint64) bool {
+		return bc.atxi != nil && bc.atxi.Logs && n <= dbGetATXILogsBookmark(indexDb)
+	}
+	logEntries := func(prefix []byte) func(block *types.Block) (map[string][]byte, error) {
+		return func(block *types.Block) (map[string][]byte, error) {
+			entries := make(map[string][]byte)
+			for _, key := range blockLogIndexKeys(block, GetBlockReceipts(bc.chainDb, block.Hash())) {
+				if bytes.HasPrefix(key, prefix) {
+					entries[string(key)] = nil
+				}
+			}
+			return entries, nil
+		}
+	}
+	logBlockNumberOf := func(key []byte) uint64 {
+		return binary.BigEndian.Uint64(key[len(key)-8:])
+	}
+	return []*atxiVerifiedIndex{
+		{
+			name:   "transaction",
+			prefix: txAddressIndexPrefix,
+			blockNumberOf: func(key []byte) uint64 {
+				_, bn, _, _, _ := resolveAddrTxBytes(key)
+				return binary.LittleEndian.Uint64(bn)
+			},
+			entries: func(block *types.Block) (map[string][]byte, error) {
+				keys, err := blockAddrTxKeys(block)
+				if err != nil {
+					return nil, err
+				}
+				entries := make(map[string][]byte)
+				for _, key := range keys {
+					entries[string(key)] = nil
+				}
+				return entries, nil
+			},
+			built: all,
+		},
+		{
+			// Only the internal transactions recorded on processing are known, so
+			// blocks processed without tracing them are not checked for missing keys
+			name:   "internal transaction",
+			prefix: internalTxAddressIndexPrefix,
+			blockNumberOf: func(key []byte) uint64 {
+				_, bn, _, _, _ := resolveAddrTxBytes(key)
+				return binary.LittleEndian.Uint64(bn)
+			},
+			entries: func(block *types.Block) (map[string][]byte, error) {
+				entries := make(map[string][]byte)
+				for _, itx := range GetBlockInternalTxs(indexDb, block.Hash()) {
+					data, err := rlp.EncodeToBytes(itx)
+					if err != nil {
+						return nil, err
+					}
+					entries[string(formatInternalTxBytesIndex(itx.From, 'f', itx))] = data
+					entries[string(formatInternalTxBytesIndex(itx.To, 't', itx))] = data
+				}
+				return entries, nil
+			},
+			built: all,
+		},
+		{name: "log address", prefix: logAddressIndexPrefix, blockNumberOf: logBlockNumberOf, entries: logEntries(logAddressIndexPrefix), built: logsBuilt},
+		{name: "log topic", prefix: logTopicIndexPrefix, blockNumberOf: logBlockNumberOf, entries: logEntries(logTopicIndexPrefix), built: logsBuilt},
+	}
+}
+
+// VerifyAddrTxIndex checks the keys of the blocks within [start, stop] of the atx-
+// index, and of the internal transaction and log indexes, against the canonical
+// chain. Keys of canonical blocks which are absent are reported missing, keys which
+// don't belong to the canonical block of their number, eg. left over from a reorg or
+// rollback, are reported stale. If repair is set the missing keys are written and
+// the stale ones removed. A stop of 0 means the current head, in which case keys of
+// blocks beyond the head are checked too.
+//
+// Log keys are only reported missing for blocks up to the log index bookmark, as
+// the log index is only built up to it.
+func VerifyAddrTxIndex(bc *BlockChain, indexDb ethdb.Database, start, stop uint64, repair bool) (*AtxiVerifyResult, error) {
+	ldb, ok := indexDb.(*ethdb.LDBDatabase)
+	if !ok {
+		return nil, errors.New("could not cast indexes db to level db")
+	}
+	head := bc.CurrentBlock().NumberU64()
+	if n := bc.CurrentFastBlock().NumberU64(); n > head {
+		head = n
+	}
+	// Keys beyond the head are all stale, so they're checked if up to the head
+	staleStop := stop
+	if stop == 0 || stop >= head {
+		stop, staleStop = head, math.MaxUint64
+	}
+	if start > stop {
+		return nil, fmt.Errorf("start must be prior to (smaller than) or equal to stop, got start=%d stop=%d", start, stop)
+	}
+	res := &AtxiVerifyResult{Start: start, Stop: stop, Repaired: repair}
+	indexes := atxiVerifiedIndexes(bc, indexDb)
+
+	// Check every canonical block has its keys.
+	for n := start; n <= stop; n++ {
+		block := bc.GetBlockByNumber(n)
+		if block == nil {
+			return res, fmt.Errorf("block %d is nil", n)
+		}
+		res.Txs += block.Transactions().Len()
+		for _, index := range indexes {
+			if !index.built(n) {
+				continue
+			}
+			entries, err := index.entries(block)
+			if err != nil {
+				return res, err
+			}
+			for key, value := range entries {
+				if has, err := ldb.Has([]byte(key)); err != nil {
+					return res, err
+				} else if has {
+					continue
+				}
+				res.Missing++
+				glog.V(logger.Debug).Infof("atxi-verify: missing %s key %x", index.name, key)
+				if repair {
+					if err := ldb.Put([]byte(key), value); err != nil {
+						return res, err
+					}
+				}
+			}
+		}
+		if n%10000 == 0 {
+			glog.D(logger.Info).Infof("atxi-verify: checked block %d / %d missing: %d", n, stop, res.Missing)
+		}
+	}
+
+	// Check every key in range belongs to a canonical block. Keys are ordered by
+	// subject, so the keys of recently seen blocks are cached.
+	for _, index := range indexes {
+		canonical, _ := lru.New(10000)
+		canonicalKeys := func(n uint64) (map[string][]byte, error) {
+			if entries, ok := canonical.Get(n); ok {
+				return entries.(map[string][]byte), nil
+			}
+			entries := make(map[string][]byte)
+			if block := bc.GetBlockByNumber(n); block != nil && n <= head {
+				var err error
+				if entries, err = index.entries(block); err != nil {
+					return nil, err
+				}
+			}
+			canonical.Add(n, entries)
+			return entries, nil
+		}
+
+		var removals [][]byte
+		it := ldb.NewIteratorRange(ethdb.NewBytesPrefix(index.prefix))
+		for it.Next() {
+			key := it.Key()
+			bn := index.blockNumberOf(key)
+			if bn < start || bn > staleStop {
+				continue
+			}
+			entries, err := canonicalKeys(bn)
+			if err != nil {
+				it.Release()
+				return res, err
+			}
+			if _, ok := entries[string(key)]; ok {
+				continue
+			}
+			res.Stale++
+			glog.V(logger.Debug).Infof("atxi-verify: stale %s key %x", index.name, key)
+			if repair {
+				removals = append(removals, common.CopyBytes(key))
+			}
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return res, err
+		}
+		for _, key := range removals {
+			if err := ldb.Delete(key); err != nil {
+				return res, err
+			}
+		}
+	}
+
+	if !repair && (res.Missing > 0 || res.Stale > 0) {
+		return res, ErrAtxiInconsistent
+	}
+	return res, nil
+}
@@ -82,7 +82,7 @@ func NewBlockValidator(config *ChainConfig, blockchain *BlockChain, pow pow.PoW)
 // false positives where a header is present but the state is not.
 func (v *BlockValidator) ValidateBlock(block *types.Block) error {
 	if v.bc.HasBlock(block.Hash()) {
-		if _, err := state.New(block.Root(), state.NewDatabase(v.bc.chainDb)); err == nil {
+		if _, err := state.New(block.Root(), v.bc.stateDatabase()); err == nil {
 			return &KnownBlockError{block.Number(), block.Hash()}
 		}
 	}
@@ -90,9 +90,6 @@ func (v *BlockValidator) ValidateBlock(block *types.Block) error {
 	if parent == nil {
 		return ParentError(block.ParentHash())
 	}
-	if _, err := state.New(parent.Root(), state.NewDatabase(v.bc.chainDb)); err != nil {
-		return ParentError(block.ParentHash())
-	}
 
 	header := block.Header()
 	// validate the block header
@@ -117,6 +114,11 @@ func (v *BlockValidator) ValidateBlock(block *types.Block) error {
 		return fmt.Errorf("invalid transaction root hash. received=%x calculated=%x", header.TxHash, txSha)
 	}
 
+	// Check the parent state last, so that a block of a side chain whose parent
+	// state was garbage collected is otherwise known to be valid
+	if _, err := state.New(parent.Root(), v.bc.stateDatabase()); err != nil {
+		return ParentError(block.ParentHash())
+	}
 	return nil
 }
 
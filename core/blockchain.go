@@ -32,8 +32,6 @@ import (
 	"reflect"
 	"strconv"
 
-	"encoding/binary"
-
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/core/state"
 	"github.com/ethereumproject/go-ethereum/core/types"
@@ -43,6 +41,7 @@ import (
 	"github.com/ethereumproject/go-ethereum/event"
 	"github.com/ethereumproject/go-ethereum/logger"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/metrics"
 	"github.com/ethereumproject/go-ethereum/pow"
 	"github.com/ethereumproject/go-ethereum/rlp"
 	"github.com/ethereumproject/go-ethereum/trie"
@@ -65,6 +64,17 @@ const (
 	// must be bumped when consensus algorithm is changed, this forces the upgradedb
 	// command to be run (forces the blocks to be imported again using the new algorithm)
 	BlockChainVersion = 3
+
+	// TrieFlushInterval is the number of blocks after which the state of a block is
+	// flushed to disk when state garbage collection is enabled.
+	TrieFlushInterval = 4096
+	// TrieFlushTimeout is the time after which the state of a block is flushed to
+	// disk when state garbage collection is enabled, bounding the blocks to process
+	// again after a crash when they come in slowly, eg. at the head of the chain.
+	TrieFlushTimeout = 10 * time.Minute
+
+	triesInMemory  = 128               // Number of recent states kept in memory when garbage collecting
+	trieCacheLimit = 256 * 1024 * 1024 // Size of the trie node cache above which a state is flushed early
 )
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -113,12 +123,26 @@ type BlockChain struct {
 	validator Validator // block and state validator interface
 
 	atxi *AtxiT
+
+	triedb      *trie.NodeCache // Trie node cache holding recent states, nil when not garbage collecting
+	triegc      []trieGCEntry   // States referenced in the trie node cache
+	trieFlushed uint64          // Number of the last block whose state was flushed from the trie node cache
+	trieFlushAt time.Time       // Time the state of the last block was flushed from the trie node cache
+
+	vmCrossCheck atomic.Value // *vmCrossCheck of the VMs, if enabled
+}
+
+// trieGCEntry is the state root of a block held in the trie node cache.
+type trieGCEntry struct {
+	root   common.Hash
+	number uint64
 }
 
 type ChainInsertResult struct {
 	ChainInsertEvent
-	Index int
-	Error error
+	Index   int
+	Error   error
+	Invalid bool // Whether Error means the block at Index breaks consensus, rather than failed to import locally
 }
 
 type ReceiptChainInsertResult struct {
@@ -180,13 +204,7 @@ func NewBlockChain(chainDb ethdb.Database, config *ChainConfig, pow pow.PoW, mux
 		return nil, err
 	}
 	// Check the current state of the block hashes and make sure that we do not have any of the bad blocks in our chain
-	for i := range config.BadHashes {
-		if header := bc.GetHeader(config.BadHashes[i].Hash); header != nil && header.Number.Cmp(config.BadHashes[i].Block) == 0 {
-			glog.V(logger.Error).Infof("Found bad hash, rewinding chain to block #%d [%s]", header.Number, header.ParentHash.Hex())
-			bc.SetHead(header.Number.Uint64() - 1)
-			glog.V(logger.Error).Infoln("Chain rewind was successful, resuming normal operation")
-		}
-	}
+	bc.rewindBadHashes(config.BadHashes)
 	// Take ownership of this particular state
 	go bc.update()
 	return bc, nil
@@ -228,16 +246,30 @@ func NewBlockChainDryrun(chainDb ethdb.Database, config *ChainConfig, pow pow.Po
 	//	return nil, err
 	//}
 	// Check the current state of the block hashes and make sure that we do not have any of the bad blocks in our chain
-	for i := range config.BadHashes {
-		if header := bc.GetHeader(config.BadHashes[i].Hash); header != nil && header.Number.Cmp(config.BadHashes[i].Block) == 0 {
+	bc.rewindBadHashes(config.BadHashes)
+	// // Take ownership of this particular state
+	//go bc.update()
+	return bc, nil
+}
+
+// rewindBadHashes rewinds the chain to the parent of the first of the given
+// bad blocks it has.
+func (bc *BlockChain) rewindBadHashes(bad []*BadHash) {
+	for i := range bad {
+		if header := bc.GetHeader(bad[i].Hash); header != nil && header.Number.Cmp(bad[i].Block) == 0 {
 			glog.V(logger.Error).Infof("Found bad hash, rewinding chain to block #%d [%s]", header.Number, header.ParentHash.Hex())
 			bc.SetHead(header.Number.Uint64() - 1)
 			glog.V(logger.Error).Infoln("Chain rewind was successful, resuming normal operation")
 		}
 	}
-	// // Take ownership of this particular state
-	//go bc.update()
-	return bc, nil
+}
+
+// SetBadHashes replaces the bad hashes of the chain configuration while the
+// chain is running, rewinding the chain if it has any of the new bad blocks.
+// Blocks with a bad hash are rejected from then on.
+func (bc *BlockChain) SetBadHashes(bad []*BadHash) {
+	bc.config.SetBadHashes(bad)
+	bc.rewindBadHashes(bad)
 }
 
 // GetEventMux returns the blockchain's event mux
@@ -255,6 +287,145 @@ func (bc *BlockChain) GetAtxi() *AtxiT {
 	return bc.atxi
 }
 
+// EnableStateGC switches the blockchain from archive mode, where the state of every
+// processed block is written to disk, to garbage collecting mode. The states of the
+// recent blocks are then kept in an in-memory trie node cache, the state of a block
+// being flushed to disk every TrieFlushInterval blocks or TrieFlushTimeout, and on
+// Stop, and the nodes of older states no longer referenced being discarded.
+func (bc *BlockChain) EnableStateGC() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.triedb != nil {
+		return nil
+	}
+	bc.triedb = trie.NewNodeCache(bc.chainDb)
+	bc.trieFlushed = bc.currentBlock.NumberU64()
+	bc.trieFlushAt = time.Now()
+
+	statedb, err := state.New(bc.currentBlock.Root(), bc.stateDatabase())
+	if err != nil {
+		bc.triedb = nil
+		return err
+	}
+	bc.stateCache = statedb
+	return nil
+}
+
+// process processes a block with the chain's processor, also collecting the
+// internal transactions made by its contracts if they are indexed by atxi.
+func (bc *BlockChain) process(block *types.Block, statedb *state.StateDB) (types.Receipts, vm.Logs, *big.Int, []*InternalTx, error) {
+	if p, ok := bc.processor.(*StateProcessor); ok && bc.atxi != nil && bc.atxi.Internal {
+		return p.process(block, statedb, true)
+	}
+	receipts, logs, usedGas, err := bc.processor.Process(block, statedb)
+	return receipts, logs, usedGas, nil, err
+}
+
+// blockInternalTxs re-executes a block on the state of its parent, to collect the
+// internal transactions of a block processed without indexing them. The parent
+// state has to be available.
+func (bc *BlockChain) blockInternalTxs(block *types.Block) ([]*InternalTx, error) {
+	parent := bc.GetBlock(block.ParentHash())
+	if parent == nil {
+		return nil, ParentError(block.ParentHash())
+	}
+	statedb, err := state.New(parent.Root(), bc.stateDatabase())
+	if err != nil {
+		return nil, err
+	}
+	_, _, _, itxs, err := NewStateProcessor(bc.config, bc).process(block, statedb, true)
+	return itxs, err
+}
+
+// stateDatabase returns a backing store for the states of the chain, reading
+// through the trie node cache if enabled.
+func (bc *BlockChain) stateDatabase() state.Database {
+	if bc.triedb != nil {
+		return state.NewDatabaseWithCache(bc.triedb)
+	}
+	return state.NewDatabase(bc.chainDb)
+}
+
+// stateWriter returns where processed states are committed to.
+func (bc *BlockChain) stateWriter() trie.DatabaseWriter {
+	if bc.triedb != nil {
+		return bc.triedb
+	}
+	return bc.chainDb
+}
+
+// collectState references the state of a newly processed block in the trie node
+// cache, flushes the state of an old enough canonical block to disk if it is time
+// to, and releases the states of the blocks older than triesInMemory. It does
+// nothing in archive mode.
+func (bc *BlockChain) collectState(root common.Hash, number uint64) error {
+	if bc.triedb == nil {
+		return nil
+	}
+	bc.triedb.Reference(root, common.Hash{})
+	bc.triegc = append(bc.triegc, trieGCEntry{root, number})
+	if number <= triesInMemory {
+		return nil
+	}
+	chosen := number - triesInMemory
+
+	// Blocks re-executed for a side chain are older than the last flushed one
+	if _, size := bc.triedb.Size(); chosen > bc.trieFlushed && (size > trieCacheLimit || chosen >= bc.trieFlushed+TrieFlushInterval || time.Since(bc.trieFlushAt) > TrieFlushTimeout) {
+		if header := bc.GetHeaderByNumber(chosen); header != nil {
+			if err := bc.triedb.Commit(header.Root); err != nil {
+				return err
+			}
+			bc.trieFlushed, bc.trieFlushAt = chosen, time.Now()
+		}
+	}
+	kept := bc.triegc[:0]
+	for _, entry := range bc.triegc {
+		if entry.number > chosen {
+			kept = append(kept, entry)
+			continue
+		}
+		bc.triedb.Dereference(entry.root)
+	}
+	bc.triegc = kept
+	return nil
+}
+
+// CommitState commits the state of a block processed outside of the chain, eg. a
+// mined one, to the chain's state database.
+func (bc *BlockChain) CommitState(statedb *state.StateDB, number uint64) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	root, err := statedb.CommitTo(bc.stateWriter(), false)
+	if err != nil {
+		return err
+	}
+	return bc.collectState(root, number)
+}
+
+// flushState writes the states of the head block and of the oldest block whose
+// state is in memory to disk, so that the chain can be restarted and reorganised
+// without reprocessing blocks.
+func (bc *BlockChain) flushState() {
+	if bc.triedb == nil {
+		return
+	}
+	head := bc.CurrentBlock().NumberU64()
+	for _, offset := range []uint64{0, 1, triesInMemory - 1} {
+		if head < offset {
+			continue
+		}
+		if header := bc.GetHeaderByNumber(head - offset); header != nil {
+			if err := bc.triedb.Commit(header.Root); err != nil {
+				glog.V(logger.Error).Errorf("failed to flush state of block #%d: %v", head-offset, err)
+			}
+		}
+	}
+	nodes, size := bc.triedb.Size()
+	glog.V(logger.Info).Infof("Flushed recent states, %d trie nodes (%v) discarded", nodes, size)
+}
+
 func (bc *BlockChain) getProcInterrupt() bool {
 	return atomic.LoadInt32(&bc.procInterrupt) == 1
 }
@@ -608,6 +779,15 @@ func (bc *BlockChain) LoadLastState(dryrun bool) error {
 		return errors.New("nil currentBlock")
 	}
 
+	// With state garbage collection, the state of the recent blocks is lost if the
+	// node stops without flushing it, eg. on a crash. Rewind to the newest block
+	// with state, the blocks above are processed again.
+	if !dryrun {
+		if err := bc.repair(&currentBlock); err != nil {
+			return err
+		}
+	}
+
 	// If currentBlock (fullblock) is not genesis, check that it is valid
 	// and that it has a state associated with it.
 	if currentBlock.Number().Cmp(new(big.Int)) > 0 {
@@ -725,7 +905,7 @@ func (bc *BlockChain) LoadLastState(dryrun bool) error {
 	}
 
 	// Initialize a statedb cache to ensure singleton account bloom filter generation
-	statedb, err := state.New(bc.currentBlock.Root(), state.NewDatabase(bc.chainDb))
+	statedb, err := state.New(bc.currentBlock.Root(), bc.stateDatabase())
 	if err != nil {
 		return err
 	}
@@ -755,6 +935,31 @@ func (bc *BlockChain) LoadLastState(dryrun bool) error {
 	return nil
 }
 
+// repair rewinds head to the newest of its ancestors whose state is available,
+// and makes it the head block in the database.
+func (bc *BlockChain) repair(head **types.Block) error {
+	rewound := *head
+	for {
+		if _, err := state.New(rewound.Root(), bc.stateDatabase()); err == nil {
+			break
+		}
+		parent := bc.GetBlock(rewound.ParentHash())
+		if parent == nil {
+			return fmt.Errorf("missing state of block #%d [%x…] and of its ancestors", (*head).NumberU64(), (*head).Hash().Bytes()[:4])
+		}
+		rewound = parent
+	}
+	if rewound == *head {
+		return nil
+	}
+	glog.V(logger.Warn).Warnf("Head state #%d [%x…] missing, rewound to block #%d [%x…]", (*head).NumberU64(), (*head).Hash().Bytes()[:4], rewound.NumberU64(), rewound.Hash().Bytes()[:4])
+	if err := WriteHeadBlockHash(bc.chainDb, rewound.Hash()); err != nil {
+		return err
+	}
+	*head = rewound
+	return nil
+}
+
 // PurgeAbove works like SetHead, but instead of rm'ing head <-> bc.currentBlock,
 // it removes all stored blockchain data n -> *anyexistingblockdata*
 // TODO: possibly replace with kv database iterator
@@ -783,6 +988,13 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	bc.hc.SetHead(head, delFn)
 	currentHeader := bc.hc.CurrentHeader()
 
+	// Discard the ancient chain data above the new head, if any
+	if db, ok := bc.chainDb.(*ethdb.LDBDatabase); ok && db.Freezer() != nil {
+		if err := db.Freezer().TruncateAncients(head + 1); err != nil {
+			glog.Fatalf("failed to truncate ancients: %v", err)
+		}
+	}
+
 	// Clear out any stale content from the caches
 	bc.bodyCache.Purge()
 	bc.bodyRLPCache.Purge()
@@ -793,11 +1005,17 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	if bc.currentBlock != nil && currentHeader.Number.Uint64() < bc.currentBlock.NumberU64() {
 		bc.currentBlock = bc.GetBlock(currentHeader.Hash())
 	}
-	if bc.currentBlock != nil {
-		if _, err := state.New(bc.currentBlock.Root(), state.NewDatabase(bc.chainDb)); err != nil {
-			// Rewound state missing, rolled back to before pivot, reset to genesis
+	// If the rewound state is missing, eg. not flushed from the trie node cache,
+	// keep rewinding; rolled back to before pivot, this resets to genesis.
+	for bc.currentBlock != nil {
+		if _, err := state.New(bc.currentBlock.Root(), bc.stateDatabase()); err == nil {
+			break
+		}
+		if bc.currentBlock.NumberU64() == 0 {
 			bc.currentBlock = nil
+			break
 		}
+		bc.currentBlock = bc.GetBlock(bc.currentBlock.ParentHash())
 	}
 	// Rewind the fast block in a simpleton way to the target head
 	if bc.currentFastBlock != nil && currentHeader.Number.Uint64() < bc.currentFastBlock.NumberU64() {
@@ -818,51 +1036,11 @@ func (bc *BlockChain) SetHead(head uint64) error {
 		glog.Fatalf("failed to reset head fast block hash: %v", err)
 	}
 
-	if bc.atxi != nil && bc.atxi.AutoMode {
-		ldb, ok := bc.atxi.Db.(*ethdb.LDBDatabase)
-		if !ok {
-			glog.Fatal("could not cast indexes db to level db")
-		}
-
-		var removals [][]byte
-		deleteRemovalsFn := func(rs [][]byte) {
-			for _, r := range rs {
-				if e := ldb.Delete(r); e != nil {
-					glog.Fatal(e)
-				}
-			}
-		}
-
-		pre := ethdb.NewBytesPrefix(txAddressIndexPrefix)
-		it := ldb.NewIteratorRange(pre)
-
-		for it.Next() {
-			key := it.Key()
-			_, bn, _, _, _ := resolveAddrTxBytes(key)
-			n := binary.LittleEndian.Uint64(bn)
-			if n > head {
-				removals = append(removals, key)
-				// Prevent removals from getting too massive in case it's a big rollback
-				// 100000 is a guess at a big but not-too-big memory allowance
-				if len(removals) > 100000 {
-					deleteRemovalsFn(removals)
-					removals = [][]byte{}
-				}
-			}
-		}
-		it.Release()
-		if e := it.Error(); e != nil {
-			return e
-		}
-		deleteRemovalsFn(removals)
-
-		// update atxi bookmark to lower head in the case that its progress was higher than the new head
-		if bc.atxi != nil && bc.atxi.AutoMode {
-			if i := bc.atxi.GetATXIBookmark(); i > head {
-				if err := bc.atxi.SetATXIBookmark(head); err != nil {
-					return err
-				}
-			}
+	// Remove the indexes of the blocks above the new head; they are no longer canonical.
+	if bc.atxi != nil {
+		if err := bc.atxi.rmIndexesAbove(head); err != nil {
+			bc.mu.Unlock()
+			return err
 		}
 	}
 
@@ -970,7 +1148,7 @@ func (bc *BlockChain) State() (*state.StateDB, error) {
 
 // StateAt returns a new mutable state based on a particular point in time.
 func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
-	return state.New(root, state.NewDatabase(bc.chainDb))
+	return state.New(root, bc.stateDatabase())
 }
 
 // Reset purges the entire blockchain, restoring it to its genesis state.
@@ -1121,7 +1299,7 @@ func (bc *BlockChain) HasBlockAndState(hash common.Hash) bool {
 		return false
 	}
 	// Ensure the associated state is also present
-	_, err := state.New(block.Root(), state.NewDatabase(bc.chainDb))
+	_, err := state.New(block.Root(), bc.stateDatabase())
 	return err == nil
 }
 
@@ -1186,6 +1364,8 @@ func (bc *BlockChain) Stop() {
 
 	bc.wg.Wait()
 
+	bc.flushState()
+
 	glog.V(logger.Info).Infoln("Chain manager stopped")
 }
 
@@ -1331,14 +1511,14 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 				if err := WriteBlockAddTxIndexes(bc.atxi.Db, block); err != nil {
 					glog.Fatalf("failed to write block add-tx indexes, err: %v", err)
 				}
-				// if buildATXI has been in use (via RPC) and is NOT finished, current < stop
-				// if buildATXI has been in use (via RPC) and IS finished, current == stop
-				// else if builtATXI has not been in use (via RPC), then current == stop == 0
-				if bc.atxi.AutoMode && bc.atxi.Progress.Current == bc.atxi.Progress.Stop {
-					if err := bc.atxi.SetATXIBookmark(block.NumberU64()); err != nil {
-						glog.Fatalln(err)
+				if bc.atxi.Logs {
+					if err := WriteBlockLogIndexes(bc.atxi.Db, block, receipts); err != nil {
+						glog.Fatalf("failed to write block log indexes, err: %v", err)
 					}
 				}
+				if err := bc.atxi.setImported(block.NumberU64()); err != nil {
+					glog.Fatalln(err)
+				}
 			}
 			atomic.AddInt32(&stats.processed, 1)
 		}
@@ -1415,6 +1595,17 @@ func (bc *BlockChain) WriteBlockAddrTxIndexesBatch(indexDb ethdb.Database, start
 	blockProcessedHead := func() uint64 {
 		return startBlockN + blockProcessedCount
 	}
+	// Blocks processed before internal transactions were indexed are re-executed,
+	// which needs the state of their parent
+	var (
+		untraced    int
+		untracedErr error
+	)
+	defer func() {
+		if untraced > 0 {
+			glog.V(logger.Warn).Warnf("atxi-build: internal transactions of %d blocks in #%d-#%d not indexed: %v", untraced, startBlockN, stopBlockN, untracedErr)
+		}
+	}()
 
 	for block != nil && blockProcessedHead() <= stopBlockN {
 		txP, err := putBlockAddrTxsToBatch(batch, block)
@@ -1422,6 +1613,21 @@ func (bc *BlockChain) WriteBlockAddrTxIndexesBatch(indexDb ethdb.Database, start
 			return txsCount, err
 		}
 		txsCount += txP
+		if bc.atxi != nil && bc.atxi.Internal && len(block.Transactions()) > 0 && !hasBlockInternalTxs(indexDb, block.Hash()) {
+			if itxs, err := bc.blockInternalTxs(block); err != nil {
+				untraced, untracedErr = untraced+1, err
+			} else if err := WriteBlockInternalTxs(indexDb, block.Hash(), itxs); err != nil {
+				return txsCount, err
+			}
+		}
+		if _, err := putBlockInternalTxsToBatch(batch, indexDb, block); err != nil {
+			return txsCount, err
+		}
+		if bc.atxi != nil && bc.atxi.Logs {
+			if _, err := putBlockLogsToBatch(batch, block, GetBlockReceipts(bc.chainDb, block.Hash())); err != nil {
+				return txsCount, err
+			}
+		}
 		blockProcessedCount++
 
 		// Write on stepN mod
@@ -1554,6 +1760,14 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (res *ChainInsertResult) {
 	bc.chainmu.Lock()
 	defer bc.chainmu.Unlock()
 
+	return bc.insertChain(chain)
+}
+
+// insertChain is the internal implementation of InsertChain, which assumes that
+// the chain is contiguous and the chain insertion lock is held.
+func (bc *BlockChain) insertChain(chain types.Blocks) (res *ChainInsertResult) {
+	res = &ChainInsertResult{} // initialize
+
 	// A queued approach to delivering events. This is generally
 	// faster than direct delivery and requires much less mutex
 	// acquiring.
@@ -1570,6 +1784,18 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (res *ChainInsertResult) {
 	nonceAbort, nonceResults := verifyNoncesFromBlocks(bc.pow, chain)
 	defer close(nonceAbort)
 
+	// Start the parallel sender recovery.
+	senderAbort := recoverSendersFromBlocks(bc.config, chain)
+	defer close(senderAbort)
+
+	// Interrupt the state prefetching of the next block, if any, when done.
+	var prefetchInterrupt *uint32
+	defer func() {
+		if prefetchInterrupt != nil {
+			atomic.StoreUint32(prefetchInterrupt, 1)
+		}
+	}()
+
 	txcount := 0
 	for i, block := range chain {
 		res.Index = i
@@ -1588,12 +1814,14 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (res *ChainInsertResult) {
 				block := chain[r.index]
 				res.Index = r.index
 				res.Error = &BlockNonceErr{Hash: block.Hash(), Number: block.Number(), Nonce: block.Nonce()}
+				res.Invalid = true
 				return
 			}
 		}
 
 		if err := bc.config.HeaderCheck(block.Header()); err != nil {
 			res.Error = err
+			res.Invalid = true
 			return
 		}
 
@@ -1626,40 +1854,97 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (res *ChainInsertResult) {
 				continue
 			}
 
+			// With state garbage collection, the parent state of a block forking off
+			// more than triesInMemory blocks back is gone. Store the block without
+			// state while its chain is lighter than the canonical one, and once it
+			// is not, re-execute the chain from the newest ancestor with state.
+			if IsParentErr(err) && bc.triedb != nil && bc.HasBlock(block.ParentHash()) {
+				externTd := new(big.Int).Add(bc.GetTd(block.ParentHash()), block.Difficulty())
+				if externTd.Cmp(bc.GetTd(bc.CurrentBlock().Hash())) < 0 {
+					if _, err := bc.WriteBlock(block); err != nil {
+						res.Error = err
+						return
+					}
+					stats.ignored++
+					continue
+				}
+				ancestors, err := bc.prunedAncestors(block)
+				if err != nil {
+					res.Error = err
+					return
+				}
+				glog.V(logger.Info).Infof("Re-executing %d blocks below side chain block #%d [%x…]", len(ancestors), block.NumberU64(), block.Hash().Bytes()[:4])
+
+				go bc.postChainEvents(events, coalescedLogs)
+				sub := bc.insertChain(append(ancestors, chain[i:]...))
+				if sub.Error != nil {
+					if sub.Index -= len(ancestors); sub.Index < 0 {
+						sub.Index = 0
+					}
+					sub.Index += i
+				}
+				return sub
+			}
+
 			res.Error = err
+			res.Invalid = !IsParentErr(err)
 			return
 		}
 
 		// Create a new statedb using the parent block and report an
 		// error if it fails.
+		var parentRoot common.Hash
 		switch {
 		case i == 0:
-			err = bc.stateCache.Reset(bc.GetBlock(block.ParentHash()).Root())
+			parentRoot = bc.GetBlock(block.ParentHash()).Root()
 		default:
-			err = bc.stateCache.Reset(chain[i-1].Root())
+			parentRoot = chain[i-1].Root()
 		}
+		err = bc.stateCache.Reset(parentRoot)
 		res.Error = err
 		if err != nil {
 			return
 		}
+		// Stop the prefetching of this block, and start the one of the next block
+		// on top of the parent state, warming the caches while this one is
+		// being processed.
+		if prefetchInterrupt != nil {
+			atomic.StoreUint32(prefetchInterrupt, 1)
+			prefetchInterrupt = nil
+		}
+		if i+1 < len(chain) {
+			if throwaway, err := state.New(parentRoot, bc.stateDatabase()); err == nil {
+				interrupt := new(uint32)
+				go prefetchState(bc.config, bc, chain[i+1], throwaway, interrupt)
+				prefetchInterrupt = interrupt
+			}
+		}
 		// Process block using the parent state as reference point.
-		receipts, logs, usedGas, err := bc.processor.Process(block, bc.stateCache)
+		pstart := time.Now()
+		receipts, logs, usedGas, internalTxs, err := bc.process(block, bc.stateCache)
 		if err != nil {
 			res.Error = err
+			res.Invalid = true
 			return
 		}
+		metrics.ChainExecutionTime.Inc(int64(time.Since(pstart)))
 		// Validate the state using the default validator
 		err = bc.Validator().ValidateState(block, bc.GetBlock(block.ParentHash()), bc.stateCache, receipts, usedGas)
 		if err != nil {
 			res.Error = err
+			res.Invalid = true
 			return
 		}
 		// Write state changes to database
-		_, err = bc.stateCache.CommitTo(bc.chainDb, false)
+		root, err := bc.stateCache.CommitTo(bc.stateWriter(), false)
 		if err != nil {
 			res.Error = err
 			return
 		}
+		if err := bc.collectState(root, block.NumberU64()); err != nil {
+			res.Error = err
+			return
+		}
 
 		// coalesce logs for later processing
 		coalescedLogs = append(coalescedLogs, logs...)
@@ -1676,6 +1961,14 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (res *ChainInsertResult) {
 			res.Error = err
 			return
 		}
+		// Keep the internal transactions of side blocks too, to index them if
+		// they become canonical
+		if bc.atxi != nil && bc.atxi.Internal {
+			if err := WriteBlockInternalTxs(bc.atxi.Db, block.Hash(), internalTxs); err != nil {
+				res.Error = fmt.Errorf("failed to write block internal transactions: %v", err)
+				return
+			}
+		}
 
 		switch status {
 		case CanonStatTy:
@@ -1705,15 +1998,16 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (res *ChainInsertResult) {
 					res.Error = fmt.Errorf("failed to write block add-tx indexes: %v", err)
 					return
 				}
-				// if buildATXI has been in use (via RPC) and is NOT finished, current < stop
-				// if buildATXI has been in use (via RPC) and IS finished, current == stop
-				// else if builtATXI has not been in use (via RPC), then current == stop == 0
-				if bc.atxi.AutoMode && bc.atxi.Progress.Current == bc.atxi.Progress.Stop {
-					if err := bc.atxi.SetATXIBookmark(block.NumberU64()); err != nil {
-						res.Error = err
+				if bc.atxi.Logs {
+					if err := WriteBlockLogIndexes(bc.atxi.Db, block, receipts); err != nil {
+						res.Error = fmt.Errorf("failed to write block log indexes: %v", err)
 						return
 					}
 				}
+				if err := bc.atxi.setImported(block.NumberU64()); err != nil {
+					res.Error = err
+					return
+				}
 			}
 		case SideStatTy:
 			if glog.V(logger.Detail) {
@@ -1722,6 +2016,8 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (res *ChainInsertResult) {
 			events = append(events, ChainSideEvent{block, logs})
 		}
 		stats.processed++
+		metrics.ChainInsertBlocks.Mark(1)
+		metrics.ChainInsertTime.Inc(int64(time.Since(bstart)))
 	}
 
 	ev := ChainInsertEvent{
@@ -1771,6 +2067,31 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (res *ChainInsertResult) {
 	return r
 }
 
+// prunedAncestors returns the ancestors of a block back to the newest one with
+// state, oldest first. Side chains forking off below the canonical states kept,
+// eg. before the pivot block of a fast sync, are not re-executed.
+func (bc *BlockChain) prunedAncestors(block *types.Block) (types.Blocks, error) {
+	var (
+		ancestors types.Blocks
+		canonical int
+	)
+	for parent := bc.GetBlock(block.ParentHash()); parent != nil; parent = bc.GetBlock(parent.ParentHash()) {
+		if _, err := state.New(parent.Root(), bc.stateDatabase()); err == nil {
+			for i, j := 0, len(ancestors)-1; i < j; i, j = i+1, j-1 {
+				ancestors[i], ancestors[j] = ancestors[j], ancestors[i]
+			}
+			return ancestors, nil
+		}
+		if GetCanonicalHash(bc.chainDb, parent.NumberU64()) == parent.Hash() {
+			if canonical++; canonical > TrieFlushInterval+triesInMemory {
+				return nil, fmt.Errorf("no state within %d canonical blocks below side chain block #%d [%x…]", canonical-1, block.NumberU64(), block.Hash().Bytes()[:4])
+			}
+		}
+		ancestors = append(ancestors, parent)
+	}
+	return nil, ParentError(block.ParentHash())
+}
+
 // reorgs takes two blocks, an old chain and a new chain and will reconstruct the blocks and inserts them
 // to be part of the new canonical chain and accumulates potential missing transactions and post an
 // event about them
@@ -1863,6 +2184,14 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 					return err
 				}
 			}
+			if err := RmBlockInternalTxs(bc.atxi.Db, block); err != nil {
+				return err
+			}
+			if bc.atxi.Logs {
+				if err := RmBlockLogIndexes(bc.atxi.Db, block, GetBlockReceipts(bc.chainDb, block.Hash())); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
@@ -1880,11 +2209,8 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			if err := WriteBlockAddTxIndexes(bc.atxi.Db, block); err != nil {
 				return err
 			}
-			// if buildATXI has been in use (via RPC) and is NOT finished, current < stop
-			// if buildATXI has been in use (via RPC) and IS finished, current == stop
-			// else if builtATXI has not been in use (via RPC), then current == stop == 0
-			if bc.atxi.AutoMode && bc.atxi.Progress.Current == bc.atxi.Progress.Stop {
-				if err := bc.atxi.SetATXIBookmark(block.NumberU64()); err != nil {
+			if bc.atxi.Logs {
+				if err := WriteBlockLogIndexes(bc.atxi.Db, block, GetBlockReceipts(bc.chainDb, block.Hash())); err != nil {
 					return err
 				}
 			}
@@ -1900,6 +2226,14 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		}
 		addedTxs = append(addedTxs, block.Transactions()...)
 	}
+	// Move the index bookmarks on in chain order, once the whole new chain is indexed
+	if bc.atxi != nil {
+		for i := len(newChain) - 1; i >= 0; i-- {
+			if err := bc.atxi.setImported(newChain[i].NumberU64()); err != nil {
+				return err
+			}
+		}
+	}
 
 	// calculate the difference between deleted and added transactions
 	diff := types.TxDifference(deletedTxs, addedTxs)
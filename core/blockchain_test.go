@@ -17,6 +17,8 @@
 package core
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -715,6 +717,40 @@ func testReorgBadHashes(t *testing.T, full bool) {
 	}
 }
 
+// Tests that bad hashes set while the chain is running rewind the chain and
+// keep the bad block from being imported again.
+func TestSetBadHashes(t *testing.T) {
+	db, err := ethdb.NewMemDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis, err := WriteGenesisBlock(db, DefaultConfigMorden.Genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := chm(t, genesis, db)
+
+	blocks := makeBlockChainWithDiff(genesis, []int{1, 2, 3, 4}, 10)
+	if res := bc.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to import blocks: %v", res.Error)
+	}
+
+	bc.SetBadHashes([]*BadHash{
+		{
+			Block: blocks[3].Number(),
+			Hash:  blocks[3].Hash(),
+		},
+	})
+	defer bc.SetBadHashes([]*BadHash{})
+
+	if bc.CurrentBlock().Hash() != blocks[2].Hash() {
+		t.Errorf("last block hash mismatch: have: %x, want %x", bc.CurrentBlock().Hash(), blocks[2].Hash())
+	}
+	if res := bc.InsertChain(blocks[3:]); res.Error != ErrHashKnownBad {
+		t.Errorf("got error %#v, want %#v", res.Error, ErrHashKnownBad)
+	}
+}
+
 // Tests chain insertions in the face of one entity containing an invalid nonce.
 func TestHeadersInsertNonceError(t *testing.T) { testInsertNonceError(t, false) }
 func TestBlocksInsertNonceError(t *testing.T)  { testInsertNonceError(t, true) }
@@ -744,6 +780,9 @@ func testInsertNonceError(t *testing.T, full bool) {
 
 			res := blockchain.InsertChain(blocks)
 			failRes, err = res.Index, res.Error
+			if !res.Invalid {
+				t.Errorf("test %d: nonce failure not reported as invalid block", i)
+			}
 		} else {
 			headers := makeHeaderChain(blockchain.config, blockchain.CurrentHeader(), i, db, 0)
 
@@ -1096,6 +1135,312 @@ func TestRmAddrTx(t *testing.T) {
 	}
 }
 
+// Tests that atxi entries of rolled back blocks are removed, and that the consistency
+// check finds and repairs missing and stale entries.
+func TestAtxiSetHeadAndVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atxi-verify-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := ethdb.NewLDBDatabase(dir, 10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	MinGasLimit = big.NewInt(125000)
+
+	key1, err := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		addr1  = crypto.PubkeyToAddress(key1.PublicKey)
+		addr2  = crypto.PubkeyToAddress(key2.PublicKey)
+		signer = types.NewChainIdSigner(big.NewInt(63))
+		config = MakeDiehardChainConfig()
+	)
+
+	t1, err := types.NewTransaction(0, addr2, big.NewInt(1000), TxGas, nil, nil).WithSigner(signer).SignECDSA(key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, err := types.NewTransaction(1, addr2, big.NewInt(1000), TxGas, nil, nil).WithSigner(signer).SignECDSA(key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t3, err := types.NewTransaction(0, addr1, big.NewInt(1000), TxGas, nil, nil).WithSigner(signer).SignECDSA(key2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := WriteGenesisBlockForTesting(db,
+		GenesisAccount{addr1, big.NewInt(1000000)},
+		GenesisAccount{addr2, big.NewInt(1000000)},
+	)
+	blocks, _ := GenerateChain(config, genesis, db, 3, func(i int, gen *BlockGen) {
+		switch i {
+		case 0:
+			gen.AddTx(t1)
+		case 1:
+			gen.AddTx(t2)
+		case 2:
+			gen.AddTx(t3)
+		}
+	})
+
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// turn on atxi, not in auto mode
+	blockchain.SetAtxi(&AtxiT{Db: db})
+
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+	if res, err := VerifyAddrTxIndex(blockchain, db, 0, 0, false); err != nil {
+		t.Fatalf("unexpected inconsistency: %+v, %v", res, err)
+	}
+
+	if err := blockchain.SetHead(1); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := GetAddrTxs(db, addr1, 0, 0, "", "", -1, -1, false)
+	if len(out) != 1 {
+		t.Errorf("got: %v, want: %v", len(out), 1)
+	}
+	out, _ = GetAddrTxs(db, addr2, 0, 0, "", "", -1, -1, false)
+	if len(out) != 1 {
+		t.Errorf("got: %v, want: %v", len(out), 1)
+	}
+
+	// Make the index inconsistent with a key for a tx which is not in block 1,
+	// and the removal of one of the keys for t1.
+	bn := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bn, 1)
+	stale := formatAddrTxBytesIndex(addr2.Bytes(), bn, []byte("f"), []byte("s"), t3.Hash().Bytes())
+	if err := db.Put(stale, nil); err != nil {
+		t.Fatal(err)
+	}
+	missing := formatAddrTxBytesIndex(addr2.Bytes(), bn, []byte("t"), []byte("s"), t1.Hash().Bytes())
+	if err := db.Delete(missing); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := VerifyAddrTxIndex(blockchain, db, 0, 0, false)
+	if err != ErrAtxiInconsistent {
+		t.Errorf("got: %v, want: %v", err, ErrAtxiInconsistent)
+	}
+	if res.Missing != 1 || res.Stale != 1 {
+		t.Errorf("got: missing %d stale %d, want: missing 1 stale 1", res.Missing, res.Stale)
+	}
+	if _, err := VerifyAddrTxIndex(blockchain, db, 0, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := VerifyAddrTxIndex(blockchain, db, 0, 0, false); err != nil {
+		t.Errorf("unexpected inconsistency after repair: %+v, %v", res, err)
+	}
+	if has, _ := db.Has(stale); has {
+		t.Error("stale key not removed")
+	}
+	if has, _ := db.Has(missing); !has {
+		t.Error("missing key not written")
+	}
+}
+
+// newInternalTxTestChain creates a database with a block whose single
+// transaction creates a contract sending 1 wei of its endowment to payee.
+func newInternalTxTestChain(t *testing.T) (db ethdb.Database, config *ChainConfig, blocks types.Blocks, tx *types.Transaction, creator, payee common.Address, cleanup func()) {
+	dir, err := ioutil.TempDir("", "itx-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = ethdb.NewLDBDatabase(dir, 10, 100)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup = func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+
+	MinGasLimit = big.NewInt(125000)
+
+	key1, err := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		addr1  = crypto.PubkeyToAddress(key1.PublicKey)
+		signer = types.NewChainIdSigner(big.NewInt(63))
+		// init code sending 1 wei of the endowment to payee
+		initCode = []byte{
+			byte(vm.PUSH1), 0, // out size
+			byte(vm.PUSH1), 0, // out offset
+			byte(vm.PUSH1), 0, // in size
+			byte(vm.PUSH1), 0, // in offset
+			byte(vm.PUSH1), 1, // value
+			byte(vm.PUSH1), 0x33, // address
+			byte(vm.GAS),
+			byte(vm.CALL),
+			byte(vm.STOP),
+		}
+	)
+	config = MakeDiehardChainConfig()
+
+	tx, err = types.NewContractCreation(0, big.NewInt(10), big.NewInt(100000), new(big.Int), initCode).WithSigner(signer).SignECDSA(key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr1, big.NewInt(1000000)})
+	blocks, _ = GenerateChain(config, genesis, db, 1, func(i int, gen *BlockGen) {
+		gen.AddTx(tx)
+	})
+	return db, config, blocks, tx, addr1, common.BytesToAddress([]byte{0x33}), cleanup
+}
+
+// checkInternalTxIndex checks that the single internal transaction of the
+// internal tx test chain is indexed.
+func checkInternalTxIndex(t *testing.T, db ethdb.Database, tx *types.Transaction, creator, payee common.Address) {
+	out, err := GetInternalTxs(db, payee, 0, 0, "", "", -1, -1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("got: %v, want: %v", len(out), 1)
+	}
+	if out[0].TxHash != tx.Hash() || out[0].Kind != InternalTxCall || out[0].Value.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("unexpected internal tx: %+v", out[0])
+	}
+	if from := crypto.CreateAddress(creator, 0); out[0].From != from {
+		t.Errorf("got: %x, want: %x", out[0].From, from)
+	}
+}
+
+// Tests that internal transactions are indexed during block processing when
+// enabled, and only recorded for blocks which are valid.
+func TestInternalTxIndexing(t *testing.T) {
+	db, config, blocks, tx, creator, payee, cleanup := newInternalTxTestChain(t)
+	defer cleanup()
+
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// turn on atxi with internal transactions
+	blockchain.SetAtxi(&AtxiT{Db: db, Internal: true})
+
+	// A block failing state validation leaves no internal transactions behind
+	header := blocks[0].Header()
+	header.Root = common.Hash{0x01}
+	bad := types.NewBlockWithHeader(header).WithBody(blocks[0].Transactions(), blocks[0].Uncles())
+	if res := blockchain.InsertChain(types.Blocks{bad}); res.Error == nil {
+		t.Fatal("block with invalid state root imported")
+	}
+	if hasBlockInternalTxs(db, bad.Hash()) {
+		t.Error("internal transactions of invalid block recorded")
+	}
+	if out, _ := GetInternalTxs(db, payee, 0, 0, "", "", -1, -1, false); len(out) != 0 {
+		t.Errorf("internal transactions of invalid block indexed: %v", out)
+	}
+
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+	checkInternalTxIndex(t, db, tx, creator, payee)
+}
+
+// Tests that building the index re-executes the blocks imported without
+// indexing their internal transactions.
+func TestInternalTxIndexBuild(t *testing.T) {
+	db, config, blocks, tx, creator, payee, cleanup := newInternalTxTestChain(t)
+	defer cleanup()
+
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.SetAtxi(&AtxiT{Db: db})
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+	if hasBlockInternalTxs(db, blocks[0].Hash()) {
+		t.Fatal("internal transactions recorded while not indexed")
+	}
+
+	blockchain.SetAtxi(&AtxiT{Db: db, Progress: &AtxiProgressT{}, Internal: true})
+	if err := BuildAddrTxIndex(blockchain, db, db, 0, blockchain.CurrentBlock().NumberU64(), 10); err != nil {
+		t.Fatal(err)
+	}
+	checkInternalTxIndex(t, db, tx, creator, payee)
+}
+
+// Tests that verifying the index checks the internal transaction and log keys,
+// and the keys of blocks beyond the head.
+func TestAtxiVerifyAllIndexes(t *testing.T) {
+	db, config, blocks, _, _, payee, cleanup := newInternalTxTestChain(t)
+	defer cleanup()
+
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.SetAtxi(&AtxiT{Db: db, Internal: true, Logs: true})
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+	if res, err := VerifyAddrTxIndex(blockchain, db, 0, 0, false); err != nil {
+		t.Fatalf("unexpected inconsistency: %+v, %v", res, err)
+	}
+
+	// Drop a key of the internal transaction, and add stale keys for a
+	// transaction beyond the head and for a log which block 1 doesn't hold.
+	itx := GetBlockInternalTxs(db, blocks[0].Hash())[0]
+	missing := formatInternalTxBytesIndex(payee, 't', itx)
+	if err := db.Delete(missing); err != nil {
+		t.Fatal(err)
+	}
+	bn := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bn, 5)
+	staleTx := formatAddrTxBytesIndex(payee.Bytes(), bn, []byte("f"), []byte("s"), common.Hash{0x01}.Bytes())
+	staleLog := formatLogIndexKey(logAddressIndexPrefix, payee.Bytes(), 1)
+	for _, key := range [][]byte{staleTx, staleLog} {
+		if err := db.Put(key, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := VerifyAddrTxIndex(blockchain, db, 0, 0, false)
+	if err != ErrAtxiInconsistent {
+		t.Errorf("got: %v, want: %v", err, ErrAtxiInconsistent)
+	}
+	if res.Missing != 1 || res.Stale != 2 {
+		t.Errorf("got: missing %d stale %d, want: missing 1 stale 2", res.Missing, res.Stale)
+	}
+	if _, err := VerifyAddrTxIndex(blockchain, db, 0, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := VerifyAddrTxIndex(blockchain, db, 0, 0, false); err != nil {
+		t.Errorf("unexpected inconsistency after repair: %+v, %v", res, err)
+	}
+	if out, _ := GetInternalTxs(db, payee, 0, 0, "t", "", -1, -1, false); len(out) != 1 {
+		t.Errorf("missing internal transaction not restored, got %d", len(out))
+	}
+	for _, key := range [][]byte{staleTx, staleLog} {
+		if has, _ := db.Has(key); has {
+			t.Errorf("stale key %x not removed", key)
+		}
+	}
+}
+
 // Tests that various import methods move the chain head pointers to the correct
 // positions.
 func TestLightVsFastVsFullChainHeads(t *testing.T) {
@@ -1421,8 +1766,8 @@ func TestLogReorgs(t *testing.T) {
 	// have any chain like this exist in real world, so SputnikVM does
 	// not contain a patch for this. As a result, it cannot figure out
 	// a correct patch to run. So we bypass this test when running
-	// with `UseSputnikVM`.
-	if UseSputnikVM == "true" {
+	// with SputnikVM.
+	if testVM != NativeTxExecutor {
 		return
 	}
 
@@ -1483,8 +1828,8 @@ func TestReorgSideEvent(t *testing.T) {
 	// have any chain like this exist in real world, so SputnikVM does
 	// not contain a patch for this. As a result, it cannot figure out
 	// a correct patch to run. So we bypass this test when running
-	// with `UseSputnikVM`.
-	if UseSputnikVM == "true" {
+	// with SputnikVM.
+	if testVM != NativeTxExecutor {
 		return
 	}
 
@@ -1838,3 +2183,360 @@ func TestBlockChain_BlockIsGenesis(t *testing.T) {
 		t.Errorf("expected: is not genesis block")
 	}
 }
+
+// Tests that with state garbage collection, only the recent states are kept, in
+// memory, and that the head state is written to disk on Stop.
+func TestStateGC(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	var (
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		signer   = types.NewChainIdSigner(big.NewInt(63))
+		config   = MakeDiehardChainConfig()
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000)})
+	WriteGenesisBlockForTesting(gendb, GenesisAccount{addr, big.NewInt(1000000)})
+
+	// The chain generation writes all states to its database, hence gendb.
+	n := triesInMemory + 72
+	blocks, _ := GenerateChain(config, genesis, gendb, n, func(i int, gen *BlockGen) {
+		tx, err := types.NewTransaction(uint64(i), common.BigToAddress(big.NewInt(int64(0x1000+i))), big.NewInt(1000), TxGas, nil, nil).WithSigner(signer).SignECDSA(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.AddTx(tx)
+	})
+
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blockchain.EnableStateGC(); err != nil {
+		t.Fatal(err)
+	}
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+
+	for i, block := range blocks {
+		_, err := blockchain.StateAt(block.Root())
+		if recent := i >= n-triesInMemory; recent != (err == nil) {
+			t.Errorf("block #%d state available: have %v, want %v", block.NumberU64(), err == nil, recent)
+		}
+		if _, err := state.New(block.Root(), state.NewDatabase(db)); err == nil {
+			t.Errorf("block #%d state written to disk", block.NumberU64())
+		}
+	}
+
+	blockchain.Stop()
+	if nodes, _ := blockchain.triedb.Size(); nodes == 0 {
+		t.Error("no state discarded on stop")
+	}
+	head := blocks[n-1]
+	statedb, err := state.New(head.Root(), state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("head state not flushed: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		if balance := statedb.GetBalance(common.BigToAddress(big.NewInt(int64(0x1000 + i)))); balance.Cmp(big.NewInt(1000)) != 0 {
+			t.Fatalf("account %d balance mismatch: have %v, want %v", i, balance, 1000)
+		}
+	}
+	if nonce := statedb.GetNonce(addr); nonce != uint64(n) {
+		t.Errorf("nonce mismatch: have %d, want %d", nonce, n)
+	}
+}
+
+// Tests that pruning the state keeps the states of the recent blocks, and only
+// deletes unreachable trie nodes.
+func TestPruneState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prune-state-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	MinGasLimit = big.NewInt(125000)
+
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	var (
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		signer   = types.NewChainIdSigner(big.NewInt(63))
+		config   = MakeDiehardChainConfig()
+		gendb, _ = ethdb.NewMemDatabase()
+		txs      []*types.Transaction
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000)})
+	WriteGenesisBlockForTesting(gendb, GenesisAccount{addr, big.NewInt(1000000)})
+
+	// The contract created in the first block stores the block number at slot 0,
+	// and has a single zero byte as code.
+	blocks, _ := GenerateChain(config, genesis, gendb, 20, func(i int, gen *BlockGen) {
+		var tx *types.Transaction
+		if i == 0 {
+			tx = types.NewContractCreation(0, new(big.Int), big.NewInt(100000), new(big.Int), common.FromHex("0x4360005560016000f3"))
+		} else {
+			tx = types.NewTransaction(uint64(i), common.BigToAddress(big.NewInt(int64(0x1000+i))), big.NewInt(1000), TxGas, nil, nil)
+		}
+		tx, err := tx.WithSigner(signer).SignECDSA(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.AddTx(tx)
+		txs = append(txs, tx)
+	})
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+	blockchain.Stop()
+
+	roots, err := PruneStateRoots(db, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 3 {
+		t.Fatalf("roots mismatch: have %d, want %d", len(roots), 3)
+	}
+	res, err := PruneState(db, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Deleted == 0 || res.Reclaimed == 0 {
+		t.Fatalf("nothing pruned: %+v", res)
+	}
+
+	complete := func(root common.Hash) bool {
+		statedb, err := state.New(root, state.NewDatabase(db))
+		if err != nil {
+			return false
+		}
+		it := state.NewNodeIterator(statedb)
+		for it.Next() {
+		}
+		return it.Error == nil
+	}
+	for i, block := range blocks {
+		if kept := i >= len(blocks)-3; complete(block.Root()) != kept {
+			t.Errorf("block #%d state complete: have %v, want %v", block.NumberU64(), !kept, kept)
+		}
+	}
+	statedb, _ := state.New(blocks[len(blocks)-1].Root(), state.NewDatabase(db))
+	contract := crypto.CreateAddress(addr, 0)
+	if code := statedb.GetCode(contract); len(code) != 1 || code[0] != 0 {
+		t.Errorf("contract code mismatch: have %x", code)
+	}
+	if v := statedb.GetState(contract, common.Hash{}); v != common.BigToHash(big.NewInt(1)) {
+		t.Errorf("contract storage mismatch: have %x", v)
+	}
+	for _, tx := range txs {
+		if found, _, _, _ := GetTransaction(db, tx.Hash()); found == nil {
+			t.Fatalf("transaction %x deleted", tx.Hash())
+		}
+	}
+}
+
+func TestExportImportState(t *testing.T) {
+	MinGasLimit = big.NewInt(125000)
+
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	var (
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		contract = crypto.CreateAddress(addr, 0)
+		signer   = types.NewChainIdSigner(big.NewInt(63))
+		config   = MakeDiehardChainConfig()
+		srcdb, _ = ethdb.NewMemDatabase()
+		dstdb, _ = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+	)
+	genesis := WriteGenesisBlockForTesting(srcdb, GenesisAccount{addr, big.NewInt(1000000)})
+	WriteGenesisBlockForTesting(dstdb, GenesisAccount{addr, big.NewInt(1000000)})
+	WriteGenesisBlockForTesting(gendb, GenesisAccount{addr, big.NewInt(1000000)})
+
+	// The contract created in the first block stores the block number at slot 0.
+	blocks, _ := GenerateChain(config, genesis, gendb, 30, func(i int, gen *BlockGen) {
+		var tx *types.Transaction
+		if i == 0 {
+			tx = types.NewContractCreation(0, new(big.Int), big.NewInt(100000), new(big.Int), common.FromHex("0x4360005560016000f3"))
+		} else {
+			tx = types.NewTransaction(uint64(i), common.BigToAddress(big.NewInt(int64(0x1000+i))), big.NewInt(1000), TxGas, nil, nil)
+		}
+		tx, err := tx.WithSigner(signer).SignECDSA(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.AddTx(tx)
+	})
+	src, err := NewBlockChain(srcdb, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := src.InsertChain(blocks[:20]); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+	defer src.Stop()
+
+	var snapshot bytes.Buffer
+	if err := src.ExportState(&snapshot, blocks[19]); err != nil {
+		t.Fatal(err)
+	}
+	block, err := ImportState(dstdb, bytes.NewReader(snapshot.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Hash() != blocks[19].Hash() {
+		t.Fatalf("block mismatch: have %x, want %x", block.Hash(), blocks[19].Hash())
+	}
+
+	dst, err := NewBlockChain(dstdb, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Stop()
+	if head := dst.CurrentBlock().Hash(); head != blocks[19].Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, blocks[19].Hash())
+	}
+	statedb, err := dst.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := statedb.GetBalance(common.BigToAddress(big.NewInt(0x1005))); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", balance, 1000)
+	}
+	if value := statedb.GetState(contract, common.Hash{}); value != common.BigToHash(big.NewInt(1)) {
+		t.Errorf("storage mismatch: have %x, want %x", value, common.BigToHash(big.NewInt(1)))
+	}
+	// The node continues the chain from the snapshot block.
+	if res := dst.InsertChain(blocks[20:]); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index+20, res.Error)
+	}
+
+	// The state of a known block can be reimported, but not onto another chain.
+	if _, err := ImportState(srcdb, bytes.NewReader(snapshot.Bytes())); err != nil {
+		t.Errorf("import of known block failed: %v", err)
+	}
+	otherdb, _ := ethdb.NewMemDatabase()
+	WriteGenesisBlockForTesting(otherdb, GenesisAccount{addr, big.NewInt(2000000)})
+	if _, err := ImportState(otherdb, bytes.NewReader(snapshot.Bytes())); err == nil {
+		t.Error("import on another genesis succeeded")
+	}
+}
+
+// Tests that a chain garbage collecting state starts again after a crash, losing
+// the recent states, by rewinding to the newest block with state on disk.
+func TestStateGCCrashRecovery(t *testing.T) {
+	var (
+		config   = MakeDiehardChainConfig()
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+	)
+	genesis := WriteGenesisBlockForTesting(db)
+	WriteGenesisBlockForTesting(gendb)
+	blocks, _ := GenerateChain(config, genesis, gendb, triesInMemory+8, nil)
+
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blockchain.EnableStateGC(); err != nil {
+		t.Fatal(err)
+	}
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+
+	// Restart without stopping the chain, none of the states being flushed
+	blockchain, err = NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatalf("failed to restart: %v", err)
+	}
+	defer blockchain.Stop()
+	if head := blockchain.CurrentBlock(); head.Hash() != genesis.Hash() {
+		t.Fatalf("head mismatch: have #%d, want genesis", head.NumberU64())
+	}
+	if hash := GetHeadBlockHash(db); hash != genesis.Hash() {
+		t.Fatalf("stored head mismatch: have %x, want %x", hash, genesis.Hash())
+	}
+	if err := blockchain.EnableStateGC(); err != nil {
+		t.Fatal(err)
+	}
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d again: %v", res.Index, res.Error)
+	}
+	if head, want := blockchain.CurrentBlock(), blocks[len(blocks)-1]; head.Hash() != want.Hash() {
+		t.Errorf("head mismatch: have #%d, want #%d", head.NumberU64(), want.NumberU64())
+	}
+}
+
+// Tests that with state garbage collection, a side chain forking off before the
+// recent states is stored until it is heavier than the canonical chain, and then
+// re-executed from the newest ancestor with state.
+func TestStateGCDeepReorg(t *testing.T) {
+	var (
+		config   = MakeDiehardChainConfig()
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+	)
+	genesis := WriteGenesisBlockForTesting(db)
+	WriteGenesisBlockForTesting(gendb)
+
+	n, fork := triesInMemory+72, 10
+	blocks, _ := GenerateChain(config, genesis, gendb, n, nil)
+	side, _ := GenerateChain(config, blocks[fork-1], gendb, n-fork+2, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blockchain.Stop()
+	if err := blockchain.EnableStateGC(); err != nil {
+		t.Fatal(err)
+	}
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+	if _, err := blockchain.StateAt(blocks[fork-1].Root()); err == nil {
+		t.Fatalf("fork point state not garbage collected")
+	}
+
+	// The lighter part of the side chain is stored without processing it
+	if res := blockchain.InsertChain(side[:triesInMemory]); res.Error != nil {
+		t.Fatalf("failed to store side block %d: %v", res.Index, res.Error)
+	}
+	if head := blockchain.CurrentBlock(); head.Hash() != blocks[n-1].Hash() {
+		t.Fatalf("head mismatch after light side chain: have #%d [%x…], want #%d", head.NumberU64(), head.Hash().Bytes()[:4], n)
+	}
+	for _, block := range side[:triesInMemory] {
+		if !blockchain.HasBlock(block.Hash()) {
+			t.Fatalf("side block #%d not stored", block.NumberU64())
+		}
+	}
+	// The rest makes it heavier, reorganising onto it
+	if res := blockchain.InsertChain(side[triesInMemory:]); res.Error != nil {
+		t.Fatalf("failed to process side block %d: %v", res.Index, res.Error)
+	}
+	want := side[len(side)-1]
+	if head := blockchain.CurrentBlock(); head.Hash() != want.Hash() {
+		t.Fatalf("head mismatch: have #%d [%x…], want #%d [%x…]", head.NumberU64(), head.Hash().Bytes()[:4], want.NumberU64(), want.Hash().Bytes()[:4])
+	}
+	if _, err := blockchain.StateAt(want.Root()); err != nil {
+		t.Errorf("head state missing: %v", err)
+	}
+	for _, block := range side {
+		if hash := blockchain.GetBlockByNumber(block.NumberU64()).Hash(); hash != block.Hash() {
+			t.Fatalf("canonical block #%d mismatch: have %x, want %x", block.NumberU64(), hash, block.Hash())
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/bloombits"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+)
+
+const (
+	// BloomBitsBlocks is the number of blocks a single bloom bit section vector
+	// contains.
+	BloomBitsBlocks uint64 = 4096
+
+	// bloomConfirms is the number of confirmation blocks before a bloom section is
+	// considered probably final and its rotated bits are calculated.
+	bloomConfirms = 256
+
+	// bloomIndexInterval is the interval at which the indexer checks for new
+	// sections to process.
+	bloomIndexInterval = 10 * time.Second
+)
+
+var errBloomIndexerStopped = errors.New("bloom indexer stopped")
+
+// BloomIndexer generates the rotated bloom bits of the canonical chain, section by
+// section, in the background. Sections are processed once their last block has
+// bloomConfirms confirmations; sections whose last block has been reorged away
+// are processed again.
+type BloomIndexer struct {
+	db      ethdb.Database
+	confirm uint64
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewBloomIndexer creates a bloom bits indexer for the canonical chain stored in db.
+func NewBloomIndexer(db ethdb.Database) *BloomIndexer {
+	return &BloomIndexer{
+		db:      db,
+		confirm: bloomConfirms,
+		quit:    make(chan struct{}),
+	}
+}
+
+// Start launches the background indexing loop.
+func (b *BloomIndexer) Start() {
+	b.wg.Add(1)
+	go b.loop()
+}
+
+// Stop terminates the background indexing loop and waits for it to return.
+func (b *BloomIndexer) Stop() {
+	close(b.quit)
+	b.wg.Wait()
+}
+
+func (b *BloomIndexer) loop() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(bloomIndexInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := b.Process(); err != nil && err != errBloomIndexerStopped {
+			glog.V(logger.Warn).Infof("bloom bits indexing failed: %v", err)
+		}
+		select {
+		case <-b.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process generates the bloom bits of all the confirmed sections not processed
+// yet and returns the number of valid sections.
+func (b *BloomIndexer) Process() (uint64, error) {
+	head := GetHeader(b.db, GetHeadHeaderHash(b.db))
+	if head == nil {
+		return 0, nil
+	}
+	var target uint64 // number of complete and confirmed sections
+	if n := head.Number.Uint64(); n >= b.confirm {
+		target = (n - b.confirm + 1) / BloomBitsBlocks
+	}
+
+	// Roll back the sections reorged away since they were processed.
+	stored := GetBloomBitsSections(b.db)
+	sections := stored
+	for sections > 0 && GetBloomBitsHead(b.db, sections-1) != GetCanonicalHash(b.db, sections*BloomBitsBlocks-1) {
+		sections--
+	}
+	if sections != stored {
+		glog.V(logger.Info).Infof("bloom bits: rolling back from section %d to %d", stored, sections)
+		if err := WriteBloomBitsSections(b.db, sections); err != nil {
+			return sections, err
+		}
+	}
+
+	for ; sections < target; sections++ {
+		select {
+		case <-b.quit:
+			return sections, errBloomIndexerStopped
+		default:
+		}
+		start := time.Now()
+		if err := b.processSection(sections); err != nil {
+			return sections, err
+		}
+		if err := WriteBloomBitsSections(b.db, sections+1); err != nil {
+			return sections, err
+		}
+		glog.V(logger.Debug).Infof("bloom bits: processed section %d / %d (blocks %d-%d) in %v", sections+1, target, sections*BloomBitsBlocks, (sections+1)*BloomBitsBlocks-1, time.Since(start))
+	}
+	return sections, nil
+}
+
+// processSection generates and writes the bloom bits of a section.
+func (b *BloomIndexer) processSection(section uint64) error {
+	gen, err := bloombits.NewGenerator(uint(BloomBitsBlocks))
+	if err != nil {
+		return err
+	}
+	var lastHash common.Hash
+	for i := uint64(0); i < BloomBitsBlocks; i++ {
+		n := section*BloomBitsBlocks + i
+		lastHash = GetCanonicalHash(b.db, n)
+		header := GetHeader(b.db, lastHash)
+		if header == nil {
+			return fmt.Errorf("canonical header #%d missing", n)
+		}
+		if err := gen.AddBloom(uint(i), header.Bloom); err != nil {
+			return err
+		}
+	}
+
+	batch := b.db.NewBatch()
+	for bit := uint(0); bit < uint(bloombits.BloomBitLength); bit++ {
+		bits, err := gen.Bitset(bit)
+		if err != nil {
+			return err
+		}
+		if err := WriteBloomBits(batch, bit, section, lastHash, bits); err != nil {
+			return err
+		}
+	}
+	if err := WriteBloomBitsHead(batch, section, lastHash); err != nil {
+		return err
+	}
+	return batch.Write()
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import (
+	"bytes"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/core/types"
+)
+
+// Tests that batched bloom bits are correctly rotated from the input bloom
+// filters.
+func TestGenerator(t *testing.T) {
+	// Generate the input and the rotated output
+	var input, output [BloomBitLength][BloomByteLength]byte
+
+	for i := 0; i < BloomBitLength; i++ {
+		for j := 0; j < BloomBitLength; j++ {
+			bit := byte(rand.Int() % 2)
+
+			input[i][j/8] |= bit << byte(7-j%8)
+			output[BloomBitLength-1-j][i/8] |= bit << byte(7-i%8)
+		}
+	}
+	// Crunch the input through the generator and verify the result
+	gen, err := NewGenerator(BloomBitLength)
+	if err != nil {
+		t.Fatalf("failed to create bloombit generator: %v", err)
+	}
+	for i, bloom := range input {
+		if err := gen.AddBloom(uint(i), bloom); err != nil {
+			t.Fatalf("bloom %d: failed to add: %v", i, err)
+		}
+	}
+	for i, want := range output {
+		have, err := gen.Bitset(uint(i))
+		if err != nil {
+			t.Fatalf("output %d: failed to retrieve bits: %v", i, err)
+		}
+		if !bytes.Equal(have, want[:]) {
+			t.Errorf("output %d: bit vector mismatch have %x, want %x", i, have, want)
+		}
+	}
+}
+
+// Tests that bit vectors survive compression, whether sparse, dense or empty.
+func TestCompressBits(t *testing.T) {
+	sparse := make([]byte, 512)
+	sparse[3], sparse[511] = 0x81, 0x01
+
+	dense := make([]byte, 512)
+	rand.Read(dense)
+
+	for i, data := range [][]byte{make([]byte, 512), sparse, dense} {
+		comp := CompressBits(data)
+		if len(comp) > len(data)+1 {
+			t.Errorf("test %d: compressed size %d larger than raw %d", i, len(comp), len(data)+1)
+		}
+		have, err := DecompressBits(comp, len(data))
+		if err != nil {
+			t.Fatalf("test %d: failed to decompress: %v", i, err)
+		}
+		if !bytes.Equal(have, data) {
+			t.Errorf("test %d: data mismatch: have %x, want %x", i, have, data)
+		}
+	}
+	if comp := CompressBits(sparse); len(comp) != 1+3*4 {
+		t.Errorf("sparse vector not compressed: have %d bytes, want %d", len(comp), 1+3*4)
+	}
+	if _, err := DecompressBits([]byte{0x02}, 512); err == nil {
+		t.Errorf("expected error for unknown encoding")
+	}
+}
+
+// Tests that the matcher selects the blocks whose blooms contain the filtered keys.
+func TestMatcher(t *testing.T) {
+	const sections = 64
+
+	var (
+		addr   = []byte("address")
+		topic1 = []byte("topic1")
+		topic2 = []byte("topic2")
+	)
+	bloomOf := func(keys ...[]byte) types.Bloom {
+		bin := new(big.Int)
+		for _, key := range keys {
+			bin.Or(bin, types.Bloom9(key))
+		}
+		return types.BytesToBloom(bin.Bytes())
+	}
+	blooms := map[uint]types.Bloom{
+		3:  bloomOf(addr, topic1),
+		17: bloomOf(addr, topic2),
+		40: bloomOf(topic1),
+	}
+	gen, err := NewGenerator(sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint(0); i < sections; i++ {
+		if err := gen.AddBloom(i, blooms[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	retrieve := func(bit uint) ([]byte, error) {
+		return gen.Bitset(bit)
+	}
+
+	tests := []struct {
+		filters [][][]byte
+		want    []uint64
+	}{
+		{[][][]byte{{addr}}, []uint64{3, 17}},
+		{[][][]byte{{topic1}}, []uint64{3, 40}},
+		{[][][]byte{{addr}, {topic1}}, []uint64{3}},
+		{[][][]byte{{addr}, {topic1, topic2}}, []uint64{3, 17}},
+		{[][][]byte{{[]byte("missing")}}, nil},
+		{[][][]byte{{}, {topic2}}, []uint64{17}},
+	}
+	for i, tt := range tests {
+		bits, err := NewMatcher(sections, tt.filters).Match(retrieve)
+		if err != nil {
+			t.Fatalf("test %d: failed to match: %v", i, err)
+		}
+		if have := Blocks(bits); !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("test %d: blocks mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+	if !NewMatcher(sections, [][][]byte{{}}).Empty() {
+		t.Errorf("expected matcher without keys to be empty")
+	}
+}
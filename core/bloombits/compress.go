@@ -0,0 +1,86 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Bit vectors of the higher blooms are sparse for most of the chain, so they are
+// stored as the list of the positions of their set bits when that is shorter.
+const (
+	encodingRaw    = 0x00 // the bit vector itself
+	encodingSparse = 0x01 // big endian uint32 positions of the set bits
+)
+
+var errInvalidEncoding = errors.New("invalid bit vector encoding")
+
+// CompressBits encodes a bit vector for storage. A vector without any set bit
+// is encoded as an empty slice.
+func CompressBits(data []byte) []byte {
+	var positions []uint32
+	for i, b := range data {
+		for j := uint(0); b != 0 && j < 8; j++ {
+			if b&(0x80>>j) != 0 {
+				positions = append(positions, uint32(i)*8+uint32(j))
+			}
+		}
+		// bail out as soon as sparse encoding is not worth it
+		if 4*len(positions) >= len(data) {
+			return append([]byte{encodingRaw}, data...)
+		}
+	}
+	if len(positions) == 0 {
+		return []byte{}
+	}
+	out := make([]byte, 1+4*len(positions))
+	out[0] = encodingSparse
+	for i, pos := range positions {
+		binary.BigEndian.PutUint32(out[1+4*i:], pos)
+	}
+	return out
+}
+
+// DecompressBits decodes a bit vector of the given length in bytes encoded by CompressBits.
+func DecompressBits(data []byte, size int) ([]byte, error) {
+	out := make([]byte, size)
+	if len(data) == 0 {
+		return out, nil
+	}
+	switch data[0] {
+	case encodingRaw:
+		if len(data)-1 != size {
+			return nil, errInvalidEncoding
+		}
+		copy(out, data[1:])
+	case encodingSparse:
+		if (len(data)-1)%4 != 0 {
+			return nil, errInvalidEncoding
+		}
+		for i := 1; i < len(data); i += 4 {
+			pos := binary.BigEndian.Uint32(data[i:])
+			if int(pos/8) >= size {
+				return nil, errInvalidEncoding
+			}
+			out[pos/8] |= 0x80 >> (pos % 8)
+		}
+	default:
+		return nil, errInvalidEncoding
+	}
+	return out, nil
+}
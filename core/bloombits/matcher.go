@@ -0,0 +1,128 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import (
+	"github.com/ethereumproject/go-ethereum/crypto"
+)
+
+// bloomIndexes represents the bit indexes inside the bloom filter that belong
+// to some key.
+type bloomIndexes [3]uint
+
+// calcBloomIndexes returns the bloom filter bit indexes belonging to the given key.
+func calcBloomIndexes(b []byte) bloomIndexes {
+	b = crypto.Keccak256(b)
+
+	var idxs bloomIndexes
+	for i := 0; i < len(idxs); i++ {
+		idxs[i] = (uint(b[2*i+1]) + (uint(b[2*i]) << 8)) & 2047
+	}
+	return idxs
+}
+
+// Retriever returns the bit vector of a bloom bit for the section being matched.
+type Retriever func(bit uint) ([]byte, error)
+
+// Matcher matches the bit vectors of a section against a filter. The filter is
+// a list of groups of keys; a block matches if, for each group, its bloom may
+// contain any of the keys of the group.
+type Matcher struct {
+	sectionSize uint64
+	filters     [][]bloomIndexes
+}
+
+// NewMatcher creates a new matcher for sections of the given number of blocks.
+// Empty groups match everything and are dropped.
+func NewMatcher(sectionSize uint64, filters [][][]byte) *Matcher {
+	m := &Matcher{sectionSize: sectionSize}
+	for _, filter := range filters {
+		if len(filter) == 0 {
+			continue
+		}
+		bloomBits := make([]bloomIndexes, len(filter))
+		for i, clause := range filter {
+			bloomBits[i] = calcBloomIndexes(clause)
+		}
+		m.filters = append(m.filters, bloomBits)
+	}
+	return m
+}
+
+// Empty reports whether the matcher has no filter at all, ie. would match every block.
+func (m *Matcher) Empty() bool {
+	return len(m.filters) == 0
+}
+
+// Match returns the bit vector of the blocks of a section which possibly match
+// the filter, the bit vectors of the section being fetched with retrieve.
+func (m *Matcher) Match(retrieve Retriever) ([]byte, error) {
+	size := int(m.sectionSize / 8)
+	vectors := make(map[uint][]byte)
+	get := func(bit uint) ([]byte, error) {
+		if v, ok := vectors[bit]; ok {
+			return v, nil
+		}
+		v, err := retrieve(bit)
+		if err != nil {
+			return nil, err
+		}
+		vectors[bit] = v
+		return v, nil
+	}
+
+	result := make([]byte, size)
+	for i := range result {
+		result[i] = 0xff
+	}
+	for _, filter := range m.filters {
+		// any of the keys of the group, with all three bits of a key set
+		group := make([]byte, size)
+		for _, idxs := range filter {
+			key := make([]byte, size)
+			copy(key, result)
+			for _, bit := range idxs {
+				v, err := get(bit)
+				if err != nil {
+					return nil, err
+				}
+				for i := range key {
+					key[i] &= v[i]
+				}
+			}
+			for i := range group {
+				group[i] |= key[i]
+			}
+		}
+		copy(result, group)
+	}
+	return result, nil
+}
+
+// Blocks returns the indexes within the section of the blocks set in a bit vector
+// returned by Match.
+func Blocks(bits []byte) []uint64 {
+	var blocks []uint64
+	for i, b := range bits {
+		for j := uint(0); b != 0 && j < 8; j++ {
+			if b&(0x80>>j) != 0 {
+				blocks = append(blocks, uint64(i)*8+uint64(j))
+			}
+		}
+	}
+	return blocks
+}
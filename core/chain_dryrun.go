@@ -0,0 +1,124 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+	"github.com/ethereumproject/go-ethereum/pow"
+)
+
+// DryRunReport is the outcome of the validation of a block by a DryRunChain.
+type DryRunReport struct {
+	Number    uint64
+	Hash      common.Hash
+	Txs       int
+	GasUsed   *big.Int    // Gas used by the block's transactions, nil if not processed
+	Root      common.Hash // State root of the block's header
+	StateRoot common.Hash // State root computed by processing the block, zero if not processed
+	BadHash   bool        // Whether the block is a known bad one
+	Known     bool        // Whether the block is already in the chain
+	Err       error       // Why the block is invalid, nil if valid
+}
+
+// RootMismatch reports whether the block was processed into another state root
+// than the one of its header.
+func (r *DryRunReport) RootMismatch() bool {
+	return r.StateRoot != (common.Hash{}) && r.StateRoot != r.Root
+}
+
+// DryRunChain validates blocks against a chain database as InsertChain would,
+// headers, bodies and state transitions, without writing anything to it. The
+// blocks and states of the valid blocks are kept in memory for their
+// descendants to be validated on top of them.
+type DryRunChain struct {
+	db *ethdb.OverlayDatabase
+	bc *BlockChain
+}
+
+// NewDryRunChain returns a dry run chain on top of the given chain database.
+func NewDryRunChain(chainDb ethdb.Database, config *ChainConfig, pow pow.PoW) (*DryRunChain, error) {
+	db := ethdb.NewOverlayDatabase(chainDb)
+	bc, err := NewBlockChainDryrun(db, config, pow, new(event.TypeMux))
+	if err != nil {
+		return nil, err
+	}
+	return &DryRunChain{db: db, bc: bc}, nil
+}
+
+// Validate validates a block whose parent is either in the chain database or
+// a block previously validated by the dry run chain.
+func (c *DryRunChain) Validate(block *types.Block) *DryRunReport {
+	report := &DryRunReport{
+		Number: block.NumberU64(),
+		Hash:   block.Hash(),
+		Txs:    len(block.Transactions()),
+		Root:   block.Root(),
+	}
+	if report.Err = c.bc.config.HeaderCheck(block.Header()); report.Err != nil {
+		report.BadHash = report.Err == ErrHashKnownBad
+		return report
+	}
+	if !c.bc.pow.Verify(block) {
+		report.Err = &BlockNonceErr{Hash: block.Hash(), Number: block.Number(), Nonce: block.Nonce()}
+		return report
+	}
+	if err := c.bc.Validator().ValidateBlock(block); err != nil {
+		if IsKnownBlockErr(err) {
+			report.Known = true
+		} else {
+			report.Err = err
+		}
+		return report
+	}
+	parent := c.bc.GetBlock(block.ParentHash())
+	statedb, err := state.New(parent.Root(), c.bc.stateDatabase())
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	receipts, _, usedGas, err := c.bc.processor.Process(block, statedb)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	report.GasUsed = usedGas
+	report.StateRoot = statedb.IntermediateRoot(false)
+	if report.Err = c.bc.Validator().ValidateState(block, parent, statedb, receipts, usedGas); report.Err != nil {
+		return report
+	}
+	// Keep the block and its state in memory for its descendants
+	if _, err := statedb.CommitTo(c.db, false); err != nil {
+		report.Err = fmt.Errorf("failed to keep state: %v", err)
+		return report
+	}
+	if err := WriteBlock(c.db, block); err != nil {
+		report.Err = fmt.Errorf("failed to keep block: %v", err)
+	}
+	return report
+}
+
+// MemorySize returns the size of the blocks and states kept in memory.
+func (c *DryRunChain) MemorySize() common.StorageSize {
+	return common.StorageSize(c.db.Size())
+}
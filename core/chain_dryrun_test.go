@@ -0,0 +1,95 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+)
+
+// Tests that a dry run chain validates blocks on top of each other, reporting
+// invalid ones, without writing to the chain database.
+func TestDryRunChain(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	var (
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		signer   = types.NewChainIdSigner(big.NewInt(63))
+		config   = MakeDiehardChainConfig()
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000)})
+	WriteGenesisBlockForTesting(gendb, GenesisAccount{addr, big.NewInt(1000000)})
+
+	blocks, _ := GenerateChain(config, genesis, gendb, 3, func(i int, gen *BlockGen) {
+		tx, err := types.NewTransaction(gen.TxNonce(addr), common.BigToAddress(big.NewInt(0x1000)), big.NewInt(1000), TxGas, nil, nil).WithSigner(signer).SignECDSA(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.AddTx(tx)
+	})
+	keys := len(db.Keys())
+
+	chain, err := NewDryRunChain(db, config, FakePow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := chain.Validate(blocks[0]); report.Err != nil {
+		t.Fatalf("block 1 invalid: %v", report.Err)
+	}
+	// A block processed into another state root than the one of its header
+	header := blocks[1].Header()
+	header.Root = common.Hash{1}
+	tampered := types.NewBlockWithHeader(header).WithBody(blocks[1].Transactions(), blocks[1].Uncles())
+	report := chain.Validate(tampered)
+	if report.Err == nil || !report.RootMismatch() {
+		t.Errorf("tampered block not reported as root mismatch: %v", report.Err)
+	}
+	if report.StateRoot != blocks[1].Root() || report.GasUsed.Cmp(TxGas) != 0 {
+		t.Errorf("tampered block report mismatch: have root %x gas %v, want root %x gas %v", report.StateRoot, report.GasUsed, blocks[1].Root(), TxGas)
+	}
+	for i, block := range blocks[1:] {
+		report := chain.Validate(block)
+		if report.Err != nil {
+			t.Fatalf("block %d invalid: %v", i+2, report.Err)
+		}
+		if report.RootMismatch() || report.StateRoot != block.Root() || report.GasUsed.Cmp(TxGas) != 0 || report.Txs != 1 {
+			t.Errorf("block %d report mismatch: %+v", i+2, report)
+		}
+	}
+	if n := len(db.Keys()); n != keys {
+		t.Fatalf("dry run wrote to the chain database: have %d keys, want %d", n, keys)
+	}
+	if block := GetBlock(db, blocks[0].Hash()); block != nil {
+		t.Fatal("dry run block found in the chain database")
+	}
+
+	// Known bad blocks are reported as such
+	config = MakeDiehardChainConfig()
+	config.BadHashes = []*BadHash{{Block: blocks[0].Number(), Hash: blocks[0].Hash()}}
+	if chain, err = NewDryRunChain(db, config, FakePow{}); err != nil {
+		t.Fatal(err)
+	}
+	if report := chain.Validate(blocks[0]); !report.BadHash || report.Err != ErrHashKnownBad {
+		t.Errorf("bad block not reported: %v", report.Err)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+)
+
+const (
+	// DefaultFreezerDepth is the default number of recent blocks whose bodies and
+	// receipts are kept in the key-value store rather than the freezer.
+	DefaultFreezerDepth = 90000
+
+	// freezerBatchLimit is the maximum number of blocks frozen before syncing the
+	// freezer and deleting the frozen data from the key-value store.
+	freezerBatchLimit = 30000
+
+	// freezerInterval is the interval at which the chain freezer checks for
+	// blocks to freeze.
+	freezerInterval = time.Minute
+)
+
+var errFreezerStopped = errors.New("chain freezer stopped")
+
+// FreezeAncients moves the bodies and receipts of the canonical blocks older than
+// depth blocks from the head out of the key-value store into its freezer. The
+// genesis block is frozen but kept in the key-value store as well. It returns the
+// number of blocks in the freezer. The quit channel, if not nil, interrupts the
+// operation between batches.
+func FreezeAncients(db *ethdb.LDBDatabase, depth uint64, quit chan struct{}) (uint64, error) {
+	freezer := db.Freezer()
+	if freezer == nil {
+		return 0, errors.New("database has no freezer")
+	}
+	head := GetHeader(db, GetHeadBlockHash(db))
+	if head == nil || head.Number.Uint64() < depth {
+		return freezer.Ancients(), nil
+	}
+	limit := head.Number.Uint64() - depth // last block to freeze
+
+	for freezer.Ancients() <= limit {
+		select {
+		case <-quit:
+			return freezer.Ancients(), errFreezerStopped
+		default:
+		}
+		start := time.Now()
+		first := freezer.Ancients()
+		var hashes []common.Hash
+		for n := first; n <= limit && len(hashes) < freezerBatchLimit; n++ {
+			hash := GetCanonicalHash(db, n)
+			if hash == (common.Hash{}) {
+				return freezer.Ancients(), fmt.Errorf("canonical hash #%d missing", n)
+			}
+			body, _ := db.Get(freezerBodyKey(hash))
+			if len(body) == 0 {
+				return freezer.Ancients(), fmt.Errorf("block body #%d [%x…] missing", n, hash[:4])
+			}
+			// receipts are missing for blocks whose import did not complete,
+			// an empty list is kept for those
+			receipts, _ := db.Get(freezerReceiptsKey(hash))
+			if len(receipts) == 0 {
+				receipts = []byte{0xc0}
+			}
+			if err := freezer.AppendAncient(n, hash.Bytes(), body, receipts); err != nil {
+				return freezer.Ancients(), err
+			}
+			hashes = append(hashes, hash)
+		}
+		// Only delete what was persisted in the freezer.
+		if err := freezer.Sync(); err != nil {
+			return freezer.Ancients(), err
+		}
+		for i, hash := range hashes {
+			if first+uint64(i) == 0 {
+				continue
+			}
+			if err := db.Delete(freezerBodyKey(hash)); err != nil {
+				return freezer.Ancients(), err
+			}
+			if err := db.Delete(freezerReceiptsKey(hash)); err != nil {
+				return freezer.Ancients(), err
+			}
+		}
+		glog.V(logger.Info).Infof("froze blocks %d-%d in %v", first, freezer.Ancients()-1, time.Since(start))
+	}
+	return freezer.Ancients(), nil
+}
+
+// freezerBodyKey returns the key-value store key of the body of a block.
+func freezerBodyKey(hash common.Hash) []byte {
+	key := append(append([]byte{}, blockPrefix...), hash.Bytes()...)
+	return append(key, bodySuffix...)
+}
+
+// freezerReceiptsKey returns the key-value store key of the receipts of a block.
+func freezerReceiptsKey(hash common.Hash) []byte {
+	return append(append([]byte{}, blockReceiptsPrefix...), hash.Bytes()...)
+}
+
+// ChainFreezer periodically moves the ancient chain data of the database to its
+// freezer in the background.
+type ChainFreezer struct {
+	db    *ethdb.LDBDatabase
+	depth uint64
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewChainFreezer creates a chain freezer keeping depth recent blocks in the key-value
+// store of the given database, which must have a freezer.
+func NewChainFreezer(db *ethdb.LDBDatabase, depth uint64) *ChainFreezer {
+	return &ChainFreezer{
+		db:    db,
+		depth: depth,
+		quit:  make(chan struct{}),
+	}
+}
+
+// Start launches the background freezing loop.
+func (f *ChainFreezer) Start() {
+	f.wg.Add(1)
+	go f.loop()
+}
+
+// Stop terminates the background freezing loop and waits for it to return.
+func (f *ChainFreezer) Stop() {
+	close(f.quit)
+	f.wg.Wait()
+}
+
+func (f *ChainFreezer) loop() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(freezerInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := FreezeAncients(f.db, f.depth, f.quit); err != nil && err != errFreezerStopped {
+			glog.V(logger.Warn).Infof("freezing ancient blocks failed: %v", err)
+		}
+		select {
+		case <-f.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/metrics"
+)
+
+// recoverSendersFromBlocks starts a concurrent recovery of the senders of the
+// transactions of the given blocks, returning a quit channel to abort it. The
+// senders are cached in the transactions, where they are picked up by the state
+// processing; a transaction processed before its sender is recovered simply has
+// it recovered on the spot.
+func recoverSendersFromBlocks(config *ChainConfig, blocks []*types.Block) chan<- struct{} {
+	type task struct {
+		signer types.Signer
+		tx     *types.Transaction
+	}
+	var txs int
+	for _, block := range blocks {
+		txs += len(block.Transactions())
+	}
+	abort := make(chan struct{})
+	if txs == 0 {
+		return abort
+	}
+	// Spawn as many workers as allowed threads
+	workers := runtime.GOMAXPROCS(0)
+	if txs < workers {
+		workers = txs
+	}
+	var (
+		tasks = make(chan task, workers)
+		wg    sync.WaitGroup
+		start = time.Now()
+	)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				types.Sender(t.signer, t.tx)
+			}
+		}()
+	}
+	// Feed the transactions to the workers in block order until done or aborted
+	go func() {
+		defer func() {
+			close(tasks)
+			wg.Wait()
+			metrics.ChainSenderTime.Inc(int64(time.Since(start)))
+		}()
+		for _, block := range blocks {
+			signer := config.GetSigner(block.Number())
+			for _, tx := range block.Transactions() {
+				select {
+				case tasks <- task{signer, tx}:
+					metrics.ChainSenderTxs.Mark(1)
+				case <-abort:
+					return
+				}
+			}
+		}
+	}()
+	return abort
+}
+
+// prefetchMessage is a transaction executed by the state prefetcher, with its
+// sender resolved beforehand so that the transaction itself, possibly being
+// processed concurrently, isn't modified.
+type prefetchMessage struct {
+	*types.Transaction
+	from common.Address
+}
+
+func (m prefetchMessage) From() (common.Address, error) {
+	return m.from, nil
+}
+
+// prefetchState speculatively executes the transactions of a block on top of the
+// given state, which is thrown away, to pull the state the block is going to
+// access into the caches of the state database and the disk. The given state is
+// usually not the parent state of the block but the one of the block before it,
+// being processed at the same time. Execution stops once interrupt is set.
+func prefetchState(config *ChainConfig, bc *BlockChain, block *types.Block, statedb *state.StateDB, interrupt *uint32) {
+	var (
+		start  = time.Now()
+		header = block.Header()
+		gp     = new(GasPool).AddGas(block.GasLimit())
+		signer = config.GetSigner(block.Number())
+	)
+	for i, tx := range block.Transactions() {
+		if atomic.LoadUint32(interrupt) == 1 {
+			metrics.ChainPrefetchInterrupts.Mark(1)
+			return
+		}
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			return
+		}
+		msg := prefetchMessage{tx, from}
+		statedb.StartRecord(tx.Hash(), block.Hash(), i)
+		// Transactions invalid on the stale state, eg. following one of the same
+		// sender in the previous block, are skipped
+		if _, _, _, err := ApplyMessage(NewEnv(statedb, config, bc, msg, header), msg, gp); err != nil {
+			continue
+		}
+		// Carry on from the state of the transaction, without hashing it
+		statedb.Finalise(false)
+	}
+	metrics.ChainPrefetchBlocks.Mark(1)
+	metrics.ChainPrefetchTime.Inc(int64(time.Since(start)))
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+)
+
+// Tests that the state prefetcher executes the transactions of a block on the
+// given state, skipping the ones invalid on it, and can be interrupted.
+func TestPrefetchState(t *testing.T) {
+	key1, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	key2, _ := crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	var (
+		addr1    = crypto.PubkeyToAddress(key1.PublicKey)
+		addr2    = crypto.PubkeyToAddress(key2.PublicKey)
+		signer   = types.NewChainIdSigner(big.NewInt(63))
+		config   = MakeDiehardChainConfig()
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr1, big.NewInt(1000000)}, GenesisAccount{addr2, big.NewInt(1000000)})
+	WriteGenesisBlockForTesting(gendb, GenesisAccount{addr1, big.NewInt(1000000)}, GenesisAccount{addr2, big.NewInt(1000000)})
+
+	// Both blocks send value from the first account, the second block also from
+	// the second account.
+	blocks, _ := GenerateChain(config, genesis, gendb, 2, func(i int, gen *BlockGen) {
+		for j, key := range []*ecdsa.PrivateKey{key1, key2}[:i+1] {
+			tx, err := types.NewTransaction(gen.TxNonce(crypto.PubkeyToAddress(key.PublicKey)), common.BigToAddress(big.NewInt(int64(0x1000+j))), big.NewInt(1000), TxGas, nil, nil).WithSigner(signer).SignECDSA(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gen.AddTx(tx)
+		}
+	})
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blockchain.Stop()
+
+	// Prefetch the second block on the genesis state: the transaction of the
+	// first account fails on its nonce, the one of the second account doesn't.
+	statedb, err := state.New(genesis.Root(), state.NewDatabase(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefetchState(config, blockchain, blocks[1], statedb, new(uint32))
+	if balance := statedb.GetBalance(common.BigToAddress(big.NewInt(0x1000))); balance.Sign() != 0 {
+		t.Errorf("balance of first recipient mismatch: have %v, want 0", balance)
+	}
+	if balance := statedb.GetBalance(common.BigToAddress(big.NewInt(0x1001))); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("balance of second recipient mismatch: have %v, want 1000", balance)
+	}
+
+	// An interrupted prefetching executes nothing.
+	statedb, _ = state.New(blocks[0].Root(), state.NewDatabase(gendb))
+	interrupt := uint32(1)
+	prefetchState(config, blockchain, blocks[1], statedb, &interrupt)
+	if balance := statedb.GetBalance(common.BigToAddress(big.NewInt(0x1000))); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("balance of first recipient mismatch: have %v, want 1000", balance)
+	}
+
+	// The chain is imported with the prefetching and sender recovery running.
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+}
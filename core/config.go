@@ -47,6 +47,7 @@ import (
 var (
 	ErrChainConfigNotFound     = errors.New("chain config not found")
 	ErrChainConfigForkNotFound = errors.New("chain config fork not found")
+	ErrChainConfigReload       = errors.New("chain config forks changed")
 
 	ErrInvalidChainID = errors.New("invalid chainID")
 
@@ -101,6 +102,7 @@ type SufficientChainConfig struct {
 	Consensus       string           `json:"consensus"` // pow type (ethash OR ethash-test)
 	Genesis         *GenesisDump     `json:"genesis"`
 	ChainConfig     *ChainConfig     `json:"chainConfig"`
+	Checkpoint      *Checkpoint      `json:"checkpoint,omitempty"` // trusted block fast sync starts from, if any
 	Bootstrap       []string         `json:"bootstrap"`
 	ParsedBootstrap []*discover.Node `json:"-"`
 	Include         []string         `json:"include"` // config files to include
@@ -111,6 +113,15 @@ type StateConfig struct {
 	StartingNonce uint64 `json:"startingNonce,omitempty"`
 }
 
+// Checkpoint is a trusted block of the chain. Peers whose chain doesn't contain
+// it are refused for synchronisation, and the headers below it are imported
+// without verifying their proof-of-work.
+type Checkpoint struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+	TD     *big.Int    `json:"td"` // total difficulty of the chain up to and including the block
+}
+
 // GenesisDump is the geth JSON format.
 // https://github.com/ethereumproject/wiki/wiki/Ethereum-Chain-Spec-Format#subformat-genesis
 type GenesisDump struct {
@@ -149,7 +160,8 @@ type ChainConfig struct {
 	Forks Forks `json:"forks"`
 
 	// BadHashes holds well known blocks with consensus issues. See ErrHashKnownBad.
-	BadHashes []*BadHash `json:"badHashes"`
+	BadHashes     []*BadHash `json:"badHashes"`
+	badHashesLock sync.RWMutex
 }
 
 type Fork struct {
@@ -185,6 +197,7 @@ type ForkFeature struct {
 	optionsLock       sync.RWMutex
 	ParsedOptions     map[string]interface{} `json:"-"` // don't include in JSON dumps, since its for holding parsed JSON in mem
 	parsedOptionsLock sync.RWMutex
+	precompiled       map[bool]map[string]*vm.PrecompiledAccount // parsed "precompiles" options by byzantium, see ChainConfig#Precompiled
 	// TODO Derive Oracle contracts from fork struct (Version, Registrar, Release)
 }
 
@@ -239,6 +252,31 @@ func (c *SufficientChainConfig) IsValid() (string, bool) {
 		return "forks", false
 	}
 
+	if cp := c.Checkpoint; cp != nil {
+		if cp.Number == 0 {
+			return "checkpoint.number", false
+		}
+		if cp.Hash == (common.Hash{}) {
+			return "checkpoint.hash", false
+		}
+		if cp.TD == nil || cp.TD.Sign() <= 0 {
+			return "checkpoint.td", false
+		}
+	}
+
+	for _, fork := range c.ChainConfig.Forks {
+		for _, feat := range fork.Features {
+			if feat.ID != "precompiles" {
+				continue
+			}
+			for _, byzantium := range []bool{false, true} {
+				if _, err := feat.precompiledContracts(byzantium); err != nil {
+					return fmt.Sprintf("forks.features.precompiles at block %v: %v", fork.Block, err), false
+				}
+			}
+		}
+	}
+
 	return "", true
 }
 
@@ -306,6 +344,14 @@ func (c *ChainConfig) IsHomestead(num *big.Int) bool {
 	return num.Cmp(c.ForkByName("Homestead").Block) >= 0
 }
 
+// IsByzantium returns whether num is at or after the block of the "byzantium"
+// feature, enabling the byzantium opcodes, precompiled contracts and receipt
+// status codes.
+func (c *ChainConfig) IsByzantium(num *big.Int) bool {
+	_, _, configured := c.GetFeature(num, "byzantium")
+	return configured
+}
+
 // IsDiehard returns whether num is greater than or equal to the Diehard block, but less than explosion.
 func (c *ChainConfig) IsDiehard(num *big.Int) bool {
 	fork := c.ForkByName("Diehard")
@@ -402,6 +448,9 @@ func (c *ChainConfig) HeaderCheck(h *types.Header) error {
 		}
 	}
 
+	c.badHashesLock.RLock()
+	defer c.badHashesLock.RUnlock()
+
 	for _, bad := range c.BadHashes {
 		if bad.Block.Cmp(h.Number) != 0 {
 			continue
@@ -414,6 +463,24 @@ func (c *ChainConfig) HeaderCheck(h *types.Header) error {
 	return nil
 }
 
+// SetBadHashes replaces the bad hashes of a chain configuration in use.
+func (c *ChainConfig) SetBadHashes(bad []*BadHash) {
+	c.badHashesLock.Lock()
+	defer c.badHashesLock.Unlock()
+
+	c.BadHashes = bad
+}
+
+// CheckReload checks that the chain configuration next can replace c while
+// in use, i.e. that they configure the same forks with the same features.
+func (c *ChainConfig) CheckReload(next *ChainConfig) error {
+	lines := diffForks(c, next)
+	if len(lines) > 0 {
+		return fmt.Errorf("%v: %s", ErrChainConfigReload, strings.Join(lines, "; "))
+	}
+	return nil
+}
+
 // GetLatestRequiredHash returns the latest requiredHash from chain config for a given blocknumber n (eg. bc head).
 // It does NOT depend on forks being sorted.
 func (c *ChainConfig) GetLatestRequiredHashFork(n *big.Int) (f *Fork) {
@@ -467,6 +534,26 @@ func (c *ChainConfig) GasTable(num *big.Int) *vm.GasTable {
 	}
 }
 
+// Precompiled returns the precompiled contracts at the given block, keyed by
+// address: the default ones, along with the byzantium ones after the
+// "byzantium" feature, unless changed by a "precompiles" feature.
+// The returned contracts shouldn't, under any circumstances, be changed.
+func (c *ChainConfig) Precompiled(num *big.Int) map[string]*vm.PrecompiledAccount {
+	byzantium := c.IsByzantium(num)
+	f, _, configured := c.GetFeature(num, "precompiles")
+	if !configured {
+		if byzantium {
+			return vm.PrecompiledByzantium
+		}
+		return vm.Precompiled
+	}
+	contracts, err := f.precompiledContracts(byzantium)
+	if err != nil {
+		panic(fmt.Errorf("Unsupported precompiles value at block: %v: %v", num, err))
+	}
+	return contracts
+}
+
 // WriteToJSONFile writes a given config to a specified file path.
 // It doesn't run any checks on the file path so make sure that's already squeaky clean.
 func (c *SufficientChainConfig) WriteToJSONFile(path string) error {
@@ -531,6 +618,22 @@ func parseAllocationFile(config *SufficientChainConfig, open func(string) (io.Re
 }
 
 func parseExternalChainConfig(mainConfigFile string, open func(string) (io.ReadCloser, error)) (*SufficientChainConfig, error) {
+	config, err := decodeExternalChainConfig(mainConfigFile, open)
+	if err != nil {
+		return nil, err
+	}
+
+	if invalid, ok := config.IsValid(); !ok {
+		return nil, fmt.Errorf("Invalid chain configuration file. Please check the existence and integrity of keys and values for: %v", invalid)
+	}
+
+	config.ChainConfig = config.ChainConfig.SortForks()
+	return config, nil
+}
+
+// decodeExternalChainConfig reads a chain configuration file along with the
+// files it includes, without validating it nor sorting its forks.
+func decodeExternalChainConfig(mainConfigFile string, open func(string) (io.ReadCloser, error)) (*SufficientChainConfig, error) {
 	var config = &SufficientChainConfig{}
 	var processed []string
 
@@ -601,35 +704,57 @@ func parseExternalChainConfig(mainConfigFile string, open func(string) (io.ReadC
 	// Parse bootstrap nodes
 	config.ParsedBootstrap = ParseBootstrapNodeStrings(config.Bootstrap)
 
-	if invalid, ok := config.IsValid(); !ok {
-		return nil, fmt.Errorf("Invalid chain configuration file. Please check the existence and integrity of keys and values for: %v", invalid)
-	}
-
-	config.ChainConfig = config.ChainConfig.SortForks()
 	return config, nil
 }
 
-// ReadExternalChainConfigFromFile reads a flagged external json file for blockchain configuration.
-// It returns a valid and full ("hard") configuration or an error.
-func ReadExternalChainConfigFromFile(incomingPath string) (*SufficientChainConfig, error) {
+// cleanExternalChainConfigPath cleans the path of an external chain
+// configuration file and ensures it exists and is not a directory.
+func cleanExternalChainConfigPath(incomingPath string) (string, error) {
 
 	// ensure flag arg cleanliness
 	flaggedExternalChainConfigPath := filepath.Clean(incomingPath)
 
 	// ensure file exists and that it is NOT a directory
 	if info, err := os.Stat(flaggedExternalChainConfigPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("ERROR: No existing chain configuration file found at: %s", flaggedExternalChainConfigPath)
+		return "", fmt.Errorf("ERROR: No existing chain configuration file found at: %s", flaggedExternalChainConfigPath)
 	} else if info.IsDir() {
-		return nil, fmt.Errorf("ERROR: Specified configuration file cannot be a directory: %s", flaggedExternalChainConfigPath)
+		return "", fmt.Errorf("ERROR: Specified configuration file cannot be a directory: %s", flaggedExternalChainConfigPath)
+	}
+	return flaggedExternalChainConfigPath, nil
+}
+
+// ReadExternalChainConfigFromFile reads a flagged external json file for blockchain configuration.
+// It returns a valid and full ("hard") configuration or an error.
+func ReadExternalChainConfigFromFile(incomingPath string) (*SufficientChainConfig, error) {
+	path, err := cleanExternalChainConfigPath(incomingPath)
+	if err != nil {
+		return nil, err
 	}
 
-	config, err := parseExternalChainConfig(flaggedExternalChainConfigPath, func(path string) (io.ReadCloser, error) { return os.Open(path) })
+	config, err := parseExternalChainConfig(path, func(path string) (io.ReadCloser, error) { return os.Open(path) })
 	if err != nil {
 		return nil, err
 	}
 	return config, nil
 }
 
+// ValidateExternalChainConfigFile reads an external json file for blockchain
+// configuration as written, forks unsorted, and deeply validates it.
+// It returns an error if the file cannot be read, and the problems found by
+// SufficientChainConfig#Validate otherwise.
+func ValidateExternalChainConfigFile(incomingPath string) ([]error, error) {
+	path, err := cleanExternalChainConfigPath(incomingPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := decodeExternalChainConfig(path, func(path string) (io.ReadCloser, error) { return os.Open(path) })
+	if err != nil {
+		return nil, err
+	}
+	return config.Validate(), nil
+}
+
 // ParseBootstrapNodeStrings is a helper function to parse stringified bs nodes, ie []"enode://e809c4a2fec7daed400e5e28564e23693b23b2cc5a019b612505631bbe7b9ccf709c1796d2a3d29ef2b045f210caf51e3c4f5b6d3587d43ad5d6397526fa6179@174.112.32.157:30303",...
 // to usable Nodes. It takes a slice of strings and returns a slice of Nodes.
 func ParseBootstrapNodeStrings(nodeStrings []string) []*discover.Node {
@@ -728,6 +853,114 @@ func (o *ForkFeature) GetBigInt(name string) (*big.Int, bool) {
 	return nil, false
 }
 
+// precompiledContracts returns the precompiled contracts of a "precompiles"
+// feature. Its options are keyed by the names of the built-in contracts, each
+// one changing the default one with the following options:
+//
+//	"enabled": false to remove the contract, true to add a byzantium one
+//	"address": the address to move the contract to
+//	"base", "word": the gas price, base plus word for every 32 bytes of input
+//
+// Contracts not named keep their default address and price. The byzantium
+// ones are only there by default after the byzantium feature.
+func (o *ForkFeature) precompiledContracts(byzantium bool) (map[string]*vm.PrecompiledAccount, error) {
+	o.parsedOptionsLock.Lock()
+	defer o.parsedOptionsLock.Unlock()
+
+	if contracts, ok := o.precompiled[byzantium]; ok {
+		return contracts, nil
+	}
+
+	o.optionsLock.RLock()
+	defer o.optionsLock.RUnlock()
+
+	specs := vm.ByzantiumPrecompiledSpecs()
+	defaults := len(vm.DefaultPrecompiledSpecs())
+	for name := range o.Options {
+		found := false
+		for _, spec := range specs {
+			found = found || spec.Name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown precompiled contract %q", name)
+		}
+	}
+	var enabled []*vm.PrecompiledSpec
+	for i, spec := range specs {
+		on := byzantium || i < defaults
+		raw, ok := o.Options[spec.Name]
+		if !ok {
+			if on {
+				enabled = append(enabled, spec)
+			}
+			continue
+		}
+		options, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: options must be an object", spec.Name)
+		}
+		for key, value := range options {
+			var err error
+			switch key {
+			case "enabled":
+				var ok bool
+				if on, ok = value.(bool); !ok {
+					err = fmt.Errorf("must be a boolean")
+				}
+			case "address":
+				if str, ok := value.(string); !ok || !common.IsHexAddress(str) {
+					err = fmt.Errorf("must be a hex address")
+				} else {
+					spec.Address = common.HexToAddress(str)
+				}
+			case "base":
+				spec.Base, err = parsePrecompiledGas(value)
+			case "word":
+				spec.Word, err = parsePrecompiledGas(value)
+			default:
+				err = fmt.Errorf("unknown option")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", spec.Name, key, err)
+			}
+		}
+		if on {
+			enabled = append(enabled, spec)
+		}
+	}
+	contracts, err := vm.NewPrecompiledContracts(enabled)
+	if err != nil {
+		return nil, err
+	}
+	if o.precompiled == nil {
+		o.precompiled = make(map[bool]map[string]*vm.PrecompiledAccount)
+	}
+	o.precompiled[byzantium] = contracts
+	return contracts, nil
+}
+
+// parsePrecompiledGas parses a gas price option of a "precompiles" feature,
+// a JSON number or a decimal or hex string.
+func parsePrecompiledGas(value interface{}) (*big.Int, error) {
+	var gas *big.Int
+	switch v := value.(type) {
+	case float64:
+		if v == float64(int64(v)) {
+			gas = big.NewInt(int64(v))
+		}
+	case int:
+		gas = big.NewInt(int64(v))
+	case int64:
+		gas = big.NewInt(v)
+	case string:
+		gas, _ = new(big.Int).SetString(v, 0)
+	}
+	if gas == nil || gas.Sign() < 0 {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	return gas, nil
+}
+
 // WriteGenesisBlock writes the genesis block to the database as block number 0
 func WriteGenesisBlock(chainDb ethdb.Database, genesis *GenesisDump) (*types.Block, error) {
 	statedb, err := state.New(common.Hash{}, state.NewDatabase(chainDb))
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"encoding/json"
 	"io"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"strings"
@@ -11,6 +13,7 @@ import (
 
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/core/vm"
 	"github.com/ethereumproject/go-ethereum/ethdb"
 	"reflect"
 )
@@ -631,6 +634,117 @@ func TestChainConfig_GetSigner(t *testing.T) {
 
 }
 
+func TestChainConfig_Precompiled(t *testing.T) {
+	var c ChainConfig
+	if err := json.Unmarshal([]byte(`{"forks": [{
+		"name": "Precompiles",
+		"block": 10,
+		"features": [{
+			"id": "precompiles",
+			"options": {
+				"sha256": {"base": 100, "word": "0x20"},
+				"ripemd160": {"enabled": false},
+				"identity": {"address": "0x0000000000000000000000000000000000000100"}
+			}
+		}]
+	}]}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	addr := func(b ...byte) string { return common.BytesToAddress(b).Str() }
+
+	if contracts := c.Precompiled(big.NewInt(9)); !reflect.DeepEqual(contracts, vm.Precompiled) {
+		t.Errorf("default contracts expected before the fork, got %v", contracts)
+	}
+	contracts := c.Precompiled(big.NewInt(10))
+	if len(contracts) != 3 {
+		t.Errorf("contract count mismatch: have %d, want 3", len(contracts))
+	}
+	if gas := contracts[addr(1)].Gas(make([]byte, 64)); gas.Cmp(big.NewInt(3000)) != 0 {
+		t.Errorf("ecrecover gas mismatch: have %v, want 3000", gas)
+	}
+	if gas := contracts[addr(2)].Gas(make([]byte, 64)); gas.Cmp(big.NewInt(100+2*32)) != 0 {
+		t.Errorf("sha256 gas mismatch: have %v, want %v", gas, 100+2*32)
+	}
+	if contracts[addr(3)] != nil {
+		t.Error("disabled ripemd160 found")
+	}
+	if contracts[addr(4)] != nil || contracts[addr(1, 0)] == nil {
+		t.Error("identity not relocated")
+	}
+	if out, err := contracts[addr(1, 0)].Call([]byte{42}); err != nil || !reflect.DeepEqual(out, []byte{42}) {
+		t.Errorf("relocated identity output mismatch: have %x, want 2a", out)
+	}
+
+	for _, options := range []string{
+		`{"sha3": {}}`,
+		`{"sha256": {"base": -1}}`,
+		`{"sha256": {"word": 1.5}}`,
+		`{"sha256": {"enabled": "no"}}`,
+		`{"sha256": {"address": "0x01"}}`,
+		`{"sha256": {"address": "0x0000000000000000000000000000000000000001"}}`,
+		`{"sha256": {"gas": 1}}`,
+		`{"sha256": true}`,
+	} {
+		feat := &ForkFeature{ID: "precompiles"}
+		if err := json.Unmarshal([]byte(options), &feat.Options); err != nil {
+			t.Fatal(err)
+		}
+		scc := makeOKSufficientChainConfig(DefaultConfigMainnet.Genesis, &ChainConfig{Forks: []*Fork{{Block: big.NewInt(10), Features: []*ForkFeature{feat}}}})
+		if _, ok := scc.IsValid(); ok {
+			t.Errorf("invalid options %s accepted", options)
+		}
+	}
+}
+
+func TestChainConfig_Byzantium(t *testing.T) {
+	var c ChainConfig
+	if err := json.Unmarshal([]byte(`{"forks": [{
+		"name": "Byzantium",
+		"block": 10,
+		"features": [{"id": "byzantium"}]
+	}, {
+		"name": "Reprice",
+		"block": 20,
+		"features": [{
+			"id": "precompiles",
+			"options": {
+				"bn256Pairing": {"enabled": false},
+				"modexp": {"word": 2}
+			}
+		}]
+	}]}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	addr := func(b ...byte) string { return common.BytesToAddress(b).Str() }
+
+	if c.IsByzantium(big.NewInt(9)) || !c.IsByzantium(big.NewInt(10)) || !c.IsByzantium(big.NewInt(20)) {
+		t.Error("byzantium activation mismatch")
+	}
+	if contracts := c.Precompiled(big.NewInt(9)); !reflect.DeepEqual(contracts, vm.Precompiled) {
+		t.Errorf("default contracts expected before byzantium, got %v", contracts)
+	}
+	if contracts := c.Precompiled(big.NewInt(10)); !reflect.DeepEqual(contracts, vm.PrecompiledByzantium) {
+		t.Errorf("byzantium contracts expected, got %v", contracts)
+	}
+
+	contracts := c.Precompiled(big.NewInt(20))
+	if len(contracts) != 7 {
+		t.Errorf("contract count mismatch: have %d, want 7", len(contracts))
+	}
+	if contracts[addr(8)] != nil {
+		t.Error("disabled bn256Pairing found")
+	}
+	// 1-byte base and modulus, exponent 0x010000: adjusted exponent length 16
+	input := common.FromHex("0x" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0301000007")
+	if gas := contracts[addr(5)].Gas(input); gas.Cmp(big.NewInt(16/2)) != 0 {
+		t.Errorf("modexp gas mismatch: have %v, want %v", gas, 16/2)
+	}
+}
+
 func TestResolvePath(t *testing.T) {
 	cases := []struct {
 		args []string
@@ -842,6 +956,233 @@ func TestSufficientChainConfig_IsValid(t *testing.T) {
 	}
 }
 
+func TestSufficientChainConfig_Validate(t *testing.T) {
+	// other tests change the default configurations, parse them again
+	for _, path := range []string{"/core/config/mainnet.json", "/core/config/morden.json"} {
+		config, err := parseExternalChainConfig(path, assetsOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := config.Validate(); len(errs) != 0 {
+			t.Errorf("%s: unexpected errors: %v", path, errs)
+		}
+	}
+
+	tests := []struct {
+		change func(c *SufficientChainConfig)
+		want   string
+	}{
+		{func(c *SufficientChainConfig) { c.Network = 0 }, "missing or invalid: networkId"},
+		{func(c *SufficientChainConfig) { c.Bootstrap = append(c.Bootstrap, "enode://1234@127.0.0.1:30303") }, "invalid node ID"},
+		{func(c *SufficientChainConfig) {
+			c.Genesis.Alloc["0102"] = &GenesisDumpAlloc{Balance: "1"}
+		}, "genesis: malformed addres"},
+		{func(c *SufficientChainConfig) {
+			c.Genesis.Alloc["0000000000000000000000000000000000000001"] = &GenesisDumpAlloc{Balance: "one"}
+		}, "genesis: malformed account"},
+		{func(c *SufficientChainConfig) { c.ChainConfig.Forks[1].Name = c.ChainConfig.Forks[0].Name }, `forks[1] "Homestead": duplicate name`},
+		{func(c *SufficientChainConfig) {
+			c.ChainConfig.Forks[0], c.ChainConfig.Forks[1] = c.ChainConfig.Forks[1], c.ChainConfig.Forks[0]
+		}, `forks[1] "Homestead": block 494000 before block 1783000 of the previous fork "GasReprice"`},
+		{func(c *SufficientChainConfig) { c.ChainConfig.Forks[0].Block = nil }, `forks[0] "Homestead": missing block`},
+		{func(c *SufficientChainConfig) {
+			c.ChainConfig.Forks[0].Block = new(big.Int)
+			c.ChainConfig.Forks[0].RequiredHash = common.HexToHash("0x01")
+		}, "is not the genesis hash"},
+		{func(c *SufficientChainConfig) {
+			c.ChainConfig.Forks[0].Features[0].Options["type"] = "ecip1010"
+		}, `feature "difficulty": option "length" must be a positive integer`},
+		{func(c *SufficientChainConfig) {
+			c.ChainConfig.Forks[0].Features[1].Options["type"] = 150
+		}, `feature "gastable": missing string option "type"`},
+		{func(c *SufficientChainConfig) {
+			c.ChainConfig.Forks[0].Features = append(c.ChainConfig.Forks[0].Features, &ForkFeature{ID: "eip155", Options: ChainFeatureConfigOptions{"chainID": "sixty"}})
+		}, `feature "eip155": option "chainID" must be a positive integer`},
+		{func(c *SufficientChainConfig) {
+			c.ChainConfig.Forks[0].Features = append(c.ChainConfig.Forks[0].Features, &ForkFeature{ID: "gastable", Options: ChainFeatureConfigOptions{"type": "eip150"}})
+		}, `duplicate feature "gastable"`},
+		{func(c *SufficientChainConfig) {
+			c.ChainConfig.Forks[0].Features = append(c.ChainConfig.Forks[0].Features, &ForkFeature{ID: "eip999"})
+		}, `feature "eip999": unknown feature`},
+		{func(c *SufficientChainConfig) {
+			c.ChainConfig.Forks[0].Features = append(c.ChainConfig.Forks[0].Features, &ForkFeature{ID: "precompiles", Options: ChainFeatureConfigOptions{"sha3": map[string]interface{}{}}})
+		}, `feature "precompiles"`},
+		{func(c *SufficientChainConfig) {
+			c.ChainConfig.BadHashes = []*BadHash{{Hash: common.HexToHash("0x01")}}
+		}, "badHashes[0]: missing block"},
+		{func(c *SufficientChainConfig) {
+			c.Checkpoint = &Checkpoint{Number: 100, TD: big.NewInt(1)}
+		}, "missing or invalid: checkpoint.hash"},
+		{func(c *SufficientChainConfig) {
+			c.Checkpoint = &Checkpoint{Number: 100, Hash: common.HexToHash("0x01")}
+		}, "missing or invalid: checkpoint.td"},
+	}
+	for i, test := range tests {
+		config, err := parseExternalChainConfig("/core/config/morden.json", assetsOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.change(config)
+
+		errs := config.Validate()
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err.Error(), test.want)
+		}
+		if !found {
+			t.Errorf("test %d: expected error containing %q, got %v", i, test.want, errs)
+		}
+	}
+}
+
+func TestValidateExternalChainConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chain-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config, err := parseExternalChainConfig("/core/config/morden.json", assetsOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "morden.json")
+	if err := config.WriteToJSONFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if errs, err := ValidateExternalChainConfigFile(path); err != nil || len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v, %v", err, errs)
+	}
+
+	// forks out of order are reported as written
+	config.ChainConfig.Forks[0], config.ChainConfig.Forks[1] = config.ChainConfig.Forks[1], config.ChainConfig.Forks[0]
+	if err := config.WriteToJSONFile(path); err != nil {
+		t.Fatal(err)
+	}
+	errs, err := ValidateExternalChainConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "before block") {
+		t.Errorf("expected a fork order error, got %v", errs)
+	}
+
+	if _, err := ValidateExternalChainConfigFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestDiffChainConfigs(t *testing.T) {
+	a, err := parseExternalChainConfig("/core/config/morden.json", assetsOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := parseExternalChainConfig("/core/config/morden.json", assetsOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := DiffChainConfigs(a, b); len(lines) != 0 {
+		t.Errorf("expected no differences, got %v", lines)
+	}
+
+	b.Network = 3
+	b.Bootstrap = b.Bootstrap[1:]
+	b.Genesis.Alloc["0000000000000000000000000000000000000fff"] = &GenesisDumpAlloc{Balance: "1"}
+	b.ChainConfig.Forks[0].Block = big.NewInt(500000)
+	b.ChainConfig.Forks[1].Features[0].Options["type"] = "eip160"
+	b.ChainConfig.Forks[2].Features = append(b.ChainConfig.Forks[2].Features, &ForkFeature{ID: "byzantium"})
+	b.ChainConfig.Forks = append(b.ChainConfig.Forks[:3], b.ChainConfig.Forks[4:]...)
+	b.ChainConfig.Forks = append(b.ChainConfig.Forks, &Fork{Name: "Atlantis", Block: big.NewInt(5000000), Features: []*ForkFeature{{ID: "byzantium"}}})
+
+	want := []string{
+		"~ network: 2 -> 3",
+		"~ genesis.alloc: 0 accounts removed, 1 added, 0 changed",
+		"- bootstrap " + a.Bootstrap[0],
+		`~ fork "Homestead" block: 494000 -> 500000`,
+		`~ fork "GasReprice" feature "gastable": {"type":"eip150"} -> {"type":"eip160"}`,
+		`+ fork "The DAO Hard Fork" feature "byzantium" {}`,
+		`- fork "Diehard" at block 1915000`,
+		`+ fork "Atlantis" at block 5000000`,
+		`+ fork "Atlantis" feature "byzantium" {}`,
+	}
+	if lines := DiffChainConfigs(a, b); !reflect.DeepEqual(lines, want) {
+		t.Errorf("diff mismatch:\nhave %q\nwant %q", lines, want)
+	}
+}
+
+func TestChainConfig_CheckReload(t *testing.T) {
+	a, err := parseExternalChainConfig("/core/config/morden.json", assetsOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := parseExternalChainConfig("/core/config/morden.json", assetsOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ChainConfig.BadHashes = append(b.ChainConfig.BadHashes, &BadHash{Block: big.NewInt(100), Hash: common.HexToHash("0x1234")})
+	if err := a.ChainConfig.CheckReload(b.ChainConfig); err != nil {
+		t.Errorf("unexpected error for changed bad hashes: %v", err)
+	}
+
+	b.ChainConfig.Forks[0].Block = big.NewInt(500000)
+	err = a.ChainConfig.CheckReload(b.ChainConfig)
+	if err == nil || !strings.HasPrefix(err.Error(), ErrChainConfigReload.Error()) {
+		t.Errorf("got error %v, want %v", err, ErrChainConfigReload)
+	}
+}
+
+func TestChainConfig_ForkID(t *testing.T) {
+	genesis := common.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3")
+	config := &ChainConfig{Forks: Forks{
+		{Name: "C", Block: big.NewInt(20)},
+		{Name: "Genesis", Block: big.NewInt(0)},
+		{Name: "A", Block: big.NewInt(10)},
+		{Name: "B", Block: big.NewInt(20)},
+	}}
+	sums := forkChecksums(genesis, []uint64{10, 20})
+
+	ids := []struct {
+		head uint64
+		want ForkID
+	}{
+		{0, ForkID{Hash: sums[0], Next: 10}},
+		{9, ForkID{Hash: sums[0], Next: 10}},
+		{10, ForkID{Hash: sums[1], Next: 20}},
+		{20, ForkID{Hash: sums[2], Next: 0}},
+		{1000, ForkID{Hash: sums[2], Next: 0}},
+	}
+	for i, tt := range ids {
+		if have := config.ForkID(genesis, tt.head); have != tt.want {
+			t.Errorf("test %d: fork ID mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+
+	checks := []struct {
+		head uint64
+		id   ForkID
+		err  error
+	}{
+		// Same fork state, next fork known or not.
+		{15, ForkID{Hash: sums[1], Next: 20}, nil},
+		{15, ForkID{Hash: sums[1], Next: 0}, nil},
+		// Same fork state, but remote announces a fork we already passed.
+		{25, ForkID{Hash: sums[2], Next: 22}, ErrLocalIncompatibleOrStale},
+		// Remote still syncing, before a fork we passed.
+		{25, ForkID{Hash: sums[0], Next: 10}, nil},
+		// Remote before a fork we passed, but unaware of it.
+		{25, ForkID{Hash: sums[1], Next: 0}, ErrRemoteStale},
+		// Remote ahead of us.
+		{5, ForkID{Hash: sums[2], Next: 0}, nil},
+		// Unknown checksum.
+		{5, ForkID{Hash: [4]byte{0xde, 0xad, 0xbe, 0xef}}, ErrLocalIncompatibleOrStale},
+	}
+	for i, tt := range checks {
+		if err := config.CheckForkID(genesis, tt.head, tt.id); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
 func TestGenesisAllocationError(t *testing.T) {
 	_, err := parseExternalChainConfig("testdata/test.json", func(path string) (io.ReadCloser, error) { return os.Open(path) })
 	if err == nil {
@@ -0,0 +1,430 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/p2p/discover"
+)
+
+// Validate deeply checks a chain configuration. On top of IsValid, it checks
+// the genesis allocation, the bootstrap node URLs, the order and names of the
+// forks, the options of their features, and the required and bad hashes.
+// It returns every problem found, nil if none.
+func (c *SufficientChainConfig) Validate() []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if invalid, ok := c.IsValid(); !ok {
+		fail("missing or invalid: %s", invalid)
+	}
+
+	// the genesis block is built from scratch, parsing the whole allocation
+	var genesisHash common.Hash
+	if c.Genesis != nil {
+		db, _ := ethdb.NewMemDatabase()
+		if block, err := WriteGenesisBlock(db, c.Genesis); err != nil {
+			fail("genesis: %v", err)
+		} else {
+			genesisHash = block.Hash()
+		}
+	}
+
+	for i, url := range c.Bootstrap {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		if _, err := discover.ParseNode(url); err != nil {
+			fail("bootstrap[%d] %q: %v", i, url, err)
+		}
+	}
+
+	if c.ChainConfig != nil {
+		errs = append(errs, c.ChainConfig.validate(genesisHash)...)
+	}
+	return errs
+}
+
+// validate checks the forks and the bad hashes of a chain configuration. The
+// forks must be listed in chronological order under unique names. A required
+// hash at block 0 must be the given genesis hash, unless empty.
+func (c *ChainConfig) validate(genesisHash common.Hash) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	names := make(map[string]bool)
+	var last *Fork
+	for i, fork := range c.Forks {
+		if fork == nil {
+			fail("forks[%d]: empty", i)
+			continue
+		}
+		where := fmt.Sprintf("forks[%d] %q", i, fork.Name)
+
+		if fork.Name == "" {
+			fail("%s: missing name", where)
+		} else if names[fork.Name] {
+			fail("%s: duplicate name", where)
+		}
+		names[fork.Name] = true
+
+		switch {
+		case fork.Block == nil:
+			fail("%s: missing block", where)
+		case fork.Block.Sign() < 0:
+			fail("%s: negative block %v", where, fork.Block)
+		case last != nil && fork.Block.Cmp(last.Block) < 0:
+			fail("%s: block %v before block %v of the previous fork %q", where, fork.Block, last.Block, last.Name)
+		}
+		if fork.Block != nil {
+			last = fork
+		}
+
+		if fork.Block != nil && fork.Block.Sign() == 0 && !fork.RequiredHash.IsEmpty() &&
+			!genesisHash.IsEmpty() && fork.RequiredHash != genesisHash {
+			fail("%s: required hash %x is not the genesis hash %x", where, fork.RequiredHash, genesisHash)
+		}
+
+		ids := make(map[string]bool)
+		for j, feat := range fork.Features {
+			if feat == nil {
+				fail("%s: features[%d]: empty", where, j)
+				continue
+			}
+			if ids[feat.ID] {
+				fail("%s: duplicate feature %q", where, feat.ID)
+			}
+			ids[feat.ID] = true
+
+			if err := feat.validate(); err != nil {
+				fail("%s: feature %q: %v", where, feat.ID, err)
+			}
+		}
+	}
+
+	for i, bad := range c.BadHashes {
+		if bad == nil {
+			fail("badHashes[%d]: empty", i)
+			continue
+		}
+		if bad.Block == nil {
+			fail("badHashes[%d]: missing block", i)
+		}
+		if bad.Hash.IsEmpty() {
+			fail("badHashes[%d]: missing hash", i)
+		}
+		for _, fork := range c.Forks {
+			if fork == nil || fork.Block == nil || bad.Block == nil || fork.Block.Cmp(bad.Block) != 0 {
+				continue
+			}
+			if !bad.Hash.IsEmpty() && fork.RequiredHash == bad.Hash {
+				fail("badHashes[%d]: hash %x is required by fork %q", i, bad.Hash, fork.Name)
+			}
+		}
+	}
+	return errs
+}
+
+// validate checks the id and the options of a fork feature against the ones
+// supported by the chain configuration.
+func (o *ForkFeature) validate() error {
+	switch o.ID {
+	case "difficulty":
+		typ, ok := o.GetString("type")
+		if !ok {
+			return errors.New(`missing string option "type"`)
+		}
+		switch typ {
+		case "frontier", "homestead", "defused":
+		case "ecip1010":
+			if length, ok := o.GetBigInt("length"); !ok || length.Sign() <= 0 {
+				return errors.New(`option "length" must be a positive integer`)
+			}
+		default:
+			return fmt.Errorf("unsupported type %q", typ)
+		}
+	case "gastable":
+		typ, ok := o.GetString("type")
+		if !ok {
+			return errors.New(`missing string option "type"`)
+		}
+		switch typ {
+		case "homestead", "eip150", "eip160":
+		default:
+			return fmt.Errorf("unsupported type %q", typ)
+		}
+	case "eip155":
+		if chainID, ok := o.GetBigInt("chainID"); !ok || chainID.Sign() <= 0 {
+			return errors.New(`option "chainID" must be a positive integer`)
+		}
+	case "reward":
+		if typ, ok := o.GetString("type"); !ok || typ != "ecip1017" {
+			return errors.New(`option "type" must be "ecip1017"`)
+		}
+		if era, ok := o.GetBigInt("era"); !ok || era.Sign() <= 0 {
+			return errors.New(`option "era" must be a positive integer`)
+		}
+	case "byzantium":
+		o.optionsLock.RLock()
+		defer o.optionsLock.RUnlock()
+
+		if len(o.Options) > 0 {
+			return errors.New("no options expected")
+		}
+	case "precompiles":
+		for _, byzantium := range []bool{false, true} {
+			if _, err := o.precompiledContracts(byzantium); err != nil {
+				return err
+			}
+		}
+	case "":
+		return errors.New("missing id")
+	default:
+		return errors.New("unknown feature")
+	}
+	return nil
+}
+
+// DiffChainConfigs returns the differences between two chain configurations,
+// one line each. Forks are matched by name and their features by id. Lines
+// start with "-" for what only a has, "+" for what only b has and "~" for
+// what changed from a to b. Genesis allocations are only summarized.
+func DiffChainConfigs(a, b *SufficientChainConfig) []string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	changed := func(name string, x, y interface{}) {
+		if !reflect.DeepEqual(x, y) {
+			add("~ %s: %v -> %v", name, x, y)
+		}
+	}
+
+	changed("identity", a.Identity, b.Identity)
+	changed("name", a.Name, b.Name)
+	changed("network", a.Network, b.Network)
+	changed("consensus", a.Consensus, b.Consensus)
+	changed("state.startingNonce", startingNonce(a), startingNonce(b))
+	changed("checkpoint", checkpointString(a), checkpointString(b))
+
+	if a.Genesis != nil && b.Genesis != nil {
+		ga, gb := a.Genesis, b.Genesis
+		changed("genesis.nonce", ga.Nonce, gb.Nonce)
+		changed("genesis.timestamp", ga.Timestamp, gb.Timestamp)
+		changed("genesis.parentHash", ga.ParentHash, gb.ParentHash)
+		changed("genesis.extraData", ga.ExtraData, gb.ExtraData)
+		changed("genesis.gasLimit", ga.GasLimit, gb.GasLimit)
+		changed("genesis.difficulty", ga.Difficulty, gb.Difficulty)
+		changed("genesis.mixhash", ga.Mixhash, gb.Mixhash)
+		changed("genesis.coinbase", ga.Coinbase, gb.Coinbase)
+
+		var onlyA, onlyB, diff int
+		for addr, account := range ga.Alloc {
+			if other, ok := gb.Alloc[addr]; !ok {
+				onlyA++
+			} else if !reflect.DeepEqual(account, other) {
+				diff++
+			}
+		}
+		for addr := range gb.Alloc {
+			if _, ok := ga.Alloc[addr]; !ok {
+				onlyB++
+			}
+		}
+		if onlyA > 0 || onlyB > 0 || diff > 0 {
+			add("~ genesis.alloc: %d accounts removed, %d added, %d changed", onlyA, onlyB, diff)
+		}
+	} else if a.Genesis != nil {
+		add("- genesis")
+	} else if b.Genesis != nil {
+		add("+ genesis")
+	}
+
+	for _, url := range a.Bootstrap {
+		if !containsString(b.Bootstrap, url) {
+			add("- bootstrap %s", url)
+		}
+	}
+	for _, url := range b.Bootstrap {
+		if !containsString(a.Bootstrap, url) {
+			add("+ bootstrap %s", url)
+		}
+	}
+
+	ca, cb := a.ChainConfig, b.ChainConfig
+	if ca == nil {
+		ca = &ChainConfig{}
+	}
+	if cb == nil {
+		cb = &ChainConfig{}
+	}
+	lines = append(lines, diffForks(ca, cb)...)
+
+	for _, bad := range ca.BadHashes {
+		if !containsBadHash(cb.BadHashes, bad) {
+			add("- badHash %x at block %v", bad.Hash, bad.Block)
+		}
+	}
+	for _, bad := range cb.BadHashes {
+		if !containsBadHash(ca.BadHashes, bad) {
+			add("+ badHash %x at block %v", bad.Hash, bad.Block)
+		}
+	}
+	return lines
+}
+
+// diffForks returns the differences between the forks of two chain
+// configurations, see DiffChainConfigs.
+func diffForks(a, b *ChainConfig) []string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	for _, fa := range a.Forks {
+		fb := b.forkByName(fa.Name)
+		if fb == nil {
+			add("- fork %q at block %v", fa.Name, fa.Block)
+			continue
+		}
+		if !sameBlock(fa.Block, fb.Block) {
+			add("~ fork %q block: %v -> %v", fa.Name, fa.Block, fb.Block)
+		}
+		if fa.RequiredHash != fb.RequiredHash {
+			add("~ fork %q requiredHash: %s -> %s", fa.Name, fa.RequiredHash.Hex(), fb.RequiredHash.Hex())
+		}
+		lines = append(lines, diffForkFeatures(fa, fb)...)
+	}
+	for _, fb := range b.Forks {
+		if a.forkByName(fb.Name) == nil {
+			add("+ fork %q at block %v", fb.Name, fb.Block)
+			for _, feat := range fb.Features {
+				add("+ fork %q feature %q %s", fb.Name, feat.ID, featureOptionsString(feat))
+			}
+		}
+	}
+	return lines
+}
+
+// diffForkFeatures returns the differences between the features of two
+// forks of the same name, see DiffChainConfigs.
+func diffForkFeatures(a, b *Fork) []string {
+	var lines []string
+	find := func(feats []*ForkFeature, id string) *ForkFeature {
+		for _, feat := range feats {
+			if feat.ID == id {
+				return feat
+			}
+		}
+		return nil
+	}
+
+	for _, fa := range a.Features {
+		fb := find(b.Features, fa.ID)
+		switch {
+		case fb == nil:
+			lines = append(lines, fmt.Sprintf("- fork %q feature %q %s", a.Name, fa.ID, featureOptionsString(fa)))
+		case featureOptionsString(fa) != featureOptionsString(fb):
+			lines = append(lines, fmt.Sprintf("~ fork %q feature %q: %s -> %s", a.Name, fa.ID, featureOptionsString(fa), featureOptionsString(fb)))
+		}
+	}
+	for _, fb := range b.Features {
+		if find(a.Features, fb.ID) == nil {
+			lines = append(lines, fmt.Sprintf("+ fork %q feature %q %s", b.Name, fb.ID, featureOptionsString(fb)))
+		}
+	}
+	return lines
+}
+
+// forkByName is ForkByName returning nil for a missing fork.
+func (c *ChainConfig) forkByName(name string) *Fork {
+	for _, fork := range c.Forks {
+		if fork.Name == name {
+			return fork
+		}
+	}
+	return nil
+}
+
+// featureOptionsString returns the options of a feature as JSON, keys sorted.
+func featureOptionsString(o *ForkFeature) string {
+	o.optionsLock.RLock()
+	defer o.optionsLock.RUnlock()
+
+	if len(o.Options) == 0 {
+		return "{}"
+	}
+	b, err := json.Marshal(o.Options)
+	if err != nil {
+		return fmt.Sprintf("%v", o.Options)
+	}
+	return string(b)
+}
+
+func startingNonce(c *SufficientChainConfig) uint64 {
+	if c.State == nil {
+		return 0
+	}
+	return c.State.StartingNonce
+}
+
+// checkpointString describes the trusted checkpoint of a chain configuration.
+func checkpointString(c *SufficientChainConfig) string {
+	cp := c.Checkpoint
+	if cp == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%d %x td=%v", cp.Number, cp.Hash, cp.TD)
+}
+
+func sameBlock(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsBadHash(list []*BadHash, bad *BadHash) bool {
+	for _, v := range list {
+		if v.Hash == bad.Hash && sameBlock(v.Block, bad.Block) {
+			return true
+		}
+	}
+	return false
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/bloombits"
 	"github.com/ethereumproject/go-ethereum/core/types"
 	"github.com/ethereumproject/go-ethereum/ethdb"
 	"github.com/ethereumproject/go-ethereum/logger"
@@ -48,10 +49,16 @@ var (
 	mipmapPre    = []byte("mipmap-log-bloom-")
 	MIPMapLevels = []uint64{1000000, 500000, 100000, 50000, 1000}
 
+	bloomBitsPrefix      = []byte("bloomBits-")     // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
+	bloomBitsHeadPrefix  = []byte("bloomBitsHead-") // bloomBitsHeadPrefix + section (uint64 big endian) -> hash of the last block of the section
+	bloomBitsSectionsKey = []byte("BloomBitsSections")
+
 	blockHashPrefix = []byte("block-hash-") // [deprecated by the header/block split, remove eventually]
 
 	preimagePrefix = "secure-key-" // preimagePrefix + hash -> preimage
 	lookupPrefix   = []byte("l")   // lookupPrefix + hash -> transaction/receipt lookup metadata
+
+	importedSegmentPrefix = []byte("imported-segment-") // importedSegmentPrefix + checksum -> hash of the last block of the segment
 )
 
 // TxLookupEntry is a positional metadata to help looking up the data content of
@@ -130,6 +137,30 @@ func GetHeader(db ethdb.Database, hash common.Hash) *types.Header {
 // GetBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func GetBodyRLP(db ethdb.Database, hash common.Hash) rlp.RawValue {
 	data, _ := db.Get(append(append(blockPrefix, hash[:]...), bodySuffix...))
+	if len(data) == 0 {
+		data = readAncient(db, ethdb.FreezerBodies, hash)
+	}
+	return data
+}
+
+// readAncient retrieves ancient chain data of the given kind for the block with the
+// given hash from the freezer of the database, nil if the database has none or the
+// block is not frozen.
+func readAncient(db ethdb.Database, kind string, hash common.Hash) []byte {
+	store, ok := db.(ethdb.AncientStore)
+	if !ok || store.Ancients() == 0 {
+		return nil
+	}
+	header := GetHeader(db, hash)
+	if header == nil {
+		return nil
+	}
+	// only canonical blocks are frozen, make sure this is the one
+	number := header.Number.Uint64()
+	if frozen, err := store.Ancient(ethdb.FreezerHashes, number); err != nil || common.BytesToHash(frozen) != hash {
+		return nil
+	}
+	data, _ := store.Ancient(kind, number)
 	return data
 }
 
@@ -187,6 +218,9 @@ func GetBlock(db ethdb.Database, hash common.Hash) *types.Block {
 // in a block given by its hash.
 func GetBlockReceipts(db ethdb.Database, hash common.Hash) types.Receipts {
 	data, _ := db.Get(append(blockReceiptsPrefix, hash[:]...))
+	if len(data) == 0 {
+		data = readAncient(db, ethdb.FreezerReceipts, hash)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -577,6 +611,66 @@ func GetMipmapBloom(db ethdb.Database, number, level uint64) types.Bloom {
 	return types.BytesToBloom(bloomDat)
 }
 
+func bloomBitsKey(bit uint, section uint64, head common.Hash) []byte {
+	key := append(append([]byte{}, bloomBitsPrefix...), make([]byte, 10)...)
+	binary.BigEndian.PutUint16(key[len(bloomBitsPrefix):], uint16(bit))
+	binary.BigEndian.PutUint64(key[len(bloomBitsPrefix)+2:], section)
+	return append(key, head.Bytes()...)
+}
+
+func bloomBitsHeadKey(section uint64) []byte {
+	key := append(append([]byte{}, bloomBitsHeadPrefix...), make([]byte, 8)...)
+	binary.BigEndian.PutUint64(key[len(bloomBitsHeadPrefix):], section)
+	return key
+}
+
+// WriteBloomBits writes the bit vector of a bloom bit for the section of
+// BloomBitsBlocks blocks ending with the block of the given hash.
+func WriteBloomBits(db ethdb.Putter, bit uint, section uint64, head common.Hash, bits []byte) error {
+	return db.Put(bloomBitsKey(bit, section, head), bloombits.CompressBits(bits))
+}
+
+// GetBloomBits retrieves the bit vector of a bloom bit for the section of
+// BloomBitsBlocks blocks ending with the block of the given hash.
+func GetBloomBits(db ethdb.Database, bit uint, section uint64, head common.Hash) ([]byte, error) {
+	data, err := db.Get(bloomBitsKey(bit, section, head))
+	if err != nil {
+		return nil, fmt.Errorf("bloom bits %d of section %d (head %x) not found", bit, section, head[:4])
+	}
+	return bloombits.DecompressBits(data, int(BloomBitsBlocks/8))
+}
+
+// GetBloomBitsSections returns the number of sections, from genesis, for which the
+// bloom bits have been generated.
+func GetBloomBitsSections(db ethdb.Database) uint64 {
+	data, _ := db.Get(bloomBitsSectionsKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteBloomBitsSections writes the number of sections for which the bloom bits
+// have been generated.
+func WriteBloomBitsSections(db ethdb.Putter, sections uint64) error {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, sections)
+	return db.Put(bloomBitsSectionsKey, data)
+}
+
+// GetBloomBitsHead returns the hash of the last block of a section as it was when
+// its bloom bits were generated.
+func GetBloomBitsHead(db ethdb.Database, section uint64) common.Hash {
+	data, _ := db.Get(bloomBitsHeadKey(section))
+	return common.BytesToHash(data)
+}
+
+// WriteBloomBitsHead writes the hash of the last block of a section for which the
+// bloom bits have been generated.
+func WriteBloomBitsHead(db ethdb.Putter, section uint64, head common.Hash) error {
+	return db.Put(bloomBitsHeadKey(section), head.Bytes())
+}
+
 // GetBlockChainVersion reads the version number from db.
 func GetBlockChainVersion(db ethdb.Database) int {
 	var vsn uint
@@ -590,3 +684,22 @@ func WriteBlockChainVersion(db ethdb.Database, vsn int) {
 	enc, _ := rlp.EncodeToBytes(uint(vsn))
 	db.Put([]byte("BlockchainVersion"), enc)
 }
+
+// GetImportedSegment retrieves the hash of the last block of the imported chain
+// segment file with the given checksum, or the zero hash if not imported.
+func GetImportedSegment(db ethdb.Database, checksum common.Hash) common.Hash {
+	data, _ := db.Get(append(importedSegmentPrefix, checksum.Bytes()...))
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteImportedSegment records the import of the chain segment file with the
+// given checksum, along with the hash of its last block.
+func WriteImportedSegment(db ethdb.Database, checksum, last common.Hash) error {
+	if err := db.Put(append(importedSegmentPrefix, checksum.Bytes()...), last.Bytes()); err != nil {
+		glog.Fatalf("failed to store imported segment into database: %v", err)
+	}
+	return nil
+}
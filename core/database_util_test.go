@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 
@@ -865,3 +866,217 @@ func TestMipmapChain(t *testing.T) {
 		t.Error("address was included in bloom and should not have")
 	}
 }
+
+func TestInternalTxStorage(t *testing.T) {
+	dbFilepath, err := ioutil.TempDir("", "geth-db-util-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbFilepath)
+	db, _ := ethdb.NewLDBDatabase(dbFilepath, 10, 100)
+
+	var (
+		contract = common.BytesToAddress([]byte{0x11})
+		created  = common.BytesToAddress([]byte{0x22})
+		payee    = common.BytesToAddress([]byte{0x33})
+		txHash   = common.BytesToHash([]byte{0x44})
+	)
+	// contract creates a contract which pays and self destructs to payee,
+	// followed by a failed and a value-less call which must not be indexed
+	root := &vm.CallFrame{Type: vm.CALL, From: common.BytesToAddress([]byte{0x01}), To: contract, Value: new(big.Int)}
+	root.Calls = []*vm.CallFrame{
+		{Type: vm.CREATE, From: contract, To: created, Value: big.NewInt(10), Calls: []*vm.CallFrame{
+			{Type: vm.CALL, From: created, To: payee, Value: big.NewInt(3)},
+			{Type: vm.SUICIDE, From: created, To: payee, Value: big.NewInt(7)},
+		}},
+		{Type: vm.CALL, From: contract, To: payee, Value: big.NewInt(1), Err: vm.OutOfGasError},
+		{Type: vm.CALL, From: contract, To: payee, Value: new(big.Int)},
+	}
+
+	itxs := internalTxsFromCallTree(314, txHash, root)
+	if len(itxs) != 3 {
+		t.Fatalf("want: %v, got: %v", 3, len(itxs))
+	}
+	for i, want := range []string{InternalTxCreate, InternalTxCall, InternalTxSuicide} {
+		if itxs[i].Kind != want {
+			t.Errorf("itx %d: want: %v, got: %v", i, want, itxs[i].Kind)
+		}
+		if itxs[i].Index != uint(i) {
+			t.Errorf("itx %d: want index: %v, got: %v", i, i, itxs[i].Index)
+		}
+	}
+	if itxs[1].Depth != 2 {
+		t.Errorf("want: %v, got: %v", 2, itxs[1].Depth)
+	}
+
+	block := types.NewBlock(&types.Header{Number: big.NewInt(314)}, nil, nil, nil)
+	if err := WriteBlockInternalTxs(db, block.Hash(), itxs); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBlockAddTxIndexes(db, block); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := GetInternalTxs(db, payee, 0, 0, "", "", -1, -1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 {
+		t.Errorf("want: %v, got: %v", 2, len(out))
+	}
+	out, _ = GetInternalTxs(db, created, 0, 0, "f", "", -1, -1, false)
+	if len(out) != 2 {
+		t.Errorf("want: %v, got: %v", 2, len(out))
+	}
+	out, _ = GetInternalTxs(db, created, 0, 0, "t", "c", -1, -1, false)
+	if len(out) != 1 || out[0].From != contract || out[0].Value.Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("unexpected creation: %v", out)
+	}
+	out, _ = GetInternalTxs(db, payee, 0, 0, "", "d", -1, -1, false)
+	if len(out) != 1 || out[0].TxHash != txHash {
+		t.Errorf("unexpected suicide: %v", out)
+	}
+	out, _ = GetInternalTxs(db, payee, 315, 0, "", "", -1, -1, false)
+	if len(out) != 0 {
+		t.Errorf("want: %v, got: %v", 0, len(out))
+	}
+	if _, err := GetInternalTxs(db, payee, 0, 0, "x", "", -1, -1, false); err == nil {
+		t.Error("expected error for invalid direction")
+	}
+
+	if err := RmBlockInternalTxs(db, block); err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []common.Address{contract, created, payee} {
+		if out, _ := GetInternalTxs(db, addr, 0, 0, "", "", -1, -1, false); len(out) != 0 {
+			t.Errorf("%x: want: %v, got: %v", addr, 0, len(out))
+		}
+	}
+}
+
+// Tests that the log index bookmark only covers blocks indexed without gaps, and
+// that blocks indexed on import join it once the gap is built.
+func TestLogIndexBookmarks(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	atxi := &AtxiT{Db: db, AutoMode: true, Progress: &AtxiProgressT{}, Logs: true}
+
+	check := func(step string, bookmark, start, end uint64) {
+		if n := atxi.GetATXILogsBookmark(); n != bookmark {
+			t.Errorf("%s: bookmark mismatch: have %d, want %d", step, n, bookmark)
+		}
+		if n := dbGetATXILogsNumber(db, logIndexLiveStartKey); n != start {
+			t.Errorf("%s: live start mismatch: have %d, want %d", step, n, start)
+		}
+		if n := dbGetATXILogsNumber(db, logIndexLiveEndKey); n != end {
+			t.Errorf("%s: live end mismatch: have %d, want %d", step, n, end)
+		}
+	}
+	// Logs enabled on a chain with 100 unindexed blocks
+	atxi.setImported(101)
+	atxi.setImported(102)
+	check("import past gap", 0, 101, 102)
+	if n := atxi.GetATXIBookmark(); n != 102 {
+		t.Errorf("atx bookmark mismatch: have %d, want 102", n)
+	}
+	atxi.extendLogsBookmark(50)
+	check("partial build", 50, 101, 102)
+	atxi.extendLogsBookmark(100)
+	check("complete build", 102, 0, 0)
+	atxi.setImported(103)
+	check("import next", 103, 0, 0)
+
+	// Rollbacks lower the bookmark, and imports out of order join it
+	atxi.lowerLogsBookmarks(90)
+	check("rollback", 90, 0, 0)
+	atxi.setImported(92)
+	check("import ahead", 90, 92, 92)
+	atxi.setImported(91)
+	check("import gap", 92, 0, 0)
+}
+
+func TestFreezeAncients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geth-freezer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := ethdb.NewLDBDatabase(filepath.Join(dir, "chaindata"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := common.BytesToAddress([]byte("jeff"))
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000)})
+	chain, receipts := GenerateChain(testChainConfig(), genesis, db, 20, func(i int, gen *BlockGen) {
+		if i == 2 {
+			receipt := types.NewReceipt(nil, new(big.Int))
+			receipt.Logs = vm.Logs{&vm.Log{Address: addr}}
+			gen.AddUncheckedReceipt(receipt)
+		}
+	})
+	for i, block := range chain {
+		WriteBlock(db, block)
+		WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		WriteHeadBlockHash(db, block.Hash())
+		if err := WriteBlockReceipts(db, block.Hash(), receipts[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := FreezeAncients(db, 5, nil); err == nil {
+		t.Fatal("expected error freezing without a freezer")
+	}
+	if err := db.OpenFreezer(filepath.Join(dir, "ancient"), true); err != nil {
+		t.Fatal(err)
+	}
+	frozen, err := FreezeAncients(db, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frozen != 16 {
+		t.Fatalf("frozen blocks mismatch: have %d, want %d", frozen, 16)
+	}
+
+	check := func(ancient bool) {
+		for _, block := range chain[:frozen-1] {
+			if data, _ := db.Get(freezerBodyKey(block.Hash())); (len(data) == 0) != ancient {
+				t.Errorf("block #%d body in key-value store: %v", block.NumberU64(), len(data) != 0)
+			}
+			if body := GetBody(db, block.Hash()); body == nil {
+				t.Errorf("block #%d body not found", block.NumberU64())
+			}
+		}
+		if rs := GetBlockReceipts(db, chain[2].Hash()); len(rs) != 1 || len(rs[0].Logs) != 1 {
+			t.Errorf("block #3 receipts mismatch: have %v", rs)
+		}
+		if body := GetBody(db, genesis.Hash()); body == nil {
+			t.Error("genesis body not found")
+		}
+	}
+	check(true)
+
+	// Data survives reopening the freezer.
+	db.Close()
+	if db, err = ethdb.NewLDBDatabase(filepath.Join(dir, "chaindata"), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.OpenFreezer(filepath.Join(dir, "ancient"), false); err != nil {
+		t.Fatal(err)
+	}
+	if db.Ancients() != frozen {
+		t.Fatalf("reopened frozen blocks mismatch: have %d, want %d", db.Ancients(), frozen)
+	}
+	check(true)
+
+	// Truncated ancients are no longer available.
+	if err := db.Freezer().TruncateAncients(2); err != nil {
+		t.Fatal(err)
+	}
+	if body := GetBody(db, chain[4].Hash()); body != nil {
+		t.Error("truncated body still found")
+	}
+	if body := GetBody(db, chain[0].Hash()); body == nil {
+		t.Error("block #1 body not found")
+	}
+}
@@ -52,13 +52,24 @@ func DelegateCall(env vm.Environment, caller vm.ContractRef, addr common.Address
 	return ret, err
 }
 
+// StaticCall executes within the given contract, disallowing any state
+// modification by it and by the contracts it calls
+func StaticCall(env vm.Environment, caller vm.ContractRef, addr common.Address, input []byte, gas, gasPrice *big.Int) (ret []byte, err error) {
+	ret, err = execStaticCall(env, caller, &addr, env.Db().GetCodeHash(addr), input, env.Db().GetCode(addr), gas, gasPrice)
+	return ret, err
+}
+
 // Create creates a new contract with the given code
 func Create(env vm.Environment, caller vm.ContractRef, code []byte, gas, gasPrice, value *big.Int) (ret []byte, address common.Address, err error) {
 	ret, address, err = exec(env, caller, nil, nil, crypto.Keccak256Hash(code), nil, code, gas, gasPrice, value)
 	// Here we get an error if we run into maximum stack depth,
 	// See: https://github.com/ethereum/yellowpaper/pull/131
 	// and YP definitions for CREATE instruction
-	if err != nil {
+	//
+	// A creation reverted by REVERT has already had its state rolled back and
+	// its remaining gas refunded by exec, and keeps its output as the return
+	// data of the creator.
+	if err != nil && err != vm.ExecutionRevertedError {
 		return nil, address, err
 	}
 	return ret, address, err
@@ -130,13 +141,17 @@ func exec(env vm.Environment, caller vm.ContractRef, address, codeAddr *common.A
 	}
 
 	// When an error was returned by the EVM or when setting the creation code
-	// above we revert to the snapshot and consume any gas remaining. Additionally
-	// when we're in homestead this also counts for code storage gas errors.
+	// above we revert to the snapshot and consume any gas remaining, unless
+	// reverted by REVERT. Additionally when we're in homestead this also counts
+	// for code storage gas errors.
 	if err != nil && (env.RuleSet().IsHomestead(env.BlockNumber()) || err != vm.CodeStoreOutOfGasError) {
-		contract.UseGas(contract.Gas)
+		if err != vm.ExecutionRevertedError {
+			contract.UseGas(contract.Gas)
+		}
 
 		env.RevertToSnapshot(snapshotPreTransfer)
 	}
+	evm.CaptureExit(contract, ret, err)
 
 	return ret, addr, err
 }
@@ -166,14 +181,56 @@ func execDelegateCall(env vm.Environment, caller vm.ContractRef, originAddr, toA
 
 	ret, err = evm.Run(contract, input)
 	if err != nil {
-		contract.UseGas(contract.Gas)
+		if err != vm.ExecutionRevertedError {
+			contract.UseGas(contract.Gas)
+		}
 
 		env.RevertToSnapshot(snapshot)
 	}
+	evm.CaptureExit(contract, ret, err)
 
 	return ret, addr, err
 }
 
+func execStaticCall(env vm.Environment, caller vm.ContractRef, address *common.Address, codeHash common.Hash, input, code []byte, gas, gasPrice *big.Int) (ret []byte, err error) {
+	evm := env.Vm()
+	// Depth check execution. Fail if we're trying to execute above the
+	// limit.
+	if env.Depth() > callCreateDepthMax {
+		caller.ReturnGas(gas, gasPrice)
+		return nil, errCallCreateDepth
+	}
+
+	snapshot := env.SnapshotDatabase()
+
+	var to vm.Account
+	if !env.Db().Exist(*address) {
+		to = env.Db().CreateAccount(*address)
+	} else {
+		to = env.Db().GetAccount(*address)
+	}
+
+	// Initialise a new contract in a static context, inherited by the
+	// contracts it calls
+	contract := vm.NewContract(caller, to, new(big.Int), gas, gasPrice).AsStatic()
+	contract.SetCallCode(address, codeHash, code)
+	defer contract.Finalise()
+
+	// Nothing but the accounts touched, eg. by zero-value calls, can change
+	// in a static context; those stay, unless the call fails
+	ret, err = evm.Run(contract, input)
+	if err != nil {
+		if err != vm.ExecutionRevertedError {
+			contract.UseGas(contract.Gas)
+		}
+
+		env.RevertToSnapshot(snapshot)
+	}
+	evm.CaptureExit(contract, ret, err)
+
+	return ret, err
+}
+
 // generic transfer method
 func Transfer(from, to vm.Account, amount *big.Int) {
 	from.SubBalance(amount)
@@ -0,0 +1,153 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+
+	"github.com/ethereumproject/go-ethereum/common"
+)
+
+var (
+	// ErrRemoteStale is returned by CheckForkID if the remote fork ID is a subset
+	// of the local one, but the remote is missing a fork block the local chain
+	// already passed, i.e. it is running outdated software.
+	ErrRemoteStale = errors.New("remote needs update")
+
+	// ErrLocalIncompatibleOrStale is returned by CheckForkID if the remote fork
+	// ID is neither a subset nor a superset of the local one, or the local chain
+	// passed a fork block the remote announced but the local config lacks.
+	ErrLocalIncompatibleOrStale = errors.New("local incompatible or needs update")
+)
+
+// ForkID is a compact identifier of the fork state of a chain, exchanged
+// during the eth handshake so that peers on incompatible chains can be
+// rejected without any further round trips.
+type ForkID struct {
+	Hash [4]byte // CRC32 checksum of the genesis hash and the passed fork blocks
+	Next uint64  // Block number of the next upcoming fork, or 0 if none is known
+}
+
+// String implements fmt.Stringer.
+func (id ForkID) String() string {
+	return fmt.Sprintf("%x/%d", id.Hash, id.Next)
+}
+
+// forkBlocks returns the distinct, non-genesis fork block numbers of the
+// configuration in ascending order.
+func (c *ChainConfig) forkBlocks() []uint64 {
+	var blocks []uint64
+	for _, f := range c.Forks {
+		if f.Block == nil || f.Block.Sign() == 0 {
+			continue
+		}
+		blocks = append(blocks, f.Block.Uint64())
+	}
+	sort.Sort(uint64Slice(blocks))
+
+	out := blocks[:0]
+	for i, n := range blocks {
+		if i == 0 || blocks[i-1] != n {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// forkChecksums returns the checksum of the genesis hash followed by the
+// checksum after each of the given fork blocks was passed.
+func forkChecksums(genesis common.Hash, forks []uint64) [][4]byte {
+	sums := make([][4]byte, len(forks)+1)
+	hash := crc32.ChecksumIEEE(genesis[:])
+	binary.BigEndian.PutUint32(sums[0][:], hash)
+	for i, fork := range forks {
+		var blob [8]byte
+		binary.BigEndian.PutUint64(blob[:], fork)
+		hash = crc32.Update(hash, crc32.IEEETable, blob[:])
+		binary.BigEndian.PutUint32(sums[i+1][:], hash)
+	}
+	return sums
+}
+
+// ForkID returns the fork identifier of a chain with the given genesis block
+// and this configuration, when its head is at block number head.
+func (c *ChainConfig) ForkID(genesis common.Hash, head uint64) ForkID {
+	forks := c.forkBlocks()
+	sums := forkChecksums(genesis, forks)
+	for i, fork := range forks {
+		if head < fork {
+			return ForkID{Hash: sums[i], Next: fork}
+		}
+	}
+	return ForkID{Hash: sums[len(sums)-1]}
+}
+
+// CheckForkID validates a fork identifier announced by a remote peer against
+// the local chain with the given genesis block and head block number. It
+// returns nil if the two chains are compatible, following the rules of EIP-2124:
+//
+//   - an identical checksum is compatible, unless the remote announces a next
+//     fork which the local head already passed;
+//   - a checksum the local chain had before passing some of its forks is
+//     compatible only if the remote announces the next of those forks;
+//   - a checksum the local chain will have after passing some of its upcoming
+//     forks is compatible, since the remote is simply ahead in syncing;
+//   - anything else is incompatible.
+func (c *ChainConfig) CheckForkID(genesis common.Hash, head uint64, id ForkID) error {
+	forks := c.forkBlocks()
+	sums := forkChecksums(genesis, forks)
+
+	// Find the checksum matching the local head.
+	current := len(forks)
+	for i, fork := range forks {
+		if head < fork {
+			current = i
+			break
+		}
+	}
+	if sums[current] == id.Hash {
+		if id.Next > 0 && head >= id.Next {
+			return ErrLocalIncompatibleOrStale
+		}
+		return nil
+	}
+	for i := 0; i < current; i++ {
+		if sums[i] == id.Hash {
+			if forks[i] != id.Next {
+				return ErrRemoteStale
+			}
+			return nil
+		}
+	}
+	for i := current + 1; i < len(sums); i++ {
+		if sums[i] == id.Hash {
+			return nil
+		}
+	}
+	return ErrLocalIncompatibleOrStale
+}
+
+// uint64Slice attaches the methods of sort.Interface to []uint64.
+type uint64Slice []uint64
+
+func (s uint64Slice) Len() int           { return len(s) }
+func (s uint64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -239,7 +239,9 @@ type WhCallback func(*types.Header) error
 // The verify parameter can be used to fine tune whether nonce verification
 // should be done or not. The reason behind the optional check is because some
 // of the header retrieval mechanisms already need to verfy nonces, as well as
-// because nonces can be verified sparsely, not needing to check each.
+// because nonces can be verified sparsely, not needing to check each. A
+// checkFreq of zero skips nonce verification altogether, for headers already
+// vouched for by a trusted checkpoint.
 func (hc *HeaderChain) InsertHeaderChain(chain []*types.Header, checkFreq int, writeHeader WhCallback) (res *HeaderChainInsertResult) {
 	res = &HeaderChainInsertResult{}
 
@@ -250,14 +252,16 @@ func (hc *HeaderChain) InsertHeaderChain(chain []*types.Header, checkFreq int, w
 
 	// Generate the list of headers that should be POW verified
 	verify := make([]bool, len(chain))
-	for i := 0; i < len(verify)/checkFreq; i++ {
-		index := i*checkFreq + hc.rand.Intn(checkFreq)
-		if index >= len(verify) {
-			index = len(verify) - 1
+	if checkFreq > 0 {
+		for i := 0; i < len(verify)/checkFreq; i++ {
+			index := i*checkFreq + hc.rand.Intn(checkFreq)
+			if index >= len(verify) {
+				index = len(verify) - 1
+			}
+			verify[index] = true
 		}
-		verify[index] = true
+		verify[len(verify)-1] = true // Last should always be verified to avoid junk
 	}
-	verify[len(verify)-1] = true // Last should always be verified to avoid junk
 
 	// Create the header verification task queue and worker functions
 	tasks := make(chan int, len(chain))
@@ -574,6 +578,12 @@ type headerValidator struct {
 	Pow    pow.PoW      // Proof of work used for validating
 }
 
+// NewHeaderValidator returns a HeaderValidator checking headers against the
+// given header chain, for chains which only import headers.
+func NewHeaderValidator(config *ChainConfig, hc *HeaderChain, pow pow.PoW) HeaderValidator {
+	return &headerValidator{config: config, hc: hc, Pow: pow}
+}
+
 // ValidateHeader validates the given header and, depending on the pow arg,
 // checks the proof of work of the given header. Returns an error if the
 // validation failed.
@@ -18,12 +18,28 @@ package core
 
 import (
 	"container/list"
+	"os"
 
 	"github.com/ethereumproject/go-ethereum/core/types"
 	"github.com/ethereumproject/go-ethereum/ethdb"
 	"github.com/ethereumproject/go-ethereum/event"
 )
 
+// testVM is the VM running the tests, selected with the GETH_TEST_VM environment
+// variable, or DefaultTxExecutor if not set.
+var testVM = setTestVM()
+
+func setTestVM() string {
+	vm := os.Getenv("GETH_TEST_VM")
+	if vm == "" {
+		vm = DefaultTxExecutor
+	}
+	if err := SetTxExecutor(vm); err != nil {
+		panic(err)
+	}
+	return vm
+}
+
 // Implement our EthTest Manager
 type TestManager struct {
 	// stateManager *StateManager
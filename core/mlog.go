@@ -14,6 +14,7 @@ var mlogTxPool = logger.MLogRegisterAvailable("txpool", mLogLinesTxPool)
 var mLogLinesBlockchain = []*logger.MLogT{
 	mlogBlockchainWriteBlock,
 	mlogBlockchainInsertBlocks,
+	mlogBlockchainVMDivergence,
 }
 
 var mLogLinesHeaderchain = []*logger.MLogT{
@@ -68,6 +69,25 @@ var mlogBlockchainInsertBlocks = &logger.MLogT{
 	},
 }
 
+var mlogBlockchainVMDivergence = &logger.MLogT{
+	Description: `Called when the VM in use and the cross-checked one disagree on the outcome of a
+transaction in VM cross-check mode. FIELD is one of "error", "gas", "status", "logs" and "root".`,
+	Receiver: "BLOCKCHAIN",
+	Verb:     "DIVERGE",
+	Subject:  "VM",
+	Details: []logger.MLogDetailT{
+		{Owner: "BLOCK", Key: "NUMBER", Value: "INT"},
+		{Owner: "BLOCK", Key: "HASH", Value: "STRING"},
+		{Owner: "TX", Key: "HASH", Value: "STRING"},
+		{Owner: "TX", Key: "INDEX", Value: "INT"},
+		{Owner: "DIVERGE", Key: "FIELD", Value: "STRING"},
+		{Owner: "VM", Key: "NAME", Value: "STRING"},
+		{Owner: "VM", Key: "VALUE", Value: "QUOTEDSTRING"},
+		{Owner: "ALTERNATIVE", Key: "NAME", Value: "STRING"},
+		{Owner: "ALTERNATIVE", Key: "VALUE", Value: "QUOTEDSTRING"},
+	},
+}
+
 var mlogBlockchainReorgBlocks = &logger.MLogT{
 	Description: "Called when a chain split is detected and a subset of blocks are reoganized.",
 	Receiver:    "BLOCKCHAIN",
@@ -3,6 +3,7 @@
 package core
 
 import (
+	"errors"
 	"math/big"
 
 	"github.com/ETCDEVTeam/sputnikvm-ffi/go/sputnikvm"
@@ -15,18 +16,27 @@ import (
 	"github.com/ethereumproject/go-ethereum/logger/glog"
 )
 
-const SputnikVMExists = true
+var (
+	errSputnikVMByzantium   = errors.New("sputnikvm: byzantium feature not supported")
+	errSputnikVMPrecompiles = errors.New("sputnikvm: precompiles feature not supported")
+)
 
-// UseSputnikVM determines whether the VM will be Sputnik or Geth's native one.
-// Awkward though it is to use a string variable, go's -ldflags relies on it being a constant string in order to be settable via -X from the command line,
-// eg. -ldflags "-X core.UseSputnikVM=true".
-var UseSputnikVM string = "false"
+func init() {
+	RegisterTxExecutor("sputnikvm", TxExecutorFunc(ApplyMultiVmTransaction))
+}
 
 // Apply a transaction using the SputnikVM processor with the given
 // chain config and state. Note that we use the name of the chain
 // config to determine which hard fork to use so ClassicVM's gas table
 // would not be used.
 func ApplyMultiVmTransaction(config *ChainConfig, bc *BlockChain, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, totalUsedGas *big.Int) (*types.Receipt, evm.Logs, *big.Int, error) {
+	if config.IsByzantium(header.Number) {
+		return nil, nil, nil, errSputnikVMByzantium
+	}
+	// SputnikVM has the precompiled contracts built in
+	if _, _, configured := config.GetFeature(header.Number, "precompiles"); configured {
+		return nil, nil, nil, errSputnikVMPrecompiles
+	}
 	tx.SetSigner(config.GetSigner(header.Number))
 
 	from, err := tx.From()
@@ -0,0 +1,31 @@
+// +build sputnikvm
+
+package core
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/core/types"
+)
+
+// Tests that SputnikVM refuses to process blocks from a fork configuring the
+// precompiled contracts, as it has them built in.
+func TestMultiVmPrecompiles(t *testing.T) {
+	var config ChainConfig
+	if err := json.Unmarshal([]byte(`{"forks": [{
+		"name": "Precompiles",
+		"block": 10,
+		"features": [{
+			"id": "precompiles",
+			"options": {"ripemd160": {"enabled": false}}
+		}]
+	}]}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	header := &types.Header{Number: big.NewInt(10)}
+	if _, _, _, err := ApplyMultiVmTransaction(&config, nil, nil, nil, header, nil, nil); err != errSputnikVMPrecompiles {
+		t.Errorf("error mismatch: have %v, want %v", err, errSputnikVMPrecompiles)
+	}
+}
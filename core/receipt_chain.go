@@ -0,0 +1,166 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/rlp"
+)
+
+const (
+	receiptChainBatchSize = 2048 // Number of blocks inserted at once by ImportReceiptChain
+	receiptChainCheckFreq = 100  // Header PoW verification frequency, as in fast sync
+)
+
+// ReceiptChainRecord is a record of a receipt chain file, a block along with
+// the consensus fields of its receipts. The state root of the block is the one
+// of its header, and the intermediate ones of its transactions those of its
+// receipts.
+type ReceiptChainRecord struct {
+	Block    *types.Block
+	Receipts types.Receipts
+}
+
+// ExportReceiptChainN writes the blocks first to last of the active chain to
+// the given writer as receipt chain records.
+func (bc *BlockChain) ExportReceiptChainN(w io.Writer, first uint64, last uint64) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+
+	glog.V(logger.Info).Infof("exporting %d blocks with receipts...\n", last-first+1)
+
+	for nr := first; nr <= last; nr++ {
+		block := bc.GetBlockByNumber(nr)
+		if block == nil {
+			return fmt.Errorf("export failed on #%d: not found", nr)
+		}
+		receipts := GetBlockReceipts(bc.chainDb, block.Hash())
+		if len(receipts) != len(block.Transactions()) {
+			return fmt.Errorf("export failed on #%d: receipts not found", nr)
+		}
+		if err := rlp.Encode(w, &ReceiptChainRecord{Block: block, Receipts: receipts}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportReceiptChain imports the receipt chain records read from r the way fast
+// sync does, inserting headers, bodies and receipts without executing the
+// transactions. Bodies and receipts are checked against their headers, whose
+// proof-of-work is verified sparsely: the chain is trusted by the hash of its
+// last block, the checkpoint. Records past the checkpoint are not read, and
+// if the checkpoint is not found the imported blocks are rolled back.
+//
+// The head block is left as is, only the head header and fast block move to
+// the checkpoint, whose state is to be imported separately, if needed.
+func (bc *BlockChain) ImportReceiptChain(r io.Reader, checkpoint common.Hash) (*types.Block, error) {
+	var (
+		stream   = rlp.NewStream(r, 0)
+		blocks   = make(types.Blocks, 0, receiptChainBatchSize)
+		receipts = make([]types.Receipts, 0, receiptChainBatchSize)
+		imported []common.Hash
+		reached  *types.Block
+	)
+	insert := func() error {
+		if len(blocks) == 0 {
+			return nil
+		}
+		headers := make([]*types.Header, len(blocks))
+		for i, block := range blocks {
+			headers[i] = block.Header()
+		}
+		// Roll back even partially inserted batches on failure
+		for _, block := range blocks {
+			imported = append(imported, block.Hash())
+		}
+		if res := bc.InsertHeaderChain(headers, receiptChainCheckFreq); res.Error != nil {
+			return fmt.Errorf("invalid header #%d: %v", headers[res.Index].Number, res.Error)
+		}
+		if res := bc.InsertReceiptChain(blocks, receipts); res.Error != nil {
+			return fmt.Errorf("invalid block #%d: %v", blocks[res.Index].Number(), res.Error)
+		}
+		blocks, receipts = blocks[:0], receipts[:0]
+		return nil
+	}
+	fail := func(err error) (*types.Block, error) {
+		bc.Rollback(imported)
+		return nil, err
+	}
+
+	for n := 0; reached == nil; n++ {
+		var record ReceiptChainRecord
+		if err := stream.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return fail(fmt.Errorf("at record %d: %v", n, err))
+		}
+		block := record.Block
+		if block.NumberU64() == 0 {
+			continue
+		}
+		if err := checkReceiptChainRecord(&record); err != nil {
+			return fail(fmt.Errorf("invalid block #%d [%x…]: %v", block.Number(), block.Hash().Bytes()[:4], err))
+		}
+		blocks, receipts = append(blocks, block), append(receipts, record.Receipts)
+		if block.Hash() == checkpoint {
+			reached = block
+		}
+		if len(blocks) == receiptChainBatchSize {
+			if err := insert(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if reached == nil {
+		return fail(fmt.Errorf("checkpoint [%x…] not found", checkpoint.Bytes()[:4]))
+	}
+	if err := insert(); err != nil {
+		return fail(err)
+	}
+	return reached, nil
+}
+
+// checkReceiptChainRecord checks the body and the receipts of a record against
+// the header of its block.
+func checkReceiptChainRecord(record *ReceiptChainRecord) error {
+	header := record.Block.Header()
+	if hash := types.DeriveSha(record.Block.Transactions()); hash != header.TxHash {
+		return fmt.Errorf("transaction root hash mismatch: have %x, want %x", hash, header.TxHash)
+	}
+	if hash := types.CalcUncleHash(record.Block.Uncles()); hash != header.UncleHash {
+		return fmt.Errorf("uncle root hash mismatch: have %x, want %x", hash, header.UncleHash)
+	}
+	if len(record.Receipts) != len(record.Block.Transactions()) {
+		return fmt.Errorf("receipt count mismatch: have %d, want %d", len(record.Receipts), len(record.Block.Transactions()))
+	}
+	if hash := types.DeriveSha(record.Receipts); hash != header.ReceiptHash {
+		return fmt.Errorf("receipt root hash mismatch: have %x, want %x", hash, header.ReceiptHash)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+	"github.com/ethereumproject/go-ethereum/rlp"
+)
+
+// Tests that an exported receipt chain is imported up to its checkpoint with the
+// receipts of the source chain, and rolled back if the checkpoint is not found.
+func TestReceiptChainExportImport(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	var (
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		signer   = types.NewChainIdSigner(big.NewInt(63))
+		config   = MakeDiehardChainConfig()
+		gendb, _ = ethdb.NewMemDatabase()
+	)
+	genesis := WriteGenesisBlockForTesting(gendb, GenesisAccount{addr, big.NewInt(1000000)})
+	blocks, _ := GenerateChain(config, genesis, gendb, 5, func(i int, gen *BlockGen) {
+		tx, err := types.NewTransaction(gen.TxNonce(addr), common.BigToAddress(big.NewInt(0x1000)), big.NewInt(1000), TxGas, nil, nil).WithSigner(signer).SignECDSA(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.AddTx(tx)
+	})
+	newChain := func() (*BlockChain, ethdb.Database) {
+		db, _ := ethdb.NewMemDatabase()
+		WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000)})
+		chain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chain, db
+	}
+	source, _ := newChain()
+	defer source.Stop()
+	if res := source.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to insert block %d: %v", res.Index, res.Error)
+	}
+	var export bytes.Buffer
+	if err := source.ExportReceiptChainN(&export, 0, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// Importing up to the checkpoint, the records past it are left alone
+	chain, db := newChain()
+	defer chain.Stop()
+	block, err := chain.ImportReceiptChain(bytes.NewReader(export.Bytes()), blocks[3].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Hash() != blocks[3].Hash() {
+		t.Fatalf("checkpoint mismatch: have %x, want %x", block.Hash(), blocks[3].Hash())
+	}
+	if head := chain.CurrentFastBlock().Hash(); head != blocks[3].Hash() {
+		t.Errorf("head fast block mismatch: have %x, want %x", head, blocks[3].Hash())
+	}
+	if head := chain.CurrentHeader().Hash(); head != blocks[3].Hash() {
+		t.Errorf("head header mismatch: have %x, want %x", head, blocks[3].Hash())
+	}
+	if head := chain.CurrentBlock().Hash(); head != chain.Genesis().Hash() {
+		t.Errorf("head block moved: have %x, want genesis", head)
+	}
+	if chain.HasHeader(blocks[4].Hash()) {
+		t.Error("block past the checkpoint imported")
+	}
+	for i, block := range blocks[:4] {
+		have, _ := rlp.EncodeToBytes(GetBlockReceipts(db, block.Hash()))
+		want, _ := rlp.EncodeToBytes(GetBlockReceipts(source.chainDb, block.Hash()))
+		if !bytes.Equal(have, want) {
+			t.Errorf("block %d receipts mismatch", i+1)
+		}
+	}
+
+	// Importing without finding the checkpoint rolls back
+	chain, _ = newChain()
+	defer chain.Stop()
+	if _, err := chain.ImportReceiptChain(bytes.NewReader(export.Bytes()), common.Hash{1}); err == nil {
+		t.Fatal("import without checkpoint succeeded")
+	}
+	if head := chain.CurrentFastBlock().Hash(); head != chain.Genesis().Hash() {
+		t.Errorf("head fast block not rolled back: have %x", head)
+	}
+	if head := chain.CurrentHeader().Hash(); head != chain.Genesis().Hash() {
+		t.Errorf("head header not rolled back: have %x", head)
+	}
+}
+
+// Tests that receipts not matching the receipt root of their block are rejected.
+func TestReceiptChainTamperedReceipts(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	var (
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		signer   = types.NewChainIdSigner(big.NewInt(63))
+		config   = MakeDiehardChainConfig()
+		gendb, _ = ethdb.NewMemDatabase()
+	)
+	genesis := WriteGenesisBlockForTesting(gendb, GenesisAccount{addr, big.NewInt(1000000)})
+	blocks, receipts := GenerateChain(config, genesis, gendb, 1, func(i int, gen *BlockGen) {
+		tx, err := types.NewTransaction(gen.TxNonce(addr), common.BigToAddress(big.NewInt(0x1000)), big.NewInt(1000), TxGas, nil, nil).WithSigner(signer).SignECDSA(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.AddTx(tx)
+	})
+	receipts[0][0].CumulativeGasUsed = new(big.Int).Add(receipts[0][0].CumulativeGasUsed, common.Big1)
+
+	var export bytes.Buffer
+	if err := rlp.Encode(&export, &ReceiptChainRecord{Block: blocks[0], Receipts: receipts[0]}); err != nil {
+		t.Fatal(err)
+	}
+	db, _ := ethdb.NewMemDatabase()
+	WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000)})
+	chain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Stop()
+	if _, err := chain.ImportReceiptChain(&export, blocks[0].Hash()); err == nil {
+		t.Fatal("tampered receipts imported")
+	}
+	if chain.HasHeader(blocks[0].Hash()) {
+		t.Error("block with tampered receipts imported")
+	}
+}
@@ -61,6 +61,7 @@ type Trie interface {
 	Hash() common.Hash
 	NodeIterator(startKey []byte) trie.NodeIterator
 	GetKey([]byte) []byte // TODO(fjl): remove this when SecureTrie is removed
+	Prove(key []byte, fromLevel uint, proofDb trie.DatabaseWriter) error
 }
 
 // NewDatabase creates a backing store for state. The returned database is safe for
@@ -70,8 +71,16 @@ func NewDatabase(db ethdb.Database) Database {
 	return &cachingDB{db: db, codeSizeCache: csc}
 }
 
+// NewDatabaseWithCache creates a backing store for state reading trie nodes and
+// contract code through the given trie node cache, so that states committed to it
+// but not yet flushed to disk are available.
+func NewDatabaseWithCache(nodes *trie.NodeCache) Database {
+	csc, _ := lru.New(codeSizeCacheSize)
+	return &cachingDB{db: nodes, codeSizeCache: csc}
+}
+
 type cachingDB struct {
-	db            ethdb.Database
+	db            trie.Database
 	mu            sync.Mutex
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
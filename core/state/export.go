@@ -0,0 +1,222 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/rlp"
+	"github.com/ethereumproject/go-ethereum/trie"
+)
+
+const (
+	// exportSlotChunk is the maximum number of storage slots of an exported
+	// storage chunk.
+	exportSlotChunk = 1024
+
+	// importCommitInterval is the number of accounts after which the state trie
+	// being imported is committed to disk, bounding its memory use.
+	importCommitInterval = 10000
+)
+
+// ExportedAccount is an account record of a state export. It is followed in the
+// stream by the storage chunks of the account, each a list of ExportedSlot, all
+// of them holding exportSlotChunk slots but the last one, which may be empty.
+type ExportedAccount struct {
+	Hash     common.Hash // Hash of the address, the key of the account in the state trie
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+	Code     []byte // Empty if already exported with a previous account
+}
+
+// ExportedSlot is a storage slot of a state export.
+type ExportedSlot struct {
+	Key   common.Hash // Hash of the slot, the key of the slot in the storage trie
+	Value []byte      // Value as stored in the storage trie
+}
+
+// Export streams the accounts of the state, with their code and storage, to w as
+// RLP records. It returns the number of accounts exported.
+func (self *StateDB) Export(w io.Writer) (uint64, error) {
+	var (
+		accounts uint64
+		codes    = make(map[common.Hash]bool)
+	)
+	it := trie.NewIterator(self.trie.NodeIterator(nil))
+	for it.Next() {
+		var data Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return accounts, err
+		}
+		addrHash := common.BytesToHash(it.Key)
+		account := ExportedAccount{
+			Hash:     addrHash,
+			Nonce:    data.Nonce,
+			Balance:  data.Balance,
+			Root:     data.Root,
+			CodeHash: data.CodeHash,
+		}
+		if codeHash := common.BytesToHash(data.CodeHash); !bytes.Equal(data.CodeHash, emptyCodeHash) && !codes[codeHash] {
+			code, err := self.db.ContractCode(addrHash, codeHash)
+			if err != nil {
+				return accounts, fmt.Errorf("account %x: code: %v", addrHash, err)
+			}
+			account.Code = code
+			codes[codeHash] = true
+		}
+		if err := rlp.Encode(w, &account); err != nil {
+			return accounts, err
+		}
+
+		storage, err := self.db.OpenStorageTrie(addrHash, data.Root)
+		if err != nil {
+			return accounts, fmt.Errorf("account %x: storage: %v", addrHash, err)
+		}
+		chunk := make([]ExportedSlot, 0, exportSlotChunk)
+		storageIt := trie.NewIterator(storage.NodeIterator(nil))
+		for storageIt.Next() {
+			chunk = append(chunk, ExportedSlot{common.BytesToHash(storageIt.Key), storageIt.Value})
+			if len(chunk) == exportSlotChunk {
+				if err := rlp.Encode(w, chunk); err != nil {
+					return accounts, err
+				}
+				chunk = chunk[:0]
+			}
+		}
+		if storageIt.Err != nil {
+			return accounts, fmt.Errorf("account %x: storage: %v", addrHash, storageIt.Err)
+		}
+		if err := rlp.Encode(w, chunk); err != nil {
+			return accounts, err
+		}
+
+		accounts++
+		if accounts%100000 == 0 {
+			glog.V(logger.Info).Infof("exported %d accounts", accounts)
+		}
+	}
+	if it.Err != nil {
+		return accounts, it.Err
+	}
+	return accounts, nil
+}
+
+// Import rebuilds in db the state exported by Export and read from s until its
+// end, checking the storage root and code hash of every account. It returns the
+// root of the state and the number of accounts imported.
+func Import(db ethdb.Database, s *rlp.Stream) (common.Hash, uint64, error) {
+	var accounts uint64
+
+	stateTrie, err := trie.New(common.Hash{}, db)
+	if err != nil {
+		return common.Hash{}, 0, err
+	}
+	// Unload the nodes committed by the previous commit, the accounts coming in
+	// key order.
+	stateTrie.SetCacheLimit(1)
+
+	for {
+		var account ExportedAccount
+		if err := s.Decode(&account); err == io.EOF {
+			break
+		} else if err != nil {
+			return common.Hash{}, accounts, fmt.Errorf("account %d: %v", accounts, err)
+		}
+
+		storage, err := trie.New(common.Hash{}, db)
+		if err != nil {
+			return common.Hash{}, accounts, err
+		}
+		for {
+			var chunk []ExportedSlot
+			if err := s.Decode(&chunk); err != nil {
+				return common.Hash{}, accounts, fmt.Errorf("account %x: storage: %v", account.Hash, err)
+			}
+			for _, slot := range chunk {
+				if err := storage.TryUpdate(slot.Key[:], slot.Value); err != nil {
+					return common.Hash{}, accounts, err
+				}
+			}
+			if len(chunk) < exportSlotChunk {
+				break
+			}
+		}
+		root, err := commitTrie(db, storage)
+		if err != nil {
+			return common.Hash{}, accounts, err
+		}
+		if root != account.Root {
+			return common.Hash{}, accounts, fmt.Errorf("account %x: storage root mismatch: have %x, want %x", account.Hash, root, account.Root)
+		}
+
+		if len(account.Code) > 0 {
+			if hash := crypto.Keccak256(account.Code); !bytes.Equal(hash, account.CodeHash) {
+				return common.Hash{}, accounts, fmt.Errorf("account %x: code hash mismatch: have %x, want %x", account.Hash, hash, account.CodeHash)
+			}
+			if err := db.Put(account.CodeHash, account.Code); err != nil {
+				return common.Hash{}, accounts, err
+			}
+		} else if !bytes.Equal(account.CodeHash, emptyCodeHash) {
+			if ok, _ := db.Has(account.CodeHash); !ok {
+				return common.Hash{}, accounts, fmt.Errorf("account %x: code %x missing", account.Hash, account.CodeHash)
+			}
+		}
+
+		data, err := rlp.EncodeToBytes(&Account{
+			Nonce:    account.Nonce,
+			Balance:  account.Balance,
+			Root:     account.Root,
+			CodeHash: account.CodeHash,
+		})
+		if err != nil {
+			return common.Hash{}, accounts, err
+		}
+		if err := stateTrie.TryUpdate(account.Hash[:], data); err != nil {
+			return common.Hash{}, accounts, err
+		}
+
+		accounts++
+		if accounts%importCommitInterval == 0 {
+			if _, err := commitTrie(db, stateTrie); err != nil {
+				return common.Hash{}, accounts, err
+			}
+			glog.V(logger.Info).Infof("imported %d accounts", accounts)
+		}
+	}
+	root, err := commitTrie(db, stateTrie)
+	return root, accounts, err
+}
+
+// commitTrie commits a trie to db in a batch.
+func commitTrie(db ethdb.Database, t *trie.Trie) (common.Hash, error) {
+	batch := db.NewBatch()
+	root, err := t.CommitTo(batch)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return root, batch.Write()
+}
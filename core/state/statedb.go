@@ -258,6 +258,34 @@ func (self *StateDB) GetState(a common.Address, b common.Hash) common.Hash {
 	return common.Hash{}
 }
 
+// GetProof returns the Merkle proof of the account at addr in the state trie,
+// i.e. the encoded trie nodes on the path from the root to the account.
+func (self *StateDB) GetProof(addr common.Address) ([][]byte, error) {
+	var proof ProofList
+	err := self.trie.Prove(addr[:], 0, &proof)
+	return proof, err
+}
+
+// GetStorageProof returns the Merkle proof of the storage slot key in the
+// storage trie of the account at addr.
+func (self *StateDB) GetStorageProof(addr common.Address, key common.Hash) ([][]byte, error) {
+	stateObject := self.getStateObject(addr)
+	if stateObject == nil {
+		return nil, fmt.Errorf("storage proof of missing account %x", addr)
+	}
+	var proof ProofList
+	err := stateObject.getTrie(self.db).Prove(key[:], 0, &proof)
+	return proof, err
+}
+
+// ProofList collects the nodes of a Merkle proof in the order they are written.
+type ProofList [][]byte
+
+func (n *ProofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
 func (self *StateDB) HasSuicided(addr common.Address) bool {
 	stateObject := self.getStateObject(addr)
 	if stateObject != nil {
@@ -593,7 +621,20 @@ func (s *StateDB) CommitTo(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (ro
 		}
 		delete(s.stateObjectsDirty, addr)
 	}
-	// Write trie changes.
+	// Write trie changes. When committing to a trie node cache, the storage tries
+	// and code of the accounts are referenced from the account trie nodes holding
+	// them, so they are kept as long as those are.
+	if cache, ok := dbw.(*trie.NodeCache); ok {
+		dbw = cache.LeafWriter(func(leaf []byte, parent common.Hash) error {
+			var account Account
+			if err := rlp.DecodeBytes(leaf, &account); err != nil {
+				return nil
+			}
+			cache.Reference(account.Root, parent)
+			cache.Reference(common.BytesToHash(account.CodeHash), parent)
+			return nil
+		})
+	}
 	root, err = s.trie.CommitTo(dbw)
 	glog.V(logger.Debug).Infoln("Trie cache stats after commit", "misses", trie.CacheMisses(), "unloads", trie.CacheUnloads())
 	return root, err
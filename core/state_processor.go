@@ -64,6 +64,14 @@ func NewStateProcessor(config *ChainConfig, bc *BlockChain) *StateProcessor {
 // returns the amount of gas that was used in the process. If any of the
 // transactions failed to execute due to insufficient gas it will return an error.
 func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB) (types.Receipts, vm.Logs, *big.Int, error) {
+	receipts, logs, usedGas, _, err := p.process(block, statedb, false)
+	return receipts, logs, usedGas, err
+}
+
+// process is Process also collecting the internal transactions made by the
+// contracts called, if traceInternal is set. They are returned rather than
+// stored, as the block is yet to be validated.
+func (p *StateProcessor) process(block *types.Block, statedb *state.StateDB, traceInternal bool) (types.Receipts, vm.Logs, *big.Int, []*InternalTx, error) {
 	var (
 		receipts     types.Receipts
 		totalUsedGas = big.NewInt(0)
@@ -71,38 +79,57 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB) (ty
 		header       = block.Header()
 		allLogs      vm.Logs
 		gp           = new(GasPool).AddGas(block.GasLimit())
+		internalTxs  []*InternalTx
+		crossCheck   = p.bc.crossCheck()
+
+		executorName, executor = CurrentTxExecutor()
 	)
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
 		if tx.Protected() {
 			chainId := p.config.GetChainID()
 			if chainId.Cmp(new(big.Int)) == 0 {
-				return nil, nil, nil, fmt.Errorf("ChainID is not set for EIP-155 in chain configuration at block number: %v. \n  Tx ChainID: %v", block.Number(), tx.ChainId())
+				return nil, nil, nil, nil, fmt.Errorf("ChainID is not set for EIP-155 in chain configuration at block number: %v. \n  Tx ChainID: %v", block.Number(), tx.ChainId())
 			}
 			if tx.ChainId() == nil || tx.ChainId().Cmp(chainId) != 0 {
-				return nil, nil, nil, fmt.Errorf("Invalid transaction chain id. Current chain id: %v tx chain id: %v", p.config.GetChainID(), tx.ChainId())
+				return nil, nil, nil, nil, fmt.Errorf("Invalid transaction chain id. Current chain id: %v tx chain id: %v", p.config.GetChainID(), tx.ChainId())
 			}
 		}
 		statedb.StartRecord(tx.Hash(), block.Hash(), i)
-		if UseSputnikVM != "true" {
-			receipt, logs, _, err := ApplyTransaction(p.config, p.bc, gp, statedb, header, tx, totalUsedGas)
-			if err != nil {
-				return nil, nil, totalUsedGas, err
-			}
-			receipts = append(receipts, receipt)
-			allLogs = append(allLogs, logs...)
-			continue
+		// Execute the transaction with the other VM too in cross-check mode
+		var shadow *vmShadow
+		if crossCheck != nil {
+			shadow = crossCheck.shadow(statedb, gp, totalUsedGas)
+		}
+		var (
+			receipt *types.Receipt
+			logs    vm.Logs
+			gas     *big.Int
+			err     error
+			tracer  *vm.CallTracer
+		)
+		// Internal transactions are only traced by the native EVM
+		if traceInternal && executorName == NativeTxExecutor {
+			tracer = vm.NewCallTracer()
+			receipt, logs, gas, err = applyTransaction(p.config, p.bc, gp, statedb, header, tx, totalUsedGas, tracer)
+		} else {
+			receipt, logs, gas, err = executor.ApplyTransaction(p.config, p.bc, gp, statedb, header, tx, totalUsedGas)
+		}
+		if shadow != nil {
+			crossCheck.check(shadow, p.config, p.bc, header, i, tx, txOutcome{receipt, gas, err})
 		}
-		receipt, logs, _, err := ApplyMultiVmTransaction(p.config, p.bc, gp, statedb, header, tx, totalUsedGas)
 		if err != nil {
-			return nil, nil, totalUsedGas, err
+			return nil, nil, totalUsedGas, nil, err
 		}
 		receipts = append(receipts, receipt)
 		allLogs = append(allLogs, logs...)
+		if tracer != nil {
+			internalTxs = append(internalTxs, internalTxsFromCallTree(block.NumberU64(), tx.Hash(), tracer.Result())...)
+		}
 	}
 	AccumulateRewards(p.config, statedb, header, block.Uncles())
 
-	return receipts, allLogs, totalUsedGas, err
+	return receipts, allLogs, totalUsedGas, internalTxs, err
 }
 
 // ApplyTransaction attempts to apply a transaction to the given state database
@@ -111,16 +138,31 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB) (ty
 // ApplyTransactions returns the generated receipts and vm logs during the
 // execution of the state transition phase.
 func ApplyTransaction(config *ChainConfig, bc *BlockChain, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *big.Int) (*types.Receipt, vm.Logs, *big.Int, error) {
+	return applyTransaction(config, bc, gp, statedb, header, tx, usedGas, nil)
+}
+
+// applyTransaction is ApplyTransaction reporting the execution of the transaction
+// to the given call tracer, if not nil.
+func applyTransaction(config *ChainConfig, bc *BlockChain, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *big.Int, tracer *vm.CallTracer) (*types.Receipt, vm.Logs, *big.Int, error) {
 	tx.SetSigner(config.GetSigner(header.Number))
 
-	_, gas, failed, err := ApplyMessage(NewEnv(statedb, config, bc, tx, header), tx, gp)
+	env := NewEnv(statedb, config, bc, tx, header)
+	if tracer != nil {
+		env = NewTracingEnv(statedb, config, bc, tx, header, tracer)
+	}
+	_, gas, failed, err := ApplyMessage(env, tx, gp)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
 	// Update the state with pending changes
 	usedGas.Add(usedGas, gas)
-	receipt := types.NewReceipt(statedb.IntermediateRoot(false).Bytes(), usedGas)
+	// Byzantium receipts carry the status code in place of the intermediate root
+	root := statedb.IntermediateRoot(false).Bytes()
+	if config.IsByzantium(header.Number) {
+		root = nil
+	}
+	receipt := types.NewReceipt(root, usedGas)
 	receipt.TxHash = tx.Hash()
 	receipt.GasUsed = new(big.Int).Set(gas)
 	if MessageCreatesContract(tx) {
@@ -0,0 +1,173 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/rlp"
+	"github.com/ethereumproject/go-ethereum/trie"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// pruneBatchSize is the number of deletions written at once by PruneState.
+const pruneBatchSize = 10000
+
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// PruneStateResult reports the outcome of PruneState.
+type PruneStateResult struct {
+	Roots     int                // Number of state roots kept
+	Reachable int                // Number of trie nodes and contract codes reachable from the roots
+	Deleted   int                // Number of trie nodes deleted
+	Reclaimed common.StorageSize // Size of the deleted keys and values
+}
+
+// PruneStateRoots returns the state roots of the last given number of canonical blocks,
+// head included, whose state is present in the database. It fails if the state of
+// the head block is missing.
+func PruneStateRoots(db ethdb.Database, blocks uint64) ([]common.Hash, error) {
+	head := GetBlock(db, GetHeadBlockHash(db))
+	if head == nil {
+		return nil, fmt.Errorf("head block missing")
+	}
+	if fast := GetHeadFastBlockHash(db); fast != (common.Hash{}) && fast != head.Hash() {
+		return nil, fmt.Errorf("head fast block %x… differs from head block %x…, chain is being synced", fast[:4], head.Hash().Bytes()[:4])
+	}
+	if ok, _ := db.Has(head.Root().Bytes()); !ok {
+		return nil, fmt.Errorf("head block #%d state %x… missing", head.NumberU64(), head.Root().Bytes()[:4])
+	}
+	var roots []common.Hash
+	for n := head.NumberU64(); head.NumberU64()-n < blocks; n-- {
+		header := GetHeader(db, GetCanonicalHash(db, n))
+		if header == nil {
+			return nil, fmt.Errorf("canonical header #%d missing", n)
+		}
+		if ok, _ := db.Has(header.Root.Bytes()); ok {
+			roots = append(roots, header.Root)
+		}
+		if n == 0 {
+			break
+		}
+	}
+	return roots, nil
+}
+
+// PruneState deletes from the database every trie node not reachable from the given
+// state roots. It must not be run while the database is in use, eg. by a running
+// node. Contract codes are never deleted.
+func PruneState(db *ethdb.LDBDatabase, roots []common.Hash) (*PruneStateResult, error) {
+	res := &PruneStateResult{Roots: len(roots)}
+
+	// Mark the nodes reachable from the roots. The subtries of the nodes already
+	// marked are skipped, since they are shared with a state walked before.
+	start := time.Now()
+	marked := make(map[common.Hash]struct{})
+	for _, root := range roots {
+		if err := markTrie(db, root, marked, true); err != nil {
+			return nil, fmt.Errorf("state %x…: %v", root[:4], err)
+		}
+		glog.V(logger.Info).Infof("marked state %x…, %d reachable nodes", root[:4], len(marked))
+	}
+	res.Reachable = len(marked)
+	glog.V(logger.Info).Infof("marked %d reachable nodes of %d states in %v", len(marked), len(roots), time.Since(start))
+
+	// Sweep the unmarked trie nodes, the only 32 bytes keys holding content whose
+	// hash is the key and which is encoded as a trie node.
+	start = time.Now()
+	batch := new(leveldb.Batch)
+	it := db.NewIterator()
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+		if len(key) != common.HashLength {
+			continue
+		}
+		if _, ok := marked[common.BytesToHash(key)]; ok || !trie.IsNode(key, value) {
+			continue
+		}
+		batch.Delete(key)
+		res.Deleted++
+		res.Reclaimed += common.StorageSize(len(key) + len(value))
+
+		if batch.Len() >= pruneBatchSize {
+			if err := db.LDB().Write(batch, nil); err != nil {
+				it.Release()
+				return nil, err
+			}
+			batch.Reset()
+			glog.V(logger.Info).Infof("deleted %d unreachable nodes (%v)", res.Deleted, res.Reclaimed)
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	if err := db.LDB().Write(batch, nil); err != nil {
+		return nil, err
+	}
+	glog.V(logger.Info).Infof("deleted %d unreachable nodes (%v) in %v", res.Deleted, res.Reclaimed, time.Since(start))
+	return res, nil
+}
+
+// markTrie marks the nodes of the trie with the given root, and if it is a state
+// trie, the storage tries and codes of its accounts.
+func markTrie(db ethdb.Database, root common.Hash, marked map[common.Hash]struct{}, accounts bool) error {
+	if root == (common.Hash{}) || root == types.EmptyRootHash {
+		return nil
+	}
+	if _, ok := marked[root]; ok {
+		return nil
+	}
+	tr, err := trie.New(root, db)
+	if err != nil {
+		return err
+	}
+	it := tr.NodeIterator(nil)
+	for descend := true; it.Next(descend); {
+		descend = true
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			if _, ok := marked[hash]; ok {
+				descend = false
+				continue
+			}
+			marked[hash] = struct{}{}
+		}
+		if !accounts || !it.Leaf() {
+			continue
+		}
+		var account state.Account
+		if err := rlp.Decode(bytes.NewReader(it.LeafBlob()), &account); err != nil {
+			return err
+		}
+		if err := markTrie(db, account.Root, marked, false); err != nil {
+			return err
+		}
+		if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCodeHash {
+			marked[codeHash] = struct{}{}
+		}
+	}
+	return it.Error()
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/rlp"
+)
+
+const (
+	// stateSnapshotVersion is the version of the state snapshot format.
+	stateSnapshotVersion = 1
+
+	// stateSnapshotAncestors is the number of ancestors of the block included in
+	// a state snapshot, enough for the BLOCKHASH opcode and uncle validation of
+	// the following blocks.
+	stateSnapshotAncestors = 256
+)
+
+var errStateSnapshotVersion = errors.New("unsupported state snapshot version")
+
+// stateSnapshotHeader is the first record of a state snapshot, followed by the
+// records of state.Export. A state snapshot is a gzip compressed stream of RLP
+// records.
+type stateSnapshotHeader struct {
+	Version   uint64
+	Genesis   common.Hash    // Hash of the genesis block of the chain
+	Block     *types.Block   // Block the state belongs to
+	TD        *big.Int       // Total difficulty of the block
+	Ancestors []*types.Block // Ancestors of the block, parent first
+}
+
+// ExportState writes a snapshot of the state of the given canonical block to w,
+// along with the block and enough of its ancestors for a node to continue the
+// chain from it.
+func (bc *BlockChain) ExportState(w io.Writer, block *types.Block) error {
+	statedb, err := bc.StateAt(block.Root())
+	if err != nil {
+		return fmt.Errorf("state of block #%d missing: %v", block.NumberU64(), err)
+	}
+	header := &stateSnapshotHeader{
+		Version: stateSnapshotVersion,
+		Genesis: bc.Genesis().Hash(),
+		Block:   block,
+		TD:      bc.GetTd(block.Hash()),
+	}
+	if header.TD == nil {
+		return fmt.Errorf("total difficulty of block #%d missing", block.NumberU64())
+	}
+	for parent := block; parent.NumberU64() > 1 && len(header.Ancestors) < stateSnapshotAncestors; {
+		if parent = bc.GetBlock(parent.ParentHash()); parent == nil {
+			return fmt.Errorf("ancestor of block #%d missing", block.NumberU64())
+		}
+		header.Ancestors = append(header.Ancestors, parent)
+	}
+
+	start := time.Now()
+	zw := gzip.NewWriter(w)
+	if err := rlp.Encode(zw, header); err != nil {
+		return err
+	}
+	accounts, err := statedb.Export(zw)
+	if err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	glog.V(logger.Info).Infof("exported state of block #%d [%x…] with %d accounts in %v", block.NumberU64(), block.Hash().Bytes()[:4], accounts, time.Since(start))
+	return nil
+}
+
+// ImportState imports a state snapshot written by ExportState into the chain
+// database, which must not be in use, and returns its block. The state is checked
+// against the state root of the block. If the block is not known locally, the
+// database must hold no other block than the genesis one: the block and its
+// ancestors in the snapshot are then written as the canonical chain, the block
+// becoming the head.
+func ImportState(db ethdb.Database, r io.Reader) (*types.Block, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	stream := rlp.NewStream(zr, 0)
+
+	header := new(stateSnapshotHeader)
+	if err := stream.Decode(header); err != nil {
+		return nil, err
+	}
+	if header.Version != stateSnapshotVersion {
+		return nil, errStateSnapshotVersion
+	}
+	block := header.Block
+	if genesis := GetCanonicalHash(db, 0); genesis != header.Genesis {
+		return nil, fmt.Errorf("genesis mismatch: have %x, want %x", genesis, header.Genesis)
+	}
+	// Check that the ancestors are a chain ending at the block.
+	child := block
+	for _, ancestor := range header.Ancestors {
+		if ancestor.Hash() != child.ParentHash() || ancestor.NumberU64()+1 != child.NumberU64() {
+			return nil, fmt.Errorf("ancestor #%d is not the parent of #%d", ancestor.Number(), child.Number())
+		}
+		child = ancestor
+	}
+
+	known := GetHeader(db, block.Hash()) != nil
+	if !known {
+		if head := GetBlock(db, GetHeadBlockHash(db)); head == nil || head.NumberU64() != 0 {
+			return nil, errors.New("snapshot block unknown and database not empty")
+		}
+	}
+
+	start := time.Now()
+	root, accounts, err := state.Import(db, stream)
+	if err != nil {
+		return nil, err
+	}
+	if root != block.Root() {
+		return nil, fmt.Errorf("state root mismatch: have %x, want %x", root, block.Root())
+	}
+	glog.V(logger.Info).Infof("imported state of block #%d [%x…] with %d accounts in %v", block.NumberU64(), block.Hash().Bytes()[:4], accounts, time.Since(start))
+
+	if known {
+		// Only move the head up to the block if it is canonical.
+		head := GetBlock(db, GetHeadBlockHash(db))
+		if GetCanonicalHash(db, block.NumberU64()) == block.Hash() && (head == nil || head.NumberU64() < block.NumberU64()) {
+			if err := WriteHeadBlockHash(db, block.Hash()); err != nil {
+				return nil, err
+			}
+		}
+		return block, nil
+	}
+
+	// Write the chain segment of the snapshot, the total difficulties of the
+	// ancestors following from the one of the block.
+	td := new(big.Int).Sub(header.TD, block.Difficulty())
+	for _, ancestor := range header.Ancestors {
+		if err := WriteBlock(db, ancestor); err != nil {
+			return nil, err
+		}
+		if err := WriteTd(db, ancestor.Hash(), td); err != nil {
+			return nil, err
+		}
+		if err := WriteCanonicalHash(db, ancestor.Hash(), ancestor.NumberU64()); err != nil {
+			return nil, err
+		}
+		td = new(big.Int).Sub(td, ancestor.Difficulty())
+	}
+	if err := WriteBlock(db, block); err != nil {
+		return nil, err
+	}
+	if err := WriteTd(db, block.Hash(), header.TD); err != nil {
+		return nil, err
+	}
+	if err := WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+		return nil, err
+	}
+	if err := WriteHeadHeaderHash(db, block.Hash()); err != nil {
+		return nil, err
+	}
+	if err := WriteHeadFastBlockHash(db, block.Hash()); err != nil {
+		return nil, err
+	}
+	if err := WriteHeadBlockHash(db, block.Hash()); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
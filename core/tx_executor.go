@@ -0,0 +1,127 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/core/vm"
+)
+
+// NativeTxExecutor is the name of the executor running transactions with the
+// native EVM, the default one.
+const NativeTxExecutor = "native"
+
+// TxExecutor is a VM backend executing the transactions of the blocks processed
+// by the chain. Backends register themselves with RegisterTxExecutor, usually
+// from an init function, and are selected with SetTxExecutor.
+type TxExecutor interface {
+	// ApplyTransaction applies a transaction to the given state, with the same
+	// semantics as the package level ApplyTransaction.
+	ApplyTransaction(config *ChainConfig, bc *BlockChain, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *big.Int) (*types.Receipt, vm.Logs, *big.Int, error)
+}
+
+// TxExecutorFunc is an adapter to use a function as a TxExecutor.
+type TxExecutorFunc func(config *ChainConfig, bc *BlockChain, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *big.Int) (*types.Receipt, vm.Logs, *big.Int, error)
+
+// ApplyTransaction calls f.
+func (f TxExecutorFunc) ApplyTransaction(config *ChainConfig, bc *BlockChain, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *big.Int) (*types.Receipt, vm.Logs, *big.Int, error) {
+	return f(config, bc, gp, statedb, header, tx, usedGas)
+}
+
+// DefaultTxExecutor is the name of the executor processing blocks until another
+// one is selected with SetTxExecutor. Being a string variable, it can be set at
+// link time to run all the packages of a build with another VM, e.g.
+//	go test -ldflags "-X github.com/ethereumproject/go-ethereum/core.DefaultTxExecutor=sputnikvm" ./...
+var DefaultTxExecutor = NativeTxExecutor
+
+var (
+	txExecutorsMu  sync.RWMutex
+	txExecutors    = map[string]TxExecutor{NativeTxExecutor: TxExecutorFunc(ApplyTransaction)}
+	txExecutorName = DefaultTxExecutor // Name of the executor in use
+)
+
+// RegisterTxExecutor makes a transaction executor available under the given name.
+// It panics if the name is already taken.
+func RegisterTxExecutor(name string, executor TxExecutor) {
+	txExecutorsMu.Lock()
+	defer txExecutorsMu.Unlock()
+
+	if _, ok := txExecutors[name]; ok {
+		panic(fmt.Sprintf("transaction executor %q registered twice", name))
+	}
+	txExecutors[name] = executor
+}
+
+// GetTxExecutor returns the transaction executor registered under the given name.
+func GetTxExecutor(name string) (TxExecutor, error) {
+	txExecutorsMu.RLock()
+	defer txExecutorsMu.RUnlock()
+
+	executor, ok := txExecutors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown VM %q, available: %v", name, txExecutorNames())
+	}
+	return executor, nil
+}
+
+// TxExecutorNames returns the sorted names of the registered transaction executors.
+func TxExecutorNames() []string {
+	txExecutorsMu.RLock()
+	defer txExecutorsMu.RUnlock()
+
+	return txExecutorNames()
+}
+
+func txExecutorNames() []string {
+	names := make([]string, 0, len(txExecutors))
+	for name := range txExecutors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetTxExecutor selects the registered transaction executor processing blocks.
+func SetTxExecutor(name string) error {
+	if _, err := GetTxExecutor(name); err != nil {
+		return err
+	}
+	txExecutorsMu.Lock()
+	txExecutorName = name
+	txExecutorsMu.Unlock()
+	return nil
+}
+
+// CurrentTxExecutor returns the name of the transaction executor processing
+// blocks, and the executor itself. It panics if the default executor set at
+// link time is not registered in this build.
+func CurrentTxExecutor() (string, TxExecutor) {
+	txExecutorsMu.RLock()
+	defer txExecutorsMu.RUnlock()
+
+	executor, ok := txExecutors[txExecutorName]
+	if !ok {
+		panic(fmt.Sprintf("transaction executor %q not registered, available: %v", txExecutorName, txExecutorNames()))
+	}
+	return txExecutorName, executor
+}
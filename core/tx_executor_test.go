@@ -0,0 +1,105 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/core/vm"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+)
+
+// Tests that blocks are processed by the selected transaction executor.
+func TestTxExecutor(t *testing.T) {
+	if _, err := GetTxExecutor("executor-unknown"); err == nil {
+		t.Fatal("unknown executor found")
+	}
+	if err := SetTxExecutor("executor-unknown"); err == nil {
+		t.Fatal("unknown executor selected")
+	}
+
+	var applied int32
+	RegisterTxExecutor("executor-test", TxExecutorFunc(func(config *ChainConfig, bc *BlockChain, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *big.Int) (*types.Receipt, vm.Logs, *big.Int, error) {
+		atomic.AddInt32(&applied, 1)
+		return ApplyTransaction(config, bc, gp, statedb, header, tx, usedGas)
+	}))
+	defer unregisterTxExecutor("executor-test")
+
+	found := false
+	for _, name := range TxExecutorNames() {
+		found = found || name == "executor-test"
+	}
+	if !found {
+		t.Fatalf("registered executor not listed: %v", TxExecutorNames())
+	}
+
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	var (
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		signer   = types.NewChainIdSigner(big.NewInt(63))
+		config   = MakeDiehardChainConfig()
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000)})
+	WriteGenesisBlockForTesting(gendb, GenesisAccount{addr, big.NewInt(1000000)})
+
+	blocks, _ := GenerateChain(config, genesis, gendb, 3, func(i int, gen *BlockGen) {
+		tx, err := types.NewTransaction(gen.TxNonce(addr), common.BigToAddress(big.NewInt(0x1000)), big.NewInt(1000), TxGas, nil, nil).WithSigner(signer).SignECDSA(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.AddTx(tx)
+	})
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blockchain.Stop()
+
+	previous, _ := CurrentTxExecutor()
+	if err := SetTxExecutor("executor-test"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTxExecutor(previous)
+
+	if name, _ := CurrentTxExecutor(); name != "executor-test" {
+		t.Fatalf("current executor mismatch: have %s, want executor-test", name)
+	}
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+	if n := atomic.LoadInt32(&applied); n != 3 {
+		t.Errorf("applied transactions mismatch: have %d, want 3", n)
+	}
+}
+
+// unregisterTxExecutor removes a transaction executor registered by a test, so
+// that the test can run again in the same process.
+func unregisterTxExecutor(name string) {
+	txExecutorsMu.Lock()
+	defer txExecutorsMu.Unlock()
+
+	delete(txExecutors, name)
+}
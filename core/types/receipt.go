@@ -17,6 +17,7 @@
 package types
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"math/big"
@@ -54,10 +55,44 @@ func NewReceipt(root []byte, cumulativeGasUsed *big.Int) *Receipt {
 	return &Receipt{PostState: common.CopyBytes(root), CumulativeGasUsed: new(big.Int).Set(cumulativeGasUsed), Status: TxStatusUnknown}
 }
 
+var (
+	receiptStatusFailedRLP     = []byte{}
+	receiptStatusSuccessfulRLP = []byte{0x01}
+)
+
+// statusEncoding returns the first consensus field of the receipt: the post
+// state root, or, for receipts created without one (byzantium), the EIP-658
+// status code.
+func (r *Receipt) statusEncoding() []byte {
+	if len(r.PostState) > 0 {
+		return r.PostState
+	}
+	if r.Status == TxSuccess {
+		return receiptStatusSuccessfulRLP
+	}
+	return receiptStatusFailedRLP
+}
+
+// setStatus parses the first consensus field of a receipt, which is either
+// a post state root or an EIP-658 status code.
+func (r *Receipt) setStatus(postStateOrStatus []byte) error {
+	switch {
+	case len(postStateOrStatus) == len(common.Hash{}):
+		r.PostState, r.Status = postStateOrStatus, TxStatusUnknown
+	case bytes.Equal(postStateOrStatus, receiptStatusSuccessfulRLP):
+		r.PostState, r.Status = nil, TxSuccess
+	case bytes.Equal(postStateOrStatus, receiptStatusFailedRLP):
+		r.PostState, r.Status = nil, TxFailure
+	default:
+		return fmt.Errorf("invalid receipt status %x", postStateOrStatus)
+	}
+	return nil
+}
+
 // EncodeRLP implements rlp.Encoder, and flattens the consensus fields of a receipt
 // into an RLP stream.
 func (r *Receipt) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, []interface{}{r.PostState, r.CumulativeGasUsed, r.Bloom, r.Logs})
+	return rlp.Encode(w, []interface{}{r.statusEncoding(), r.CumulativeGasUsed, r.Bloom, r.Logs})
 }
 
 // DecodeRLP implements rlp.Decoder, and loads the consensus fields of a receipt
@@ -72,7 +107,10 @@ func (r *Receipt) DecodeRLP(s *rlp.Stream) error {
 	if err := s.Decode(&receipt); err != nil {
 		return err
 	}
-	r.PostState, r.CumulativeGasUsed, r.Bloom, r.Logs = receipt.PostState, receipt.CumulativeGasUsed, receipt.Bloom, receipt.Logs
+	if err := r.setStatus(receipt.PostState); err != nil {
+		return err
+	}
+	r.CumulativeGasUsed, r.Bloom, r.Logs = receipt.CumulativeGasUsed, receipt.Bloom, receipt.Logs
 	return nil
 }
 
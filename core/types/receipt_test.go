@@ -0,0 +1,74 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/rlp"
+)
+
+func TestReceiptStatusRLP(t *testing.T) {
+	root := common.HexToHash("0x0102").Bytes()
+	tests := []struct {
+		postState []byte
+		status    ReceiptStatus
+		wantFirst []byte
+		decoded   ReceiptStatus
+	}{
+		{root, TxSuccess, root, TxStatusUnknown},
+		{nil, TxSuccess, []byte{0x01}, TxSuccess},
+		{nil, TxFailure, []byte{}, TxFailure},
+	}
+	for i, test := range tests {
+		receipt := NewReceipt(test.postState, big.NewInt(21000))
+		receipt.Status = test.status
+
+		enc, err := rlp.EncodeToBytes(receipt)
+		if err != nil {
+			t.Fatalf("test %d: encode failed: %v", i, err)
+		}
+		var fields []rlp.RawValue
+		if err := rlp.DecodeBytes(enc, &fields); err != nil {
+			t.Fatalf("test %d: decode fields failed: %v", i, err)
+		}
+		var first []byte
+		if err := rlp.DecodeBytes(fields[0], &first); err != nil {
+			t.Fatalf("test %d: decode first field failed: %v", i, err)
+		}
+		if !bytes.Equal(first, test.wantFirst) {
+			t.Errorf("test %d: first field mismatch: have %x, want %x", i, first, test.wantFirst)
+		}
+
+		var dec Receipt
+		if err := rlp.DecodeBytes(enc, &dec); err != nil {
+			t.Fatalf("test %d: decode failed: %v", i, err)
+		}
+		if !bytes.Equal(dec.PostState, test.postState) || dec.Status != test.decoded {
+			t.Errorf("test %d: decoded mismatch: have %x/%v, want %x/%v", i, dec.PostState, dec.Status, test.postState, test.decoded)
+		}
+	}
+
+	var dec Receipt
+	enc, _ := rlp.EncodeToBytes([]interface{}{[]byte{0x02}, big.NewInt(0), Bloom{}, []interface{}{}})
+	if err := rlp.DecodeBytes(enc, &dec); err == nil {
+		t.Error("expected invalid status to fail")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common"
+)
+
+// CallFrame is a single node of the call tree collected by CallTracer.
+type CallFrame struct {
+	Type    OpCode
+	From    common.Address
+	To      common.Address
+	Value   *big.Int
+	Gas     *big.Int
+	GasUsed *big.Int
+	Input   []byte
+	Output  []byte
+	Err     error
+	Calls   []*CallFrame
+}
+
+// CallTracer is a Tracer that, instead of recording every step of the VM,
+// collects the tree of message calls, contract creations and suicides made
+// during an execution.
+type CallTracer struct {
+	root   *CallFrame
+	frames []*CallFrame // stack of currently open frames
+	lastOp OpCode       // last opcode executed in the innermost open frame
+}
+
+// NewCallTracer returns a new call tree tracer.
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+// CaptureEnter opens a new call frame. The kind of the frame is derived from
+// the opcode which was last executed by the parent frame.
+func (t *CallTracer) CaptureEnter(env Environment, contract *Contract, input []byte, depth int) error {
+	frame := &CallFrame{
+		Type:  CALL,
+		From:  contract.Caller(),
+		To:    contract.Address(),
+		Value: new(big.Int).Set(contract.Value()),
+		Gas:   new(big.Int).Set(contract.Gas),
+		Input: common.CopyBytes(input),
+	}
+	if contract.CodeAddr != nil {
+		frame.To = *contract.CodeAddr
+	}
+	if len(t.frames) == 0 {
+		if contract.CodeAddr == nil {
+			frame.Type = CREATE
+		}
+	} else {
+		switch t.lastOp {
+		case CREATE, CALLCODE, DELEGATECALL, STATICCALL:
+			frame.Type = t.lastOp
+		}
+	}
+	if contract.CodeAddr == nil {
+		// the input of a creation is the init code
+		frame.Input = common.CopyBytes(contract.Code)
+	}
+
+	if len(t.frames) == 0 {
+		t.root = frame
+	} else {
+		parent := t.frames[len(t.frames)-1]
+		parent.Calls = append(parent.Calls, frame)
+	}
+	t.frames = append(t.frames, frame)
+
+	return nil
+}
+
+// CaptureState records the opcode about to be executed so that a subsequent
+// CaptureEnter knows which kind of call created the new frame. Suicides do not
+// run in a frame of their own and are recorded here, transferring the whole
+// balance of the contract to the beneficiary.
+func (t *CallTracer) CaptureState(env Environment, pc uint64, op OpCode, gas, cost *big.Int, memory *Memory, stack []*big.Int, contract *Contract, depth int, err error) error {
+	t.lastOp = op
+
+	if op == SUICIDE && err == nil && len(t.frames) > 0 && len(stack) > 0 {
+		parent := t.frames[len(t.frames)-1]
+		parent.Calls = append(parent.Calls, &CallFrame{
+			Type:    SUICIDE,
+			From:    contract.Address(),
+			To:      common.BigToAddress(stack[len(stack)-1]),
+			Value:   new(big.Int).Set(env.Db().GetBalance(contract.Address())),
+			Gas:     new(big.Int),
+			GasUsed: new(big.Int),
+		})
+	}
+	return nil
+}
+
+// CaptureExit closes the innermost open call frame.
+func (t *CallTracer) CaptureExit(env Environment, output []byte, gasUsed *big.Int, err error) error {
+	if len(t.frames) == 0 {
+		return nil
+	}
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+
+	frame.GasUsed = new(big.Int).Set(gasUsed)
+	frame.Output = common.CopyBytes(output)
+	frame.Err = err
+
+	return nil
+}
+
+// Result returns the root of the collected call tree, or nil if nothing
+// was executed.
+func (t *CallTracer) Result() *CallFrame {
+	return t.root
+}
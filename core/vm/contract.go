@@ -53,6 +53,12 @@ type Contract struct {
 	Args []byte
 
 	DelegateCall bool
+	// ReadOnly disallows state modifications, in the contract and in the
+	// ones it calls. It is set by STATICCALL.
+	ReadOnly bool
+
+	returnData []byte   // output of the last call made by the contract
+	traceGas   *big.Int // gas available when a traced run was entered
 }
 
 // NewContract returns a new contract environment for the execution of EVM.
@@ -62,6 +68,8 @@ func NewContract(caller ContractRef, object ContractRef, value, gas, price *big.
 	if parent, ok := caller.(*Contract); ok {
 		// Reuse JUMPDEST analysis from parent context if available.
 		c.jumpdests = parent.jumpdests
+		// Calls made in a static context are static too
+		c.ReadOnly = parent.ReadOnly
 	} else {
 		c.jumpdests = make(destinations)
 	}
@@ -88,6 +96,13 @@ func (c *Contract) AsDelegate() *Contract {
 	return c
 }
 
+// AsStatic sets the contract to be a static call and returns the current
+// contract (for chaining calls)
+func (c *Contract) AsStatic() *Contract {
+	c.ReadOnly = true
+	return c
+}
+
 // GetOp returns the n'th element in the contract's byte array
 func (c *Contract) GetOp(n uint64) OpCode {
 	return OpCode(c.GetByte(n))
@@ -1,84 +1,157 @@
-// Copyright 2014 The go-ethereum Authors
-// This file is part of the go-ethereum library.
-//
-// The go-ethereum library is free software: you can redistribute it and/or modify
-// it under the terms of the GNU Lesser General Public License as published by
-// the Free Software Foundation, either version 3 of the License, or
-// (at your option) any later version.
-//
-// The go-ethereum library is distributed in the hope that it will be useful,
-// but WITHOUT ANY WARRANTY; without even the implied warranty of
-// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
-// GNU Lesser General Public License for more details.
-//
-// You should have received a copy of the GNU Lesser General Public License
-// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
-
 package vm
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
 
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/crypto/bn256"
 	"github.com/ethereumproject/go-ethereum/logger"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
 )
 
+var (
+	errBN256InvalidPoint = errors.New("bn256: invalid point")
+	errBN256InvalidInput = errors.New("bn256: invalid input length")
+)
+
 // PrecompiledAccount represents a native ethereum contract
 type PrecompiledAccount struct {
-	Gas func(l int) *big.Int
-	fn  func(in []byte) []byte
+	Gas func(in []byte) *big.Int
+	fn  func(in []byte) ([]byte, error)
 }
 
 // Call calls the native function
-func (self PrecompiledAccount) Call(in []byte) []byte {
+func (self PrecompiledAccount) Call(in []byte) ([]byte, error) {
 	return self.fn(in)
 }
 
 // Precompiled contains the default set of ethereum contracts
 var Precompiled = PrecompiledContracts()
 
+// PrecompiledByzantium contains the default set of ethereum contracts along
+// with the byzantium ones.
+var PrecompiledByzantium = mustPrecompiledContracts(ByzantiumPrecompiledSpecs())
+
+// Names of the built-in precompiled contracts.
+const (
+	ECRecoverPrecompile      = "ecrecover"
+	SHA256Precompile         = "sha256"
+	RIPEMD160Precompile      = "ripemd160"
+	IdentityPrecompile       = "identity"
+	ModExpPrecompile         = "modexp"
+	BN256AddPrecompile       = "bn256Add"
+	BN256ScalarMulPrecompile = "bn256ScalarMul"
+	BN256PairingPrecompile   = "bn256Pairing"
+)
+
+// precompiledFunc is the function of a built-in precompiled contract along
+// with its gas price, given the base and word prices of its spec.
+type precompiledFunc struct {
+	fn  func(in []byte) ([]byte, error)
+	gas func(in []byte, base, word *big.Int) *big.Int
+}
+
+// precompiledFuncs maps the names of the built-in precompiled contracts to
+// their functions.
+var precompiledFuncs = map[string]precompiledFunc{
+	ECRecoverPrecompile:      {ecrecoverFunc, wordGas},
+	SHA256Precompile:         {sha256Func, wordGas},
+	RIPEMD160Precompile:      {ripemd160Func, wordGas},
+	IdentityPrecompile:       {memCpy, wordGas},
+	ModExpPrecompile:         {modExpFunc, modExpGas},
+	BN256AddPrecompile:       {bn256AddFunc, wordGas},
+	BN256ScalarMulPrecompile: {bn256ScalarMulFunc, wordGas},
+	BN256PairingPrecompile:   {bn256PairingFunc, bn256PairingGas},
+}
+
+// PrecompiledSpec places a built-in precompiled contract at an address, with a
+// gas price of Base plus Word for every 32 bytes word of input. Word is the
+// price of every pair of points for bn256Pairing instead, and the divisor of
+// the complexity of the exponentiation for modexp.
+type PrecompiledSpec struct {
+	Name    string
+	Address common.Address
+	Base    *big.Int
+	Word    *big.Int
+}
+
+// DefaultPrecompiledSpecs returns the specs of the precompiled contracts
+// defined by the ethereum yellow paper.
+func DefaultPrecompiledSpecs() []*PrecompiledSpec {
+	return []*PrecompiledSpec{
+		{ECRecoverPrecompile, common.BytesToAddress([]byte{1}), big.NewInt(3000), big.NewInt(0)},
+		{SHA256Precompile, common.BytesToAddress([]byte{2}), big.NewInt(60), big.NewInt(12)},
+		{RIPEMD160Precompile, common.BytesToAddress([]byte{3}), big.NewInt(600), big.NewInt(120)},
+		{IdentityPrecompile, common.BytesToAddress([]byte{4}), big.NewInt(15), big.NewInt(3)},
+	}
+}
+
+// ByzantiumPrecompiledSpecs returns the specs of the default precompiled
+// contracts along with the ones of the byzantium fork: modexp (EIP-198) and
+// the alt_bn128 curve operations (EIP-196 and EIP-197).
+func ByzantiumPrecompiledSpecs() []*PrecompiledSpec {
+	return append(DefaultPrecompiledSpecs(),
+		&PrecompiledSpec{ModExpPrecompile, common.BytesToAddress([]byte{5}), big.NewInt(0), big.NewInt(20)},
+		&PrecompiledSpec{BN256AddPrecompile, common.BytesToAddress([]byte{6}), big.NewInt(500), big.NewInt(0)},
+		&PrecompiledSpec{BN256ScalarMulPrecompile, common.BytesToAddress([]byte{7}), big.NewInt(40000), big.NewInt(0)},
+		&PrecompiledSpec{BN256PairingPrecompile, common.BytesToAddress([]byte{8}), big.NewInt(100000), big.NewInt(80000)},
+	)
+}
+
 // PrecompiledContracts returns the default set of precompiled ethereum
 // contracts defined by the ethereum yellow paper.
 func PrecompiledContracts() map[string]*PrecompiledAccount {
-	return map[string]*PrecompiledAccount{
-		// ECRECOVER
-		string(common.LeftPadBytes([]byte{1}, 20)): {func(l int) *big.Int {
-			return big.NewInt(3000)
-		}, ecrecoverFunc},
-
-		// SHA256
-		string(common.LeftPadBytes([]byte{2}, 20)): {func(l int) *big.Int {
-			n := big.NewInt(int64(l+31) / 32)
-			n.Mul(n, big.NewInt(12))
-			return n.Add(n, big.NewInt(60))
-		}, sha256Func},
+	return mustPrecompiledContracts(DefaultPrecompiledSpecs())
+}
 
-		// RIPEMD160
-		string(common.LeftPadBytes([]byte{3}, 20)): {func(l int) *big.Int {
-			n := big.NewInt(int64(l+31) / 32)
-			n.Mul(n, big.NewInt(120))
-			return n.Add(n, big.NewInt(600))
-		}, ripemd160Func},
+func mustPrecompiledContracts(specs []*PrecompiledSpec) map[string]*PrecompiledAccount {
+	contracts, err := NewPrecompiledContracts(specs)
+	if err != nil {
+		panic(err)
+	}
+	return contracts
+}
 
-		string(common.LeftPadBytes([]byte{4}, 20)): {func(l int) *big.Int {
-			n := big.NewInt(int64(l+31) / 32)
-			n.Mul(n, big.NewInt(3))
-			return n.Add(n, big.NewInt(15))
-		}, memCpy},
+// NewPrecompiledContracts returns the set of precompiled contracts placed by
+// the given specs, keyed by address like Precompiled.
+func NewPrecompiledContracts(specs []*PrecompiledSpec) (map[string]*PrecompiledAccount, error) {
+	contracts := make(map[string]*PrecompiledAccount, len(specs))
+	for _, spec := range specs {
+		f, ok := precompiledFuncs[spec.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown precompiled contract %q", spec.Name)
+		}
+		if _, ok := contracts[spec.Address.Str()]; ok {
+			return nil, fmt.Errorf("several precompiled contracts at %x", spec.Address)
+		}
+		base, word, gas := new(big.Int).Set(spec.Base), new(big.Int).Set(spec.Word), f.gas
+		contracts[spec.Address.Str()] = &PrecompiledAccount{func(in []byte) *big.Int {
+			return gas(in, base, word)
+		}, f.fn}
 	}
+	return contracts, nil
+}
+
+// wordGas returns the base price plus the word price for every 32 bytes word
+// of input.
+func wordGas(in []byte, base, word *big.Int) *big.Int {
+	n := big.NewInt(int64(len(in)+31) / 32)
+	n.Mul(n, word)
+	return n.Add(n, base)
 }
 
-func sha256Func(in []byte) []byte {
-	return crypto.Sha256(in)
+func sha256Func(in []byte) ([]byte, error) {
+	return crypto.Sha256(in), nil
 }
 
-func ripemd160Func(in []byte) []byte {
-	return common.LeftPadBytes(crypto.Ripemd160(in), 32)
+func ripemd160Func(in []byte) ([]byte, error) {
+	return common.LeftPadBytes(crypto.Ripemd160(in), 32), nil
 }
 
-func ecrecoverFunc(in []byte) []byte {
+func ecrecoverFunc(in []byte) ([]byte, error) {
 	in = common.RightPadBytes(in, 128)
 	// "in" is (hash, v, r, s), each 32 bytes
 	// but for ecrecover we want (r, s, v)
@@ -92,7 +165,7 @@ func ecrecoverFunc(in []byte) []byte {
 	// tighter sig s values in homestead only apply to tx sigs
 	if !crypto.ValidateSignatureValues(v, r, s, false) {
 		glog.V(logger.Detail).Infof("ECRECOVER error: v, r or s value invalid")
-		return nil
+		return nil, nil
 	}
 
 	// v needs to be at the end and normalized for libsecp256k1
@@ -103,13 +176,165 @@ func ecrecoverFunc(in []byte) []byte {
 	// make sure the public key is a valid one
 	if err != nil {
 		glog.V(logger.Detail).Infoln("ECRECOVER error: ", err)
-		return nil
+		return nil, nil
 	}
 
 	// the first byte of pubkey is bitcoin heritage
-	return common.LeftPadBytes(crypto.Keccak256(pubKey[1:])[12:], 32)
+	return common.LeftPadBytes(crypto.Keccak256(pubKey[1:])[12:], 32), nil
+}
+
+func memCpy(in []byte) ([]byte, error) {
+	return in, nil
+}
+
+// modExpLengths returns the lengths of the base, exponent and modulus of a
+// modexp input, and the input past them.
+func modExpLengths(in []byte) (baseLen, expLen, modLen *big.Int, data []byte) {
+	header := common.RightPadBytes(in, 96)
+	baseLen = new(big.Int).SetBytes(header[0:32])
+	expLen = new(big.Int).SetBytes(header[32:64])
+	modLen = new(big.Int).SetBytes(header[64:96])
+	if len(in) > 96 {
+		data = in[96:]
+	}
+	return baseLen, expLen, modLen, data
+}
+
+// modExpGas returns the gas price of a modexp input as defined by EIP-198,
+// the complexity of the multiplications times the length of the exponent,
+// divided by the word price, plus the base price.
+func modExpGas(in []byte, base, word *big.Int) *big.Int {
+	baseLen, expLen, modLen, data := modExpLengths(in)
+
+	// The length of the exponent is adjusted to the position of its highest
+	// bit, found in its first 32 bytes
+	headLen := common.BigMin(expLen, big.NewInt(32))
+	head := new(big.Int).SetBytes(getData(data, baseLen, headLen))
+
+	adjExpLen := new(big.Int)
+	if expLen.Cmp(big.NewInt(32)) > 0 {
+		adjExpLen.Sub(expLen, big.NewInt(32))
+		adjExpLen.Mul(adjExpLen, big.NewInt(8))
+	}
+	if bits := head.BitLen(); bits > 0 {
+		adjExpLen.Add(adjExpLen, big.NewInt(int64(bits-1)))
+	}
+	adjExpLen = common.BigMax(adjExpLen, common.Big1)
+
+	// The complexity of the multiplications depends on the largest length
+	x := common.BigMax(baseLen, modLen)
+	gas := new(big.Int).Mul(x, x)
+	switch {
+	case x.Cmp(big.NewInt(64)) <= 0:
+	case x.Cmp(big.NewInt(1024)) <= 0:
+		gas.Div(gas, big.NewInt(4))
+		gas.Add(gas, new(big.Int).Mul(x, big.NewInt(96)))
+		gas.Sub(gas, big.NewInt(3072))
+	default:
+		gas.Div(gas, big.NewInt(16))
+		gas.Add(gas, new(big.Int).Mul(x, big.NewInt(480)))
+		gas.Sub(gas, big.NewInt(199680))
+	}
+	gas.Mul(gas, adjExpLen)
+	if word.Sign() > 0 {
+		gas.Div(gas, word)
+	}
+	return gas.Add(gas, base)
+}
+
+// modExpFunc computes base**exponent % modulus, all of the lengths given by
+// the input, padded to the length of the modulus.
+func modExpFunc(in []byte) ([]byte, error) {
+	baseLen, expLen, modLen, data := modExpLengths(in)
+	if baseLen.Sign() == 0 && modLen.Sign() == 0 {
+		return []byte{}, nil
+	}
+	var (
+		base = new(big.Int).SetBytes(getData(data, common.Big0, baseLen))
+		exp  = new(big.Int).SetBytes(getData(data, baseLen, expLen))
+		mod  = new(big.Int).SetBytes(getData(data, new(big.Int).Add(baseLen, expLen), modLen))
+	)
+	if mod.Sign() == 0 {
+		return common.LeftPadBytes([]byte{}, int(modLen.Int64())), nil
+	}
+	return common.LeftPadBytes(base.Exp(base, exp, mod).Bytes(), int(modLen.Int64())), nil
+}
+
+// newBN256G1 unmarshals a point of G1, checking that it is on the curve.
+func newBN256G1(blob []byte) (*bn256.G1, error) {
+	p, ok := new(bn256.G1).Unmarshal(blob)
+	if !ok {
+		return nil, errBN256InvalidPoint
+	}
+	return p, nil
+}
+
+// newBN256G2 unmarshals a point of G2, checking that it is in the group.
+func newBN256G2(blob []byte) (*bn256.G2, error) {
+	p, ok := new(bn256.G2).Unmarshal(blob)
+	if !ok {
+		return nil, errBN256InvalidPoint
+	}
+	return p, nil
 }
 
-func memCpy(in []byte) []byte {
-	return in
+// bn256AddFunc adds two points of the alt_bn128 curve (EIP-196).
+func bn256AddFunc(in []byte) ([]byte, error) {
+	in = common.RightPadBytes(in, 128)
+	x, err := newBN256G1(in[0:64])
+	if err != nil {
+		return nil, err
+	}
+	y, err := newBN256G1(in[64:128])
+	if err != nil {
+		return nil, err
+	}
+	return new(bn256.G1).Add(x, y).Marshal(), nil
+}
+
+// bn256ScalarMulFunc multiplies a point of the alt_bn128 curve by a scalar
+// (EIP-196).
+func bn256ScalarMulFunc(in []byte) ([]byte, error) {
+	in = common.RightPadBytes(in, 96)
+	p, err := newBN256G1(in[0:64])
+	if err != nil {
+		return nil, err
+	}
+	return new(bn256.G1).ScalarMult(p, new(big.Int).SetBytes(in[64:96])).Marshal(), nil
+}
+
+// bn256PairingGas returns the base price plus the word price for every pair
+// of points of the input.
+func bn256PairingGas(in []byte, base, word *big.Int) *big.Int {
+	n := big.NewInt(int64(len(in) / 192))
+	n.Mul(n, word)
+	return n.Add(n, base)
+}
+
+// bn256PairingFunc checks whether the product of the pairings of the pairs of
+// points of the input is one (EIP-197).
+func bn256PairingFunc(in []byte) ([]byte, error) {
+	if len(in)%192 != 0 {
+		return nil, errBN256InvalidInput
+	}
+	var (
+		cs []*bn256.G1
+		ts []*bn256.G2
+	)
+	for i := 0; i < len(in); i += 192 {
+		c, err := newBN256G1(in[i : i+64])
+		if err != nil {
+			return nil, err
+		}
+		t, err := newBN256G2(in[i+64 : i+192])
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+		ts = append(ts, t)
+	}
+	if bn256.PairingCheck(cs, ts) {
+		return common.LeftPadBytes([]byte{1}, 32), nil
+	}
+	return make([]byte, 32), nil
 }
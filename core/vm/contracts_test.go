@@ -0,0 +1,101 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/common"
+)
+
+const (
+	// the generator of G1, (1, 2), its negation and its double
+	bn256G1    = "0000000000000000000000000000000000000000000000000000000000000001" + "0000000000000000000000000000000000000000000000000000000000000002"
+	bn256NegG1 = "0000000000000000000000000000000000000000000000000000000000000001" + "30644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd45"
+	bn256G1x2  = "030644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd3" + "15ed738c0e0a7c92e7845f96b2ae9c0a68a6a449e3538fc7ff3ebf7a5a18a2c4"
+
+	// the generator of G2, imaginary parts first
+	bn256G2 = "198e9393920d483a7260bfb731fb5d25f1aa493335a9e71297e485b7aef312c2" + "1800deef121f1e76426a00665e5c4479674322d4f75edadd46debd5cd992f6ed" +
+		"090689d0585ff075ec9e99ad690c3395bc4b313370b38ef355acdadcd122975b" + "12c85ea5db8c6deb4aab71808dcb408fe3d1e7690c43d37b4ce6cc0166fa7daa"
+)
+
+func byzantiumPrecompiled(b byte) *PrecompiledAccount {
+	return PrecompiledByzantium[common.BytesToAddress([]byte{b}).Str()]
+}
+
+func TestPrecompiledByzantium(t *testing.T) {
+	word := func(n int64) string { return common.Bytes2Hex(common.LeftPadBytes(big.NewInt(n).Bytes(), 32)) }
+
+	tests := []struct {
+		addr  byte
+		input string
+		gas   int64
+		out   string
+		err   error
+	}{
+		// 3**5 % 100 = 43
+		{5, word(1) + word(1) + word(1) + "03" + "05" + "64", 0, "2b", nil},
+		// the modulus pads the output, a zero modulus gives zero
+		{5, word(1) + word(1) + word(2) + "03" + "05" + "0064", 0, "002b", nil},
+		{5, word(1) + word(1) + word(1) + "03" + "05" + "00", 0, "00", nil},
+
+		{6, bn256G1 + bn256G1, 500, bn256G1x2, nil},
+		{6, bn256G1 + bn256NegG1, 500, word(0) + word(0), nil},
+		{6, "", 500, word(0) + word(0), nil},
+		{6, word(1) + word(3), 500, "", errBN256InvalidPoint},
+
+		{7, bn256G1 + word(2), 40000, bn256G1x2, nil},
+		{7, bn256G1 + word(0), 40000, word(0) + word(0), nil},
+
+		// e(G1, G2) * e(-G1, G2) = 1, the empty product is 1 as well
+		{8, bn256G1 + bn256G2 + bn256NegG1 + bn256G2, 100000 + 2*80000, word(1), nil},
+		{8, bn256G1 + bn256G2 + bn256G1 + bn256G2, 100000 + 2*80000, word(0), nil},
+		{8, "", 100000, word(1), nil},
+		{8, bn256G1, 100000, "", errBN256InvalidInput},
+	}
+	for i, test := range tests {
+		p := byzantiumPrecompiled(test.addr)
+		if p == nil {
+			t.Fatalf("test %d: precompiled contract %d missing", i, test.addr)
+		}
+		in := common.Hex2Bytes(test.input)
+		if gas := p.Gas(in); gas.Cmp(big.NewInt(test.gas)) != 0 {
+			t.Errorf("test %d: gas mismatch: have %v, want %d", i, gas, test.gas)
+		}
+		out, err := p.Call(in)
+		if err != test.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.err)
+			continue
+		}
+		if want := common.Hex2Bytes(test.out); err == nil && !bytes.Equal(out, want) {
+			t.Errorf("test %d: output mismatch: have %x, want %x", i, out, want)
+		}
+	}
+}
+
+func TestPrecompiledByzantiumDefaults(t *testing.T) {
+	if len(PrecompiledByzantium) != len(Precompiled)+4 {
+		t.Errorf("contract count mismatch: have %d, want %d", len(PrecompiledByzantium), len(Precompiled)+4)
+	}
+	for addr := range Precompiled {
+		if PrecompiledByzantium[addr] == nil {
+			t.Errorf("default contract %x missing", addr)
+		}
+	}
+}
@@ -26,9 +26,16 @@ import (
 // execution of the EVM instructions (e.g. whether it's homestead)
 type RuleSet interface {
 	IsHomestead(*big.Int) bool
+	// IsByzantium returns whether the byzantium opcodes (REVERT,
+	// RETURNDATASIZE, RETURNDATACOPY and STATICCALL) are enabled at the
+	// block number passed in.
+	IsByzantium(*big.Int) bool
 	// GasTable returns the gas prices for this phase, which is based on
 	// block number passed in.
 	GasTable(*big.Int) *GasTable
+	// Precompiled returns the precompiled contracts, keyed by address, at the
+	// block number passed in.
+	Precompiled(*big.Int) map[string]*PrecompiledAccount
 }
 
 // Environment is an EVM requirement and helper which allows access to outside
@@ -74,6 +81,8 @@ type Environment interface {
 	CallCode(me ContractRef, addr common.Address, data []byte, gas, price, value *big.Int) ([]byte, error)
 	// Same as CallCode except sender and value is propagated from parent to child scope
 	DelegateCall(me ContractRef, addr common.Address, data []byte, gas, price *big.Int) ([]byte, error)
+	// Call another contract, disallowing any state modification
+	StaticCall(me ContractRef, addr common.Address, data []byte, gas, price *big.Int) ([]byte, error)
 	// Create a new contract
 	Create(me ContractRef, data []byte, gas, price, value *big.Int) ([]byte, common.Address, error)
 }
@@ -84,6 +93,10 @@ type Vm interface {
 	// and return the contract execution return bytes or an error if it
 	// failed.
 	Run(c *Contract, in []byte) ([]byte, error)
+	// CaptureExit should report the end of the run of the given contract,
+	// once the caller has charged all of its gas, eg. burning what remains
+	// on failure or the code deposit of a creation.
+	CaptureExit(c *Contract, ret []byte, err error)
 }
 
 // Database is a EVM database for full state querying.
@@ -181,9 +181,14 @@ var _baseCheck = map[OpCode]req{
 	CALL:         {7, new(big.Int), 1},
 	CALLCODE:     {7, new(big.Int), 1},
 	DELEGATECALL: {6, new(big.Int), 1},
+	STATICCALL:   {6, new(big.Int), 1},
 	SUICIDE:      {1, new(big.Int), 0},
 	JUMPDEST:     {0, big.NewInt(1), 0},
 	RETURN:       {2, new(big.Int), 0},
+	REVERT:       {2, new(big.Int), 0},
 	PUSH1:        {0, GasFastestStep, 1},
 	DUP1:         {0, new(big.Int), 1},
+
+	RETURNDATASIZE: {0, GasQuickStep, 1},
+	RETURNDATACOPY: {3, GasFastestStep, 0},
 }
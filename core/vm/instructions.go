@@ -291,6 +291,20 @@ func opCalldataCopy(instr instruction, pc *uint64, env Environment, contract *Co
 	memory.Set(mOff.Uint64(), l.Uint64(), getData(contract.Input, cOff, l))
 }
 
+func opReturnDataSize(instr instruction, pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) {
+	stack.push(big.NewInt(int64(len(contract.returnData))))
+}
+
+func opReturnDataCopy(instr instruction, pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) {
+	var (
+		mOff = stack.pop()
+		dOff = stack.pop()
+		l    = stack.pop()
+	)
+	// the bounds of the return data are checked along with the gas
+	memory.Set(mOff.Uint64(), l.Uint64(), contract.returnData[dOff.Uint64():dOff.Uint64()+l.Uint64()])
+}
+
 func opExtCodeSize(instr instruction, pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) {
 	addr := common.BigToAddress(stack.pop())
 	l := big.NewInt(int64(env.Db().GetCodeSize(addr)))
@@ -421,7 +435,7 @@ func opCreate(instr instruction, pc *uint64, env Environment, contract *Contract
 	}
 
 	contract.UseGas(gas)
-	_, addr, suberr := env.Create(contract, input, gas, contract.Price, value)
+	ret, addr, suberr := env.Create(contract, input, gas, contract.Price, value)
 	// Push item on the stack based on the returned error. If the ruleset is
 	// homestead we must check for CodeStoreOutOfGasError (homestead only
 	// rule) and treat as an error, if the ruleset is frontier we must
@@ -433,6 +447,12 @@ func opCreate(instr instruction, pc *uint64, env Environment, contract *Contract
 	} else {
 		stack.push(addr.Big())
 	}
+	// Only the output of a reverted creation is return data
+	if suberr == ExecutionRevertedError {
+		contract.returnData = ret
+	} else {
+		contract.returnData = nil
+	}
 }
 
 func opCall(instr instruction, pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) {
@@ -461,9 +481,11 @@ func opCall(instr instruction, pc *uint64, env Environment, contract *Contract,
 
 	} else {
 		stack.push(big.NewInt(1))
-
+	}
+	if err == nil || err == ExecutionRevertedError {
 		memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
 	}
+	contract.returnData = ret
 }
 
 func opCallCode(instr instruction, pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) {
@@ -492,9 +514,11 @@ func opCallCode(instr instruction, pc *uint64, env Environment, contract *Contra
 
 	} else {
 		stack.push(big.NewInt(1))
-
+	}
+	if err == nil || err == ExecutionRevertedError {
 		memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
 	}
+	contract.returnData = ret
 }
 
 func opDelegateCall(instr instruction, pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) {
@@ -507,8 +531,28 @@ func opDelegateCall(instr instruction, pc *uint64, env Environment, contract *Co
 		stack.push(new(big.Int))
 	} else {
 		stack.push(big.NewInt(1))
+	}
+	if err == nil || err == ExecutionRevertedError {
+		memory.Set(outOffset.Uint64(), outSize.Uint64(), ret)
+	}
+	contract.returnData = ret
+}
+
+func opStaticCall(instr instruction, pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) {
+	gas, to, inOffset, inSize, outOffset, outSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+
+	toAddr := common.BigToAddress(to)
+	args := memory.Get(inOffset.Int64(), inSize.Int64())
+	ret, err := env.StaticCall(contract, toAddr, args, gas, contract.Price)
+	if err != nil {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(big.NewInt(1))
+	}
+	if err == nil || err == ExecutionRevertedError {
 		memory.Set(outOffset.Uint64(), outSize.Uint64(), ret)
 	}
+	contract.returnData = ret
 }
 
 func opSuicide(instr instruction, pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) {
@@ -33,6 +33,12 @@ func newJumpTable(ruleset RuleSet, blockNumber *big.Int) vmJumpTable {
 	if ruleset.IsHomestead(blockNumber) {
 		jumpTable[DELEGATECALL] = jumpPtr{opDelegateCall, true}
 	}
+	if ruleset.IsByzantium(blockNumber) {
+		jumpTable[RETURNDATASIZE] = jumpPtr{opReturnDataSize, true}
+		jumpTable[RETURNDATACOPY] = jumpPtr{opReturnDataCopy, true}
+		jumpTable[STATICCALL] = jumpPtr{opStaticCall, true}
+		jumpTable[REVERT] = jumpPtr{nil, true}
+	}
 
 	jumpTable[ADD] = jumpPtr{opAdd, true}
 	jumpTable[SUB] = jumpPtr{opSub, true}
@@ -27,6 +27,10 @@ type ruleSet struct {
 
 func (r ruleSet) IsHomestead(n *big.Int) bool { return n.Cmp(r.hs) >= 0 }
 
+func (r ruleSet) IsByzantium(n *big.Int) bool { return false }
+
+func (r ruleSet) Precompiled(*big.Int) map[string]*PrecompiledAccount { return Precompiled }
+
 func (r ruleSet) GasTable(*big.Int) *GasTable {
 	return &GasTable{
 		ExtcodeSize: big.NewInt(20),
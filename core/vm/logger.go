@@ -0,0 +1,198 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common"
+)
+
+// ErrTraceLimitReached is returned by a Tracer when it has collected the
+// configured maximum number of entries. The EVM aborts execution on it.
+var ErrTraceLimitReached = errors.New("the number of logs reached the specified limit")
+
+// Storage represents a contract's storage.
+type Storage map[common.Hash]common.Hash
+
+// Copy duplicates the current storage.
+func (s Storage) Copy() Storage {
+	cpy := make(Storage)
+	for key, value := range s {
+		cpy[key] = value
+	}
+
+	return cpy
+}
+
+// Tracer is used to collect execution traces from an EVM transaction
+// execution. CaptureEnter and CaptureExit bracket every call frame run by
+// the EVM, CaptureState is called for each step of the VM with the current
+// VM state. Note that the stack and memory passed to CaptureState are the
+// live structures of the VM and must be copied if they are to be retained.
+type Tracer interface {
+	CaptureEnter(env Environment, contract *Contract, input []byte, depth int) error
+	CaptureState(env Environment, pc uint64, op OpCode, gas, cost *big.Int, memory *Memory, stack []*big.Int, contract *Contract, depth int, err error) error
+	CaptureExit(env Environment, output []byte, gasUsed *big.Int, err error) error
+}
+
+// LogConfig are the configuration options for structured logger the EVM
+type LogConfig struct {
+	DisableMemory  bool // disable memory capture
+	DisableStack   bool // disable stack capture
+	DisableStorage bool // disable storage capture
+	Limit          int  // maximum length of output, but zero means unlimited
+}
+
+// StructLog is emitted to the EVM each cycle and lists information about the current internal state
+// prior to the execution of the statement.
+type StructLog struct {
+	Pc      uint64
+	Op      OpCode
+	Gas     *big.Int
+	GasCost *big.Int
+	Memory  []byte
+	Stack   []*big.Int
+	Storage map[common.Hash]common.Hash
+	Depth   int
+	Err     error
+}
+
+// StructLogger is an EVM state logger and implements Tracer.
+//
+// StructLogger can capture state based on the given Log configuration and also keeps
+// a track record of modified storage which is used in reporting snapshots of the
+// contract their storage.
+type StructLogger struct {
+	cfg LogConfig
+
+	logs          []StructLog
+	changedValues map[common.Address]Storage
+}
+
+// NewStructLogger returns a new logger
+func NewStructLogger(cfg *LogConfig) *StructLogger {
+	logger := &StructLogger{
+		changedValues: make(map[common.Address]Storage),
+	}
+	if cfg != nil {
+		logger.cfg = *cfg
+	}
+	return logger
+}
+
+// CaptureEnter implements Tracer. The struct logger does not track call frames
+// other than through the depth recorded with each step.
+func (l *StructLogger) CaptureEnter(env Environment, contract *Contract, input []byte, depth int) error {
+	return nil
+}
+
+// CaptureState logs a new structured log message and pushes it out to the environment
+//
+// CaptureState also tracks SSTORE ops to track dirty values.
+func (l *StructLogger) CaptureState(env Environment, pc uint64, op OpCode, gas, cost *big.Int, memory *Memory, stack []*big.Int, contract *Contract, depth int, err error) error {
+	// check if already accumulated the specified number of logs
+	if l.cfg.Limit != 0 && l.cfg.Limit <= len(l.logs) {
+		return ErrTraceLimitReached
+	}
+
+	// initialise new changed values storage container for this contract
+	// if not present.
+	if l.changedValues[contract.Address()] == nil {
+		l.changedValues[contract.Address()] = make(Storage)
+	}
+
+	// capture SSTORE opcodes and determine the changed value and store
+	// it in the local storage container. NOTE: we do not need to do any
+	// range checks here because that's already handled prior to calling
+	// this function.
+	if op == SSTORE && len(stack) >= 2 {
+		var (
+			value   = common.BigToHash(stack[len(stack)-2])
+			address = common.BigToHash(stack[len(stack)-1])
+		)
+		l.changedValues[contract.Address()][address] = value
+	}
+
+	// copy a snapshot of the current memory state to a new buffer
+	var mem []byte
+	if !l.cfg.DisableMemory {
+		mem = make([]byte, len(memory.Data()))
+		copy(mem, memory.Data())
+	}
+
+	// copy a snapshot of the current stack state to a new buffer
+	var stck []*big.Int
+	if !l.cfg.DisableStack {
+		stck = make([]*big.Int, len(stack))
+		for i, item := range stack {
+			stck[i] = new(big.Int).Set(item)
+		}
+	}
+
+	// copy the storage values changed so far by this contract
+	var storage Storage
+	if !l.cfg.DisableStorage {
+		storage = l.changedValues[contract.Address()].Copy()
+	}
+	// create a new snapshot of the EVM.
+	log := StructLog{pc, op, new(big.Int).Set(gas), new(big.Int).Set(cost), mem, stck, storage, depth, err}
+
+	l.logs = append(l.logs, log)
+	return nil
+}
+
+// CaptureExit implements Tracer.
+func (l *StructLogger) CaptureExit(env Environment, output []byte, gasUsed *big.Int, err error) error {
+	return nil
+}
+
+// StructLogs returns a list of captured log entries
+func (l *StructLogger) StructLogs() []StructLog {
+	return l.logs
+}
+
+// WriteTrace writes a formatted trace to the given writer
+func WriteTrace(writer io.Writer, logs []StructLog) {
+	for _, log := range logs {
+		fmt.Fprintf(writer, "%-10spc=%08d gas=%v cost=%v", log.Op, log.Pc, log.Gas, log.GasCost)
+		if log.Err != nil {
+			fmt.Fprintf(writer, " ERROR: %v", log.Err)
+		}
+		fmt.Fprintf(writer, "\n")
+
+		for i := len(log.Stack) - 1; i >= 0; i-- {
+			fmt.Fprintf(writer, "%08d  %x\n", len(log.Stack)-i-1, common.LeftPadBytes(log.Stack[i].Bytes(), 32))
+		}
+
+		const maxMem = 10
+		addr := 0
+		for i := 0; i+16 <= len(log.Memory) && addr < maxMem; i += 16 {
+			data := log.Memory[i : i+16]
+			fmt.Fprintf(writer, "%04d: % x\n", addr*16, data)
+			addr++
+		}
+
+		for h, item := range log.Storage {
+			fmt.Fprintf(writer, "%x: %x\n", h, item)
+		}
+		fmt.Fprintln(writer)
+	}
+}
@@ -82,6 +82,8 @@ const (
 	GASPRICE
 	EXTCODESIZE
 	EXTCODECOPY
+	RETURNDATASIZE
+	RETURNDATACOPY
 )
 
 const (
@@ -202,7 +204,9 @@ const (
 	RETURN
 	DELEGATECALL
 
-	SUICIDE = 0xff
+	STATICCALL = 0xfa
+	REVERT     = 0xfd
+	SUICIDE    = 0xff
 )
 
 // Since the opcodes aren't all in order we can't use a regular slice
@@ -260,6 +264,9 @@ var opCodeToString = map[OpCode]string{
 	EXTCODESIZE: "EXTCODESIZE",
 	EXTCODECOPY: "EXTCODECOPY",
 
+	RETURNDATASIZE: "RETURNDATASIZE",
+	RETURNDATACOPY: "RETURNDATACOPY",
+
 	// 0x50 range - 'storage' and execution
 	POP: "POP",
 	//DUP:     "DUP",
@@ -355,6 +362,8 @@ var opCodeToString = map[OpCode]string{
 	RETURN:       "RETURN",
 	CALLCODE:     "CALLCODE",
 	DELEGATECALL: "DELEGATECALL",
+	STATICCALL:   "STATICCALL",
+	REVERT:       "REVERT",
 	SUICIDE:      "SUICIDE",
 
 	PUSH: "PUSH",
@@ -501,7 +510,12 @@ var stringToOp = map[string]OpCode{
 	"CALL":         CALL,
 	"RETURN":       RETURN,
 	"CALLCODE":     CALLCODE,
+	"STATICCALL":   STATICCALL,
+	"REVERT":       REVERT,
 	"SUICIDE":      SUICIDE,
+
+	"RETURNDATASIZE": RETURNDATASIZE,
+	"RETURNDATACOPY": RETURNDATACOPY,
 }
 
 func StringToOp(str string) OpCode {
@@ -32,6 +32,10 @@ import (
 type ruleSet struct{}
 
 func (ruleSet) IsHomestead(*big.Int) bool { return true }
+func (ruleSet) IsByzantium(*big.Int) bool { return false }
+func (ruleSet) Precompiled(*big.Int) map[string]*vm.PrecompiledAccount {
+	return vm.Precompiled
+}
 func (ruleSet) GasTable(*big.Int) *vm.GasTable {
 	return &vm.GasTable{
 		ExtcodeSize:     big.NewInt(700),
@@ -59,6 +63,7 @@ type Config struct {
 	Value       *big.Int
 	DisableJit  bool // "disable" so it's enabled by default
 	Debug       bool
+	Tracer      vm.Tracer // optional tracer receiving the execution steps
 
 	State     *state.StateDB
 	GetHashFn func(n uint64) common.Hash
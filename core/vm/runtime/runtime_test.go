@@ -25,6 +25,7 @@ import (
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/core/state"
 	"github.com/ethereumproject/go-ethereum/core/vm"
+	"github.com/ethereumproject/go-ethereum/crypto"
 	"github.com/ethereumproject/go-ethereum/ethdb"
 )
 
@@ -149,3 +150,409 @@ func BenchmarkCall(b *testing.B) {
 		}
 	}
 }
+
+func TestStructLogger(t *testing.T) {
+	code := []byte{
+		byte(vm.PUSH1), 1,
+		byte(vm.PUSH1), 0,
+		byte(vm.SSTORE),
+		byte(vm.PUSH1), 10,
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.STOP),
+	}
+
+	logger := vm.NewStructLogger(nil)
+	if _, _, err := Execute(code, nil, &Config{Tracer: logger}); err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	logs := logger.StructLogs()
+	if len(logs) != 7 {
+		t.Fatalf("expected 7 struct logs, got %d", len(logs))
+	}
+	if logs[2].Op != vm.SSTORE {
+		t.Errorf("expected SSTORE at step 2, got %v", logs[2].Op)
+	}
+	if len(logs[2].Stack) != 2 {
+		t.Errorf("expected stack of size 2 at SSTORE, got %d", len(logs[2].Stack))
+	}
+	if v := logs[3].Storage[common.Hash{}]; v != common.BigToHash(big.NewInt(1)) {
+		t.Errorf("expected storage slot 0 to be 1 after SSTORE, got %x", v)
+	}
+	if len(logs[6].Memory) != 32 {
+		t.Errorf("expected 32 bytes of memory after MSTORE, got %d", len(logs[6].Memory))
+	}
+	for i, log := range logs {
+		if log.Depth != 1 {
+			t.Errorf("step %d: expected depth 1, got %d", i, log.Depth)
+		}
+	}
+
+	logger = vm.NewStructLogger(&vm.LogConfig{DisableMemory: true, DisableStack: true, DisableStorage: true, Limit: 3})
+	if _, _, err := Execute(code, nil, &Config{Tracer: logger}); err != vm.ErrTraceLimitReached {
+		t.Fatalf("expected %v, got %v", vm.ErrTraceLimitReached, err)
+	}
+	logs = logger.StructLogs()
+	if len(logs) != 3 {
+		t.Fatalf("expected 3 struct logs, got %d", len(logs))
+	}
+	if logs[2].Stack != nil || logs[2].Memory != nil || logs[2].Storage != nil {
+		t.Errorf("expected stack, memory and storage to be disabled, got %v", logs[2])
+	}
+}
+
+func TestCallTracer(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// callee returns 10
+	callee := common.HexToAddress("0x0b")
+	statedb.SetCode(callee, []byte{
+		byte(vm.PUSH1), 10,
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 32,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	})
+	// caller callcodes the callee with all available gas and stops
+	caller := common.HexToAddress("0x0a")
+	statedb.SetCode(caller, []byte{
+		byte(vm.PUSH1), 0, // out size
+		byte(vm.PUSH1), 0, // out offset
+		byte(vm.PUSH1), 0, // in size
+		byte(vm.PUSH1), 0, // in offset
+		byte(vm.PUSH1), 0, // value
+		byte(vm.PUSH1), 0x0b, // address
+		byte(vm.GAS),
+		byte(vm.CALLCODE),
+		byte(vm.STOP),
+	})
+
+	tracer := vm.NewCallTracer()
+	if _, err := Call(caller, nil, &Config{State: statedb, Tracer: tracer}); err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	root := tracer.Result()
+	if root == nil {
+		t.Fatal("expected a call tree")
+	}
+	if root.Type != vm.CALL || root.To != caller {
+		t.Errorf("unexpected root frame: %v %x", root.Type, root.To)
+	}
+	if len(root.Calls) != 1 {
+		t.Fatalf("expected 1 nested call, got %d", len(root.Calls))
+	}
+	nested := root.Calls[0]
+	if nested.Type != vm.CALLCODE || nested.To != callee || nested.From != caller {
+		t.Errorf("unexpected nested frame: %v %x -> %x", nested.Type, nested.From, nested.To)
+	}
+	if new(big.Int).SetBytes(nested.Output).Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("expected nested call to return 10, got %x", nested.Output)
+	}
+	if nested.GasUsed == nil || nested.GasUsed.Sign() == 0 {
+		t.Errorf("expected nested call to use gas")
+	}
+}
+
+func TestCallTracerGasUsed(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// callee fails on an invalid opcode, burning all of its gas
+	callee := common.HexToAddress("0x0b")
+	statedb.SetCode(callee, []byte{0xfe})
+
+	// caller creates a contract of 32 bytes and calls the callee with 10000 gas
+	caller := common.HexToAddress("0x0a")
+	statedb.SetCode(caller, []byte{
+		byte(vm.PUSH5), 0x60, 0x20, 0x60, 0x00, 0xf3, // init code returning 32 bytes
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 5, // size
+		byte(vm.PUSH1), 27, // offset
+		byte(vm.PUSH1), 0, // value
+		byte(vm.CREATE),
+		byte(vm.POP),
+		byte(vm.PUSH1), 0, // out size
+		byte(vm.PUSH1), 0, // out offset
+		byte(vm.PUSH1), 0, // in size
+		byte(vm.PUSH1), 0, // in offset
+		byte(vm.PUSH1), 0, // value
+		byte(vm.PUSH1), 0x0b, // address
+		byte(vm.PUSH2), 0x27, 0x10, // gas
+		byte(vm.CALL),
+		byte(vm.STOP),
+	})
+
+	tracer := vm.NewCallTracer()
+	if _, err := Call(caller, nil, &Config{State: statedb, Tracer: tracer}); err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	root := tracer.Result()
+	if root == nil || len(root.Calls) != 2 {
+		t.Fatalf("expected 2 nested calls, got %v", root)
+	}
+	// the creation pays for its execution and for storing its code
+	create := root.Calls[0]
+	if create.Type != vm.CREATE {
+		t.Errorf("frame type mismatch: have %v, want %v", create.Type, vm.CREATE)
+	}
+	if want := big.NewInt(3 + 3 + 3 + 32*200); create.GasUsed.Cmp(want) != 0 {
+		t.Errorf("creation gas used mismatch: have %v, want %v", create.GasUsed, want)
+	}
+	// the failed call uses all of its gas
+	call := root.Calls[1]
+	if call.Err == nil {
+		t.Errorf("expected call to fail")
+	}
+	if want := big.NewInt(10000); call.GasUsed.Cmp(want) != 0 {
+		t.Errorf("failed call gas used mismatch: have %v, want %v", call.GasUsed, want)
+	}
+}
+
+// byzantiumRuleSet is the default rule set with the byzantium opcodes enabled
+type byzantiumRuleSet struct{ ruleSet }
+
+func (byzantiumRuleSet) IsByzantium(*big.Int) bool { return true }
+
+func TestRevert(t *testing.T) {
+	// store 42 and revert with it
+	code := []byte{
+		byte(vm.PUSH1), 42,
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 32,
+		byte(vm.PUSH1), 0,
+		byte(vm.REVERT),
+	}
+
+	ret, _, err := Execute(code, nil, &Config{RuleSet: byzantiumRuleSet{}, GasLimit: big.NewInt(100000)})
+	if err != vm.ExecutionRevertedError {
+		t.Fatalf("error mismatch: have %v, want %v", err, vm.ExecutionRevertedError)
+	}
+	if new(big.Int).SetBytes(ret).Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("expected revert data 42, got %x", ret)
+	}
+
+	// before byzantium REVERT is an invalid opcode
+	_, _, err = Execute(code, nil, &Config{GasLimit: big.NewInt(100000)})
+	if err == nil || err == vm.ExecutionRevertedError {
+		t.Errorf("expected invalid opcode error, got %v", err)
+	}
+}
+
+func TestCreateRevert(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// init stores 1 in slot 0 and reverts with 42
+	init := []byte{
+		byte(vm.PUSH1), 1,
+		byte(vm.PUSH1), 0,
+		byte(vm.SSTORE),
+		byte(vm.PUSH1), 42,
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 32,
+		byte(vm.PUSH1), 0,
+		byte(vm.REVERT),
+	}
+	// caller creates a contract from init, stores the created address in
+	// slot 1 and the gas left in slot 2, and returns the data of the creation
+	caller := common.HexToAddress("0x0a")
+	code := append([]byte{byte(vm.PUSH15)}, init...)
+	code = append(code,
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), byte(len(init)), // size
+		byte(vm.PUSH1), byte(32-len(init)), // offset
+		byte(vm.PUSH1), 0, // value
+		byte(vm.CREATE),
+		byte(vm.PUSH1), 1,
+		byte(vm.SSTORE),
+		byte(vm.GAS),
+		byte(vm.PUSH1), 2,
+		byte(vm.SSTORE),
+		byte(vm.RETURNDATASIZE),
+		byte(vm.PUSH1), 0, // data offset
+		byte(vm.PUSH1), 0, // memory offset
+		byte(vm.RETURNDATACOPY),
+		byte(vm.RETURNDATASIZE),
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	)
+	statedb.SetCode(caller, code)
+
+	gasLimit := big.NewInt(1000000)
+	ret, err := Call(caller, nil, &Config{State: statedb, RuleSet: byzantiumRuleSet{}, GasLimit: gasLimit})
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	if new(big.Int).SetBytes(ret).Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("expected revert data 42, got %x", ret)
+	}
+	if v := statedb.GetState(caller, common.BigToHash(big.NewInt(1))); v != (common.Hash{}) {
+		t.Errorf("expected creation to fail, got address %x", v)
+	}
+	// the gas left to the reverted creation is refunded, rather than consumed
+	if gas := statedb.GetState(caller, common.BigToHash(big.NewInt(2))).Big(); gas.Cmp(new(big.Int).Div(gasLimit, big.NewInt(2))) < 0 {
+		t.Errorf("expected creation gas to be refunded, got %v gas left", gas)
+	}
+	// the state changes of the reverted creation are rolled back, but not the
+	// nonce increase of the creator
+	created := crypto.CreateAddress(caller, 0)
+	if v := statedb.GetState(created, common.Hash{}); v != (common.Hash{}) {
+		t.Errorf("expected created storage to be rolled back, got %x", v)
+	}
+	if nonce := statedb.GetNonce(caller); nonce != 1 {
+		t.Errorf("creator nonce mismatch: have %d, want 1", nonce)
+	}
+}
+
+func TestStaticCall(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// writer stores 1 in slot 0
+	writer := common.HexToAddress("0x0b")
+	statedb.SetCode(writer, []byte{
+		byte(vm.PUSH1), 1,
+		byte(vm.PUSH1), 0,
+		byte(vm.SSTORE),
+		byte(vm.STOP),
+	})
+	// reader returns 10
+	reader := common.HexToAddress("0x0c")
+	statedb.SetCode(reader, []byte{
+		byte(vm.PUSH1), 10,
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 32,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	})
+	staticCall := func(addr byte) []byte {
+		return []byte{
+			byte(vm.PUSH1), 0, // out size
+			byte(vm.PUSH1), 0, // out offset
+			byte(vm.PUSH1), 0, // in size
+			byte(vm.PUSH1), 0, // in offset
+			byte(vm.PUSH1), addr, // address
+			byte(vm.GAS),
+			byte(vm.STATICCALL),
+		}
+	}
+	// caller static calls the writer and the reader, stores their
+	// success in slots 1 and 2 and returns the data of the reader
+	caller := common.HexToAddress("0x0a")
+	code := staticCall(0x0b)
+	code = append(code, byte(vm.PUSH1), 1, byte(vm.SSTORE))
+	code = append(code, staticCall(0x0c)...)
+	code = append(code, byte(vm.PUSH1), 2, byte(vm.SSTORE))
+	code = append(code,
+		byte(vm.RETURNDATASIZE),
+		byte(vm.PUSH1), 0, // data offset
+		byte(vm.PUSH1), 0, // memory offset
+		byte(vm.RETURNDATACOPY),
+		byte(vm.RETURNDATASIZE),
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	)
+	statedb.SetCode(caller, code)
+
+	ret, err := Call(caller, nil, &Config{State: statedb, RuleSet: byzantiumRuleSet{}})
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	if new(big.Int).SetBytes(ret).Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("expected return data 10, got %x", ret)
+	}
+	if v := statedb.GetState(caller, common.BigToHash(big.NewInt(1))); v != (common.Hash{}) {
+		t.Errorf("expected static call to the writer to fail, got %x", v)
+	}
+	if v := statedb.GetState(caller, common.BigToHash(big.NewInt(2))); v != common.BigToHash(big.NewInt(1)) {
+		t.Errorf("expected static call to the reader to succeed, got %x", v)
+	}
+	if v := statedb.GetState(writer, common.Hash{}); v != (common.Hash{}) {
+		t.Errorf("expected writer storage to be untouched, got %x", v)
+	}
+}
+
+// Tests that the accounts touched by a successful static call stay in the state,
+// while those touched by a failed one are rolled back.
+func TestStaticCallTouch(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// toucher makes a zero-value call to the address in its input, and fails
+	// if the input has a second word
+	toucher := common.HexToAddress("0x0b")
+	statedb.SetCode(toucher, []byte{
+		byte(vm.PUSH1), 0, // out size
+		byte(vm.PUSH1), 0, // out offset
+		byte(vm.PUSH1), 0, // in size
+		byte(vm.PUSH1), 0, // in offset
+		byte(vm.PUSH1), 0, // value
+		byte(vm.PUSH1), 0,
+		byte(vm.CALLDATALOAD), // address
+		byte(vm.GAS),
+		byte(vm.CALL),
+		byte(vm.POP),
+		byte(vm.PUSH1), 32,
+		byte(vm.CALLDATALOAD),
+		byte(vm.PUSH1), 23, // position of the JUMPDEST
+		byte(vm.JUMPI),
+		byte(vm.STOP),
+		byte(vm.JUMPDEST),
+		byte(vm.PUSH1), 0,
+		byte(vm.DUP1),
+		byte(vm.REVERT),
+	})
+	// caller static calls the toucher with its own input
+	caller := common.HexToAddress("0x0a")
+	statedb.SetCode(caller, []byte{
+		byte(vm.CALLDATASIZE),
+		byte(vm.PUSH1), 0, // data offset
+		byte(vm.PUSH1), 0, // memory offset
+		byte(vm.CALLDATACOPY),
+		byte(vm.PUSH1), 0, // out size
+		byte(vm.PUSH1), 0, // out offset
+		byte(vm.CALLDATASIZE), // in size
+		byte(vm.PUSH1), 0,     // in offset
+		byte(vm.PUSH1), 0x0b, // address
+		byte(vm.GAS),
+		byte(vm.STATICCALL),
+		byte(vm.STOP),
+	})
+
+	kept, reverted := common.HexToAddress("0xdd"), common.HexToAddress("0xee")
+	for _, input := range [][]byte{
+		common.LeftPadBytes(kept[:], 32),
+		append(common.LeftPadBytes(reverted[:], 32), common.LeftPadBytes([]byte{1}, 32)...),
+	} {
+		if _, err := Call(caller, input, &Config{State: statedb, RuleSet: byzantiumRuleSet{}}); err != nil {
+			t.Fatal("didn't expect error", err)
+		}
+	}
+	if !statedb.Exist(kept) {
+		t.Errorf("expected account touched by a successful static call to exist")
+	}
+	if statedb.Exist(reverted) {
+		t.Errorf("expected account touched by a failed static call to be rolled back")
+	}
+}
+
+func TestReturnDataCopyOutOfBounds(t *testing.T) {
+	// copy a word of return data while there is none
+	code := []byte{
+		byte(vm.PUSH1), 32,
+		byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURNDATACOPY),
+		byte(vm.STOP),
+	}
+	if _, _, err := Execute(code, nil, &Config{RuleSet: byzantiumRuleSet{}, GasLimit: big.NewInt(100000)}); err != vm.ReturnDataOutOfBoundsError {
+		t.Errorf("error mismatch: have %v, want %v", err, vm.ReturnDataOutOfBoundsError)
+	}
+}
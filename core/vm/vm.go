@@ -31,6 +31,11 @@ import (
 var (
 	OutOfGasError          = errors.New("Out of gas")
 	CodeStoreOutOfGasError = errors.New("Contract creation code storage out of gas")
+	// ExecutionRevertedError is returned by REVERT. Unlike other errors, it
+	// leaves the remaining gas to the caller.
+	ExecutionRevertedError     = errors.New("Execution reverted")
+	WriteProtectionError       = errors.New("State modification in a static call")
+	ReturnDataOutOfBoundsError = errors.New("Return data out of bounds")
 )
 
 // VirtualMachine is an EVM interface
@@ -46,6 +51,7 @@ type EVM struct {
 	env       Environment
 	jumpTable vmJumpTable
 	gasTable  GasTable
+	tracer    Tracer
 }
 
 // New returns a new instance of the EVM.
@@ -57,13 +63,30 @@ func New(env Environment) *EVM {
 	}
 }
 
+// NewWithTracer returns a new instance of the EVM which reports every call
+// frame and every executed step to the given tracer.
+func NewWithTracer(env Environment, tracer Tracer) *EVM {
+	evm := New(env)
+	evm.tracer = tracer
+	return evm
+}
+
 // Run loops and evaluates the contract's code with the given input data
 func (evm *EVM) Run(contract *Contract, input []byte) (ret []byte, err error) {
 	evm.env.SetDepth(evm.env.Depth() + 1)
 	defer evm.env.SetDepth(evm.env.Depth() - 1)
 
+	if evm.tracer != nil {
+		if err := evm.tracer.CaptureEnter(evm.env, contract, input, evm.env.Depth()); err != nil {
+			return nil, err
+		}
+		// The frame is closed by the caller through CaptureExit, once it has
+		// charged all the gas of the run
+		contract.traceGas = new(big.Int).Set(contract.Gas)
+	}
+
 	if contract.CodeAddr != nil {
-		if p := Precompiled[contract.CodeAddr.Str()]; p != nil {
+		if p := evm.env.RuleSet().Precompiled(evm.env.BlockNumber())[contract.CodeAddr.Str()]; p != nil {
 			return evm.RunPrecompiled(p, input, contract)
 		}
 	}
@@ -123,18 +146,32 @@ func (evm *EVM) Run(contract *Contract, input []byte) (ret []byte, err error) {
 		// calculate the new memory size and gas price for the current executing opcode
 		newMemSize, cost, err = calculateGasAndSize(&evm.gasTable, evm.env, contract, caller, op, statedb, mem, stack)
 		if err != nil {
+			if evm.tracer != nil {
+				evm.tracer.CaptureState(evm.env, pc, op, contract.Gas, new(big.Int), mem, stack.data, contract, evm.env.Depth(), err)
+			}
 			return nil, err
 		}
 
 		// Use the calculated gas. When insufficient gas is present, use all gas and return an
 		// Out Of Gas error
 		if !contract.UseGas(cost) {
+			if evm.tracer != nil {
+				evm.tracer.CaptureState(evm.env, pc, op, contract.Gas, cost, mem, stack.data, contract, evm.env.Depth(), OutOfGasError)
+			}
 			return nil, OutOfGasError
 		}
 
 		// Resize the memory calculated previously
 		mem.Resize(newMemSize.Uint64())
 
+		if evm.tracer != nil {
+			// report the gas available prior to charging the step
+			gas := new(big.Int).Add(contract.Gas, cost)
+			if err := evm.tracer.CaptureState(evm.env, pc, op, gas, cost, mem, stack.data, contract, evm.env.Depth(), nil); err != nil {
+				return nil, err
+			}
+		}
+
 		if opPtr := evm.jumpTable[op]; opPtr.valid {
 			if opPtr.fn != nil {
 				opPtr.fn(instruction{}, &pc, evm.env, contract, mem, stack)
@@ -163,6 +200,11 @@ func (evm *EVM) Run(contract *Contract, input []byte) (ret []byte, err error) {
 					ret := mem.GetPtr(offset.Int64(), size.Int64())
 
 					return ret, nil
+				case REVERT:
+					offset, size := stack.pop(), stack.pop()
+					ret := mem.GetPtr(offset.Int64(), size.Int64())
+
+					return ret, ExecutionRevertedError
 				case SUICIDE:
 					opSuicide(instruction{}, nil, evm.env, contract, mem, stack)
 
@@ -192,6 +234,18 @@ func calculateGasAndSize(gasTable *GasTable, env Environment, contract *Contract
 		return nil, nil, err
 	}
 
+	// State modifications are not allowed in a static call
+	if contract.ReadOnly {
+		switch op {
+		case SSTORE, LOG0, LOG1, LOG2, LOG3, LOG4, CREATE, SUICIDE:
+			return nil, nil, WriteProtectionError
+		case CALL:
+			if stack.data[stack.len()-3].Sign() != 0 {
+				return nil, nil, WriteProtectionError
+			}
+		}
+	}
+
 	// stack Check, memory resize & gas phase
 	switch op {
 	case SUICIDE:
@@ -283,7 +337,7 @@ func calculateGasAndSize(gasTable *GasTable, env Environment, contract *Contract
 	case MSTORE:
 		newMemSize = calcMemSize(stack.peek(), u256(32))
 		quadMemGas(mem, newMemSize, gas)
-	case RETURN:
+	case RETURN, REVERT:
 		newMemSize = calcMemSize(stack.peek(), stack.data[stack.len()-2])
 		quadMemGas(mem, newMemSize, gas)
 	case SHA3:
@@ -306,6 +360,17 @@ func calculateGasAndSize(gasTable *GasTable, env Environment, contract *Contract
 		words := toWordSize(stack.data[stack.len()-3])
 		gas.Add(gas, words.Mul(words, big.NewInt(3)))
 
+		quadMemGas(mem, newMemSize, gas)
+	case RETURNDATACOPY:
+		end := new(big.Int).Add(stack.data[stack.len()-2], stack.data[stack.len()-3])
+		if end.Cmp(big.NewInt(int64(len(contract.returnData)))) > 0 {
+			return nil, nil, ReturnDataOutOfBoundsError
+		}
+		newMemSize = calcMemSize(stack.peek(), stack.data[stack.len()-3])
+
+		words := toWordSize(stack.data[stack.len()-3])
+		gas.Add(gas, words.Mul(words, big.NewInt(3)))
+
 		quadMemGas(mem, newMemSize, gas)
 	case EXTCODECOPY:
 		gas.Set(gasTable.ExtcodeCopy)
@@ -348,7 +413,7 @@ func calculateGasAndSize(gasTable *GasTable, env Environment, contract *Contract
 		stack.data[stack.len()-1] = cg
 		gas.Add(gas, cg)
 
-	case DELEGATECALL:
+	case DELEGATECALL, STATICCALL:
 		gas.Set(gasTable.Calls)
 
 		x := calcMemSize(stack.data[stack.len()-5], stack.data[stack.len()-6])
@@ -373,12 +438,20 @@ func calculateGasAndSize(gasTable *GasTable, env Environment, contract *Contract
 }
 
 // RunPrecompile runs and evaluate the output of a precompiled contract defined in contracts.go
+// CaptureExit reports the end of the run of the given contract to the tracer,
+// if the run was traced, with the gas used by it since it was entered.
+func (evm *EVM) CaptureExit(contract *Contract, ret []byte, err error) {
+	if evm.tracer == nil || contract.traceGas == nil {
+		return
+	}
+	evm.tracer.CaptureExit(evm.env, ret, new(big.Int).Sub(contract.traceGas, contract.Gas), err)
+	contract.traceGas = nil
+}
+
 func (evm *EVM) RunPrecompiled(p *PrecompiledAccount, input []byte, contract *Contract) (ret []byte, err error) {
-	gas := p.Gas(len(input))
+	gas := p.Gas(input)
 	if contract.UseGas(gas) {
-		ret = p.Call(input)
-
-		return ret, nil
+		return p.Call(input)
 	} else {
 		return nil, OutOfGasError
 	}
@@ -0,0 +1,202 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/rlp"
+)
+
+// maxVMDivergences is the number of most recent divergences kept by the VM
+// cross-check.
+const maxVMDivergences = 1024
+
+// VMDivergence is a disagreement between the VM in use and the cross-checked one
+// on the outcome of a transaction.
+type VMDivergence struct {
+	BlockNumber      uint64      `json:"blockNumber"`
+	BlockHash        common.Hash `json:"blockHash"`
+	TxHash           common.Hash `json:"transactionHash"`
+	TxIndex          int         `json:"transactionIndex"`
+	Field            string      `json:"field"` // One of "error", "gas", "status", "logs" and "root"
+	VM               string      `json:"vm"`    // Name of the VM in use
+	Value            string      `json:"value"`
+	Alternative      string      `json:"alternative"` // Name of the cross-checked VM
+	AlternativeValue string      `json:"alternativeValue"`
+}
+
+// txOutcome is the outcome of a transaction compared by the VM cross-check.
+type txOutcome struct {
+	receipt *types.Receipt
+	gas     *big.Int
+	err     error
+}
+
+// vmCrossCheck executes every transaction processed by the chain with both the
+// VM in use and another one, on a copy of the state, and records where they
+// diverge. The outcome of the VM in use is the one the chain carries on with.
+type vmCrossCheck struct {
+	name        string     // Name of the cross-checked VM
+	alternative TxExecutor // Cross-checked VM
+
+	mu          sync.Mutex
+	divergences []*VMDivergence // Most recent divergences, oldest first
+}
+
+// vmShadow is the execution context of a transaction with the alternative VM,
+// copied from the one of the VM in use before the transaction.
+type vmShadow struct {
+	statedb *state.StateDB
+	gp      *GasPool
+	usedGas *big.Int
+}
+
+// EnableVMCrossCheck turns on the cross-checking of the VM in use against the
+// registered one of the given name for the blocks processed from now on.
+// Divergences are logged, sent to mlog and retrievable with VMDivergences.
+func (bc *BlockChain) EnableVMCrossCheck(name string) error {
+	alternative, err := GetTxExecutor(name)
+	if err != nil {
+		return err
+	}
+	if current, _ := CurrentTxExecutor(); current == name {
+		return fmt.Errorf("VM %q cross-checked against itself", name)
+	}
+	bc.vmCrossCheck.Store(&vmCrossCheck{name: name, alternative: alternative})
+	return nil
+}
+
+// VMDivergences returns the most recent divergences found by the VM cross-check,
+// oldest first, or nil if it is not enabled.
+func (bc *BlockChain) VMDivergences() []*VMDivergence {
+	c := bc.crossCheck()
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]*VMDivergence{}, c.divergences...)
+}
+
+// crossCheck returns the VM cross-check, or nil if not enabled.
+func (bc *BlockChain) crossCheck() *vmCrossCheck {
+	if bc == nil {
+		return nil
+	}
+	c, _ := bc.vmCrossCheck.Load().(*vmCrossCheck)
+	return c
+}
+
+// shadow copies the execution context of a transaction about to be applied.
+func (c *vmCrossCheck) shadow(statedb *state.StateDB, gp *GasPool, usedGas *big.Int) *vmShadow {
+	return &vmShadow{
+		statedb: statedb.Copy(),
+		gp:      new(GasPool).AddGas((*big.Int)(gp)),
+		usedGas: new(big.Int).Set(usedGas),
+	}
+}
+
+// check applies a transaction with the alternative VM in its shadow context and
+// records any divergence from the outcome of the VM in use.
+func (c *vmCrossCheck) check(shadow *vmShadow, config *ChainConfig, bc *BlockChain, header *types.Header, index int, tx *types.Transaction, outcome txOutcome) {
+	shadow.statedb.StartRecord(tx.Hash(), header.Hash(), index)
+	receipt, _, gas, err := c.alternative.ApplyTransaction(config, bc, shadow.gp, shadow.statedb, header, tx, shadow.usedGas)
+	alternative := txOutcome{receipt, gas, err}
+
+	current, _ := CurrentTxExecutor()
+	for _, field := range []string{"error", "gas", "status", "logs", "root"} {
+		value, alternativeValue := outcome.field(field), alternative.field(field)
+		if value == alternativeValue {
+			continue
+		}
+		c.record(&VMDivergence{
+			BlockNumber:      header.Number.Uint64(),
+			BlockHash:        header.Hash(),
+			TxHash:           tx.Hash(),
+			TxIndex:          index,
+			Field:            field,
+			VM:               current,
+			Value:            value,
+			Alternative:      c.name,
+			AlternativeValue: alternativeValue,
+		})
+		// Nothing else to compare without receipts
+		if field == "error" {
+			break
+		}
+	}
+}
+
+// field formats a field of the outcome for comparison.
+func (o txOutcome) field(name string) string {
+	if name == "error" {
+		if o.err == nil {
+			return ""
+		}
+		return o.err.Error()
+	}
+	if o.err != nil {
+		return ""
+	}
+	switch name {
+	case "gas":
+		return o.gas.String()
+	case "status":
+		return fmt.Sprintf("%d", o.receipt.Status)
+	case "logs":
+		enc, _ := rlp.EncodeToBytes(o.receipt.Logs)
+		return common.ToHex(enc)
+	case "root":
+		return common.ToHex(o.receipt.PostState)
+	}
+	return ""
+}
+
+// record keeps a divergence and reports it.
+func (c *vmCrossCheck) record(d *VMDivergence) {
+	c.mu.Lock()
+	if len(c.divergences) == maxVMDivergences {
+		copy(c.divergences, c.divergences[1:])
+		c.divergences = c.divergences[:len(c.divergences)-1]
+	}
+	c.divergences = append(c.divergences, d)
+	c.mu.Unlock()
+
+	glog.V(logger.Warn).Warnf("VM divergence in block #%d [%x…] tx %d [%x…] on %s: %s %q, %s %q", d.BlockNumber, d.BlockHash.Bytes()[:4], d.TxIndex, d.TxHash.Bytes()[:4], d.Field, d.VM, d.Value, d.Alternative, d.AlternativeValue)
+	if logger.MlogEnabled() {
+		mlogBlockchainVMDivergence.AssignDetails(
+			d.BlockNumber,
+			d.BlockHash.Hex(),
+			d.TxHash.Hex(),
+			d.TxIndex,
+			d.Field,
+			d.VM,
+			d.Value,
+			d.Alternative,
+			d.AlternativeValue,
+		).Send(mlogBlockchain)
+	}
+}
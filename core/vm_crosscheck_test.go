@@ -0,0 +1,103 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/core/vm"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+)
+
+// Tests that the VM cross-check reports the transactions on which the VMs
+// diverge, the chain carrying on with the outcome of the VM in use.
+func TestVMCrossCheck(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	var (
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		signer   = types.NewChainIdSigner(big.NewInt(63))
+		config   = MakeDiehardChainConfig()
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000)})
+	WriteGenesisBlockForTesting(gendb, GenesisAccount{addr, big.NewInt(1000000)})
+
+	blocks, _ := GenerateChain(config, genesis, gendb, 3, func(i int, gen *BlockGen) {
+		tx, err := types.NewTransaction(gen.TxNonce(addr), common.BigToAddress(big.NewInt(0x1000)), big.NewInt(1000), TxGas, nil, nil).WithSigner(signer).SignECDSA(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.AddTx(tx)
+	})
+	blockchain, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blockchain.Stop()
+
+	if divergences := blockchain.VMDivergences(); divergences != nil {
+		t.Fatalf("divergences reported while disabled: %v", divergences)
+	}
+	if err := blockchain.EnableVMCrossCheck(NativeTxExecutor); err == nil {
+		t.Fatal("VM cross-checked against itself")
+	}
+	if err := blockchain.EnableVMCrossCheck("crosscheck-unknown"); err == nil {
+		t.Fatal("VM cross-checked against an unknown one")
+	}
+	// The alternative VM charges one more gas for the transaction of the second block.
+	diverging := blocks[1].Transactions()[0].Hash()
+	RegisterTxExecutor("crosscheck-test", TxExecutorFunc(func(config *ChainConfig, bc *BlockChain, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *big.Int) (*types.Receipt, vm.Logs, *big.Int, error) {
+		receipt, logs, gas, err := ApplyTransaction(config, bc, gp, statedb, header, tx, usedGas)
+		if err == nil && tx.Hash() == diverging {
+			gas = new(big.Int).Add(gas, common.Big1)
+		}
+		return receipt, logs, gas, err
+	}))
+	defer unregisterTxExecutor("crosscheck-test")
+
+	if err := blockchain.EnableVMCrossCheck("crosscheck-test"); err != nil {
+		t.Fatal(err)
+	}
+	if res := blockchain.InsertChain(blocks); res.Error != nil {
+		t.Fatalf("failed to process block %d: %v", res.Index, res.Error)
+	}
+	if head := blockchain.CurrentBlock().Hash(); head != blocks[2].Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, blocks[2].Hash())
+	}
+
+	divergences := blockchain.VMDivergences()
+	if len(divergences) != 1 {
+		t.Fatalf("divergences mismatch: have %d, want 1", len(divergences))
+	}
+	d := divergences[0]
+	if d.BlockHash != blocks[1].Hash() || d.TxHash != diverging || d.TxIndex != 0 {
+		t.Errorf("divergence location mismatch: have block %x tx %x (%d), want block %x tx %x (0)", d.BlockHash, d.TxHash, d.TxIndex, blocks[1].Hash(), diverging)
+	}
+	if d.VM != NativeTxExecutor || d.Alternative != "crosscheck-test" {
+		t.Errorf("divergence VMs mismatch: have %s/%s, want %s/crosscheck-test", d.VM, d.Alternative, NativeTxExecutor)
+	}
+	if d.Field != "gas" || d.Value != TxGas.String() || d.AlternativeValue != new(big.Int).Add(TxGas, common.Big1).String() {
+		t.Errorf("divergence mismatch: have %s %s/%s, want gas %v/%v", d.Field, d.Value, d.AlternativeValue, TxGas, new(big.Int).Add(TxGas, common.Big1))
+	}
+}
@@ -66,6 +66,14 @@ func NewEnv(state *state.StateDB, chainConfig *ChainConfig, chain *BlockChain, m
 	return env
 }
 
+// NewTracingEnv returns a new VMEnv whose EVM reports its execution to the
+// given tracer.
+func NewTracingEnv(state *state.StateDB, chainConfig *ChainConfig, chain *BlockChain, msg Message, header *types.Header, tracer vm.Tracer) *VMEnv {
+	env := NewEnv(state, chainConfig, chain, msg, header)
+	env.evm = vm.NewWithTracer(env, tracer)
+	return env
+}
+
 func (self *VMEnv) RuleSet() vm.RuleSet      { return self.chainConfig }
 func (self *VMEnv) Vm() vm.Vm                { return self.evm }
 func (self *VMEnv) Origin() common.Address   { f, _ := self.msg.From(); return f }
@@ -112,6 +120,10 @@ func (self *VMEnv) DelegateCall(me vm.ContractRef, addr common.Address, data []b
 	return DelegateCall(self, me, addr, data, gas, price)
 }
 
+func (self *VMEnv) StaticCall(me vm.ContractRef, addr common.Address, data []byte, gas, price *big.Int) ([]byte, error) {
+	return StaticCall(self, me, addr, data, gas, price)
+}
+
 func (self *VMEnv) Create(me vm.ContractRef, data []byte, gas, price, value *big.Int) ([]byte, common.Address, error) {
 	return Create(self, me, data, gas, price, value)
 }
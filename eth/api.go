@@ -844,6 +844,12 @@ func (s *PublicBlockChainAPI) EstimateGas(args CallArgs) (*rpc.HexNumber, error)
 // returned. When fullTx is true the returned block contains full transaction details, otherwise it will only contain
 // transaction hashes.
 func (s *PublicBlockChainAPI) rpcOutputBlock(b *types.Block, inclTx bool, fullTx bool) (map[string]interface{}, error) {
+	return RPCMarshalBlock(b, s.bc.GetTd(b.Hash()), s.bc.Config().GetChainID(), inclTx, fullTx)
+}
+
+// RPCMarshalBlock converts the given block with total difficulty td to the RPC output, as rpcOutputBlock does. The
+// chain id is used to recover the senders of replay protected transactions.
+func RPCMarshalBlock(b *types.Block, td *big.Int, chainId *big.Int, inclTx bool, fullTx bool) (map[string]interface{}, error) {
 	fields := map[string]interface{}{
 		"number":           rpc.NewHexNumber(b.Number()),
 		"hash":             b.Hash(),
@@ -855,7 +861,7 @@ func (s *PublicBlockChainAPI) rpcOutputBlock(b *types.Block, inclTx bool, fullTx
 		"stateRoot":        b.Root(),
 		"miner":            b.Coinbase(),
 		"difficulty":       rpc.NewHexNumber(b.Difficulty()),
-		"totalDifficulty":  rpc.NewHexNumber(s.bc.GetTd(b.Hash())),
+		"totalDifficulty":  rpc.NewHexNumber(td),
 		"extraData":        fmt.Sprintf("0x%x", b.Extra()),
 		"size":             rpc.NewHexNumber(b.Size().Int64()),
 		"gasLimit":         rpc.NewHexNumber(b.GasLimit()),
@@ -873,7 +879,7 @@ func (s *PublicBlockChainAPI) rpcOutputBlock(b *types.Block, inclTx bool, fullTx
 		if fullTx {
 			formatTx = func(tx *types.Transaction) (interface{}, error) {
 				if tx.Protected() {
-					tx.SetSigner(types.NewChainIdSigner(s.bc.Config().GetChainID()))
+					tx.SetSigner(types.NewChainIdSigner(chainId))
 				}
 				return newRPCTransaction(b, tx.Hash())
 			}
@@ -1660,6 +1666,45 @@ func (api *PrivateAdminAPI) SetSolc(path string) (string, error) {
 	return solc.Info(), nil
 }
 
+// ReloadChainConfig re-reads the external chain configuration file, applying
+// its bootstrap nodes and bad hashes. Its genesis and forks must be unchanged.
+func (api *PrivateAdminAPI) ReloadChainConfig() (bool, error) {
+	if err := api.eth.ReloadChainConfig(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PeerScore is the reputation of a remote node, as returned by PeerScores.
+type PeerScore struct {
+	ID          string     `json:"id"`
+	Score       int64      `json:"score"`
+	Offences    int64      `json:"offences"`
+	BannedUntil *time.Time `json:"bannedUntil"`
+}
+
+// PeerScores retrieves the reputation of all the nodes scored by the protocol
+// manager, best first. Banned nodes carry the time their ban expires.
+func (api *PrivateAdminAPI) PeerScores() []*PeerScore {
+	var (
+		now    = time.Now()
+		scores = api.eth.protocolManager.scorer.Scores()
+		result = make([]*PeerScore, len(scores))
+	)
+	for i, score := range scores {
+		result[i] = &PeerScore{
+			ID:       score.ID.String(),
+			Score:    score.Score,
+			Offences: score.Offences,
+		}
+		if score.Banned(now) {
+			banned := score.BannedUntil
+			result[i].BannedUntil = &banned
+		}
+	}
+	return result
+}
+
 // ExportChain exports the current blockchain into a local file.
 func (api *PrivateAdminAPI) ExportChain(file string) (bool, error) {
 	// Make sure we can create the file to export into
@@ -1784,6 +1829,58 @@ func (api *PublicGethAPI) GetAddressTransactions(address common.Address, blockSt
 	return list, nil
 }
 
+// RPCInternalTransaction represents an internal transaction, ie. a value transfer,
+// contract creation or suicide made by a contract, that will serialize to the RPC
+// representation
+type RPCInternalTransaction struct {
+	BlockNumber     *rpc.HexNumber `json:"blockNumber"`
+	TransactionHash common.Hash    `json:"transactionHash"`
+	Index           *rpc.HexNumber `json:"index"`
+	Depth           *rpc.HexNumber `json:"depth"`
+	Type            string         `json:"type"`
+	From            common.Address `json:"from"`
+	To              common.Address `json:"to"`
+	Value           *rpc.HexNumber `json:"value"`
+}
+
+// GetInternalTransactionsByAddress gets the internal transactions (value transfers, contract
+// creations and suicides made by contracts) for a given address.
+// The parameters follow the semantics of GetAddressTransactions, with txKindOf accepting
+// 's' (value transfer), 'c' (contract creation) and 'd' (contract destruction).
+func (api *PublicGethAPI) GetInternalTransactionsByAddress(address common.Address, blockStartN uint64, blockEndN rpc.BlockNumber, toOrFrom string, txKindOf string, pagStart, pagEnd int, reverse bool) ([]*RPCInternalTransaction, error) {
+	glog.V(logger.Debug).Infof("RPC call: geth_getInternalTransactionsByAddress %s %d %d %s %s", address, blockStartN, blockEndN, toOrFrom, txKindOf)
+
+	atxi := api.eth.BlockChain().GetAtxi()
+	if atxi == nil || !atxi.Internal {
+		return nil, errors.New("internal tx indexing not enabled")
+	}
+	if toOrFrom == "tf" || toOrFrom == "ft" {
+		toOrFrom = "b"
+	}
+	if blockEndN == rpc.LatestBlockNumber || blockEndN == rpc.PendingBlockNumber {
+		blockEndN = 0
+	}
+
+	itxs, err := core.GetInternalTxs(atxi.Db, address, blockStartN, uint64(blockEndN.Int64()), toOrFrom, txKindOf, pagStart, pagEnd, reverse)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*RPCInternalTransaction, len(itxs))
+	for i, itx := range itxs {
+		list[i] = &RPCInternalTransaction{
+			BlockNumber:     rpc.NewHexNumber(itx.BlockNumber),
+			TransactionHash: itx.TxHash,
+			Index:           rpc.NewHexNumber(itx.Index),
+			Depth:           rpc.NewHexNumber(itx.Depth),
+			Type:            itx.Kind,
+			From:            itx.From,
+			To:              itx.To,
+			Value:           rpc.NewHexNumber(itx.Value),
+		}
+	}
+	return list, nil
+}
+
 func (api *PublicGethAPI) BuildATXI(start, stop, step rpc.BlockNumber) (bool, error) {
 	glog.V(logger.Debug).Infof("RPC call: geth_buildATXI %v %v %v", start, stop, step)
 
@@ -1917,6 +2014,16 @@ func (api *PublicDebugAPI) SetHead(number uint64) (bool, error) {
 	return true, nil
 }
 
+// VmDivergences returns the most recent divergences between the native EVM and
+// SputnikVM found by the VM cross-check, oldest first.
+func (api *PublicDebugAPI) VmDivergences() ([]*core.VMDivergence, error) {
+	divergences := api.eth.BlockChain().VMDivergences()
+	if divergences == nil {
+		return nil, errors.New("VM cross-check not enabled, use --vm.crosscheck=<vm>")
+	}
+	return divergences, nil
+}
+
 // Metrics return all available registered metrics for the client.
 // See https://github.com/ethereumproject/go-ethereum/wiki/Metrics-and-Monitoring for prophetic documentation.
 func (api *PublicDebugAPI) Metrics(raw bool) (map[string]interface{}, error) {
@@ -2027,8 +2134,153 @@ func (api *PublicDebugAPI) Vmodule(s string) (string, error) {
 // while replaying a transaction in debug mode as well as the amount of
 // gas used and the return value
 type ExecutionResult struct {
-	Gas         *big.Int `json:"gas"`
-	ReturnValue string   `json:"returnValue"`
+	Gas         *big.Int       `json:"gas"`
+	Failed      bool           `json:"failed"`
+	ReturnValue string         `json:"returnValue"`
+	StructLogs  []StructLogRes `json:"structLogs,omitempty"`
+}
+
+// StructLogRes stores a structured log emitted by the EVM while replaying a
+// transaction in debug mode
+type StructLogRes struct {
+	Pc      uint64             `json:"pc"`
+	Op      string             `json:"op"`
+	Gas     *big.Int           `json:"gas"`
+	GasCost *big.Int           `json:"gasCost"`
+	Depth   int                `json:"depth"`
+	Error   string             `json:"error,omitempty"`
+	Stack   *[]string          `json:"stack,omitempty"`
+	Memory  *[]string          `json:"memory,omitempty"`
+	Storage *map[string]string `json:"storage,omitempty"`
+}
+
+// formatLogs formats EVM returned structured logs for json output
+func formatLogs(structLogs []vm.StructLog) []StructLogRes {
+	formatted := make([]StructLogRes, len(structLogs))
+	for index, trace := range structLogs {
+		formatted[index] = StructLogRes{
+			Pc:      trace.Pc,
+			Op:      trace.Op.String(),
+			Gas:     trace.Gas,
+			GasCost: trace.GasCost,
+			Depth:   trace.Depth,
+		}
+		if trace.Err != nil {
+			formatted[index].Error = trace.Err.Error()
+		}
+		if trace.Stack != nil {
+			stack := make([]string, len(trace.Stack))
+			for i, stackValue := range trace.Stack {
+				stack[i] = fmt.Sprintf("%x", common.LeftPadBytes(stackValue.Bytes(), 32))
+			}
+			formatted[index].Stack = &stack
+		}
+		if trace.Memory != nil {
+			memory := make([]string, 0, (len(trace.Memory)+31)/32)
+			for i := 0; i+32 <= len(trace.Memory); i += 32 {
+				memory = append(memory, fmt.Sprintf("%x", trace.Memory[i:i+32]))
+			}
+			formatted[index].Memory = &memory
+		}
+		if trace.Storage != nil {
+			storage := make(map[string]string)
+			for i, storageValue := range trace.Storage {
+				storage[fmt.Sprintf("%x", i)] = fmt.Sprintf("%x", storageValue)
+			}
+			formatted[index].Storage = &storage
+		}
+	}
+	return formatted
+}
+
+// CallFrameRes is the JSON representation of a call frame collected by the
+// call tracer
+type CallFrameRes struct {
+	Type    string          `json:"type"`
+	From    common.Address  `json:"from"`
+	To      common.Address  `json:"to"`
+	Value   *rpc.HexNumber  `json:"value"`
+	Gas     *rpc.HexNumber  `json:"gas"`
+	GasUsed *rpc.HexNumber  `json:"gasUsed"`
+	Input   string          `json:"input"`
+	Output  string          `json:"output"`
+	Error   string          `json:"error,omitempty"`
+	Calls   []*CallFrameRes `json:"calls,omitempty"`
+}
+
+// formatCallFrame formats a call tree collected by the call tracer for json output
+func formatCallFrame(frame *vm.CallFrame) *CallFrameRes {
+	if frame == nil {
+		return nil
+	}
+	res := &CallFrameRes{
+		Type:   frame.Type.String(),
+		From:   frame.From,
+		To:     frame.To,
+		Value:  rpc.NewHexNumber(frame.Value),
+		Gas:    rpc.NewHexNumber(frame.Gas),
+		Input:  fmt.Sprintf("0x%x", frame.Input),
+		Output: fmt.Sprintf("0x%x", frame.Output),
+	}
+	if frame.GasUsed != nil {
+		res.GasUsed = rpc.NewHexNumber(frame.GasUsed)
+	}
+	if frame.Err != nil {
+		res.Error = frame.Err.Error()
+	}
+	for _, call := range frame.Calls {
+		res.Calls = append(res.Calls, formatCallFrame(call))
+	}
+	return res
+}
+
+// TraceArgs holds extra parameters to trace functions
+type TraceArgs struct {
+	*vm.LogConfig
+	Tracer *string
+}
+
+const (
+	// structLoggerName is the default tracer, emitting a log for each step of the VM
+	structLoggerName = "structLogger"
+	// callTracerName is the tracer collecting the tree of calls of a transaction
+	callTracerName = "callTracer"
+)
+
+// newTracer returns the tracer requested by the given trace arguments.
+func newTracer(config *TraceArgs) (vm.Tracer, error) {
+	if config == nil {
+		return vm.NewStructLogger(nil), nil
+	}
+	name := structLoggerName
+	if config.Tracer != nil && *config.Tracer != "" {
+		name = *config.Tracer
+	}
+	switch name {
+	case structLoggerName:
+		return vm.NewStructLogger(config.LogConfig), nil
+	case callTracerName:
+		return vm.NewCallTracer(), nil
+	default:
+		return nil, fmt.Errorf("unknown tracer: %q (available: %q, %q)", name, structLoggerName, callTracerName)
+	}
+}
+
+// traceResult assembles the result of a traced execution depending on the
+// kind of tracer used.
+func traceResult(tracer vm.Tracer, ret []byte, gas *big.Int, failed bool) interface{} {
+	switch tracer := tracer.(type) {
+	case *vm.StructLogger:
+		return &ExecutionResult{
+			Gas:         gas,
+			Failed:      failed,
+			ReturnValue: fmt.Sprintf("%x", ret),
+			StructLogs:  formatLogs(tracer.StructLogs()),
+		}
+	case *vm.CallTracer:
+		return formatCallFrame(tracer.Result())
+	}
+	panic(fmt.Sprintf("bad tracer type %T", tracer))
 }
 
 // TraceCall executes a call and returns the amount of gas and optionally returned values.
@@ -2074,47 +2326,124 @@ func (s *PublicBlockChainAPI) TraceCall(args CallArgs, blockNr rpc.BlockNumber)
 	vmenv := core.NewEnv(stateDb, s.config, s.bc, msg, block.Header())
 	gp := new(core.GasPool).AddGas(common.MaxBig)
 
-	ret, gas, _, err := core.ApplyMessage(vmenv, msg, gp)
+	ret, gas, failed, err := core.ApplyMessage(vmenv, msg, gp)
+	if err != nil {
+		return nil, err
+	}
 	return &ExecutionResult{
 		Gas:         gas,
+		Failed:      failed,
 		ReturnValue: fmt.Sprintf("%x", ret),
 	}, nil
 }
 
-// TraceTransaction returns the amount of gas and execution result of the given transaction.
-func (s *PublicDebugAPI) TraceTransaction(txHash common.Hash) (*ExecutionResult, error) {
-	var result *ExecutionResult
+// TraceTransaction returns the structured logs created during the execution of the EVM
+// and returns them as a JSON object. Alternatively the call tree of the transaction
+// is returned if the "callTracer" tracer is requested.
+func (s *PublicDebugAPI) TraceTransaction(txHash common.Hash, config *TraceArgs) (interface{}, error) {
+	tracer, err := newTracer(config)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, blockHash, _, txIndex := core.GetTransaction(s.eth.ChainDb(), txHash)
 	if tx == nil {
-		return result, fmt.Errorf("tx '%x' not found", txHash)
+		return nil, fmt.Errorf("tx '%x' not found", txHash)
 	}
 
-	msg, vmenv, err := s.computeTxEnv(blockHash, int(txIndex))
+	msg, vmenv, err := s.computeTxEnv(blockHash, int(txIndex), tracer)
 	if err != nil {
 		return nil, err
 	}
 
 	gp := new(core.GasPool).AddGas(tx.Gas())
-	ret, gas, _, err := core.ApplyMessage(vmenv, msg, gp)
-	return &ExecutionResult{
-		Gas:         gas,
-		ReturnValue: fmt.Sprintf("%x", ret),
-	}, nil
+	ret, gas, failed, err := core.ApplyMessage(vmenv, msg, gp)
+	if err != nil {
+		return nil, fmt.Errorf("tracing failed: %v", err)
+	}
+	return traceResult(tracer, ret, gas, failed), nil
 }
 
-// computeTxEnv returns the execution environment of a certain transaction.
-func (s *PublicDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int) (core.Message, *core.VMEnv, error) {
+// TraceBlockByNumber replays the block with the given number on top of its parent
+// state and returns the trace of each of its transactions.
+func (s *PublicDebugAPI) TraceBlockByNumber(number rpc.BlockNumber, config *TraceArgs) ([]*TxTraceResult, error) {
+	var block *types.Block
+	switch number {
+	case rpc.PendingBlockNumber:
+		return nil, errors.New("tracing the pending block is not supported")
+	case rpc.LatestBlockNumber:
+		block = s.eth.BlockChain().CurrentBlock()
+	default:
+		block = s.eth.BlockChain().GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return TraceBlock(s.eth.BlockChain(), s.eth.chainConfig, block, config)
+}
+
+// TraceBlockByHash replays the block with the given hash on top of its parent
+// state and returns the trace of each of its transactions.
+func (s *PublicDebugAPI) TraceBlockByHash(hash common.Hash, config *TraceArgs) ([]*TxTraceResult, error) {
+	block := s.eth.BlockChain().GetBlock(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+	return TraceBlock(s.eth.BlockChain(), s.eth.chainConfig, block, config)
+}
+
+// TxTraceResult is the trace of a single transaction of a traced block. Either
+// Result or Error is set.
+type TxTraceResult struct {
+	TxHash common.Hash `json:"txHash"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// TraceBlock replays all transactions of the given block on top of the state of
+// its parent and returns the trace of every transaction, in block order, using
+// the tracer selected by config.
+func TraceBlock(bc *core.BlockChain, config *core.ChainConfig, block *types.Block, args *TraceArgs) ([]*TxTraceResult, error) {
+	// Fail early on a bad tracer selection.
+	if _, err := newTracer(args); err != nil {
+		return nil, err
+	}
+	statedb, err := parentStateOf(bc, block)
+	if err != nil {
+		return nil, err
+	}
+
+	txs := block.Transactions()
+	results := make([]*TxTraceResult, len(txs))
+	for idx, tx := range txs {
+		msg, err := txCallMsg(statedb, tx)
+		if err != nil {
+			return nil, err
+		}
+		tracer, _ := newTracer(args)
+		vmenv := core.NewTracingEnv(statedb, config, bc, msg, block.Header(), tracer)
+
+		results[idx] = &TxTraceResult{TxHash: tx.Hash()}
+		gp := new(core.GasPool).AddGas(tx.Gas())
+		ret, gas, failed, err := core.ApplyMessage(vmenv, msg, gp)
+		if err != nil {
+			results[idx].Error = err.Error()
+		} else {
+			results[idx].Result = traceResult(tracer, ret, gas, failed)
+		}
+		statedb.DeleteSuicides()
+	}
+	return results, nil
+}
 
-	// Create the parent state.
+// computeTxEnv returns the execution environment of a certain transaction.
+// If a tracer is given, the returned environment reports its execution to it.
+func (s *PublicDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int, tracer vm.Tracer) (core.Message, *core.VMEnv, error) {
 	block := s.eth.BlockChain().GetBlock(blockHash)
 	if block == nil {
 		return nil, nil, fmt.Errorf("block %x not found", blockHash)
 	}
-	parent := s.eth.BlockChain().GetBlock(block.ParentHash())
-	if parent == nil {
-		return nil, nil, fmt.Errorf("block parent %x not found", block.ParentHash())
-	}
-	statedb, err := s.eth.BlockChain().StateAt(parent.Root())
+	statedb, err := parentStateOf(s.eth.BlockChain(), block)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -2122,35 +2451,22 @@ func (s *PublicDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int) (core.
 
 	// Recompute transactions up to the target index.
 	for idx, tx := range txs {
-		// Assemble the transaction call message
-		// Retrieve the account state object to interact with
-		var from *state.StateObject
-		fromAddress, e := tx.From()
-		if e != nil {
-			return nil, nil, e
-		}
-		if fromAddress == (common.Address{}) {
-			from = statedb.GetOrNewStateObject(common.Address{})
-		} else {
-			from = statedb.GetOrNewStateObject(fromAddress)
+		msg, err := txCallMsg(statedb, tx)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		msg := callmsg{
-			from:     from,
-			to:       tx.To(),
-			gas:      tx.Gas(),
-			gasPrice: tx.GasPrice(),
-			value:    tx.Value(),
-			data:     tx.Data(),
+		if idx == txIndex {
+			if tracer != nil {
+				return msg, core.NewTracingEnv(statedb, s.eth.chainConfig, s.eth.BlockChain(), msg, block.Header(), tracer), nil
+			}
+			return msg, core.NewEnv(statedb, s.eth.chainConfig, s.eth.BlockChain(), msg, block.Header()), nil
 		}
 
 		vmenv := core.NewEnv(statedb, s.eth.chainConfig, s.eth.BlockChain(), msg, block.Header())
-		if idx == txIndex {
-			return msg, vmenv, nil
-		}
 
 		gp := new(core.GasPool).AddGas(tx.Gas())
-		_, _, _, err := core.ApplyMessage(vmenv, msg, gp)
+		_, _, _, err = core.ApplyMessage(vmenv, msg, gp)
 		if err != nil {
 			return nil, nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
 		}
@@ -2159,6 +2475,36 @@ func (s *PublicDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int) (core.
 	return nil, nil, fmt.Errorf("tx index %d out of range for block %x", txIndex, blockHash)
 }
 
+// parentStateOf returns a mutable copy of the state the given block was
+// applied to.
+func parentStateOf(bc *core.BlockChain, block *types.Block) (*state.StateDB, error) {
+	parent := bc.GetBlock(block.ParentHash())
+	if parent == nil {
+		return nil, fmt.Errorf("block parent %x not found", block.ParentHash())
+	}
+	return bc.StateAt(parent.Root())
+}
+
+// txCallMsg assembles the call message replaying the given transaction on
+// top of statedb.
+func txCallMsg(statedb *state.StateDB, tx *types.Transaction) (callmsg, error) {
+	// Retrieve the account state object to interact with
+	fromAddress, err := tx.From()
+	if err != nil {
+		return callmsg{}, err
+	}
+	from := statedb.GetOrNewStateObject(fromAddress)
+
+	return callmsg{
+		from:     from,
+		to:       tx.To(),
+		gas:      tx.Gas(),
+		gasPrice: tx.GasPrice(),
+		value:    tx.Value(),
+		data:     tx.Data(),
+	}, nil
+}
+
 // PublicNetAPI offers network related RPC methods
 type PublicNetAPI struct {
 	net            *p2p.Server
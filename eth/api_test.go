@@ -0,0 +1,104 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/core/vm"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+)
+
+// Tests that all transactions of a block are replayed and traced in order.
+func TestTraceBlock(t *testing.T) {
+	// init code storing 1 at slot 0 and returning no code
+	initCode := []byte{
+		byte(vm.PUSH1), 1,
+		byte(vm.PUSH1), 0,
+		byte(vm.SSTORE),
+		byte(vm.STOP),
+	}
+	acc1Key, _ := crypto.GenerateKey()
+	acc1Addr := crypto.PubkeyToAddress(acc1Key.PublicKey)
+
+	generator := func(i int, block *core.BlockGen) {
+		if i == 0 {
+			tx1, _ := types.NewContractCreation(block.TxNonce(testBank.Address), new(big.Int), big.NewInt(100000), new(big.Int), initCode).SignECDSA(testBankKey)
+			block.AddTx(tx1)
+			tx2, _ := types.NewTransaction(block.TxNonce(testBank.Address), acc1Addr, big.NewInt(1000), core.TxGas, nil, nil).SignECDSA(testBankKey)
+			block.AddTx(tx2)
+		}
+	}
+	var (
+		db, _         = ethdb.NewMemDatabase()
+		genesis       = core.WriteGenesisBlockForTesting(db, testBank)
+		config        = core.DefaultConfigMorden.ChainConfig
+		blockchain, _ = core.NewBlockChain(db, config, new(core.FakePow), new(event.TypeMux))
+	)
+	chain, _ := core.GenerateChain(config, genesis, db, 1, generator)
+	if res := blockchain.InsertChain(chain); res.Error != nil {
+		t.Fatalf("failed to insert chain: %v", res.Error)
+	}
+
+	block := blockchain.GetBlockByNumber(1)
+	results, err := TraceBlock(blockchain, config, block, nil)
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("trace count mismatch: have %d, want %d", len(results), 2)
+	}
+	for i, tx := range block.Transactions() {
+		if results[i].TxHash != tx.Hash() {
+			t.Errorf("trace %d: hash mismatch: have %x, want %x", i, results[i].TxHash, tx.Hash())
+		}
+		if results[i].Error != "" {
+			t.Errorf("trace %d: unexpected error: %v", i, results[i].Error)
+		}
+	}
+	creation := results[0].Result.(*ExecutionResult)
+	if len(creation.StructLogs) != len(initCode)-2 {
+		t.Errorf("creation struct log count mismatch: have %d, want %d", len(creation.StructLogs), len(initCode)-2)
+	}
+	transfer := results[1].Result.(*ExecutionResult)
+	if len(transfer.StructLogs) != 0 {
+		t.Errorf("transfer struct log count mismatch: have %d, want %d", len(transfer.StructLogs), 0)
+	}
+	if transfer.Gas.Cmp(core.TxGas) != 0 {
+		t.Errorf("transfer gas mismatch: have %v, want %v", transfer.Gas, core.TxGas)
+	}
+
+	// The call tracer reports a creation frame for the first transaction.
+	tracer := callTracerName
+	results, err = TraceBlock(blockchain, config, block, &TraceArgs{Tracer: &tracer})
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if frame := results[0].Result.(*CallFrameRes); frame.Type != vm.CREATE.String() {
+		t.Errorf("creation frame type mismatch: have %s, want %s", frame.Type, vm.CREATE)
+	}
+
+	bad := "nonexistent"
+	if _, err := TraceBlock(blockchain, config, block, &TraceArgs{Tracer: &bad}); err == nil {
+		t.Errorf("expected error for unknown tracer")
+	}
+}
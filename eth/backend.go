@@ -24,6 +24,7 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"sync"
 	"time"
@@ -58,13 +59,17 @@ const (
 )
 
 type Config struct {
-	ChainConfig *core.ChainConfig // chain configuration
+	ChainConfig     *core.ChainConfig // chain configuration
+	ChainConfigFile string            // External chain configuration file to reload, if any
+	Checkpoint      *core.Checkpoint  // Trusted block synchronisation is restricted to, if any
 
 	NetworkId int // Network ID to use for selecting peers to connect to
 	Genesis   *core.GenesisDump
 	FastSync  bool // Enables the state download based fast synchronisation algorithm
 	MaxPeers  int
 
+	PeerBanPeriod time.Duration // Time a misbehaving peer is first banned for (0 = default)
+
 	BlockChainVersion  int
 	SkipBcVersionCheck bool // e.g. blockchain export
 	DatabaseCache      int
@@ -82,7 +87,16 @@ type Config struct {
 	MinerThreads   int
 	SolcPath       string
 
-	UseAddrTxIndex bool
+	UseAddrTxIndex     bool
+	UseInternalTxIndex bool
+	UseLogIndex        bool
+
+	StateGC bool // Garbage collect the states of old blocks instead of archiving them
+
+	VMCrossCheck string // Name of a VM executing transactions too, reporting divergences
+
+	UseFreezer   bool   // Move ancient block bodies and receipts to the freezer
+	FreezerDepth uint64 // Number of recent blocks kept out of the freezer
 
 	GpoMinGasPrice          *big.Int
 	GpoMaxGasPrice          *big.Int
@@ -116,6 +130,8 @@ type Ethereum struct {
 	SolcPath        string
 	solc            *compiler.Solidity
 	gpo             *GasPriceOracle
+	bloomIndexer    *core.BloomIndexer // Bloom bits indexer for log filtering
+	chainFreezer    *core.ChainFreezer // Ancient block freezer (optional)
 
 	GpoMinGasPrice          *big.Int
 	GpoMaxGasPrice          *big.Int
@@ -138,6 +154,9 @@ type Ethereum struct {
 	etherbase     common.Address
 	netVersionId  int
 	netRPCService *PublicNetAPI
+
+	server   *p2p.Server // set on Start, for reloading the bootstrap nodes
+	reloadMu sync.Mutex  // serializes chain configuration reloads
 }
 
 func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
@@ -152,6 +171,13 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	if err := addMipmapBloomBins(chainDb); err != nil {
 		return nil, err
 	}
+	// Attach the freezer holding ancient blocks, which is only created on demand
+	// but must be read whenever present.
+	if ldb, ok := chainDb.(*ethdb.LDBDatabase); ok {
+		if err := ldb.OpenFreezer(filepath.Join(ldb.Path(), "ancient"), config.UseFreezer); err != nil {
+			return nil, err
+		}
+	}
 
 	dappDb, err := ctx.OpenDatabase("dapp", config.DatabaseCache, config.DatabaseHandles)
 	if err != nil {
@@ -287,10 +313,31 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		}
 		return nil, err
 	}
+	if config.StateGC {
+		if err := eth.blockchain.EnableStateGC(); err != nil {
+			return nil, err
+		}
+	}
+	if config.VMCrossCheck != "" {
+		if err := eth.blockchain.EnableVMCrossCheck(config.VMCrossCheck); err != nil {
+			return nil, err
+		}
+	}
+	eth.bloomIndexer = core.NewBloomIndexer(chainDb)
+	if ldb, ok := chainDb.(*ethdb.LDBDatabase); ok && config.UseFreezer {
+		depth := config.FreezerDepth
+		if depth == 0 {
+			depth = core.DefaultFreezerDepth
+		}
+		eth.chainFreezer = core.NewChainFreezer(ldb, depth)
+	}
+
 	// Configure enabled atxi for blockchain
 	if config.UseAddrTxIndex {
 		eth.blockchain.SetAtxi(&core.AtxiT{
-			Db: eth.indexesDb,
+			Db:       eth.indexesDb,
+			Internal: config.UseInternalTxIndex,
+			Logs:     config.UseLogIndex,
 		})
 	}
 
@@ -303,7 +350,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	if config.FastSync {
 		m = downloader.FastSync
 	}
-	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, m, uint64(config.NetworkId), eth.eventMux, eth.txPool, eth.pow, eth.blockchain, chainDb); err != nil {
+	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, m, config.Checkpoint, uint64(config.NetworkId), eth.eventMux, eth.txPool, eth.pow, eth.blockchain, chainDb, config.PeerBanPeriod); err != nil {
 		return nil, err
 	}
 	eth.miner = miner.New(eth, eth.chainConfig, eth.EventMux(), eth.pow)
@@ -366,7 +413,7 @@ func (s *Ethereum) APIs() []rpc.API {
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.chainDb, s.eventMux),
+			Service:   filters.NewPublicFilterAPI(s.chainDb, s.eventMux, s.blockchain.GetAtxi()),
 			Public:    true,
 		}, {
 			Namespace: "admin",
@@ -445,14 +492,25 @@ func (s *Ethereum) Start(srvr *p2p.Server) error {
 	if s.AutoDAG {
 		s.StartAutoDAG()
 	}
+	// Persist peer scores in the node database, if discovery is running
+	s.protocolManager.scorer.SetDatabase(srvr.ScoreDB())
 	s.protocolManager.Start(s.config.MaxPeers)
+	s.bloomIndexer.Start()
+	if s.chainFreezer != nil {
+		s.chainFreezer.Start()
+	}
 	s.netRPCService = NewPublicNetAPI(srvr, s.NetVersion())
+	s.server = srvr
 	return nil
 }
 
 // Stop implements node.Service, terminating all internal goroutines used by the
 // Ethereum protocol.
 func (s *Ethereum) Stop() error {
+	s.bloomIndexer.Stop()
+	if s.chainFreezer != nil {
+		s.chainFreezer.Stop()
+	}
 	s.blockchain.Stop()
 	s.protocolManager.Stop()
 	s.txPool.Stop()
@@ -557,6 +615,45 @@ func (self *Ethereum) SetSolc(solcPath string) (*compiler.Solidity, error) {
 	return self.Solc()
 }
 
+// ReloadChainConfig re-reads the external chain configuration file, and applies
+// its bootstrap nodes and bad hashes without a restart. The new configuration
+// must be valid, with the same genesis and forks as the one in use.
+func (s *Ethereum) ReloadChainConfig() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if s.config.ChainConfigFile == "" {
+		return errors.New("chain configuration is not external")
+	}
+	errs, err := core.ValidateExternalChainConfigFile(s.config.ChainConfigFile)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid chain configuration %s: %v", s.config.ChainConfigFile, errs[0])
+	}
+	next, err := core.ReadExternalChainConfigFromFile(s.config.ChainConfigFile)
+	if err != nil {
+		return err
+	}
+	if s.config.Genesis != nil && !reflect.DeepEqual(s.config.Genesis, next.Genesis) {
+		return fmt.Errorf("%v: genesis changed", core.ErrChainConfigReload)
+	}
+	if err := s.chainConfig.CheckReload(next.ChainConfig); err != nil {
+		return err
+	}
+
+	s.blockchain.SetBadHashes(next.ChainConfig.BadHashes)
+	if s.server != nil {
+		if err := s.server.SetBootstrapNodes(next.ParsedBootstrap); err != nil {
+			return err
+		}
+	}
+	glog.V(logger.Info).Infof("Reloaded chain configuration %s: %d bootstrap nodes, %d bad hashes", s.config.ChainConfigFile, len(next.ParsedBootstrap), len(next.ChainConfig.BadHashes))
+	glog.D(logger.Warn).Infof("Reloaded chain configuration: %s bootstrap nodes, %s bad hashes", logger.ColorGreen(strconv.Itoa(len(next.ParsedBootstrap))), logger.ColorGreen(strconv.Itoa(len(next.ChainConfig.BadHashes))))
+	return nil
+}
+
 // dagFiles(epoch) returns the two alternative DAG filenames (not a path)
 // 1) <revision>-<hex(seedhash[8])> 2) full-R<revision>-<hex(seedhash[8])>
 func dagFiles(epoch uint64) (string, string) {
@@ -28,6 +28,8 @@ import (
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/core"
 	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/eth/peerscore"
+	"github.com/ethereumproject/go-ethereum/eth/snap"
 	"github.com/ethereumproject/go-ethereum/ethdb"
 	"github.com/ethereumproject/go-ethereum/event"
 	"github.com/ethereumproject/go-ethereum/logger"
@@ -80,6 +82,7 @@ var (
 	errPeersUnavailable        = errors.New("no peers available or all tried for download")
 	errInvalidAncestor         = errors.New("retrieved ancestor is invalid")
 	errInvalidChain            = errors.New("retrieved hash chain is invalid")
+	errImportFailed            = errors.New("retrieved chain failed to import locally")
 	errInvalidBlock            = errors.New("retrieved block is invalid")
 	errInvalidBody             = errors.New("retrieved block body is invalid")
 	errInvalidReceipt          = errors.New("retrieved receipt is invalid")
@@ -92,6 +95,7 @@ var (
 	errCancelContentProcessing = errors.New("content processing canceled (requested)")
 	errNoSyncActive            = errors.New("no sync active")
 	errTooOld                  = errors.New("peer doesn't speak recent enough protocol version (need version >= 62)")
+	errCheckpointMismatch      = errors.New("peer's chain doesn't contain the trusted checkpoint")
 )
 
 func ErrWasRequested(e error) bool {
@@ -139,10 +143,16 @@ type Downloader struct {
 	mode SyncMode       // Synchronisation mode defining the strategy used (per sync cycle)
 	mux  *event.TypeMux // Event multiplexer to announce sync operation events
 
+	checkpoint *core.Checkpoint // Trusted block the synced chain must contain, if any
+
 	queue   *queue   // Scheduler for selecting the hashes to download
 	peers   *peerSet // Set of active peers from which download can proceed
 	stateDB ethdb.Database
 
+	scorer *peerscore.Scorer // Reputation tracker of the peers, if any
+
+	snapSyncer *snap.Syncer // State range syncer run ahead of the trie node sync
+
 	rttEstimate   uint64 // Round trip time to target for download requests
 	rttConfidence uint64 // Confidence in the estimated RTT (unit: millionths to allow atomic ops)
 
@@ -243,17 +253,23 @@ type BlockChain interface {
 }
 
 // New creates a new downloader to fetch hashes and blocks from remote peers.
-func New(mode SyncMode, stateDb ethdb.Database, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn) *Downloader {
+// If a checkpoint is given, only peers whose chain contains it are synced with.
+// If a scorer is given, the behaviour of the peers is recorded with it, and
+// peers with a good reputation are preferred for downloads.
+func New(mode SyncMode, checkpoint *core.Checkpoint, stateDb ethdb.Database, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn, scorer *peerscore.Scorer) *Downloader {
 	if lightchain == nil {
 		lightchain = chain
 	}
 
 	dl := &Downloader{
 		mode:           mode,
+		checkpoint:     checkpoint,
 		stateDB:        stateDb,
+		snapSyncer:     snap.NewSyncer(stateDb),
 		mux:            mux, // inherited from protocolManager, which inherits from Ethereum
 		queue:          newQueue(),
-		peers:          newPeerSet(),
+		peers:          newPeerSet(scorer),
+		scorer:         scorer,
 		rttEstimate:    uint64(rttMaxEstimate),
 		rttConfidence:  uint64(1000000),
 		blockchain:     chain,
@@ -275,6 +291,19 @@ func New(mode SyncMode, stateDb ethdb.Database, mux *event.TypeMux, chain BlockC
 	return dl
 }
 
+// scorePeer records a behaviour of a peer with the scorer, if any.
+func (d *Downloader) scorePeer(id string, event peerscore.Event) {
+	if d.scorer != nil {
+		d.scorer.Record(id, event)
+	}
+}
+
+// SnapSyncer returns the state range syncer, which the snap protocol peers are
+// registered with.
+func (d *Downloader) SnapSyncer() *snap.Syncer {
+	return d.snapSyncer
+}
+
 func (d *Downloader) currentLocalChainHeight() (current uint64) {
 	current = d.lightchain.CurrentHeader().Number.Uint64() // "LightSync"
 	switch d.mode {
@@ -399,8 +428,16 @@ func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode
 		glog.V(logger.Debug).Warnln("sync busy")
 	case errTimeout, errBadPeer, errStallingPeer,
 		errEmptyHeaderSet, errPeersUnavailable, errTooOld,
-		errInvalidAncestor, errInvalidChain:
+		errInvalidAncestor, errInvalidChain, errCheckpointMismatch:
 		glog.V(logger.Core).Warnf("Peer %s: drop: %s", id, err)
+		switch err {
+		case errInvalidAncestor, errInvalidChain, errCheckpointMismatch:
+			d.scorePeer(id, peerscore.InvalidBlock)
+		case errTimeout, errStallingPeer:
+			d.scorePeer(id, peerscore.Timeout)
+		default:
+			d.scorePeer(id, peerscore.UselessResponse)
+		}
 		d.dropPeer(id)
 
 	default:
@@ -526,6 +563,10 @@ func (d *Downloader) syncWithPeer(p *peer, hash common.Hash, td *big.Int) (err e
 	}
 	height := latest.Number.Uint64()
 
+	trusted, err := d.checkCheckpoint(p, td, height)
+	if err != nil {
+		return err
+	}
 	origin, err := d.findAncestor(p, height)
 	if err != nil {
 		return err
@@ -562,7 +603,7 @@ func (d *Downloader) syncWithPeer(p *peer, hash common.Hash, td *big.Int) (err e
 		func() error { return d.fetchHeaders(p, origin+1, pivot) }, // Headers are always retrieved
 		func() error { return d.fetchBodies(origin + 1) },          // Bodies are retrieved during normal and fast sync
 		func() error { return d.fetchReceipts(origin + 1) },        // Receipts are retrieved during fast sync
-		func() error { return d.processHeaders(origin+1, pivot, td) },
+		func() error { return d.processHeaders(origin+1, pivot, trusted, td) },
 	}
 	if d.mode == FastSync {
 		fetchers = append(fetchers, func() error { return d.processFastSyncContent(latest) })
@@ -685,6 +726,78 @@ func (d *Downloader) fetchHeight(p *peer) (*types.Header, error) {
 	}
 }
 
+// checkCheckpoint makes sure the chain of the remote peer contains the trusted
+// checkpoint, if one is configured and the peer already reached it. It returns
+// the number of the checkpoint if the headers up to it can be imported without
+// verifying their proof-of-work, or 0 if they can't.
+func (d *Downloader) checkCheckpoint(p *peer, td *big.Int, height uint64) (uint64, error) {
+	cp := d.checkpoint
+	if cp == nil || height < cp.Number {
+		return 0, nil
+	}
+	if td.Cmp(cp.TD) < 0 {
+		glog.V(logger.Debug).Infof("%v: total difficulty %v below checkpoint %v", p, td, cp.TD)
+		return 0, errCheckpointMismatch
+	}
+	glog.V(logger.Debug).Infof("%v: retrieving checkpoint header #%d", p, cp.Number)
+	go p.getAbsHeaders(cp.Number, 1, 0, false)
+
+	ttl := d.requestTTL()
+	timer := time.NewTimer(ttl)
+	defer timer.Stop()
+	for {
+		select {
+		case <-d.cancelCh:
+			return 0, errCancelBlockFetch
+
+		case packet := <-d.headerCh:
+			// Discard anything not from the origin peer
+			if packet.PeerId() != p.id {
+				glog.V(logger.Debug).Infof("Received headers from incorrect peer(%s)", packet.PeerId())
+				break
+			}
+			headers := packet.(*headerPack).headers
+			if len(headers) != 1 {
+				glog.V(logger.Debug).Infof("%v: invalid number of checkpoint headers: %d != 1", p, len(headers))
+				return 0, errBadPeer
+			}
+			if number, hash := headers[0].Number.Uint64(), headers[0].Hash(); number != cp.Number || hash != cp.Hash {
+				glog.V(logger.Debug).Infof("%v: checkpoint mismatch: #%d [%x…] (!= #%d [%x…])", p, number, hash[:4], cp.Number, cp.Hash[:4])
+				return 0, errCheckpointMismatch
+			}
+			return cp.Number, nil
+
+		case <-timer.C:
+			glog.V(logger.Debug).Infof("%v: checkpoint header timeout, ttl: %v", p, ttl)
+			return 0, errTimeout
+
+		case <-d.bodyCh:
+		case <-d.receiptCh:
+			// Out of bounds delivery, ignore
+		}
+	}
+}
+
+// rollbackUnverified rolls back the headers imported without verification below
+// the trusted checkpoint, from head down to the one numbered from. They are not
+// capped at fsHeaderSafetyNet, hence are rolled back in batches.
+func (d *Downloader) rollbackUnverified(from uint64, head *types.Header) {
+	count := 0
+	for head != nil && head.Number.Uint64() >= from {
+		var hashes []common.Hash
+		for ; head != nil && head.Number.Uint64() >= from && len(hashes) < fsHeaderSafetyNet; head = d.lightchain.GetHeaderByHash(head.ParentHash) {
+			hashes = append(hashes, head.Hash())
+		}
+		// Rollback expects the hashes in ascending order
+		for i, j := 0, len(hashes)-1; i < j; i, j = i+1, j-1 {
+			hashes[i], hashes[j] = hashes[j], hashes[i]
+		}
+		d.lightchain.Rollback(hashes)
+		count += len(hashes)
+	}
+	glog.V(logger.Warn).Warnln("Rolled back unverified headers", "count", count, "from", from)
+}
+
 // findAncestor tries to locate the common ancestor link of the local chain and
 // a remote peers blockchain. In the general case when our node was in sync and
 // on the correct chain, checking the top N links should already get us a match.
@@ -698,6 +811,10 @@ func (d *Downloader) findAncestor(p *peer, height uint64) (uint64, error) {
 	if ceil >= uint64(MaxForkAncestry) {
 		floor = int64(ceil - uint64(MaxForkAncestry))
 	}
+	// Never rewrite the chain below a trusted checkpoint already synced past
+	if cp := d.checkpoint; cp != nil && ceil >= cp.Number && int64(cp.Number)-1 > floor {
+		floor = int64(cp.Number) - 1
+	}
 	// Request the topmost blocks to short circuit binary ancestor lookup
 	head := ceil
 	if head > height {
@@ -955,6 +1072,7 @@ func (d *Downloader) fetchHeaders(p *peer, from uint64, pivot uint64) error {
 			// Header retrieval timed out, consider the peer bad and drop
 			glog.V(logger.Debug).Warnln("Header request timed out", "elapsed", ttl)
 			metrics.DLHeaderTimeouts.Mark(1)
+			d.scorePeer(p.id, peerscore.Timeout)
 			d.dropPeer(p.id)
 
 			// Finish the sync gracefully instead of dumping the gathered data though
@@ -1107,6 +1225,16 @@ func (d *Downloader) fetchParts(errCancel error, deliveryCh chan dataPack, deliv
 			if peer := d.peers.Peer(packet.PeerId()); peer != nil {
 				// Deliver the received chunk of data and check chain validity
 				accepted, err := deliver(packet)
+				switch {
+				case err == errNoFetchesPending || err == errStaleDelivery || err == errInvalidChain:
+					// Late answer to an expired request (already scored), or local failure
+				case err != nil:
+					d.scorePeer(peer.id, peerscore.InvalidBlock)
+				case accepted == 0:
+					d.scorePeer(peer.id, peerscore.UselessResponse)
+				default:
+					d.scorePeer(peer.id, peerscore.GoodDelivery)
+				}
 				if err == errInvalidChain {
 					return err
 				}
@@ -1167,6 +1295,7 @@ func (d *Downloader) fetchParts(errCancel error, deliveryCh chan dataPack, deliv
 					// how response times reacts, to it always requests one more than the minimum (i.e. min 2).
 					if fails > 2 {
 						glog.V(logger.Detail).Infoln("Data delivery timed out", "type", kind)
+						d.scorePeer(pid, peerscore.Timeout)
 						setIdle(peer, 0)
 					} else {
 						glog.V(logger.Detail).Infoln("Stalling delivery, dropping", "type", kind)
@@ -1240,10 +1369,20 @@ func (d *Downloader) fetchParts(errCancel error, deliveryCh chan dataPack, deliv
 // processHeaders takes batches of retrieved headers from an input channel and
 // keeps processing and scheduling them into the header chain and downloader's
 // queue until the stream ends or a failure occurs.
-func (d *Downloader) processHeaders(origin uint64, pivot uint64, td *big.Int) error {
+func (d *Downloader) processHeaders(origin uint64, pivot uint64, trusted uint64, td *big.Int) error {
 	// Keep a count of uncertain headers to roll back
 	rollback := []*types.Header{}
+
+	// Headers imported unverified below the trusted checkpoint are vouched for
+	// only once the chain links to it, until then all of them are rolled back
+	var (
+		unverified     *types.Header // Highest header imported without verification
+		unverifiedFrom uint64        // Number of the lowest header imported without verification
+	)
 	defer func() {
+		if unverified != nil {
+			d.rollbackUnverified(unverifiedFrom, unverified)
+		}
 		if len(rollback) > 0 {
 			// Flatten the headers and roll them back
 			hashes := make([]common.Hash, len(rollback))
@@ -1317,6 +1456,10 @@ func (d *Downloader) processHeaders(origin uint64, pivot uint64, td *big.Int) er
 						return errStallingPeer
 					}
 				}
+				// Headers imported unverified must link to the checkpoint
+				if unverified != nil {
+					return errStallingPeer
+				}
 				// Disable any rollback and return
 				rollback = nil
 				return nil
@@ -1338,6 +1481,15 @@ func (d *Downloader) processHeaders(origin uint64, pivot uint64, td *big.Int) er
 				}
 				chunk := headers[:limit]
 
+				// Make sure the chain actually passes through the trusted checkpoint
+				if cp := d.checkpoint; cp != nil {
+					for _, header := range chunk {
+						if header.Number.Uint64() == cp.Number && header.Hash() != cp.Hash {
+							glog.V(logger.Debug).Infoln("Checkpoint mismatch", "number", cp.Number, "hash", header.Hash(), "want", cp.Hash)
+							return errInvalidChain
+						}
+					}
+				}
 				// In case of header only syncing, validate the chunk immediately
 				if d.mode == FastSync || d.mode == LightSync {
 					// Collect the yet unknown headers to mark them as uncertain
@@ -1352,6 +1504,10 @@ func (d *Downloader) processHeaders(origin uint64, pivot uint64, td *big.Int) er
 					if chunk[len(chunk)-1].Number.Uint64()+uint64(fsHeaderForceVerify) > pivot {
 						frequency = 1
 					}
+					// Headers leading up to the trusted checkpoint are vouched for by its hash
+					if chunk[len(chunk)-1].Number.Uint64() <= trusted {
+						frequency = 0
+					}
 					res := d.lightchain.InsertHeaderChain(chunk, frequency)
 					// TODO(whilei): again, send error to events
 					if res.Error != nil {
@@ -1364,9 +1520,20 @@ func (d *Downloader) processHeaders(origin uint64, pivot uint64, td *big.Int) er
 					}
 					go d.mux.Post(InsertHeaderChainEvent{res.HeaderChainInsertEvent})
 					// All verifications passed, store newly found uncertain headers
-					rollback = append(rollback, unknown...)
-					if len(rollback) > fsHeaderSafetyNet {
-						rollback = append(rollback[:0], rollback[len(rollback)-fsHeaderSafetyNet:]...)
+					if frequency == 0 {
+						if unverified == nil {
+							unverifiedFrom = chunk[0].Number.Uint64()
+						}
+						unverified = chunk[len(chunk)-1]
+					} else {
+						rollback = append(rollback, unknown...)
+						if len(rollback) > fsHeaderSafetyNet {
+							rollback = append(rollback[:0], rollback[len(rollback)-fsHeaderSafetyNet:]...)
+						}
+					}
+					// Importing the checkpoint links the unverified headers to it
+					if trusted > 0 && chunk[len(chunk)-1].Number.Uint64() >= trusted {
+						unverified = nil
 					}
 				}
 				// Unless we're doing light chains, schedule the headers for associated content retrieval
@@ -1448,7 +1615,11 @@ func (d *Downloader) importBlockResults(results []*fetchResult) error {
 	res := d.blockchain.InsertChain(blocks)
 	if res.Error != nil {
 		glog.V(logger.Debug).Infoln("Downloaded item processing failed", "number", results[res.Index].Header.Number, "hash", results[res.Index].Header.Hash(), "err", res.Error)
-		return errInvalidChain
+		// Only blame the peer for invalid blocks, not for local import failures
+		if res.Invalid {
+			return errInvalidChain
+		}
+		return errImportFailed
 	}
 	go d.mux.Post(InsertChainEvent{res.ChainInsertEvent})
 	return nil
@@ -1592,8 +1763,10 @@ func (d *Downloader) commitFastSyncData(results []*fetchResult, stateSync *state
 	}
 	res := d.blockchain.InsertReceiptChain(blocks, receipts)
 	if res.Error != nil {
+		// Bodies and receipts were checked against their headers on delivery,
+		// failing to store them is not the fault of the peer
 		glog.V(logger.Debug).Infoln("Downloaded item processing failed", "number", results[res.Index].Header.Number, "hash", results[res.Index].Header.Hash(), "err", res.Error)
-		return errInvalidChain
+		return errImportFailed
 	}
 	// TODO(whilei): pass error in Receipt and Full chain events through
 	go d.mux.Post(InsertReceiptChainEvent{ReceiptChainInsertEvent: res.ReceiptChainInsertEvent, Pivot: false})
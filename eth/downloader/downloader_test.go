@@ -31,9 +31,11 @@ import (
 	"github.com/ethereumproject/go-ethereum/core"
 	"github.com/ethereumproject/go-ethereum/core/types"
 	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/eth/peerscore"
 	"github.com/ethereumproject/go-ethereum/ethdb"
 	"github.com/ethereumproject/go-ethereum/event"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/p2p/discover"
 	"github.com/ethereumproject/go-ethereum/trie"
 )
 
@@ -100,7 +102,7 @@ func newTester() *downloadTester {
 	tester.stateDb, _ = ethdb.NewMemDatabase()
 	tester.stateDb.Put(genesis.Root().Bytes(), []byte{0x00})
 
-	tester.downloader = New(FullSync, tester.stateDb, new(event.TypeMux), tester, nil, tester.dropPeer)
+	tester.downloader = New(FullSync, nil, tester.stateDb, new(event.TypeMux), tester, nil, tester.dropPeer, nil)
 
 	return tester
 }
@@ -888,6 +890,99 @@ func testHeavyForkedSync(t *testing.T, protocol int, mode SyncMode) {
 	assertOwnForkedChain(t, tester, common+1, []int{common + fork + 1, common + fork/2 + 1})
 }
 
+// Tests that with a trusted checkpoint configured, peers whose chain doesn't
+// contain it are refused, while peers on the checkpointed chain are synced with.
+func TestCheckpointSync63Full(t *testing.T)  { testCheckpointSync(t, 63, FullSync) }
+func TestCheckpointSync63Fast(t *testing.T)  { testCheckpointSync(t, 63, FastSync) }
+func TestCheckpointSync64Full(t *testing.T)  { testCheckpointSync(t, 64, FullSync) }
+func TestCheckpointSync64Fast(t *testing.T)  { testCheckpointSync(t, 64, FastSync) }
+func TestCheckpointSync64Light(t *testing.T) { testCheckpointSync(t, 64, LightSync) }
+
+func testCheckpointSync(t *testing.T, protocol int, mode SyncMode) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a forked chain and checkpoint a block past the fork on chain A
+	common, fork := MaxHashFetch, 2*MaxHashFetch
+	hashesA, hashesB, headersA, headersB, blocksA, blocksB, receiptsA, receiptsB := tester.makeChainFork(common+fork, fork, tester.genesis, nil, true)
+
+	tester.newPeer("fork A", protocol, hashesA, headersA, blocksA, receiptsA)
+	tester.newPeer("fork B", protocol, hashesB, headersB, blocksB, receiptsB)
+
+	number := uint64(common + fork/2)
+	hash := hashesA[len(hashesA)-1-int(number)]
+	tester.downloader.checkpoint = &core.Checkpoint{
+		Number: number,
+		Hash:   hash,
+		TD:     tester.peerChainTds["fork A"][hash],
+	}
+	// Synchronise with the peer on the other chain and make sure it's refused
+	if err := tester.sync("fork B", nil, mode); err != errCheckpointMismatch {
+		t.Fatalf("fork B: synchronisation error mismatch: have %v, want %v", err, errCheckpointMismatch)
+	}
+	assertOwnChain(t, tester, 1)
+
+	// Synchronise with the peer on the checkpointed chain and make sure it's all retrieved
+	if err := tester.sync("fork A", nil, mode); err != nil {
+		t.Fatalf("fork A: failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, common+fork+1)
+}
+
+// Tests that headers imported without verification below a trusted checkpoint
+// are all rolled back if the chain turns out not to link to the checkpoint.
+func TestCheckpointForgery64Fast(t *testing.T)  { testCheckpointForgery(t, 64, FastSync) }
+func TestCheckpointForgery64Light(t *testing.T) { testCheckpointForgery(t, 64, LightSync) }
+
+func testCheckpointForgery(t *testing.T, protocol int, mode SyncMode) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a forked chain and checkpoint a block of chain A well above the fork
+	common, fork := MaxHashFetch, 3*fsHeaderSafetyNet
+	hashesA, hashesB, headersA, headersB, blocksA, blocksB, receiptsA, receiptsB := tester.makeChainFork(common+fork, fork, tester.genesis, nil, true)
+
+	number := uint64(common + 2*fsHeaderSafetyNet)
+	hash := hashesA[len(hashesA)-1-int(number)]
+
+	tester.newPeer("fork A", protocol, hashesA, headersA, blocksA, receiptsA)
+	tester.downloader.checkpoint = &core.Checkpoint{
+		Number: number,
+		Hash:   hash,
+		TD:     tester.peerChainTds["fork A"][hash],
+	}
+	tester.dropPeer("fork A")
+
+	// The forger serves chain B, but the checkpoint header of chain A
+	tester.newPeer("forger", protocol, hashesB, headersB, blocksB, receiptsB)
+	tester.peerHashes["forger"][len(hashesB)-1-int(number)] = hash
+	tester.peerHeaders["forger"][hash] = headersA[hash]
+
+	if err := tester.sync("forger", nil, mode); err == nil {
+		t.Fatalf("succeeded forged chain synchronisation")
+	}
+	if head := tester.CurrentHeader().Number.Uint64(); head > uint64(common) {
+		t.Errorf("rollback head mismatch: have %v, want at most %v", head, common)
+	}
+	for _, h := range hashesB[:fork] {
+		if tester.HasHeader(h) {
+			t.Fatalf("forged header %x not rolled back", h[:4])
+		}
+	}
+	// Synchronise with the peer on the checkpointed chain and make sure it's all retrieved
+	tester.newPeer("fork A", protocol, hashesA, headersA, blocksA, receiptsA)
+	if err := tester.sync("fork A", nil, mode); err != nil {
+		t.Fatalf("fork A: failed to synchronise blocks: %v", err)
+	}
+	if head := tester.CurrentHeader().Hash(); head != hashesA[0] {
+		t.Errorf("head mismatch: have %x, want %x", head[:4], hashesA[0][:4])
+	}
+}
+
 // Tests that chain forks are contained within a certain interval of the current
 // chain head, ensuring that malicious peers cannot waste resources by feeding
 // long dead chains.
@@ -1367,6 +1462,7 @@ func testBlockHeaderAttackerDropping(t *testing.T, protocol int) {
 		{errPeersUnavailable, true},         // Nobody had the advertised blocks, drop the advertiser
 		{errInvalidAncestor, true},          // Agreed upon ancestor is not acceptable, drop the chain rewriter
 		{errInvalidChain, true},             // Hash chain was detected as invalid, definitely drop
+		{errImportFailed, false},            // Chain failed to import locally, origin may be innocent, don't drop
 		{errInvalidBlock, false},            // A bad peer was detected, but not the sync origin
 		{errInvalidBody, false},             // A bad peer was detected, but not the sync origin
 		{errInvalidReceipt, false},          // A bad peer was detected, but not the sync origin
@@ -1801,3 +1897,34 @@ func testDeliverHeadersHang(t *testing.T, protocol int, mode SyncMode) {
 		//tester.downloader.peers.peers["peer"]
 	}
 }
+
+// Tests that peers with a bad reputation are only assigned download tasks after
+// the reputable ones, regardless of their throughput.
+func TestIdlePeerReputation(t *testing.T) {
+	scorer, err := peerscore.New(time.Hour, nil)
+	if err != nil {
+		t.Fatalf("failed to create scorer: %v", err)
+	}
+	ps := newPeerSet(scorer)
+	for i, id := range []string{"fast-bad", "slow-good", "fast-good"} {
+		p := newPeer(id, 63, id, nil, nil, nil, nil, nil, nil)
+		if err := ps.Register(p); err != nil {
+			t.Fatalf("failed to register peer %s: %v", id, err)
+		}
+		scorer.Register(id, discover.NodeID{byte(i)})
+	}
+	ps.Peer("fast-bad").blockThroughput = 100
+	ps.Peer("slow-good").blockThroughput = 1
+	ps.Peer("fast-good").blockThroughput = 10
+	scorer.Record("fast-bad", peerscore.UselessResponse)
+
+	idle, _ := ps.BodyIdlePeers()
+	if len(idle) != 3 {
+		t.Fatalf("idle peer count mismatch: have %d, want 3", len(idle))
+	}
+	for i, want := range []string{"fast-good", "slow-good", "fast-bad"} {
+		if idle[i].id != want {
+			t.Errorf("idle peer %d mismatch: have %s, want %s", i, idle[i].id, want)
+		}
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/eth/peerscore"
 	"github.com/ethereumproject/go-ethereum/event"
 	"github.com/ethereumproject/go-ethereum/logger"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
@@ -355,15 +356,17 @@ func (p *peer) String() string {
 // download procedure.
 type peerSet struct {
 	peers        map[string]*peer
+	scorer       *peerscore.Scorer // Reputation tracker to prioritise peers by, if any
 	newPeerFeed  event.Feed
 	peerDropFeed event.Feed
 	lock         sync.RWMutex
 }
 
 // newPeerSet creates a new peer set top track the active download sources.
-func newPeerSet() *peerSet {
+func newPeerSet(scorer *peerscore.Scorer) *peerSet {
 	return &peerSet{
-		peers: make(map[string]*peer),
+		peers:  make(map[string]*peer),
+		scorer: scorer,
 	}
 }
 
@@ -542,7 +545,8 @@ func (ps *peerSet) NodeDataIdlePeers() ([]*peer, int) {
 
 // idlePeers retrieves a flat list of all currently idle peers satisfying the
 // protocol version constraints, using the provided function to check idleness.
-// The resulting set of peers are sorted by their measure throughput.
+// The resulting set of peers are sorted by their measure throughput, with the
+// peers of negative reputation placed after all others.
 func (ps *peerSet) idlePeers(minProtocol, maxProtocol int, idleCheck func(*peer) bool, throughput func(*peer) float64) ([]*peer, int) {
 	ps.lock.RLock()
 	defer ps.lock.RUnlock()
@@ -556,9 +560,13 @@ func (ps *peerSet) idlePeers(minProtocol, maxProtocol int, idleCheck func(*peer)
 			total++
 		}
 	}
+	penalised := func(p *peer) bool {
+		return ps.scorer != nil && ps.scorer.Score(p.id) < 0
+	}
 	for i := 0; i < len(idle); i++ {
 		for j := i + 1; j < len(idle); j++ {
-			if throughput(idle[i]) < throughput(idle[j]) {
+			pi, pj := penalised(idle[i]), penalised(idle[j])
+			if (pi && !pj) || (pi == pj && throughput(idle[i]) < throughput(idle[j])) {
 				idle[i], idle[j] = idle[j], idle[i]
 			}
 		}
@@ -25,6 +25,7 @@ import (
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/core/state"
 	"github.com/ethereumproject/go-ethereum/crypto/sha3"
+	"github.com/ethereumproject/go-ethereum/eth/peerscore"
 	"github.com/ethereumproject/go-ethereum/ethdb"
 	"github.com/ethereumproject/go-ethereum/logger"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
@@ -212,7 +213,8 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 // stateSync schedules requests for downloading a particular state trie defined
 // by a given state root.
 type stateSync struct {
-	d *Downloader // Downloader instance to access and manage current peerset
+	d    *Downloader // Downloader instance to access and manage current peerset
+	root common.Hash // State root being synced
 
 	sched  *trie.Sync                 // State trie sync scheduler defining the tasks
 	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
@@ -239,7 +241,7 @@ type stateTask struct {
 func newStateSync(d *Downloader, root common.Hash) *stateSync {
 	return &stateSync{
 		d:       d,
-		sched:   state.NewStateSync(root, d.stateDB),
+		root:    root,
 		keccak:  sha3.NewKeccak256(),
 		tasks:   make(map[common.Hash]*stateTask),
 		deliver: make(chan *stateReq),
@@ -248,14 +250,40 @@ func newStateSync(d *Downloader, root common.Hash) *stateSync {
 	}
 }
 
-// run starts the task assignment and response processing loop, blocking until
-// it finishes, and finally notifying any goroutines waiting for the loop to
-// finish.
+// run retrieves the state in ranges from the snap peers first, then starts the
+// task assignment and response processing loop to heal the rest of the trie,
+// blocking until it finishes, and finally notifying any goroutines waiting for
+// the loop to finish.
 func (s *stateSync) run() {
-	s.err = s.loop()
+	s.err = s.snapSync()
+	if s.err == nil {
+		s.sched = state.NewStateSync(s.root, s.d.stateDB)
+		s.err = s.loop()
+	}
 	close(s.done)
 }
 
+// snapSync retrieves as much of the state as possible in ranges of accounts and
+// storage slots from the snap peers. The trie nodes left are healed by loop.
+func (s *stateSync) snapSync() error {
+	cancel, finished := make(chan struct{}), make(chan struct{})
+	defer close(finished)
+
+	go func() {
+		select {
+		case <-s.cancel:
+			close(cancel)
+		case <-s.d.cancelCh:
+			close(cancel)
+		case <-finished:
+		}
+	}()
+	if err := s.d.snapSyncer.Sync(s.root, cancel); err != nil {
+		return errCancelStateFetch
+	}
+	return nil
+}
+
 // Wait blocks until the sync is done or canceled.
 func (s *stateSync) Wait() error {
 	<-s.done
@@ -310,6 +338,7 @@ func (s *stateSync) loop() (err error) {
 				// 2 items are the minimum requested, if even that times out, we've no use of
 				// this peer at the moment.
 				glog.V(logger.Warn).Warnln("Stalling state sync, dropping peer", "peer", req.peer.id)
+				s.d.scorePeer(req.peer.id, peerscore.Timeout)
 				s.d.dropPeer(req.peer.id)
 			}
 			// Process all the received blobs and check for stale delivery
@@ -317,6 +346,9 @@ func (s *stateSync) loop() (err error) {
 				glog.V(logger.Warn).Warnln("Node data write error", "err", err)
 				return err
 			}
+			if len(req.response) > 0 {
+				s.d.scorePeer(req.peer.id, peerscore.GoodDelivery)
+			}
 			req.peer.SetNodeDataIdle(len(req.response))
 		}
 	}
@@ -26,6 +26,7 @@ import (
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/core"
 	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/eth/peerscore"
 	"github.com/ethereumproject/go-ethereum/event"
 	"github.com/ethereumproject/go-ethereum/logger"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
@@ -144,6 +145,8 @@ type Fetcher struct {
 	insertChain    chainInsertFn      // Injects a batch of blocks into the chain
 	dropPeer       peerDropFn         // Drops a peer for misbehaving
 
+	scorer *peerscore.Scorer // Reputation tracker of the peers, if any
+
 	// Testing hooks
 	announceChangeHook func(common.Hash, bool) // Method to call upon adding or deleting a hash from the announce list
 	queueChangeHook    func(common.Hash, bool) // Method to call upon adding or deleting a block from the import queue
@@ -153,7 +156,8 @@ type Fetcher struct {
 }
 
 // New creates a block fetcher to retrieve blocks based on hash announcements.
-func New(mux *event.TypeMux, getBlock blockRetrievalFn, verifyHeader headerVerifierFn, broadcastBlock blockBroadcasterFn, chainHeight chainHeightFn, insertChain chainInsertFn, dropPeer peerDropFn) *Fetcher {
+// If a scorer is given, the behaviour of the announcing peers is recorded with it.
+func New(mux *event.TypeMux, getBlock blockRetrievalFn, verifyHeader headerVerifierFn, broadcastBlock blockBroadcasterFn, chainHeight chainHeightFn, insertChain chainInsertFn, dropPeer peerDropFn, scorer *peerscore.Scorer) *Fetcher {
 	return &Fetcher{
 		mux:            mux,
 		notify:         make(chan *announce),
@@ -177,6 +181,14 @@ func New(mux *event.TypeMux, getBlock blockRetrievalFn, verifyHeader headerVerif
 		chainHeight:    chainHeight,
 		insertChain:    insertChain,
 		dropPeer:       dropPeer,
+		scorer:         scorer,
+	}
+}
+
+// scorePeer records a behaviour of a peer with the scorer, if any.
+func (f *Fetcher) scorePeer(id string, event peerscore.Event) {
+	if f.scorer != nil {
+		f.scorer.Record(id, event)
 	}
 }
 
@@ -293,6 +305,7 @@ func (f *Fetcher) loop() {
 		// Clean up any expired block fetches
 		for hash, announce := range f.fetching {
 			if time.Since(announce.time) > fetchTimeout {
+				f.scorePeer(announce.origin, peerscore.Timeout)
 				f.forgetHash(hash)
 			}
 		}
@@ -485,6 +498,7 @@ func (f *Fetcher) loop() {
 					// If the delivered header does not match the promised number, drop the announcer
 					if header.Number.Uint64() != announce.number {
 						glog.V(logger.Detail).Infof("[eth/62] Peer %s: invalid block number for [%s]: announced %d, provided %d", announce.origin, header.Hash().Hex(), announce.number, header.Number.Uint64())
+						f.scorePeer(announce.origin, peerscore.InvalidBlock)
 						f.dropPeer(announce.origin)
 						f.forgetHash(hash)
 						continue
@@ -717,6 +731,7 @@ func (f *Fetcher) insert(peer string, block *types.Block) {
 		default:
 			// Something went very wrong, drop the peer
 			glog.V(logger.Debug).Infof("Peer %s: block #%d [%s] verification failed: %v", peer, block.NumberU64(), hash.Hex(), err)
+			f.scorePeer(peer, peerscore.InvalidBlock)
 			f.dropPeer(peer)
 			return
 		}
@@ -724,8 +739,13 @@ func (f *Fetcher) insert(peer string, block *types.Block) {
 		if res := f.insertChain(types.Blocks{block}); res.Error != nil {
 			glog.V(logger.Warn).Infof("Peer %s: block #%d [%s] import failed: %v", peer, block.NumberU64(), hash.Hex(), res.Error)
 			glog.D(logger.Warn).Warnf("Peer %s: block #%d [%s] import failed: %v", peer, block.NumberU64(), hash.Hex(), res.Error)
+			// Only blame the peer for invalid blocks, not for local import failures
+			if res.Invalid {
+				f.scorePeer(peer, peerscore.InvalidBlock)
+			}
 			return
 		} else {
+			f.scorePeer(peer, peerscore.GoodDelivery)
 			f.mux.Post(FetcherInsertBlockEvent{Peer: peer, Block: block})
 		}
 		// If import succeeded, broadcast the block
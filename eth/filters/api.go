@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core"
 	"github.com/ethereumproject/go-ethereum/core/types"
 	"github.com/ethereumproject/go-ethereum/core/vm"
 	"github.com/ethereumproject/go-ethereum/ethdb"
@@ -53,6 +54,7 @@ type PublicFilterAPI struct {
 
 	quit    chan struct{}
 	chainDb ethdb.Database
+	atxi    *core.AtxiT
 
 	filterManager *FilterSystem
 
@@ -69,11 +71,13 @@ type PublicFilterAPI struct {
 	transactionQueue map[int]*hashQueue
 }
 
-// NewPublicFilterAPI returns a new PublicFilterAPI instance.
-func NewPublicFilterAPI(chainDb ethdb.Database, mux *event.TypeMux) *PublicFilterAPI {
+// NewPublicFilterAPI returns a new PublicFilterAPI instance. The atxi may be nil,
+// otherwise its log index is used to find historical logs if enabled.
+func NewPublicFilterAPI(chainDb ethdb.Database, mux *event.TypeMux, atxi *core.AtxiT) *PublicFilterAPI {
 	svc := &PublicFilterAPI{
 		mux:              mux,
 		chainDb:          chainDb,
+		atxi:             atxi,
 		filterManager:    NewFilterSystem(mux),
 		filterMapping:    make(map[string]int),
 		logQueue:         make(map[int]*logQueue),
@@ -213,6 +217,7 @@ func (s *PublicFilterAPI) newLogFilter(earliest, latest int64, addresses []commo
 	defer s.filterManager.Unlock()
 
 	filter := New(s.chainDb)
+	filter.SetAtxi(s.atxi)
 	id, err := s.filterManager.Add(filter, LogFilter)
 	if err != nil {
 		return 0, err
@@ -441,6 +446,7 @@ func (s *PublicFilterAPI) NewFilter(args NewFilterArgs) (string, error) {
 // GetLogs returns the logs matching the given argument.
 func (s *PublicFilterAPI) GetLogs(args NewFilterArgs) []vmlog {
 	filter := New(s.chainDb)
+	filter.SetAtxi(s.atxi)
 	filter.SetBeginBlock(args.FromBlock.Int64())
 	filter.SetEndBlock(args.ToBlock.Int64())
 	filter.SetAddresses(args.Addresses)
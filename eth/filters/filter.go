@@ -22,9 +22,12 @@ import (
 
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/core/bloombits"
 	"github.com/ethereumproject/go-ethereum/core/types"
 	"github.com/ethereumproject/go-ethereum/core/vm"
 	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
 )
 
 type AccountChange struct {
@@ -36,6 +39,7 @@ type Filter struct {
 	created time.Time
 
 	db         ethdb.Database
+	atxi       *core.AtxiT
 	begin, end int64
 	addresses  []common.Address
 	topics     [][]common.Hash
@@ -70,6 +74,12 @@ func (self *Filter) SetTopics(topics [][]common.Hash) {
 	self.topics = topics
 }
 
+// SetAtxi sets the address-transaction indexes to use for finding logs. The
+// log index is only used if enabled for the given indexes.
+func (self *Filter) SetAtxi(atxi *core.AtxiT) {
+	self.atxi = atxi
+}
+
 // Run filters logs with the current parameters set
 func (self *Filter) Find() vm.Logs {
 	latestBlock := core.GetBlock(self.db, core.GetHeadBlockHash(self.db))
@@ -85,13 +95,136 @@ func (self *Filter) Find() vm.Logs {
 		endBlockNo = latestBlock.NumberU64()
 	}
 
+	// use the log index for the part of the range it covers, if available
+	if self.atxi != nil && self.atxi.Logs && (len(self.addresses) > 0 || len(self.indexedTopics()) > 0) {
+		if indexed := self.atxi.GetATXILogsBookmark(); indexed > 0 && beginBlockNo <= indexed {
+			end := endBlockNo
+			if end > indexed {
+				end = indexed
+			}
+			logs, err := self.indexFind(beginBlockNo, end)
+			if err == nil {
+				if end < endBlockNo {
+					logs = append(logs, self.bitsFind(end+1, endBlockNo)...)
+				}
+				return logs
+			}
+			glog.V(logger.Warn).Infof("log index lookup failed, falling back to blooms: %v", err)
+		}
+	}
+	return self.bitsFind(beginBlockNo, endBlockNo)
+}
+
+// bloomFilters returns the filter criteria as groups of bloom keys for the bloom
+// bits matcher: a block may match if its bloom contains any key of each group.
+func (self *Filter) bloomFilters() [][][]byte {
+	var filters [][][]byte
+	if len(self.addresses) > 0 {
+		filter := make([][]byte, len(self.addresses))
+		for i, addr := range self.addresses {
+			filter[i] = addr.Bytes()
+		}
+		filters = append(filters, filter)
+	}
+Topics:
+	for _, topics := range self.topics {
+		filter := make([][]byte, len(topics))
+		for i, topic := range topics {
+			// a wildcard matches every block
+			if (topic == common.Hash{}) {
+				continue Topics
+			}
+			filter[i] = topic.Bytes()
+		}
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+// bitsFind finds the logs in the given range using the bloom bits sections
+// generated by the bloom indexer for the part of the range they cover.
+func (self *Filter) bitsFind(start, end uint64) (logs vm.Logs) {
+	var (
+		size     = core.BloomBitsBlocks
+		sections = core.GetBloomBitsSections(self.db)
+		matcher  = bloombits.NewMatcher(size, self.bloomFilters())
+	)
+	if matcher.Empty() || start >= sections*size {
+		return self.bloomFind(start, end)
+	}
+	last := end
+	if indexed := sections*size - 1; last > indexed {
+		last = indexed
+	}
+	for section := start / size; section <= last/size; section++ {
+		from, to := section*size, (section+1)*size-1
+		if from < start {
+			from = start
+		}
+		if to > last {
+			to = last
+		}
+		head := core.GetCanonicalHash(self.db, (section+1)*size-1)
+		bits, err := matcher.Match(func(bit uint) ([]byte, error) {
+			return core.GetBloomBits(self.db, bit, section, head)
+		})
+		if err != nil {
+			// the section is being reprocessed after a reorg
+			glog.V(logger.Debug).Infof("bloom bits unavailable, falling back to blooms: %v", err)
+			logs = append(logs, self.bloomFind(from, to)...)
+			continue
+		}
+		for _, i := range bloombits.Blocks(bits) {
+			if n := section*size + i; n >= from && n <= to {
+				logs = append(logs, self.blockLogs(core.GetCanonicalHash(self.db, n))...)
+			}
+		}
+	}
+	if last < end {
+		logs = append(logs, self.bloomFind(last+1, end)...)
+	}
+	return logs
+}
+
+func (self *Filter) bloomFind(start, end uint64) vm.Logs {
 	// if no addresses are present we can't make use of fast search which
 	// uses the mipmap bloom filters to check for fast inclusion and uses
 	// higher range probability in order to ensure at least a false positive
 	if len(self.addresses) == 0 {
-		return self.getLogs(beginBlockNo, endBlockNo)
+		return self.getLogs(start, end)
+	}
+	return self.mipFind(start, end, 0)
+}
+
+// indexedTopics returns the first topics to look up in the log index, or nil if
+// the first topic is unrestricted.
+func (self *Filter) indexedTopics() []common.Hash {
+	if len(self.topics) == 0 || len(self.topics[0]) == 0 {
+		return nil
+	}
+	for _, topic := range self.topics[0] {
+		if (topic == common.Hash{}) {
+			return nil
+		}
 	}
-	return self.mipFind(beginBlockNo, endBlockNo, 0)
+	return self.topics[0]
+}
+
+// indexFind finds the logs in the given range using the log index of the atxi
+// to select the blocks to look at.
+func (self *Filter) indexFind(start, end uint64) (logs vm.Logs, err error) {
+	blocks, err := core.GetLogIndexBlocks(self.atxi.Db, self.addresses, self.indexedTopics(), start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range blocks {
+		hash := core.GetCanonicalHash(self.db, n)
+		if hash == (common.Hash{}) {
+			continue
+		}
+		logs = append(logs, self.blockLogs(hash)...)
+	}
+	return logs, nil
 }
 
 func (self *Filter) mipFind(start, end uint64, depth int) (logs vm.Logs) {
@@ -138,21 +271,25 @@ func (self *Filter) getLogs(start, end uint64) (logs vm.Logs) {
 		// Use bloom filtering to see if this block is interesting given the
 		// current parameters
 		if self.bloomFilter(block) {
-			// Get the logs of the block
-			var (
-				receipts   = core.GetBlockReceipts(self.db, block.Hash())
-				unfiltered vm.Logs
-			)
-			for _, receipt := range receipts {
-				unfiltered = append(unfiltered, receipt.Logs...)
-			}
-			logs = append(logs, self.FilterLogs(unfiltered)...)
+			logs = append(logs, self.blockLogs(block.Hash())...)
 		}
 	}
 
 	return logs
 }
 
+// blockLogs returns the logs of the block with the given hash matching the filter.
+func (self *Filter) blockLogs(hash common.Hash) vm.Logs {
+	var (
+		receipts   = core.GetBlockReceipts(self.db, hash)
+		unfiltered vm.Logs
+	)
+	for _, receipt := range receipts {
+		unfiltered = append(unfiltered, receipt.Logs...)
+	}
+	return self.FilterLogs(unfiltered)
+}
+
 func includes(addresses []common.Address, a common.Address) bool {
 	for _, addr := range addresses {
 		if addr == a {
@@ -286,3 +286,237 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+func TestLogIndexFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atxi-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		db, _   = ethdb.NewLDBDatabase(dir, 0, 0)
+		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key1.PublicKey)
+		other   = common.BytesToAddress([]byte("jeff"))
+
+		hash1 = common.BytesToHash([]byte("topic1"))
+		hash2 = common.BytesToHash([]byte("topic2"))
+
+		indexed = uint64(500)
+	)
+	defer db.Close()
+
+	makeLogReceipt := func(addr common.Address, topic common.Hash) *types.Receipt {
+		receipt := types.NewReceipt(nil, new(big.Int))
+		receipt.Logs = vm.Logs{
+			&vm.Log{Address: addr, Topics: []common.Hash{topic}},
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		return receipt
+	}
+
+	genesis := core.WriteGenesisBlockForTesting(db, core.GenesisAccount{Address: addr, Balance: big.NewInt(1000000)})
+	chain, receipts := core.GenerateChain(core.DefaultConfigMorden.ChainConfig, genesis, db, 1000, func(i int, gen *core.BlockGen) {
+		var receipts types.Receipts
+		switch i {
+		case 1:
+			receipts = types.Receipts{makeLogReceipt(addr, hash1)}
+		case 399:
+			receipts = types.Receipts{makeLogReceipt(other, hash1)}
+		case 799:
+			receipts = types.Receipts{makeLogReceipt(addr, hash2)}
+		}
+		for _, receipt := range receipts {
+			gen.AddUncheckedReceipt(receipt)
+		}
+		if err := core.WriteReceipts(db, receipts); err != nil {
+			t.Fatal(err)
+		}
+		core.WriteMipmapBloom(db, uint64(i+1), receipts)
+	})
+	for i, block := range chain {
+		core.WriteBlock(db, block)
+		if err := core.WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteHeadBlockHash(db, block.Hash()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteBlockReceipts(db, block.Hash(), receipts[i]); err != nil {
+			t.Fatal("error writing block receipts:", err)
+		}
+		if block.NumberU64() <= indexed {
+			if err := core.WriteBlockLogIndexes(db, block, receipts[i]); err != nil {
+				t.Fatal("error writing block log indexes:", err)
+			}
+		}
+	}
+	atxi := &core.AtxiT{Db: db, Logs: true}
+	if err := atxi.SetATXIBookmark(indexed); err != nil {
+		t.Fatal(err)
+	}
+
+	// by address, spanning both the index and the blooms
+	filter := New(db)
+	filter.SetAtxi(atxi)
+	filter.SetAddresses([]common.Address{addr})
+	filter.SetBeginBlock(0)
+	filter.SetEndBlock(-1)
+	logs := filter.Find()
+	if len(logs) != 2 {
+		t.Fatal("expected 2 log, got", len(logs))
+	}
+	if logs[0].Topics[0] != hash1 || logs[1].Topics[0] != hash2 {
+		t.Errorf("unexpected logs order or content: %v", logs)
+	}
+
+	// by topic0 only
+	filter = New(db)
+	filter.SetAtxi(atxi)
+	filter.SetTopics([][]common.Hash{{hash1}})
+	filter.SetBeginBlock(0)
+	filter.SetEndBlock(int64(indexed))
+	logs = filter.Find()
+	if len(logs) != 2 {
+		t.Error("expected 2 log, got", len(logs))
+	}
+
+	// by both address and topic0
+	filter = New(db)
+	filter.SetAtxi(atxi)
+	filter.SetAddresses([]common.Address{other})
+	filter.SetTopics([][]common.Hash{{hash1}})
+	filter.SetBeginBlock(0)
+	filter.SetEndBlock(int64(indexed))
+	logs = filter.Find()
+	if len(logs) != 1 {
+		t.Error("expected 1 log, got", len(logs))
+	}
+	if len(logs) > 0 && logs[0].Address != other {
+		t.Errorf("expected log[0].Address to be %x, got %x", other, logs[0].Address)
+	}
+
+	// the indexed blocks are looked up directly
+	blocks, err := core.GetLogIndexBlocks(db, nil, []common.Hash{hash1}, 0, indexed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[0] != 2 || blocks[1] != 400 {
+		t.Errorf("expected blocks [2 400], got %v", blocks)
+	}
+
+	// blooms find the same logs without the log index
+	filter = New(db)
+	filter.SetAddresses([]common.Address{addr})
+	filter.SetBeginBlock(0)
+	filter.SetEndBlock(-1)
+	logs = filter.Find()
+	if len(logs) != 2 {
+		t.Error("expected 2 log, got", len(logs))
+	}
+}
+
+func TestBloomBitsFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloombits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		db, _   = ethdb.NewLDBDatabase(dir, 0, 0)
+		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key1.PublicKey)
+		other   = common.BytesToAddress([]byte("jeff"))
+
+		hash1 = common.BytesToHash([]byte("topic1"))
+		hash2 = common.BytesToHash([]byte("topic2"))
+	)
+	defer db.Close()
+
+	makeLogReceipt := func(addr common.Address, topic common.Hash) *types.Receipt {
+		receipt := types.NewReceipt(nil, new(big.Int))
+		receipt.Logs = vm.Logs{
+			&vm.Log{Address: addr, Topics: []common.Hash{topic}},
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		return receipt
+	}
+
+	// two sections of bloom bits are confirmed, the last log is past them
+	genesis := core.WriteGenesisBlockForTesting(db, core.GenesisAccount{Address: addr, Balance: big.NewInt(1000000)})
+	chain, receipts := core.GenerateChain(core.DefaultConfigMorden.ChainConfig, genesis, db, int(2*core.BloomBitsBlocks+300), func(i int, gen *core.BlockGen) {
+		var receipts types.Receipts
+		switch i {
+		case 9:
+			receipts = types.Receipts{makeLogReceipt(addr, hash1)}
+		case 4999:
+			receipts = types.Receipts{makeLogReceipt(other, hash1)}
+		case 8399:
+			receipts = types.Receipts{makeLogReceipt(addr, hash2)}
+		}
+		for _, receipt := range receipts {
+			gen.AddUncheckedReceipt(receipt)
+		}
+		if err := core.WriteReceipts(db, receipts); err != nil {
+			t.Fatal(err)
+		}
+		core.WriteMipmapBloom(db, uint64(i+1), receipts)
+	})
+	for i, block := range chain {
+		core.WriteBlock(db, block)
+		if err := core.WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteHeadBlockHash(db, block.Hash()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteHeadHeaderHash(db, block.Hash()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteBlockReceipts(db, block.Hash(), receipts[i]); err != nil {
+			t.Fatal("error writing block receipts:", err)
+		}
+	}
+
+	indexer := core.NewBloomIndexer(db)
+	if sections, err := indexer.Process(); err != nil || sections != 2 {
+		t.Fatalf("failed to index sections: have %d (err %v), want %d", sections, err, 2)
+	}
+
+	check := func(addresses []common.Address, topics [][]common.Hash, want int) {
+		filter := New(db)
+		filter.SetAddresses(addresses)
+		filter.SetTopics(topics)
+		filter.SetBeginBlock(0)
+		filter.SetEndBlock(-1)
+		if logs := filter.Find(); len(logs) != want {
+			t.Errorf("addresses %x topics %x: expected %d log, got %d", addresses, topics, want, len(logs))
+		}
+	}
+	check([]common.Address{addr}, nil, 2)
+	check(nil, [][]common.Hash{{hash1}}, 2)
+	check(nil, [][]common.Hash{{hash1, hash2}}, 3)
+	check([]common.Address{other}, [][]common.Hash{{hash1}}, 1)
+	check([]common.Address{addr}, [][]common.Hash{{common.Hash{}}}, 2)
+
+	// A reorg of the last block of the second section invalidates it; the
+	// logs of its blocks are found through the blooms until reprocessed.
+	last := 2*core.BloomBitsBlocks - 1
+	canonical := core.GetCanonicalHash(db, last)
+	if err := core.WriteCanonicalHash(db, common.Hash{1}, last); err != nil {
+		t.Fatal(err)
+	}
+	if sections, err := indexer.Process(); err == nil || sections != 1 {
+		t.Fatalf("expected failure reprocessing the reorged section: have %d sections (err %v)", sections, err)
+	}
+	if err := core.WriteCanonicalHash(db, canonical, last); err != nil {
+		t.Fatal(err)
+	}
+	check(nil, [][]common.Hash{{hash1}}, 2)
+
+	if sections, err := indexer.Process(); err != nil || sections != 2 {
+		t.Fatalf("failed to reindex sections: have %d (err %v), want %d", sections, err, 2)
+	}
+}
@@ -31,6 +31,8 @@ import (
 	"github.com/ethereumproject/go-ethereum/core/types"
 	"github.com/ethereumproject/go-ethereum/eth/downloader"
 	"github.com/ethereumproject/go-ethereum/eth/fetcher"
+	"github.com/ethereumproject/go-ethereum/eth/peerscore"
+	"github.com/ethereumproject/go-ethereum/eth/snap"
 	"github.com/ethereumproject/go-ethereum/ethdb"
 	"github.com/ethereumproject/go-ethereum/event"
 	"github.com/ethereumproject/go-ethereum/logger"
@@ -77,6 +79,7 @@ type ProtocolManager struct {
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
 	peers      *peerSet
+	scorer     *peerscore.Scorer
 
 	SubProtocols []p2p.Protocol
 
@@ -96,8 +99,9 @@ type ProtocolManager struct {
 }
 
 // NewProtocolManager returns a new ethereum sub protocol manager. The Ethereum sub protocol manages peers capable
-// with the ethereum network.
-func NewProtocolManager(config *core.ChainConfig, mode downloader.SyncMode, networkId uint64, mux *event.TypeMux, txpool txPool, pow pow.PoW, blockchain *core.BlockChain, chaindb ethdb.Database) (*ProtocolManager, error) {
+// with the ethereum network. Synchronisation is restricted to peers on the chain of the checkpoint, if not nil.
+// Misbehaving peers are banned for multiples of banPeriod.
+func NewProtocolManager(config *core.ChainConfig, mode downloader.SyncMode, checkpoint *core.Checkpoint, networkId uint64, mux *event.TypeMux, txpool txPool, pow pow.PoW, blockchain *core.BlockChain, chaindb ethdb.Database, banPeriod time.Duration) (*ProtocolManager, error) {
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
 		networkId:   networkId,
@@ -112,6 +116,12 @@ func NewProtocolManager(config *core.ChainConfig, mode downloader.SyncMode, netw
 		txsyncCh:    make(chan *txsync),
 		quitSync:    make(chan struct{}),
 	}
+	scorer, err := peerscore.New(banPeriod, manager.removePeer)
+	if err != nil {
+		return nil, err
+	}
+	manager.scorer = scorer
+
 	// Figure out whether to allow fast sync or not
 	if mode == downloader.FastSync && blockchain.CurrentBlock().NumberU64() > 0 {
 		glog.V(logger.Warn).Infoln("Blockchain not empty, fast sync disabled")
@@ -161,7 +171,10 @@ func NewProtocolManager(config *core.ChainConfig, mode downloader.SyncMode, netw
 		return nil, errIncompatibleConfig
 	}
 	// Construct the different synchronisation mechanisms
-	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, manager.removePeer)
+	manager.downloader = downloader.New(mode, checkpoint, chaindb, manager.eventMux, blockchain, nil, manager.removePeer, manager.scorer)
+
+	// Serve state ranges to, and retrieve them from, the peers speaking snap
+	manager.SubProtocols = append(manager.SubProtocols, snap.MakeProtocols(chaindb, manager.downloader.SnapSyncer())...)
 
 	validator := func(header *types.Header) error {
 		return manager.blockchain.Validator().ValidateHeader(header, manager.blockchain.GetHeader(header.ParentHash), true)
@@ -178,7 +191,7 @@ func NewProtocolManager(config *core.ChainConfig, mode downloader.SyncMode, netw
 		atomic.StoreUint32(&manager.acceptsTxs, 1)
 		return manager.blockchain.InsertChain(blocks)
 	}
-	manager.fetcher = fetcher.New(mux, blockchain.GetBlock, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
+	manager.fetcher = fetcher.New(mux, blockchain.GetBlock, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer, manager.scorer)
 
 	return manager, nil
 }
@@ -196,8 +209,9 @@ func (pm *ProtocolManager) removePeer(id string) {
 		Peer:       peer,
 	})
 
-	// Unregister the peer from the downloader and Ethereum peer set
+	// Unregister the peer from the downloader, scorer and Ethereum peer set
 	pm.downloader.UnregisterPeer(id)
+	pm.scorer.Unregister(id)
 	if err := pm.peers.Unregister(id); err != nil {
 		glog.V(logger.Error).Infoln("Removal failed:", err)
 	}
@@ -259,11 +273,21 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		glog.D(logger.Error).Errorln("handler dropping pm.peers.len=", l, "pm.maxPeers=", pm.maxPeers)
 		return p2p.DiscTooManyPeers
 	}
+	// Refuse nodes banned for misbehaving in a previous session
+	if pm.scorer.Banned(p.ID()) {
+		glog.V(logger.Debug).Infof("handler: %s ->banned", p)
+		return p2p.DiscUselessPeer
+	}
 	glog.V(logger.Debug).Infof("handler: %s ->connected", p)
 
 	// Execute the Ethereum handshake
 	td, head, genesis := pm.blockchain.Status()
-	if err := p.Handshake(pm.networkId, td, head, genesis); err != nil {
+	headNum := pm.blockchain.CurrentHeader().Number.Uint64()
+	forkID := pm.chainConfig.ForkID(genesis, headNum)
+	forkFilter := func(id core.ForkID) error {
+		return pm.chainConfig.CheckForkID(genesis, pm.blockchain.CurrentHeader().Number.Uint64(), id)
+	}
+	if err := p.Handshake(pm.networkId, td, head, genesis, forkID, forkFilter); err != nil {
 		glog.V(logger.Debug).Infof("handler: %s ->handshakefailed err=%v", p, err)
 		return err
 	}
@@ -282,6 +306,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 			Peer:       p,
 		})
 	}
+	pm.scorer.Register(p.id, p.ID())
 	defer pm.removePeer(p.id)
 
 	// Register the peer in the downloader. If the downloader considers it banned, we disconnect
@@ -294,6 +319,8 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	// after this will be sent via broadcasts.
 	pm.syncTransactions(p)
 
+	// Fork IDs only commit to the fork block numbers, not to the required fork
+	// hashes, so the fork header challenge is needed for every protocol version.
 	pHead, _ := p.Head()
 	if headerN, doValidate := pm.getRequiredHashBlockNumber(head, pHead); doValidate {
 		// Request the peer's fork block header for extra-dat
@@ -0,0 +1,198 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package peerscore keeps track of the reputation of the eth peers, based on
+// the quality of their responses to the synchronisation mechanisms, and bans
+// the repeat offenders for a while.
+package peerscore
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/p2p/discover"
+)
+
+// Event is a peer behaviour affecting its reputation.
+type Event int
+
+const (
+	GoodDelivery    Event = iota // Peer delivered useful data
+	Timeout                      // Peer failed to answer a request in time
+	UselessResponse              // Peer answered with empty, stale or unrequested data
+	InvalidBlock                 // Peer delivered data failing validation
+)
+
+// eventScores is the reputation change caused by each event.
+var eventScores = map[Event]int64{
+	GoodDelivery:    1,
+	Timeout:         -10,
+	UselessResponse: -20,
+	InvalidBlock:    -50,
+}
+
+var eventNames = map[Event]string{
+	GoodDelivery:    "good delivery",
+	Timeout:         "timeout",
+	UselessResponse: "useless response",
+	InvalidBlock:    "invalid block",
+}
+
+func (e Event) String() string {
+	return eventNames[e]
+}
+
+const (
+	MaxScore     = 100  // Cap on the reputation, so past merits can't cover for a burst of misbehaviour
+	BanThreshold = -100 // Reputation at which a peer is banned
+
+	DefaultBanPeriod = time.Hour // Time a first offender is banned for
+)
+
+// Scorer records the behaviour of the connected peers, and bans those whose
+// reputation falls to the ban threshold. Every further ban of a node lasts a
+// ban period longer than the previous one.
+//
+// Peers are identified by the same short IDs as in the downloader and fetcher,
+// and have to be registered to have their behaviour recorded.
+type Scorer struct {
+	db        *discover.ScoreDB
+	banPeriod time.Duration
+	ban       func(id string) // Method to disconnect a banned peer
+
+	peers map[string]*discover.NodeScore // Reputation of the registered peers
+	lock  sync.RWMutex
+}
+
+// New creates a peer scorer banning offenders for multiples of banPeriod, and
+// disconnecting them with ban. Until a node database is set, scores are only
+// kept in memory.
+func New(banPeriod time.Duration, ban func(id string)) (*Scorer, error) {
+	db, err := discover.NewMemoryScoreDB()
+	if err != nil {
+		return nil, err
+	}
+	if banPeriod <= 0 {
+		banPeriod = DefaultBanPeriod
+	}
+	return &Scorer{
+		db:        db,
+		banPeriod: banPeriod,
+		ban:       ban,
+		peers:     make(map[string]*discover.NodeScore),
+	}, nil
+}
+
+// SetDatabase switches the scorer to persisting scores in db, typically the
+// node database of the p2p server. A nil db is ignored.
+func (s *Scorer) SetDatabase(db *discover.ScoreDB) {
+	if db == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.db = db
+}
+
+// Register starts recording the behaviour of a connected peer, picking up the
+// reputation of its node from any previous session.
+func (s *Scorer) Register(id string, node discover.NodeID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.peers[id] = s.db.Get(node)
+}
+
+// Unregister stops recording the behaviour of a peer.
+func (s *Scorer) Unregister(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.peers, id)
+}
+
+// Record applies the reputation change of an event to a registered peer,
+// banning and disconnecting it if its reputation falls to the ban threshold.
+func (s *Scorer) Record(id string, event Event) {
+	s.lock.Lock()
+	score, ok := s.peers[id]
+	if !ok {
+		s.lock.Unlock()
+		return
+	}
+	score.Score += eventScores[event]
+	if score.Score > MaxScore {
+		score.Score = MaxScore
+	}
+	banned := score.Score <= BanThreshold
+	if banned {
+		// Start over once the ban expires, but ban for longer on the next offence
+		score.Offences++
+		score.Score = 0
+		score.BannedUntil = time.Now().Add(time.Duration(score.Offences) * s.banPeriod)
+		glog.V(logger.Info).Infof("Peer %s banned until %v after %d offences (last: %v)", id, score.BannedUntil, score.Offences, event)
+	}
+	if err := s.db.Put(score); err != nil {
+		glog.V(logger.Error).Infof("Failed to store score of peer %s: %v", id, err)
+	}
+	s.lock.Unlock()
+
+	if banned && s.ban != nil {
+		s.ban(id)
+	}
+}
+
+// Score retrieves the reputation of a registered peer. Unknown peers have a
+// zero score.
+func (s *Scorer) Score(id string) int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if score, ok := s.peers[id]; ok {
+		return score.Score
+	}
+	return 0
+}
+
+// Banned returns whether a node is currently banned.
+func (s *Scorer) Banned(node discover.NodeID) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.db.Get(node).Banned(time.Now())
+}
+
+// Scores retrieves the reputation of every node with a score record, sorted by
+// descending score.
+func (s *Scorer) Scores() []*discover.NodeScore {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	scores := s.db.All()
+	sort.Sort(byScore(scores))
+	return scores
+}
+
+// byScore sorts node scores in descending order.
+type byScore []*discover.NodeScore
+
+func (s byScore) Len() int           { return len(s) }
+func (s byScore) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool { return s[i].Score > s[j].Score }
@@ -0,0 +1,87 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package peerscore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/p2p/discover"
+)
+
+// Tests that good deliveries raise a peer's score up to the cap.
+func TestScoreCap(t *testing.T) {
+	scorer, err := New(time.Hour, nil)
+	if err != nil {
+		t.Fatalf("failed to create scorer: %v", err)
+	}
+	scorer.Register("peer", discover.NodeID{0x01})
+	for i := 0; i < 2*MaxScore; i++ {
+		scorer.Record("peer", GoodDelivery)
+	}
+	if score := scorer.Score("peer"); score != MaxScore {
+		t.Fatalf("score mismatch: have %d, want %d", score, MaxScore)
+	}
+	// Unregistered peers are not scored
+	scorer.Record("unknown", InvalidBlock)
+	if score := scorer.Score("unknown"); score != 0 {
+		t.Fatalf("unknown peer score mismatch: have %d, want 0", score)
+	}
+}
+
+// Tests that misbehaving peers are banned and disconnected, for longer on every
+// offence, and that their reputation survives reconnecting.
+func TestBan(t *testing.T) {
+	var dropped []string
+	scorer, err := New(time.Hour, func(id string) { dropped = append(dropped, id) })
+	if err != nil {
+		t.Fatalf("failed to create scorer: %v", err)
+	}
+	node := discover.NodeID{0x01}
+
+	for offence := 1; offence <= 2; offence++ {
+		scorer.Register("peer", node)
+		scorer.Record("peer", InvalidBlock)
+		if len(dropped) != offence-1 {
+			t.Fatalf("offence %d: peer banned too early", offence)
+		}
+		scorer.Record("peer", InvalidBlock)
+		if !scorer.Banned(node) {
+			t.Fatalf("offence %d: peer not banned", offence)
+		}
+		if len(dropped) != offence {
+			t.Fatalf("offence %d: dropped peer count mismatch: have %d, want %d", offence, len(dropped), offence)
+		}
+		scorer.Unregister("peer")
+
+		scores := scorer.Scores()
+		if len(scores) != 1 {
+			t.Fatalf("offence %d: score count mismatch: have %d, want 1", offence, len(scores))
+		}
+		if scores[0].Offences != int64(offence) {
+			t.Fatalf("offence %d: offence count mismatch: have %d, want %d", offence, scores[0].Offences, offence)
+		}
+		if ban := scores[0].BannedUntil.Sub(time.Now()); ban <= time.Duration(offence-1)*time.Hour {
+			t.Fatalf("offence %d: ban too short: %v", offence, ban)
+		}
+	}
+	// Bans are lifted once they expire
+	scorer.db.Put(&discover.NodeScore{ID: node, Offences: 2, BannedUntil: time.Now().Add(-time.Second)})
+	if scorer.Banned(node) {
+		t.Fatalf("peer banned after ban expiry")
+	}
+}
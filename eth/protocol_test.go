@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core"
 	"github.com/ethereumproject/go-ethereum/core/types"
 	"github.com/ethereumproject/go-ethereum/crypto"
 	"github.com/ethereumproject/go-ethereum/eth/downloader"
@@ -41,34 +42,51 @@ var testAccount, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6
 func TestStatusMsgErrors61(t *testing.T) { testStatusMsgErrors(t, 61) }
 func TestStatusMsgErrors62(t *testing.T) { testStatusMsgErrors(t, 62) }
 func TestStatusMsgErrors63(t *testing.T) { testStatusMsgErrors(t, 63) }
+func TestStatusMsgErrors64(t *testing.T) { testStatusMsgErrors(t, 64) }
 
 func testStatusMsgErrors(t *testing.T, protocol int) {
 	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
 	td, currentBlock, genesis := pm.blockchain.Status()
+	forkID := pm.chainConfig.ForkID(genesis, pm.blockchain.CurrentHeader().Number.Uint64())
 	defer pm.Stop()
 
-	tests := []struct {
+	// status builds the status packet matching the tested protocol version.
+	status := func(version, network uint32, genesis common.Hash, forkID core.ForkID) interface{} {
+		if protocol >= eth64 {
+			return statusData64{version, network, td, currentBlock, genesis, forkID}
+		}
+		return statusData{version, network, td, currentBlock, genesis}
+	}
+	type statusMsgTest struct {
 		code      uint64
 		data      interface{}
 		wantError error
-	}{
+	}
+	tests := []statusMsgTest{
 		{
 			code: TxMsg, data: []interface{}{},
 			wantError: errResp(ErrNoStatusMsg, "first msg has code 2 (!= 0)"),
 		},
 		{
-			code: StatusMsg, data: statusData{10, NetworkId, td, currentBlock, genesis},
+			code: StatusMsg, data: status(10, NetworkId, genesis, forkID),
 			wantError: errResp(ErrProtocolVersionMismatch, "10 (!= %d)", protocol),
 		},
 		{
-			code: StatusMsg, data: statusData{uint32(protocol), 999, td, currentBlock, genesis},
+			code: StatusMsg, data: status(uint32(protocol), 999, genesis, forkID),
 			wantError: errResp(ErrNetworkIdMismatch, "999 (!= 1)"),
 		},
 		{
-			code: StatusMsg, data: statusData{uint32(protocol), NetworkId, td, currentBlock, common.Hash{3}},
+			code: StatusMsg, data: status(uint32(protocol), NetworkId, common.Hash{3}, forkID),
 			wantError: errResp(ErrGenesisBlockMismatch, "0300000000000000000000000000000000000000000000000000000000000000 (!= %x…)", genesis.Bytes()[:8]),
 		},
 	}
+	if protocol >= eth64 {
+		bad := core.ForkID{Hash: [4]byte{0xde, 0xad, 0xbe, 0xef}}
+		tests = append(tests, statusMsgTest{
+			code: StatusMsg, data: status(uint32(protocol), NetworkId, genesis, bad),
+			wantError: errResp(ErrForkIDRejected, "%v: %v", bad, core.ErrLocalIncompatibleOrStale),
+		})
+	}
 
 	for i, test := range tests {
 		p, errc := newTestPeer("peer", protocol, pm, false)
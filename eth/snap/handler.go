@@ -0,0 +1,307 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/p2p"
+	"github.com/ethereumproject/go-ethereum/rlp"
+	"github.com/ethereumproject/go-ethereum/trie"
+)
+
+// MakeProtocols constructs the snap sub-protocols, serving state ranges from
+// the given database and handing the responses of the remote peers to syncer.
+func MakeProtocols(db ethdb.Database, syncer *Syncer) []p2p.Protocol {
+	protocols := make([]p2p.Protocol, 0, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		version := version // Closure for the run
+		protocols = append(protocols, p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  ProtocolLengths[i],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return handle(db, syncer, newPeer(int(version), p, rw))
+			},
+		})
+	}
+	return protocols
+}
+
+// handle is the callback invoked to manage the life cycle of a snap peer. When
+// this function terminates, the peer is disconnected.
+func handle(db ethdb.Database, syncer *Syncer, p *Peer) error {
+	glog.V(logger.Debug).Infof("handler: %s ->connected", p)
+
+	if err := syncer.Register(p); err != nil {
+		return err
+	}
+	defer syncer.Unregister(p.id)
+
+	for {
+		if err := handleMsg(db, syncer, p); err != nil {
+			glog.V(logger.Debug).Infof("handler: %s ->msghandlefailed err=%v", p, err)
+			return err
+		}
+	}
+}
+
+// handleMsg is invoked whenever an inbound message is received from a remote
+// peer. The remote connection is torn down upon returning any error.
+func handleMsg(db ethdb.Database, syncer *Syncer, p *Peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	// Handle the message depending on its contents
+	switch msg.Code {
+	case GetAccountRangeMsg:
+		var req getAccountRangePacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		return p.sendAccountRange(serveAccountRange(db, &req))
+
+	case AccountRangeMsg:
+		var res accountRangePacket
+		if err := msg.Decode(&res); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		keys := make([][]byte, len(res.Accounts))
+		values := make([][]byte, len(res.Accounts))
+		for i, acc := range res.Accounts {
+			keys[i], values[i] = common.CopyBytes(acc.Hash[:]), acc.Body
+		}
+		if err := syncer.OnAccounts(p, res.ID, keys, values, res.Proof); err != nil {
+			glog.V(logger.Debug).Infoln("peer", p.id, err)
+		}
+
+	case GetStorageRangesMsg:
+		var req getStorageRangesPacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		return p.sendStorageRanges(serveStorageRanges(db, &req))
+
+	case StorageRangesMsg:
+		var res storageRangesPacket
+		if err := msg.Decode(&res); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		keys := make([][][]byte, len(res.Slots))
+		values := make([][][]byte, len(res.Slots))
+		for i, slots := range res.Slots {
+			keys[i] = make([][]byte, len(slots))
+			values[i] = make([][]byte, len(slots))
+			for j, slot := range slots {
+				keys[i][j], values[i][j] = common.CopyBytes(slot.Hash[:]), slot.Body
+			}
+		}
+		if err := syncer.OnStorage(p, res.ID, keys, values, res.Proof); err != nil {
+			glog.V(logger.Debug).Infoln("peer", p.id, err)
+		}
+
+	case GetByteCodesMsg:
+		var req getByteCodesPacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		return p.sendByteCodes(serveByteCodes(db, &req))
+
+	case ByteCodesMsg:
+		var res byteCodesPacket
+		if err := msg.Decode(&res); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		if err := syncer.OnByteCodes(p, res.ID, res.Codes); err != nil {
+			glog.V(logger.Debug).Infoln("peer", p.id, err)
+		}
+
+	default:
+		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
+	}
+	return nil
+}
+
+// responseLimit caps the size requested by a remote peer at the local limit.
+func responseLimit(requested uint64) uint64 {
+	if requested > softResponseLimit {
+		return softResponseLimit
+	}
+	return requested
+}
+
+// serveAccountRange gathers the accounts requested by req from the local state.
+// If the requested state is not available, the response is empty.
+func serveAccountRange(db ethdb.Database, req *getAccountRangePacket) *accountRangePacket {
+	res := &accountRangePacket{ID: req.ID}
+
+	tr, err := trie.New(req.Root, db)
+	if err != nil {
+		return res
+	}
+	var (
+		limit     = responseLimit(req.Bytes)
+		size      uint64
+		exhausted = true
+	)
+	it := trie.NewIterator(tr.NodeIterator(req.Origin[:]))
+	for it.Next() {
+		hash := common.BytesToHash(it.Key)
+		res.Accounts = append(res.Accounts, &accountData{Hash: hash, Body: common.CopyBytes(it.Value)})
+
+		size += uint64(common.HashLength + len(it.Value))
+		if bytes.Compare(hash[:], req.Limit[:]) >= 0 || size >= limit {
+			exhausted = false
+			break
+		}
+	}
+	if it.Err != nil {
+		return &accountRangePacket{ID: req.ID}
+	}
+	// The whole trie needs no proof, any other range is proven by its edges.
+	if req.Origin == (common.Hash{}) && exhausted {
+		return res
+	}
+	var keys [][]byte
+	if len(res.Accounts) > 0 {
+		keys = append(keys, res.Accounts[len(res.Accounts)-1].Hash[:])
+	}
+	proof, err := proveRange(tr, req.Origin[:], keys...)
+	if err != nil {
+		return &accountRangePacket{ID: req.ID}
+	}
+	res.Proof = proof
+	return res
+}
+
+// serveStorageRanges gathers the storage slots requested by req from the local
+// state. The response stops at the first account that is not available.
+func serveStorageRanges(db ethdb.Database, req *getStorageRangesPacket) *storageRangesPacket {
+	res := &storageRangesPacket{ID: req.ID}
+
+	tr, err := trie.New(req.Root, db)
+	if err != nil {
+		return res
+	}
+	var (
+		limit = responseLimit(req.Bytes)
+		size  uint64
+	)
+	for i, account := range req.Accounts {
+		if size >= limit {
+			break
+		}
+		enc, err := tr.TryGet(account[:])
+		if err != nil || enc == nil {
+			break
+		}
+		var acc state.Account
+		if err := rlp.DecodeBytes(enc, &acc); err != nil {
+			break
+		}
+		st, err := trie.New(acc.Root, db)
+		if err != nil {
+			break
+		}
+		var origin common.Hash
+		if i == 0 {
+			origin = req.Origin
+		}
+		var (
+			slots     []*storageData
+			exhausted = true
+		)
+		it := trie.NewIterator(st.NodeIterator(origin[:]))
+		for it.Next() {
+			slots = append(slots, &storageData{Hash: common.BytesToHash(it.Key), Body: common.CopyBytes(it.Value)})
+
+			size += uint64(common.HashLength + len(it.Value))
+			if size >= limit {
+				exhausted = false
+				break
+			}
+		}
+		if it.Err != nil {
+			break
+		}
+		res.Slots = append(res.Slots, slots)
+
+		// A continued or cut short storage trie is proven by its edges, and ends
+		// the response.
+		if origin != (common.Hash{}) || !exhausted {
+			var keys [][]byte
+			if len(slots) > 0 {
+				keys = append(keys, slots[len(slots)-1].Hash[:])
+			}
+			proof, err := proveRange(st, origin[:], keys...)
+			if err != nil {
+				return &storageRangesPacket{ID: req.ID}
+			}
+			res.Proof = proof
+			break
+		}
+	}
+	return res
+}
+
+// serveByteCodes gathers the contract codes requested by req from the database.
+func serveByteCodes(db ethdb.Database, req *getByteCodesPacket) *byteCodesPacket {
+	res := &byteCodesPacket{ID: req.ID}
+
+	var (
+		limit = responseLimit(req.Bytes)
+		size  uint64
+	)
+	for i, hash := range req.Hashes {
+		if i >= maxCodeLookups || size >= limit {
+			break
+		}
+		if code, _ := db.Get(hash[:]); len(code) > 0 {
+			res.Codes = append(res.Codes, code)
+			size += uint64(len(code))
+		}
+	}
+	return res
+}
+
+// proveRange returns the trie nodes proving the origin and the given keys.
+func proveRange(tr *trie.Trie, origin []byte, keys ...[]byte) ([][]byte, error) {
+	proofDb, _ := ethdb.NewMemDatabase()
+	for _, key := range append([][]byte{origin}, keys...) {
+		if err := tr.Prove(key, 0, proofDb); err != nil {
+			return nil, err
+		}
+	}
+	var proof [][]byte
+	for _, key := range proofDb.Keys() {
+		node, _ := proofDb.Get(key)
+		proof = append(proof, node)
+	}
+	return proof, nil
+}
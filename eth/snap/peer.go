@@ -0,0 +1,100 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"fmt"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/p2p"
+)
+
+// Peer is a remote peer speaking the snap protocol.
+type Peer struct {
+	id string
+
+	*p2p.Peer
+	rw p2p.MsgReadWriter
+
+	version int // Protocol version negotiated
+}
+
+func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *Peer {
+	id := p.ID()
+
+	return &Peer{
+		Peer:    p,
+		rw:      rw,
+		version: version,
+		id:      fmt.Sprintf("%x", id[:8]),
+	}
+}
+
+// ID retrieves the peer's unique identifier, matching the one used by the eth
+// protocol.
+func (p *Peer) ID() string {
+	return p.id
+}
+
+// String implements fmt.Stringer.
+func (p *Peer) String() string {
+	// id is %x[:8]
+	return fmt.Sprintf("peer:%s@[%s] %s/%d", p.id, p.Name(), ProtocolName, p.version)
+}
+
+// RequestAccountRange fetches a range of accounts of the state trie with the
+// given root, starting at origin and stopping after limit or bytes.
+func (p *Peer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	glog.V(logger.Debug).Infof("%v fetching account range, origin %x, limit %x", p, origin[:4], limit[:4])
+	_, err := p2p.Send(p.rw, GetAccountRangeMsg, &getAccountRangePacket{ID: id, Root: root, Origin: origin, Limit: limit, Bytes: bytes})
+	return err
+}
+
+// RequestStorageRanges fetches the storage slots of the given accounts of the
+// state trie with the given root, starting at origin for the first account.
+func (p *Peer) RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin common.Hash, bytes uint64) error {
+	glog.V(logger.Debug).Infof("%v fetching storage of %d accounts, origin %x", p, len(accounts), origin[:4])
+	_, err := p2p.Send(p.rw, GetStorageRangesMsg, &getStorageRangesPacket{ID: id, Root: root, Accounts: accounts, Origin: origin, Bytes: bytes})
+	return err
+}
+
+// RequestByteCodes fetches a batch of contract bytecodes by their hashes.
+func (p *Peer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	glog.V(logger.Debug).Infof("%v fetching %d bytecodes", p, len(hashes))
+	_, err := p2p.Send(p.rw, GetByteCodesMsg, &getByteCodesPacket{ID: id, Hashes: hashes, Bytes: bytes})
+	return err
+}
+
+// sendAccountRange sends a range of accounts with its proof to the peer.
+func (p *Peer) sendAccountRange(res *accountRangePacket) error {
+	_, err := p2p.Send(p.rw, AccountRangeMsg, res)
+	return err
+}
+
+// sendStorageRanges sends ranges of storage slots with their proof to the peer.
+func (p *Peer) sendStorageRanges(res *storageRangesPacket) error {
+	_, err := p2p.Send(p.rw, StorageRangesMsg, res)
+	return err
+}
+
+// sendByteCodes sends a batch of contract bytecodes to the peer.
+func (p *Peer) sendByteCodes(res *byteCodesPacket) error {
+	_, err := p2p.Send(p.rw, ByteCodesMsg, res)
+	return err
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snap implements the snapshot state sync subprotocol, which retrieves
+// the state of a block as contiguous ranges of accounts and storage slots, each
+// proven against the state root with the Merkle proofs of its boundaries.
+package snap
+
+import (
+	"fmt"
+
+	"github.com/ethereumproject/go-ethereum/common"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	snap1 = 1
+)
+
+// Official short name of the protocol used during capability negotiation. The
+// messages are not wire compatible with the snap protocol of other clients, so
+// the capability is named differently to never be negotiated with them.
+var ProtocolName = "etcsnap"
+
+// Supported versions of the snap protocol (first is primary).
+var ProtocolVersions = []uint{snap1}
+
+// Number of implemented message corresponding to different protocol versions.
+var ProtocolLengths = []uint64{6}
+
+const (
+	ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
+
+	softResponseLimit = 2 * 1024 * 1024 // Target maximum size of a served response
+	maxCodeLookups    = 1024            // Maximum number of bytecodes to serve in a response
+)
+
+// snap protocol message codes
+const (
+	GetAccountRangeMsg  = 0x00
+	AccountRangeMsg     = 0x01
+	GetStorageRangesMsg = 0x02
+	StorageRangesMsg    = 0x03
+	GetByteCodesMsg     = 0x04
+	ByteCodesMsg        = 0x05
+)
+
+type errCode int
+
+const (
+	ErrMsgTooLarge = iota
+	ErrDecode
+	ErrInvalidMsgCode
+)
+
+func (e errCode) String() string {
+	return errorToString[int(e)]
+}
+
+var errorToString = map[int]string{
+	ErrMsgTooLarge:    "Message too long",
+	ErrDecode:         "Invalid message",
+	ErrInvalidMsgCode: "Invalid message code",
+}
+
+func errResp(code errCode, format string, v ...interface{}) error {
+	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+}
+
+// getAccountRangePacket requests the accounts of the state trie with the given
+// root, starting at origin. The response stops after the first account at or
+// beyond limit, or when it reaches roughly the given size in bytes.
+type getAccountRangePacket struct {
+	ID     uint64      // Request ID to match up responses with
+	Root   common.Hash // Root hash of the account trie to serve
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve
+	Bytes  uint64      // Soft limit at which to stop returning data
+}
+
+// accountRangePacket is the response to getAccountRangePacket. Unless it holds
+// the whole trie, it carries the proofs of origin and the last account.
+type accountRangePacket struct {
+	ID       uint64         // ID of the request this is a response for
+	Accounts []*accountData // List of consecutive accounts from the trie
+	Proof    [][]byte       // List of trie nodes proving the account range
+}
+
+// accountData represents a single account in the state trie.
+type accountData struct {
+	Hash common.Hash // Hash of the account
+	Body []byte      // RLP encoded account as stored in the trie
+}
+
+// getStorageRangesPacket requests the storage slots of a list of accounts of
+// the state trie with the given root. Origin applies to the first account only.
+type getStorageRangesPacket struct {
+	ID       uint64        // Request ID to match up responses with
+	Root     common.Hash   // Root hash of the account trie to serve
+	Accounts []common.Hash // Account hashes of the storage tries to serve
+	Origin   common.Hash   // Hash of the first storage slot of the first account
+	Bytes    uint64        // Soft limit at which to stop returning data
+}
+
+// storageRangesPacket is the response to getStorageRangesPacket. All storage
+// tries but the last are complete. The last one is proven, if it was continued
+// from a non-zero origin or cut short.
+type storageRangesPacket struct {
+	ID    uint64           // ID of the request this is a response for
+	Slots [][]*storageData // Lists of consecutive storage slots per account
+	Proof [][]byte         // List of trie nodes proving the last slot range
+}
+
+// storageData represents a single storage slot in a storage trie.
+type storageData struct {
+	Hash common.Hash // Hash of the storage slot
+	Body []byte      // RLP encoded slot value as stored in the trie
+}
+
+// getByteCodesPacket requests contract bytecodes by their hashes.
+type getByteCodesPacket struct {
+	ID     uint64        // Request ID to match up responses with
+	Hashes []common.Hash // Code hashes to retrieve the code for
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// byteCodesPacket is the response to getByteCodesPacket. Unknown codes are
+// left out.
+type byteCodesPacket struct {
+	ID    uint64   // ID of the request this is a response for
+	Codes [][]byte // Requested contract bytecodes
+}
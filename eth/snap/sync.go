@@ -0,0 +1,696 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/rlp"
+	"github.com/ethereumproject/go-ethereum/trie"
+)
+
+var (
+	errCancelled         = errors.New("sync cancelled")
+	errUnrequested       = errors.New("unrequested response")
+	errAlreadyRegistered = errors.New("peer is already registered")
+	errNotRegistered     = errors.New("peer is not registered")
+)
+
+const (
+	// accountConcurrency is the number of chunks the account trie is split into
+	// to retrieve them from different peers concurrently.
+	accountConcurrency = 16
+
+	maxRequestSize    = 512 * 1024 // Response size to ask the remote peers for
+	maxStorageFetch   = 128        // Amount of storage tries to request at once
+	maxByteCodesFetch = 64         // Amount of bytecodes to request at once
+)
+
+// requestTimeout is the time allowed for a remote peer to answer a request,
+// after which it's considered unable to serve the state being synced.
+var requestTimeout = 10 * time.Second
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+)
+
+// SyncPeer is a remote peer the Syncer can retrieve state ranges from.
+type SyncPeer interface {
+	// ID retrieves the peer's unique identifier.
+	ID() string
+
+	// RequestAccountRange fetches a range of accounts of the state trie with the
+	// given root, starting at origin and stopping after limit or bytes.
+	RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error
+
+	// RequestStorageRanges fetches the storage slots of the given accounts of the
+	// state trie with the given root, starting at origin for the first account.
+	RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin common.Hash, bytes uint64) error
+
+	// RequestByteCodes fetches a batch of contract bytecodes by their hashes.
+	RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error
+}
+
+// accountTask is a chunk of the account trie to retrieve, from next up to and
+// including last.
+type accountTask struct {
+	next common.Hash
+	last common.Hash
+	done bool // Whether the whole chunk has been retrieved
+
+	req     *request           // Request currently in flight, if any
+	pending []*accountResponse // Retrieved ranges waiting for storage and code
+}
+
+// accountResponse is a verified range of accounts, whose trie nodes are only
+// written to the database once the storage tries and codes of all accounts in
+// it have been. This keeps up the invariant of the trie sync, that every trie
+// node in the database is the root of a complete subtrie.
+type accountResponse struct {
+	task   *accountTask
+	origin common.Hash        // First account hash of the range requested
+	nodes  *ethdb.MemDatabase // Account trie nodes within the range
+
+	pending    int  // Number of storage tries and codes still being retrieved
+	incomplete bool // Whether a storage trie was retrieved in chunks
+}
+
+// storageTask is a storage trie (or the rest of it) to retrieve.
+type storageTask struct {
+	res     *accountResponse
+	account common.Hash // Hash of the account owning the storage trie
+	root    common.Hash // Root hash of the storage trie
+	origin  common.Hash // First storage slot hash to retrieve
+}
+
+// codeTask is a contract bytecode to retrieve.
+type codeTask struct {
+	res  *accountResponse
+	hash common.Hash
+}
+
+// request is a retrieval sent to a remote peer, for either an account range,
+// a list of storage tries or a list of bytecodes.
+type request struct {
+	id   uint64
+	peer string
+
+	task    *accountTask   // Account chunk of an account range request
+	origin  common.Hash    // First account hash of an account range request
+	storage []*storageTask // Storage tries of a storage ranges request
+	codes   []*codeTask    // Bytecodes of a bytecodes request
+
+	timer   *time.Timer
+	deliver chan *response // Channel of the sync the request belongs to
+	quit    chan struct{}  // Closed when the sync the request belongs to ends
+}
+
+// response is the reply of a remote peer to a request. A response without
+// data can mean the peer has none, timed out or disconnected.
+type response struct {
+	req        *request
+	failed     bool // Whether the request timed out or the peer dropped
+	keys       [][]byte
+	values     [][]byte
+	slotKeys   [][][]byte
+	slotValues [][][]byte
+	codes      [][]byte
+	proof      [][]byte
+}
+
+// Syncer retrieves the state of a block as ranges of accounts and storage
+// slots proven against the state root, rather than trie node by trie node.
+// The trie nodes within the ranges are reconstructed locally. The nodes on the
+// edges of the ranges, as well as anything that couldn't be retrieved, need to
+// be healed by a trie node sync afterwards.
+type Syncer struct {
+	db ethdb.Database
+
+	root         common.Hash    // State root being synced, tasks are kept for it
+	tasks        []*accountTask // Account trie chunks to retrieve
+	storageQueue []*storageTask // Storage tries to retrieve
+	codeQueue    []*codeTask    // Bytecodes to retrieve
+
+	busy      map[string]struct{} // Peers with a request in flight
+	stateless map[string]struct{} // Peers unable to serve the root being synced
+
+	peers  map[string]SyncPeer // Currently connected snap peers
+	reqs   map[uint64]*request // Requests in flight, by request ID
+	nextID uint64
+	update chan struct{} // Notification channel of new peers
+	lock   sync.Mutex    // Protects the peers and requests
+}
+
+// NewSyncer creates a state syncer writing the retrieved state into db.
+func NewSyncer(db ethdb.Database) *Syncer {
+	return &Syncer{
+		db:     db,
+		peers:  make(map[string]SyncPeer),
+		reqs:   make(map[uint64]*request),
+		update: make(chan struct{}, 1),
+	}
+}
+
+// Register injects a new snap peer into the set of peers to retrieve state from.
+func (s *Syncer) Register(peer SyncPeer) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[peer.ID()]; ok {
+		return errAlreadyRegistered
+	}
+	s.peers[peer.ID()] = peer
+
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Unregister removes a snap peer, failing any of its requests in flight.
+func (s *Syncer) Unregister(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[id]; !ok {
+		return errNotRegistered
+	}
+	delete(s.peers, id)
+
+	for reqID, req := range s.reqs {
+		if req.peer == id {
+			req.timer.Stop()
+			delete(s.reqs, reqID)
+			go deliver(&response{req: req, failed: true})
+		}
+	}
+	return nil
+}
+
+// newAccountTasks splits the account trie into chunks of equal key ranges.
+func newAccountTasks() []*accountTask {
+	var (
+		tasks = make([]*accountTask, accountConcurrency)
+		step  = new(big.Int).Div(new(big.Int).Lsh(common.Big1, 256), big.NewInt(accountConcurrency))
+		next  = new(big.Int)
+	)
+	for i := range tasks {
+		last := new(big.Int).Add(next, step)
+		last.Sub(last, common.Big1)
+		tasks[i] = &accountTask{next: common.BigToHash(next), last: common.BigToHash(last)}
+		next.Add(next, step)
+	}
+	return tasks
+}
+
+// Sync retrieves as much of the state with the given root as the connected
+// peers are able to serve. It returns nil when the ranges are retrieved, or no
+// peer is left to retrieve the rest from, which then needs to be healed.
+// Progress is kept for the next call with the same root.
+func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
+	// A present root node implies a complete state.
+	if ok, _ := s.db.Has(root[:]); ok || root == emptyRoot {
+		return nil
+	}
+	if s.root != root || s.tasks == nil {
+		s.root, s.tasks = root, newAccountTasks()
+	}
+	s.busy = make(map[string]struct{})
+	s.stateless = make(map[string]struct{})
+
+	deliveries, quit := make(chan *response), make(chan struct{})
+	defer func() {
+		s.lock.Lock()
+		for id, req := range s.reqs {
+			req.timer.Stop()
+			delete(s.reqs, id)
+		}
+		close(quit)
+		s.lock.Unlock()
+
+		// Drop the ranges waiting for storage and code, rewinding their chunks to
+		// retrieve them again on the next run.
+		for _, task := range s.tasks {
+			if len(task.pending) > 0 {
+				task.next, task.done = task.pending[0].origin, false
+			}
+			task.req, task.pending = nil, nil
+		}
+		s.storageQueue, s.codeQueue = nil, nil
+	}()
+	glog.V(logger.Debug).Infof("Snap syncing state %x", root[:4])
+
+	for {
+		s.assignTasks(deliveries, quit)
+		if s.complete() {
+			glog.V(logger.Debug).Infof("Snap sync of state %x finished", root[:4])
+			return nil
+		}
+		if len(s.busy) == 0 {
+			glog.V(logger.Debug).Infof("Snap sync of state %x out of peers", root[:4])
+			return nil
+		}
+		select {
+		case <-s.update:
+			// New peer arrived, try to assign it tasks
+		case <-cancel:
+			return errCancelled
+		case res := <-deliveries:
+			s.process(res)
+		}
+	}
+}
+
+// complete reports whether all the account ranges and their storage tries and
+// codes have been retrieved.
+func (s *Syncer) complete() bool {
+	for _, task := range s.tasks {
+		if !task.done || len(task.pending) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// idlePeers returns the peers able to take new requests, ordered by ID. The
+// caller must hold the lock.
+func (s *Syncer) idlePeers() []SyncPeer {
+	var idle []SyncPeer
+	for id, peer := range s.peers {
+		if _, ok := s.busy[id]; ok {
+			continue
+		}
+		if _, ok := s.stateless[id]; ok {
+			continue
+		}
+		idle = append(idle, peer)
+	}
+	sort.Sort(peersByID(idle))
+	return idle
+}
+
+type peersByID []SyncPeer
+
+func (p peersByID) Len() int           { return len(p) }
+func (p peersByID) Less(i, j int) bool { return p[i].ID() < p[j].ID() }
+func (p peersByID) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// assignTasks hands the queued tasks out to the idle peers, account ranges
+// first, then storage tries and finally bytecodes.
+func (s *Syncer) assignTasks(deliveries chan *response, quit chan struct{}) {
+	var sends []func() error
+
+	s.lock.Lock()
+	idle := s.idlePeers()
+
+	// track registers a request to a peer, timing it out if unanswered.
+	track := func(peer SyncPeer, req *request) {
+		s.nextID++
+		req.id, req.peer = s.nextID, peer.ID()
+		req.deliver, req.quit = deliveries, quit
+		req.timer = time.AfterFunc(requestTimeout, func() {
+			s.lock.Lock()
+			if s.reqs[req.id] != req {
+				s.lock.Unlock()
+				return
+			}
+			delete(s.reqs, req.id)
+			s.lock.Unlock()
+			deliver(&response{req: req, failed: true})
+		})
+		s.reqs[req.id] = req
+		s.busy[req.peer] = struct{}{}
+	}
+	for _, task := range s.tasks {
+		if len(idle) == 0 {
+			break
+		}
+		if task.done || task.req != nil {
+			continue
+		}
+		peer, req := idle[0], &request{task: task, origin: task.next}
+		idle = idle[1:]
+
+		track(peer, req)
+		task.req = req
+		root, origin, limit := s.root, task.next, task.last
+		sends = append(sends, func() error {
+			return peer.RequestAccountRange(req.id, root, origin, limit, maxRequestSize)
+		})
+	}
+	for len(idle) > 0 && len(s.storageQueue) > 0 {
+		peer, req := idle[0], new(request)
+		idle = idle[1:]
+
+		// A storage trie continued from an origin goes alone, as the origin
+		// applies to the first account only.
+		n := 1
+		if s.storageQueue[0].origin == (common.Hash{}) {
+			for n < len(s.storageQueue) && n < maxStorageFetch && s.storageQueue[n].origin == (common.Hash{}) {
+				n++
+			}
+		}
+		req.storage = s.storageQueue[:n:n]
+		s.storageQueue = s.storageQueue[n:]
+
+		accounts := make([]common.Hash, n)
+		for i, task := range req.storage {
+			accounts[i] = task.account
+		}
+		track(peer, req)
+		root, origin := s.root, req.storage[0].origin
+		sends = append(sends, func() error {
+			return peer.RequestStorageRanges(req.id, root, accounts, origin, maxRequestSize)
+		})
+	}
+	for len(idle) > 0 && len(s.codeQueue) > 0 {
+		peer, req := idle[0], new(request)
+		idle = idle[1:]
+
+		n := len(s.codeQueue)
+		if n > maxByteCodesFetch {
+			n = maxByteCodesFetch
+		}
+		req.codes = s.codeQueue[:n:n]
+		s.codeQueue = s.codeQueue[n:]
+
+		hashes := make([]common.Hash, n)
+		for i, task := range req.codes {
+			hashes[i] = task.hash
+		}
+		track(peer, req)
+		sends = append(sends, func() error {
+			return peer.RequestByteCodes(req.id, hashes, maxRequestSize)
+		})
+	}
+	s.lock.Unlock()
+
+	// Send the requests without holding the lock, as responses may arrive
+	// before the sends return.
+	for _, send := range sends {
+		if err := send(); err != nil {
+			glog.V(logger.Debug).Infoln("Snap request failed:", err)
+		}
+	}
+}
+
+// deliver hands a response over to the sync loop the request belongs to, unless
+// that has ended already.
+func deliver(res *response) {
+	select {
+	case res.req.deliver <- res:
+	case <-res.req.quit:
+	}
+}
+
+// claim removes the request with the given ID from the requests in flight, if
+// it was sent to the given peer and matches want.
+func (s *Syncer) claim(peer SyncPeer, id uint64, want func(*request) bool) (*request, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	req := s.reqs[id]
+	if req == nil || req.peer != peer.ID() || !want(req) {
+		return nil, errUnrequested
+	}
+	req.timer.Stop()
+	delete(s.reqs, id)
+	return req, nil
+}
+
+// OnAccounts is invoked when a range of accounts with its proof arrives from a
+// remote peer.
+func (s *Syncer) OnAccounts(peer SyncPeer, id uint64, keys, values [][]byte, proof [][]byte) error {
+	req, err := s.claim(peer, id, func(req *request) bool { return req.task != nil })
+	if err != nil {
+		return err
+	}
+	deliver(&response{req: req, keys: keys, values: values, proof: proof})
+	return nil
+}
+
+// OnStorage is invoked when ranges of storage slots with the proof of the last
+// one arrive from a remote peer.
+func (s *Syncer) OnStorage(peer SyncPeer, id uint64, keys, values [][][]byte, proof [][]byte) error {
+	req, err := s.claim(peer, id, func(req *request) bool { return req.storage != nil })
+	if err != nil {
+		return err
+	}
+	deliver(&response{req: req, slotKeys: keys, slotValues: values, proof: proof})
+	return nil
+}
+
+// OnByteCodes is invoked when a batch of contract bytecodes arrives from a
+// remote peer.
+func (s *Syncer) OnByteCodes(peer SyncPeer, id uint64, codes [][]byte) error {
+	req, err := s.claim(peer, id, func(req *request) bool { return req.codes != nil })
+	if err != nil {
+		return err
+	}
+	deliver(&response{req: req, codes: codes})
+	return nil
+}
+
+// process handles a response, or the failure of a request.
+func (s *Syncer) process(res *response) {
+	delete(s.busy, res.req.peer)
+
+	var ok bool
+	switch {
+	case res.req.task != nil:
+		ok = s.processAccounts(res)
+	case res.req.storage != nil:
+		ok = s.processStorage(res)
+	default:
+		ok = s.processByteCodes(res)
+	}
+	if !ok {
+		glog.V(logger.Debug).Infof("Snap peer %s unable to serve state %x", res.req.peer, s.root[:4])
+		s.stateless[res.req.peer] = struct{}{}
+	}
+}
+
+// proofDatabase returns the proof nodes keyed by their hashes, or nil if there
+// are none.
+func proofDatabase(proof [][]byte) trie.DatabaseReader {
+	if len(proof) == 0 {
+		return nil
+	}
+	db, _ := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
+
+// incHash returns the hash following h.
+func incHash(h []byte) common.Hash {
+	return common.BigToHash(new(big.Int).Add(new(big.Int).SetBytes(h), common.Big1))
+}
+
+// processAccounts verifies a range of accounts, queueing up the retrieval of
+// the storage tries and codes it needs. It reports whether the response was
+// valid and not empty.
+func (s *Syncer) processAccounts(res *response) bool {
+	task := res.req.task
+	task.req = nil
+
+	if res.failed || len(res.keys) == 0 && len(res.proof) == 0 {
+		return false
+	}
+	nodes, _ := ethdb.NewMemDatabase()
+	more, err := trie.VerifyRangeProof(s.root, res.req.origin[:], res.keys, res.values, proofDatabase(res.proof), nodes)
+	if err != nil {
+		glog.V(logger.Debug).Infof("Snap peer %s sent invalid account range: %v", res.req.peer, err)
+		return false
+	}
+	glog.V(logger.Detail).Infof("Snap retrieved %d accounts from %x", len(res.keys), res.req.origin[:4])
+
+	resp := &accountResponse{task: task, origin: res.req.origin, nodes: nodes}
+	task.pending = append(task.pending, resp)
+
+	// Move the chunk past the range, which may reach into the next one.
+	if len(res.keys) == 0 || !more {
+		task.done = true
+	} else if last := res.keys[len(res.keys)-1]; bytes.Compare(last, task.last[:]) >= 0 {
+		task.done = true
+	} else {
+		task.next = incHash(last)
+	}
+	// Queue up the storage tries and codes not retrieved yet.
+	codes := make(map[common.Hash]struct{})
+	for i, value := range res.values {
+		var acc state.Account
+		if err := rlp.DecodeBytes(value, &acc); err != nil {
+			// The account is proven, so this is an odd state, leave it to the heal.
+			resp.incomplete = true
+			continue
+		}
+		if acc.Root != emptyRoot {
+			if ok, _ := s.db.Has(acc.Root[:]); !ok {
+				s.storageQueue = append(s.storageQueue, &storageTask{res: resp, account: common.BytesToHash(res.keys[i]), root: acc.Root})
+				resp.pending++
+			}
+		}
+		if hash := common.BytesToHash(acc.CodeHash); hash != emptyCode {
+			if _, ok := codes[hash]; ok {
+				continue
+			}
+			if ok, _ := s.db.Has(hash[:]); !ok {
+				codes[hash] = struct{}{}
+				s.codeQueue = append(s.codeQueue, &codeTask{res: resp, hash: hash})
+				resp.pending++
+			}
+		}
+	}
+	if resp.pending == 0 {
+		s.commitAccounts(resp)
+	}
+	return true
+}
+
+// processStorage verifies the storage tries of a response and writes their
+// nodes. Storage tries not delivered are queued up again. It reports whether
+// the response was valid and not empty.
+func (s *Syncer) processStorage(res *response) bool {
+	req := res.req
+	if res.failed || len(res.slotKeys) == 0 || len(res.slotKeys) > len(req.storage) || len(res.slotKeys) != len(res.slotValues) {
+		s.storageQueue = append(req.storage, s.storageQueue...)
+		return false
+	}
+	for i, keys := range res.slotKeys {
+		task := req.storage[i]
+
+		// Only the last storage trie may be proven.
+		var proofDb trie.DatabaseReader
+		if i == len(res.slotKeys)-1 {
+			proofDb = proofDatabase(res.proof)
+		}
+		batch := s.db.NewBatch()
+		more, err := trie.VerifyRangeProof(task.root, task.origin[:], keys, res.slotValues[i], proofDb, batch)
+		if err != nil {
+			glog.V(logger.Debug).Infof("Snap peer %s sent invalid storage range: %v", req.peer, err)
+			s.storageQueue = append(req.storage[i:], s.storageQueue...)
+			return false
+		}
+		if err := batch.Write(); err != nil {
+			glog.V(logger.Error).Errorf("Failed to write storage trie nodes: %v", err)
+			s.storageQueue = append(req.storage[i:], s.storageQueue...)
+			return true
+		}
+		if proofDb != nil {
+			// The root and edges of a storage trie retrieved in chunks are never
+			// written, so the accounts owning it must be healed.
+			task.res.incomplete = true
+			if more {
+				next := &storageTask{res: task.res, account: task.account, root: task.root, origin: incHash(keys[len(keys)-1])}
+				s.storageQueue = append([]*storageTask{next}, s.storageQueue...)
+				continue
+			}
+		}
+		if task.res.pending--; task.res.pending == 0 {
+			s.commitAccounts(task.res)
+		}
+	}
+	s.storageQueue = append(s.storageQueue, req.storage[len(res.slotKeys):]...)
+	return true
+}
+
+// processByteCodes verifies and writes the bytecodes of a response. Codes not
+// delivered are queued up again. It reports whether the response was valid and
+// not empty.
+func (s *Syncer) processByteCodes(res *response) bool {
+	req := res.req
+	if res.failed || len(res.codes) == 0 {
+		s.codeQueue = append(s.codeQueue, req.codes...)
+		return false
+	}
+	want := make(map[common.Hash]*codeTask, len(req.codes))
+	for _, task := range req.codes {
+		want[task.hash] = task
+	}
+	var (
+		done  []*codeTask
+		batch = s.db.NewBatch()
+		valid = true
+	)
+	for _, code := range res.codes {
+		hash := crypto.Keccak256Hash(code)
+		task, ok := want[hash]
+		if !ok {
+			valid = false
+			continue
+		}
+		batch.Put(hash[:], code)
+		delete(want, hash)
+		done = append(done, task)
+	}
+	if err := batch.Write(); err != nil {
+		glog.V(logger.Error).Errorf("Failed to write bytecodes: %v", err)
+		s.codeQueue = append(s.codeQueue, req.codes...)
+		return true
+	}
+	for _, task := range done {
+		if task.res.pending--; task.res.pending == 0 {
+			s.commitAccounts(task.res)
+		}
+	}
+	for _, task := range req.codes {
+		if _, ok := want[task.hash]; ok {
+			s.codeQueue = append(s.codeQueue, task)
+		}
+	}
+	return valid
+}
+
+// commitAccounts writes the account trie nodes of a range, whose storage tries
+// and codes are all retrieved, and drops it from the pending ranges.
+func (s *Syncer) commitAccounts(res *accountResponse) {
+	if !res.incomplete {
+		batch := s.db.NewBatch()
+		for _, key := range res.nodes.Keys() {
+			node, _ := res.nodes.Get(key)
+			batch.Put(key, node)
+		}
+		if err := batch.Write(); err != nil {
+			glog.V(logger.Error).Errorf("Failed to write account trie nodes: %v", err)
+		}
+	}
+	task := res.task
+	for i, pending := range task.pending {
+		if pending == res {
+			task.pending = append(task.pending[:i], task.pending[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/trie"
+)
+
+// testPeer serves state ranges from a local database, answering every request
+// asynchronously like a remote peer would.
+type testPeer struct {
+	id      string
+	db      ethdb.Database
+	syncer  *Syncer
+	limit   uint64 // Response size to serve, regardless of the requested one
+	corrupt bool   // Whether to tamper with the served account values
+	silent  bool   // Whether to never answer
+}
+
+func newTestPeer(id string, db ethdb.Database, syncer *Syncer) *testPeer {
+	return &testPeer{id: id, db: db, syncer: syncer, limit: 4096}
+}
+
+func (p *testPeer) ID() string { return p.id }
+
+func (p *testPeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	if p.silent {
+		return nil
+	}
+	res := serveAccountRange(p.db, &getAccountRangePacket{ID: id, Root: root, Origin: origin, Limit: limit, Bytes: p.limit})
+	keys := make([][]byte, len(res.Accounts))
+	values := make([][]byte, len(res.Accounts))
+	for i, acc := range res.Accounts {
+		keys[i], values[i] = common.CopyBytes(acc.Hash[:]), acc.Body
+	}
+	if p.corrupt && len(values) > 0 {
+		values[0] = append(common.CopyBytes(values[0]), 0x00)
+	}
+	go p.syncer.OnAccounts(p, id, keys, values, res.Proof)
+	return nil
+}
+
+func (p *testPeer) RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin common.Hash, bytes uint64) error {
+	if p.silent {
+		return nil
+	}
+	res := serveStorageRanges(p.db, &getStorageRangesPacket{ID: id, Root: root, Accounts: accounts, Origin: origin, Bytes: p.limit})
+	keys := make([][][]byte, len(res.Slots))
+	values := make([][][]byte, len(res.Slots))
+	for i, slots := range res.Slots {
+		for _, slot := range slots {
+			keys[i] = append(keys[i], common.CopyBytes(slot.Hash[:]))
+			values[i] = append(values[i], slot.Body)
+		}
+	}
+	go p.syncer.OnStorage(p, id, keys, values, res.Proof)
+	return nil
+}
+
+func (p *testPeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	if p.silent {
+		return nil
+	}
+	res := serveByteCodes(p.db, &getByteCodesPacket{ID: id, Hashes: hashes, Bytes: p.limit})
+	go p.syncer.OnByteCodes(p, id, res.Codes)
+	return nil
+}
+
+// makeTestState creates a state with plain accounts, contracts with small
+// storage tries, and a few contracts with storage tries too large to be served
+// in a single response.
+func makeTestState(t *testing.T) (*ethdb.MemDatabase, common.Hash) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	for i := 0; i < 1000; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+		statedb.AddBalance(addr, big.NewInt(int64(i+1)))
+		statedb.SetNonce(addr, uint64(i))
+
+		switch {
+		case i%100 == 0:
+			statedb.SetCode(addr, []byte{byte(i), 0x01})
+			for j := 0; j < 500; j++ {
+				statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j+1))), common.BigToHash(big.NewInt(int64(i+j+1))))
+			}
+		case i%10 == 0:
+			statedb.SetCode(addr, []byte{byte(i), 0x02})
+			for j := 0; j < 5; j++ {
+				statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j+1))), common.BigToHash(big.NewInt(int64(i+j+1))))
+			}
+		}
+	}
+	root, err := statedb.CommitTo(db, false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	return db, root
+}
+
+// healState completes a state with a trie node sync from the source database,
+// returning the number of nodes retrieved.
+func healState(t *testing.T, src, dst ethdb.Database, root common.Hash) int {
+	sched := state.NewStateSync(root, dst)
+
+	var healed int
+	for queue := sched.Missing(128); len(queue) > 0; queue = sched.Missing(128) {
+		results := make([]trie.SyncResult, len(queue))
+		for i, hash := range queue {
+			data, err := src.Get(hash[:])
+			if err != nil {
+				t.Fatalf("failed to retrieve node data for %x: %v", hash, err)
+			}
+			results[i] = trie.SyncResult{Hash: hash, Data: data}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		if index, err := sched.Commit(dst); err != nil {
+			t.Fatalf("failed to commit data #%d: %v", index, err)
+		}
+		healed += len(queue)
+	}
+	return healed
+}
+
+// checkState verifies that a synced state is complete and matches the source.
+func checkState(t *testing.T, src, dst ethdb.Database, root common.Hash) {
+	statedb, err := state.New(root, state.NewDatabase(dst))
+	if err != nil {
+		t.Fatalf("failed to open synced state: %v", err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+		if it.Hash == (common.Hash{}) {
+			continue
+		}
+		have, _ := dst.Get(it.Hash[:])
+		want, _ := src.Get(it.Hash[:])
+		if !bytes.Equal(have, want) {
+			t.Fatalf("state entry %x mismatch: have %x, want %x", it.Hash, have, want)
+		}
+	}
+	if it.Error != nil {
+		t.Fatalf("synced state incomplete: %v", it.Error)
+	}
+}
+
+// Tests that a state is retrieved in ranges from a peer, leaving only the edges
+// of the ranges to be healed.
+func TestSync(t *testing.T) {
+	src, root := makeTestState(t)
+	total := len(src.Keys())
+
+	dst, _ := ethdb.NewMemDatabase()
+	syncer := NewSyncer(dst)
+	syncer.Register(newTestPeer("peer", src, syncer))
+
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	synced := len(dst.Keys())
+	if synced == 0 {
+		t.Fatal("no state retrieved in ranges")
+	}
+	healed := healState(t, src, dst, root)
+	if healed >= total/2 {
+		t.Errorf("too many nodes healed: %d of %d", healed, total)
+	}
+	checkState(t, src, dst, root)
+
+	// A completed state doesn't need another sync.
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("failed to sync synced state: %v", err)
+	}
+}
+
+// Tests that peers serving invalid ranges, or no state at all, are skipped.
+func TestSyncBadPeers(t *testing.T) {
+	src, root := makeTestState(t)
+	empty, _ := ethdb.NewMemDatabase()
+
+	dst, _ := ethdb.NewMemDatabase()
+	syncer := NewSyncer(dst)
+
+	bad := newTestPeer("bad", src, syncer)
+	bad.corrupt = true
+	syncer.Register(bad)
+	syncer.Register(newTestPeer("empty", empty, syncer))
+	syncer.Register(newTestPeer("good", src, syncer))
+
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	healState(t, src, dst, root)
+	checkState(t, src, dst, root)
+}
+
+// Tests that a sync without any peer able to serve the state leaves it all to
+// the heal.
+func TestSyncNoPeers(t *testing.T) {
+	defer func(timeout time.Duration) { requestTimeout = timeout }(requestTimeout)
+	requestTimeout = 50 * time.Millisecond
+
+	src, root := makeTestState(t)
+	dst, _ := ethdb.NewMemDatabase()
+	syncer := NewSyncer(dst)
+
+	silent := newTestPeer("silent", src, syncer)
+	silent.silent = true
+	syncer.Register(silent)
+
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	if n := len(dst.Keys()); n != 0 {
+		t.Fatalf("state retrieved from silent peer: %d entries", n)
+	}
+	healState(t, src, dst, root)
+	checkState(t, src, dst, root)
+}
+
+// Tests that a cancelled sync returns, and resumes on the next call.
+func TestSyncCancel(t *testing.T) {
+	src, root := makeTestState(t)
+	dst, _ := ethdb.NewMemDatabase()
+	syncer := NewSyncer(dst)
+
+	cancel := make(chan struct{})
+	close(cancel)
+	syncer.Register(newTestPeer("peer", src, syncer))
+	if err := syncer.Sync(root, cancel); err != errCancelled {
+		t.Fatalf("cancelled sync error mismatch: have %v, want %v", err, errCancelled)
+	}
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("failed to resume sync: %v", err)
+	}
+	healState(t, src, dst, root)
+	checkState(t, src, dst, root)
+}
+
+// Tests that bytecodes are verified against their hashes.
+func TestSyncByteCodes(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	code := []byte{0x60, 0x00}
+	hash := crypto.Keccak256Hash(code)
+	db.Put(hash[:], code)
+
+	res := serveByteCodes(db, &getByteCodesPacket{Hashes: []common.Hash{hash, {0x01}}, Bytes: softResponseLimit})
+	if len(res.Codes) != 1 || !bytes.Equal(res.Codes[0], code) {
+		t.Fatalf("served codes mismatch: have %x, want [%x]", res.Codes, code)
+	}
+}
@@ -17,6 +17,7 @@
 package ethdb
 
 import (
+	"os"
 	"path/filepath"
 
 	"strconv"
@@ -57,8 +58,9 @@ func SetHandleRatio(db string, ratio float64) {
 }
 
 type LDBDatabase struct {
-	file string
-	db   *leveldb.DB
+	file    string
+	db      *leveldb.DB
+	freezer *Freezer // Ancient chain data store, if any
 
 	quitLock sync.Mutex      // Mutex protecting the quit channel access
 	quitChan chan chan error // Quit channel to stop the metrics collection before closing the database
@@ -141,11 +143,58 @@ func NewBytesPrefix(prefix []byte) *ldbutil.Range {
 }
 
 func (self *LDBDatabase) Close() {
+	if self.freezer != nil {
+		if err := self.freezer.Close(); err != nil {
+			glog.Errorf("eth: DB %s freezer: %s", self.file, err)
+		}
+	}
 	if err := self.db.Close(); err != nil {
 		glog.Errorf("eth: DB %s: %s", self.file, err)
 	}
 }
 
+// OpenFreezer attaches the freezer in the given directory to the database, making
+// the ancient chain data it holds available through Ancient. Unless create is set,
+// nothing is done if the directory does not exist. Nothing is done either if a
+// freezer is already attached.
+func (db *LDBDatabase) OpenFreezer(dir string, create bool) error {
+	if db.freezer != nil {
+		return nil
+	}
+	if !create {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	freezer, err := NewFreezer(dir)
+	if err != nil {
+		return err
+	}
+	db.freezer = freezer
+	return nil
+}
+
+// Freezer returns the freezer attached to the database, or nil.
+func (db *LDBDatabase) Freezer() *Freezer {
+	return db.freezer
+}
+
+// Ancient implements AncientStore.
+func (db *LDBDatabase) Ancient(kind string, number uint64) ([]byte, error) {
+	if db.freezer == nil {
+		return nil, ErrAncientNotFound
+	}
+	return db.freezer.Ancient(kind, number)
+}
+
+// Ancients implements AncientStore.
+func (db *LDBDatabase) Ancients() uint64 {
+	if db.freezer == nil {
+		return 0
+	}
+	return db.freezer.Ancients()
+}
+
 func (self *LDBDatabase) LDB() *leveldb.DB {
 	return self.db
 }
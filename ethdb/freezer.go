@@ -0,0 +1,322 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Kinds of the ancient chain data kept in the freezer, one table each.
+const (
+	FreezerHashes   = "hashes"
+	FreezerBodies   = "bodies"
+	FreezerReceipts = "receipts"
+)
+
+var (
+	freezerKinds = []string{FreezerHashes, FreezerBodies, FreezerReceipts}
+
+	// ErrAncientNotFound is returned when the item requested is not in the freezer.
+	ErrAncientNotFound = errors.New("ancient item not found")
+
+	errOutOrderInsertion = errors.New("the append operation is out-order")
+	errUnknownKind       = errors.New("unknown ancient kind")
+)
+
+// AncientStore is implemented by databases able to hold ancient chain data,
+// ie. the hashes, bodies and receipts of old canonical blocks, indexed by block
+// number outside of the key-value store.
+type AncientStore interface {
+	// Ancient retrieves an ancient item of the given kind for a block number.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// Ancients returns the number of blocks in the store, the next block to
+	// be appended having that number.
+	Ancients() uint64
+}
+
+// Freezer is an append-only flat-file store for ancient chain data. Each kind of
+// data lives in its own table of a data file, holding the items back to back, and
+// an index file, holding the end offset of each item in the data file as a big
+// endian uint64.
+type Freezer struct {
+	lock   sync.RWMutex
+	tables map[string]*freezerTable
+	frozen uint64 // number of blocks in all tables
+}
+
+// NewFreezer opens the freezer in the given directory, creating it if needed.
+// Tables left inconsistent by a crash during an append are truncated to the
+// last block appended to all of them.
+func NewFreezer(dir string) (*Freezer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f := &Freezer{tables: make(map[string]*freezerTable)}
+	for i, kind := range freezerKinds {
+		table, err := openFreezerTable(dir, kind)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.tables[kind] = table
+		if i == 0 || table.items < f.frozen {
+			f.frozen = table.items
+		}
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(f.frozen); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Ancient retrieves an ancient item of the given kind for a block number.
+func (f *Freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	table := f.tables[kind]
+	if table == nil {
+		return nil, errUnknownKind
+	}
+	if number >= f.frozen {
+		return nil, ErrAncientNotFound
+	}
+	return table.retrieve(number)
+}
+
+// Ancients returns the number of blocks in the freezer.
+func (f *Freezer) Ancients() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.frozen
+}
+
+// AppendAncient appends the hash, body and receipts of the block with the given
+// number, which must be the next one.
+func (f *Freezer) AppendAncient(number uint64, hash, body, receipts []byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if number != f.frozen {
+		return errOutOrderInsertion
+	}
+	items := map[string][]byte{
+		FreezerHashes:   hash,
+		FreezerBodies:   body,
+		FreezerReceipts: receipts,
+	}
+	for _, kind := range freezerKinds {
+		if err := f.tables[kind].append(items[kind]); err != nil {
+			// leave all tables with the same number of items
+			for _, table := range f.tables {
+				table.truncate(f.frozen)
+			}
+			return err
+		}
+	}
+	f.frozen++
+	return nil
+}
+
+// TruncateAncients discards the blocks from the given number on, eg. when the
+// chain is rewound below the freezer.
+func (f *Freezer) TruncateAncients(items uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if items >= f.frozen {
+		return nil
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(items); err != nil {
+			return err
+		}
+	}
+	f.frozen = items
+	return nil
+}
+
+// Sync flushes the tables to disk.
+func (f *Freezer) Sync() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, table := range f.tables {
+		if err := table.sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes the tables.
+func (f *Freezer) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// freezerTable is a single kind of ancient data.
+type freezerTable struct {
+	index *os.File
+	data  *os.File
+	items uint64 // number of items in the table
+	size  uint64 // size of the data file up to the last item
+}
+
+func openFreezerTable(dir, kind string) (*freezerTable, error) {
+	index, err := os.OpenFile(filepath.Join(dir, kind+".ridx"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.OpenFile(filepath.Join(dir, kind+".rdat"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	t := &freezerTable{index: index, data: data}
+
+	stat, err := index.Stat()
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	// Drop a partially written index entry, and items whose data was not
+	// fully written.
+	t.items = uint64(stat.Size()) / 8
+	if stat, err = data.Stat(); err != nil {
+		t.close()
+		return nil, err
+	}
+	for t.items > 0 {
+		end, err := t.offset(t.items - 1)
+		if err != nil {
+			t.close()
+			return nil, err
+		}
+		if end <= uint64(stat.Size()) {
+			break
+		}
+		t.items--
+	}
+	if err := t.truncate(t.items); err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// offset returns the end offset of the given item in the data file.
+func (t *freezerTable) offset(item uint64) (uint64, error) {
+	buf := make([]byte, 8)
+	if _, err := t.index.ReadAt(buf, int64(item*8)); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+func (t *freezerTable) retrieve(item uint64) ([]byte, error) {
+	var start uint64
+	if item > 0 {
+		var err error
+		if start, err = t.offset(item - 1); err != nil {
+			return nil, err
+		}
+	}
+	end, err := t.offset(item)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, end-start)
+	if _, err := t.data.ReadAt(buf, int64(start)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (t *freezerTable) append(item []byte) error {
+	if _, err := t.data.WriteAt(item, int64(t.size)); err != nil {
+		return err
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, t.size+uint64(len(item)))
+	if _, err := t.index.WriteAt(buf, int64(t.items*8)); err != nil {
+		return err
+	}
+	t.size += uint64(len(item))
+	t.items++
+	return nil
+}
+
+// truncate discards the items from the given one on.
+func (t *freezerTable) truncate(items uint64) error {
+	var size uint64
+	if items > 0 {
+		var err error
+		if size, err = t.offset(items - 1); err != nil {
+			return err
+		}
+	}
+	if err := t.index.Truncate(int64(items * 8)); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(size)); err != nil {
+		return err
+	}
+	t.items, t.size = items, size
+	return nil
+}
+
+func (t *freezerTable) sync() error {
+	if err := t.data.Sync(); err != nil {
+		return err
+	}
+	return t.index.Sync()
+}
+
+func (t *freezerTable) close() error {
+	var errs []error
+	for _, f := range []*os.File{t.data, t.index} {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
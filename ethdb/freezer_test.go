@@ -0,0 +1,80 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFreezerRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 10; i++ {
+		item := bytes.Repeat([]byte{byte(i)}, int(i))
+		if err := f.AppendAncient(i, item, item, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.AppendAncient(20, nil, nil, nil); err != errOutOrderInsertion {
+		t.Fatalf("out of order append error mismatch: have %v, want %v", err, errOutOrderInsertion)
+	}
+	f.Close()
+
+	// Simulate a crash while appending the bodies of block 9.
+	if err := os.Truncate(filepath.Join(dir, FreezerBodies+".rdat"), 40); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = NewFreezer(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Ancients() != 9 {
+		t.Fatalf("repaired ancients mismatch: have %d, want %d", f.Ancients(), 9)
+	}
+	for i := uint64(0); i < 9; i++ {
+		for _, kind := range freezerKinds {
+			item, err := f.Ancient(kind, i)
+			if err != nil {
+				t.Fatalf("%s #%d: %v", kind, i, err)
+			}
+			if want := bytes.Repeat([]byte{byte(i)}, int(i)); !bytes.Equal(item, want) {
+				t.Fatalf("%s #%d mismatch: have %x, want %x", kind, i, item, want)
+			}
+		}
+	}
+	if _, err := f.Ancient(FreezerHashes, 9); err != ErrAncientNotFound {
+		t.Fatalf("dropped item error mismatch: have %v, want %v", err, ErrAncientNotFound)
+	}
+	if err := f.AppendAncient(9, []byte{9}, []byte{9}, []byte{9}); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := f.Ancient(FreezerReceipts, 9); !bytes.Equal(item, []byte{9}) {
+		t.Fatalf("appended item mismatch: have %x", item)
+	}
+}
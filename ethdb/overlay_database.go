@@ -0,0 +1,138 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ethereumproject/go-ethereum/common"
+)
+
+// overlayEntry is a write of an OverlayDatabase, a deletion if deleted is set.
+type overlayEntry struct {
+	value   []byte
+	deleted bool
+}
+
+// OverlayDatabase is a database reading through to another one and keeping its
+// own writes and deletions in memory, leaving the underlying database untouched.
+type OverlayDatabase struct {
+	base Database
+
+	lock   sync.RWMutex
+	writes map[string]overlayEntry
+	size   int // Total size of the values written
+}
+
+// NewOverlayDatabase returns an overlay on top of the given database.
+func NewOverlayDatabase(base Database) *OverlayDatabase {
+	return &OverlayDatabase{
+		base:   base,
+		writes: make(map[string]overlayEntry),
+	}
+}
+
+func (db *OverlayDatabase) Put(key []byte, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.writes[string(key)] = overlayEntry{value: common.CopyBytes(value)}
+	db.size += len(value)
+	return nil
+}
+
+func (db *OverlayDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	entry, ok := db.writes[string(key)]
+	db.lock.RUnlock()
+
+	if !ok {
+		return db.base.Get(key)
+	}
+	if entry.deleted {
+		return nil, errors.New("not found")
+	}
+	return entry.value, nil
+}
+
+func (db *OverlayDatabase) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	entry, ok := db.writes[string(key)]
+	db.lock.RUnlock()
+
+	if !ok {
+		return db.base.Has(key)
+	}
+	return !entry.deleted, nil
+}
+
+func (db *OverlayDatabase) Delete(key []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.writes[string(key)] = overlayEntry{deleted: true}
+	return nil
+}
+
+// Close drops the writes kept in memory. The underlying database is left open.
+func (db *OverlayDatabase) Close() {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.writes = make(map[string]overlayEntry)
+	db.size = 0
+}
+
+// Size returns the total size of the values written to the overlay.
+func (db *OverlayDatabase) Size() int {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.size
+}
+
+func (db *OverlayDatabase) NewBatch() Batch {
+	return &overlayBatch{db: db}
+}
+
+type overlayBatch struct {
+	db     *OverlayDatabase
+	writes []kv
+	size   int
+}
+
+func (b *overlayBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, kv{common.CopyBytes(key), common.CopyBytes(value)})
+	b.size += len(value)
+	return nil
+}
+
+func (b *overlayBatch) Write() error {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	for _, kv := range b.writes {
+		b.db.writes[string(kv.k)] = overlayEntry{value: kv.v}
+		b.db.size += len(kv.v)
+	}
+	return nil
+}
+
+func (b *overlayBatch) ValueSize() int {
+	return b.size
+}
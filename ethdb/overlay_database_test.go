@@ -0,0 +1,63 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Tests that the overlay database reads through to the underlying one and keeps
+// its writes and deletions to itself.
+func TestOverlayDatabase(t *testing.T) {
+	base, _ := NewMemDatabase()
+	base.Put([]byte("a"), []byte("base-a"))
+	base.Put([]byte("b"), []byte("base-b"))
+
+	db := NewOverlayDatabase(base)
+	db.Put([]byte("a"), []byte("overlay-a"))
+	db.Delete([]byte("b"))
+	batch := db.NewBatch()
+	batch.Put([]byte("c"), []byte("overlay-c"))
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{"a": "overlay-a", "c": "overlay-c"} {
+		if have, err := db.Get([]byte(key)); err != nil || !bytes.Equal(have, []byte(want)) {
+			t.Errorf("overlay %s mismatch: have %q (%v), want %q", key, have, err, want)
+		}
+	}
+	if _, err := db.Get([]byte("b")); err == nil {
+		t.Error("deleted key found in overlay")
+	}
+	if ok, _ := db.Has([]byte("b")); ok {
+		t.Error("deleted key reported by overlay")
+	}
+	// The underlying database is untouched
+	for key, want := range map[string]string{"a": "base-a", "b": "base-b"} {
+		if have, err := base.Get([]byte(key)); err != nil || !bytes.Equal(have, []byte(want)) {
+			t.Errorf("base %s mismatch: have %q (%v), want %q", key, have, err, want)
+		}
+	}
+	if ok, _ := base.Has([]byte("c")); ok {
+		t.Error("overlay write leaked to the base database")
+	}
+	if size := db.Size(); size != len("overlay-a")+len("overlay-c") {
+		t.Errorf("size mismatch: have %d, want %d", size, len("overlay-a")+len("overlay-c"))
+	}
+}
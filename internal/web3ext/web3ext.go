@@ -51,6 +51,14 @@ web3._extend({
 			call: 'admin_importChain',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'reloadChainConfig',
+			call: 'admin_reloadChainConfig'
+		}),
+		new web3._extend.Method({
+			name: 'peerScores',
+			call: 'admin_peerScores'
+		}),
 		new web3._extend.Method({
 			name: 'sleepBlocks',
 			call: 'admin_sleepBlocks',
@@ -167,6 +175,12 @@ web3._extend({
 			params: 8,
 			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputDefaultBlockNumberFormatter, null, null, null, null, null]
 		}),
+		new web3._extend.Method({
+			name: 'getInternalTransactionsByAddress',
+			call: 'geth_getInternalTransactionsByAddress',
+			params: 8,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputDefaultBlockNumberFormatter, null, null, null, null, null]
+		}),
 		new web3._extend.Method({
 			name: 'buildATXI',
 			call: 'geth_buildATXI',
@@ -234,12 +248,30 @@ web3._extend({
 		new web3._extend.Method({
 			name: 'traceTransaction',
 			call: 'debug_traceTransaction',
-			params: 1
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'traceBlockByNumber',
+			call: 'debug_traceBlockByNumber',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, null]
+		}),
+		new web3._extend.Method({
+			name: 'traceBlockByHash',
+			call: 'debug_traceBlockByHash',
+			params: 2,
+			inputFormatter: [null, null]
 		}),
 		new web3._extend.Method({
 			name: 'accountExist',
 			call: 'debug_accountExist',
 			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'vmDivergences',
+			call: 'debug_vmDivergences',
+			params: 0
 		})
 	],
 	properties: []
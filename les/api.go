@@ -0,0 +1,132 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/eth"
+	"github.com/ethereumproject/go-ethereum/light"
+	"github.com/ethereumproject/go-ethereum/rpc"
+)
+
+// PublicLightEthereumAPI provides the subset of the eth API a light client can
+// answer, retrieving block bodies and state on demand from light servers.
+type PublicLightEthereumAPI struct {
+	les *LightEthereum
+}
+
+// NewPublicLightEthereumAPI creates a new light Ethereum API.
+func NewPublicLightEthereumAPI(les *LightEthereum) *PublicLightEthereumAPI {
+	return &PublicLightEthereumAPI{les: les}
+}
+
+// headerByNumber returns the canonical header with the given number. The light
+// client has no pending block, so the latest header stands in for it.
+func (s *PublicLightEthereumAPI) headerByNumber(blockNr rpc.BlockNumber) *types.Header {
+	if blockNr == rpc.LatestBlockNumber || blockNr == rpc.PendingBlockNumber {
+		return s.les.lightchain.CurrentHeader()
+	}
+	return s.les.lightchain.GetHeaderByNumber(uint64(blockNr))
+}
+
+// BlockNumber returns the block number of the chain head.
+func (s *PublicLightEthereumAPI) BlockNumber() *big.Int {
+	return s.les.lightchain.CurrentHeader().Number
+}
+
+// GetBalance returns the amount of wei for the given address in the state of the
+// given block number.
+func (s *PublicLightEthereumAPI) GetBalance(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*big.Int, error) {
+	header := s.headerByNumber(blockNr)
+	if header == nil {
+		return nil, nil
+	}
+	account, err := light.GetAccount(ctx, s.les.odr, header, address)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return new(big.Int), nil
+	}
+	return account.Balance, nil
+}
+
+// GetTransactionCount returns the number of transactions the given address has
+// sent for the given block number.
+func (s *PublicLightEthereumAPI) GetTransactionCount(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*rpc.HexNumber, error) {
+	header := s.headerByNumber(blockNr)
+	if header == nil {
+		return nil, nil
+	}
+	account, err := light.GetAccount(ctx, s.les.odr, header, address)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return rpc.NewHexNumber(0), nil
+	}
+	return rpc.NewHexNumber(account.Nonce), nil
+}
+
+// GetStorageAt returns the storage from the state at the given address, key and
+// block number.
+func (s *PublicLightEthereumAPI) GetStorageAt(ctx context.Context, address common.Address, key string, blockNr rpc.BlockNumber) (string, error) {
+	header := s.headerByNumber(blockNr)
+	if header == nil {
+		return "0x", nil
+	}
+	value, err := light.GetStorage(ctx, s.les.odr, header, address, common.HexToHash(key))
+	if err != nil {
+		return "0x", err
+	}
+	return value.Hex(), nil
+}
+
+// GetBlockByNumber returns the requested block. When fullTx is true all
+// transactions in the block are returned in full detail, otherwise only the
+// transaction hash is returned.
+func (s *PublicLightEthereumAPI) GetBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	header := s.headerByNumber(blockNr)
+	if header == nil {
+		return nil, nil
+	}
+	return s.rpcOutputBlock(ctx, header.Hash(), fullTx)
+}
+
+// GetBlockByHash returns the requested block. When fullTx is true all
+// transactions in the block are returned in full detail, otherwise only the
+// transaction hash is returned.
+func (s *PublicLightEthereumAPI) GetBlockByHash(ctx context.Context, blockHash common.Hash, fullTx bool) (map[string]interface{}, error) {
+	if !s.les.lightchain.HasHeader(blockHash) {
+		return nil, nil
+	}
+	return s.rpcOutputBlock(ctx, blockHash, fullTx)
+}
+
+// rpcOutputBlock retrieves the block with the given hash and converts it to the
+// RPC output.
+func (s *PublicLightEthereumAPI) rpcOutputBlock(ctx context.Context, hash common.Hash, fullTx bool) (map[string]interface{}, error) {
+	block, err := s.les.lightchain.GetBlock(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return eth.RPCMarshalBlock(block, s.les.lightchain.GetTd(hash), s.les.chainConfig.GetChainID(), true, fullTx)
+}
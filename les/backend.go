@@ -0,0 +1,182 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereumproject/ethash"
+	"github.com/ethereumproject/go-ethereum/accounts"
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/eth"
+	"github.com/ethereumproject/go-ethereum/eth/downloader"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+	"github.com/ethereumproject/go-ethereum/light"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/node"
+	"github.com/ethereumproject/go-ethereum/p2p"
+	"github.com/ethereumproject/go-ethereum/pow"
+	"github.com/ethereumproject/go-ethereum/rpc"
+)
+
+// LightEthereum implements the Ethereum light client service. It keeps only a
+// header chain and retrieves everything else from light servers on demand.
+type LightEthereum struct {
+	config      *eth.Config
+	chainConfig *core.ChainConfig
+	// Channel for shutting down the service
+	shutdownChan chan bool
+
+	chainDb         ethdb.Database // Header chain and retrieved data database
+	odr             *LesOdr
+	lightchain      *light.LightChain
+	protocolManager *ProtocolManager
+	accountManager  *accounts.Manager
+	pow             pow.PoW
+	eventMux        *event.TypeMux
+
+	netVersionId  int
+	netRPCService *eth.PublicNetAPI
+}
+
+// New creates a light client service from the same configuration as the full
+// Ethereum service.
+func New(ctx *node.ServiceContext, config *eth.Config) (*LightEthereum, error) {
+	chainDb, err := ctx.OpenDatabase("lightchaindata", config.DatabaseCache, config.DatabaseHandles)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(logger.Info).Infof("Light Protocol Versions: %v, Network Id: %v", ProtocolVersions, config.NetworkId)
+
+	// Load up any custom genesis block if requested
+	if config.Genesis != nil {
+		if _, err := core.WriteGenesisBlock(chainDb, config.Genesis); err != nil {
+			return nil, err
+		}
+	}
+	// load the genesis block or write a new one if no genesis
+	// block is present in the database.
+	if core.GetBlock(chainDb, core.GetCanonicalHash(chainDb, 0)) == nil {
+		genesis, err := core.WriteGenesisBlock(chainDb, core.DefaultConfigMainnet.Genesis)
+		if err != nil {
+			return nil, err
+		}
+		glog.V(logger.Info).Infof("Successfully wrote default ethereum mainnet genesis block: %s", genesis.Hash().Hex())
+	}
+	if config.ChainConfig == nil {
+		return nil, errors.New("missing chain config")
+	}
+
+	les := &LightEthereum{
+		config:         config,
+		chainConfig:    config.ChainConfig,
+		shutdownChan:   make(chan bool),
+		chainDb:        chainDb,
+		accountManager: config.AccountManager,
+		eventMux:       ctx.EventMux,
+		netVersionId:   config.NetworkId,
+	}
+	if config.PowTest {
+		glog.V(logger.Info).Infof("Consensus: ethash used in test mode")
+		if les.pow, err = ethash.NewForTesting(); err != nil {
+			return nil, err
+		}
+	} else {
+		les.pow = ethash.New()
+	}
+
+	les.odr = NewLesOdr(chainDb)
+	if les.lightchain, err = light.NewLightChain(les.odr, les.chainConfig, les.pow, les.eventMux); err != nil {
+		if err == core.ErrNoGenesis {
+			return nil, fmt.Errorf(`No chain found. Please initialise a new chain using the "init" subcommand.`)
+		}
+		return nil, err
+	}
+	les.protocolManager = NewClientProtocolManager(les.chainConfig, uint64(config.NetworkId), les.eventMux, les.lightchain, les.odr)
+
+	return les, nil
+}
+
+// APIs returns the collection of RPC services the light client offers.
+func (s *LightEthereum) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "eth",
+			Version:   "1.0",
+			Service:   NewPublicLightEthereumAPI(s),
+			Public:    true,
+		}, {
+			Namespace: "eth",
+			Version:   "1.0",
+			Service:   eth.NewPublicAccountAPI(s.accountManager),
+			Public:    true,
+		}, {
+			Namespace: "eth",
+			Version:   "1.0",
+			Service:   downloader.NewPublicDownloaderAPI(s.protocolManager.downloader, s.eventMux),
+			Public:    true,
+		}, {
+			Namespace: "net",
+			Version:   "1.0",
+			Service:   s.netRPCService,
+			Public:    true,
+		},
+	}
+}
+
+func (s *LightEthereum) LightChain() *light.LightChain      { return s.lightchain }
+func (s *LightEthereum) Odr() light.OdrBackend              { return s.odr }
+func (s *LightEthereum) ChainDb() ethdb.Database            { return s.chainDb }
+func (s *LightEthereum) EventMux() *event.TypeMux           { return s.eventMux }
+func (s *LightEthereum) ChainConfig() *core.ChainConfig     { return s.chainConfig }
+func (s *LightEthereum) Downloader() *downloader.Downloader { return s.protocolManager.downloader }
+
+// Protocols implements node.Service, returning all the currently configured
+// network protocols to start.
+func (s *LightEthereum) Protocols() []p2p.Protocol {
+	return s.protocolManager.SubProtocols
+}
+
+// Start implements node.Service, starting all internal goroutines needed by the
+// light client.
+func (s *LightEthereum) Start(srvr *p2p.Server) error {
+	s.protocolManager.Start(s.config.MaxPeers)
+	s.netRPCService = eth.NewPublicNetAPI(srvr, s.netVersionId)
+	return nil
+}
+
+// Stop implements node.Service, terminating all internal goroutines used by the
+// light client.
+func (s *LightEthereum) Stop() error {
+	s.odr.Stop()
+	s.lightchain.Stop()
+	s.protocolManager.Stop()
+	s.eventMux.Stop()
+
+	s.chainDb.Close()
+	close(s.shutdownChan)
+
+	return nil
+}
+
+// This function will wait for a shutdown and resumes main thread execution
+func (s *LightEthereum) WaitForShutdown() {
+	<-s.shutdownChan
+}
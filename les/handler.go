@@ -0,0 +1,568 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/eth/downloader"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+	"github.com/ethereumproject/go-ethereum/light"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/p2p"
+	"github.com/ethereumproject/go-ethereum/p2p/discover"
+)
+
+const (
+	// ethVersion is the eth protocol version whose header retrieval semantics the
+	// les header requests match. Light peers are registered with the downloader
+	// under this version.
+	ethVersion = 63
+
+	softResponseLimit = 2 * 1024 * 1024 // Target maximum size of returned headers
+	estHeaderRlpSize  = 500             // Approximate size of an RLP encoded block header
+)
+
+// ProtocolManager manages the peers of the light protocol. It runs either as a
+// server, answering requests from a full blockchain, or as a client, syncing a
+// header chain and retrieving everything else on demand.
+type ProtocolManager struct {
+	reqID uint64 // Last request ID issued, accessed atomically
+
+	networkId   uint64
+	chainConfig *core.ChainConfig
+	chainDb     ethdb.Database
+	serve       bool // Whether this end serves light clients
+	maxPeers    int
+
+	blockchain *core.BlockChain  // Full chain served to light clients (server only)
+	lightchain *light.LightChain // Header chain synced from servers (client only)
+	odr        *LesOdr           // On-demand retrieval backend (client only)
+	downloader *downloader.Downloader
+
+	peers *peerSet
+
+	SubProtocols []p2p.Protocol
+
+	eventMux     *event.TypeMux
+	chainHeadSub event.Subscription
+
+	newPeerCh   chan *peer
+	quitSync    chan struct{}
+	noMorePeers chan struct{}
+
+	// wait group is used for graceful shutdowns during downloading
+	// and processing
+	wg sync.WaitGroup
+}
+
+// NewServerProtocolManager returns a protocol manager serving light clients from
+// the given full blockchain.
+func NewServerProtocolManager(config *core.ChainConfig, networkId uint64, mux *event.TypeMux, blockchain *core.BlockChain, chainDb ethdb.Database) *ProtocolManager {
+	manager := newProtocolManager(config, networkId, mux, chainDb)
+	manager.serve = true
+	manager.blockchain = blockchain
+	return manager
+}
+
+// NewClientProtocolManager returns a protocol manager syncing the given light
+// chain from light servers and retrieving other data on demand through odr.
+func NewClientProtocolManager(config *core.ChainConfig, networkId uint64, mux *event.TypeMux, lightchain *light.LightChain, odr *LesOdr) *ProtocolManager {
+	manager := newProtocolManager(config, networkId, mux, odr.Database())
+	manager.lightchain = lightchain
+	manager.odr = odr
+	odr.pm = manager
+
+	manager.downloader = downloader.New(downloader.LightSync, nil, manager.chainDb, manager.eventMux, nil, lightchain, manager.removePeer, nil)
+	return manager
+}
+
+func newProtocolManager(config *core.ChainConfig, networkId uint64, mux *event.TypeMux, chainDb ethdb.Database) *ProtocolManager {
+	manager := &ProtocolManager{
+		networkId:   networkId,
+		chainConfig: config,
+		chainDb:     chainDb,
+		eventMux:    mux,
+		peers:       newPeerSet(),
+		newPeerCh:   make(chan *peer),
+		quitSync:    make(chan struct{}),
+		noMorePeers: make(chan struct{}),
+	}
+	// Initiate a sub-protocol for every implemented version we can handle
+	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		version := version // Closure for the run
+		manager.SubProtocols = append(manager.SubProtocols, p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  ProtocolLengths[i],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				peer := newPeer(int(version), p, rw)
+				select {
+				case manager.newPeerCh <- peer:
+					manager.wg.Add(1)
+					defer manager.wg.Done()
+					return manager.handle(peer)
+				case <-manager.quitSync:
+					return p2p.DiscQuitting
+				}
+			},
+			NodeInfo: func() interface{} {
+				return manager.NodeInfo()
+			},
+			PeerInfo: func(id discover.NodeID) interface{} {
+				if p := manager.peers.Peer(fmt.Sprintf("%x", id[:8])); p != nil {
+					return p.Info()
+				}
+				return nil
+			},
+		})
+	}
+	return manager
+}
+
+// getNextReqID returns a fresh ID to match a request with its response.
+func (pm *ProtocolManager) getNextReqID() uint64 {
+	return atomic.AddUint64(&pm.reqID, 1)
+}
+
+func (pm *ProtocolManager) removePeer(id string) {
+	// Short circuit if the peer was already removed
+	peer := pm.peers.Peer(id)
+	if peer == nil {
+		return
+	}
+	glog.V(logger.Debug).Infoln("Removing light peer", id)
+
+	// Unregister the peer from the downloader and the light peer set
+	if pm.downloader != nil {
+		pm.downloader.UnregisterPeer(id)
+	}
+	if err := pm.peers.Unregister(id); err != nil {
+		glog.V(logger.Error).Infoln("Removal failed:", err)
+	}
+	// Hard disconnect at the networking layer
+	peer.Peer.Disconnect(p2p.DiscUselessPeer)
+}
+
+func (pm *ProtocolManager) Start(maxPeers int) {
+	pm.maxPeers = maxPeers
+
+	if pm.serve {
+		// announce new heads to the light clients
+		pm.chainHeadSub = pm.eventMux.Subscribe(core.ChainHeadEvent{})
+		go pm.announceLoop()
+		go pm.acceptLoop()
+	} else {
+		// start sync handler
+		go pm.syncer()
+	}
+}
+
+func (pm *ProtocolManager) Stop() {
+	glog.V(logger.Info).Infoln("Stopping light protocol handler...")
+
+	if pm.chainHeadSub != nil {
+		pm.chainHeadSub.Unsubscribe() // quits announceLoop
+	}
+	// Quit the sync or accept loop.
+	// After this send has completed, no new peers will be accepted.
+	pm.noMorePeers <- struct{}{}
+
+	close(pm.quitSync)
+
+	// Disconnect existing sessions.
+	// This also closes the gate for any new registrations on the peer set.
+	pm.peers.Close()
+
+	// Wait for all peer handler goroutines and the loops to come down.
+	pm.wg.Wait()
+
+	glog.V(logger.Info).Infoln("Light protocol handler stopped")
+}
+
+// acceptLoop admits new peers on a server, which has nothing to sync from them.
+func (pm *ProtocolManager) acceptLoop() {
+	for {
+		select {
+		case <-pm.newPeerCh:
+		case <-pm.noMorePeers:
+			return
+		}
+	}
+}
+
+// announceLoop announces every new head of the served chain to the connected
+// light clients.
+func (pm *ProtocolManager) announceLoop() {
+	// automatically stops if unsubscribe
+	for obj := range pm.chainHeadSub.Chan() {
+		if ev, ok := obj.Data.(core.ChainHeadEvent); ok {
+			pm.announce(ev.Block)
+		}
+	}
+}
+
+// announce queues the announcement of a new head block to all peers.
+func (pm *ProtocolManager) announce(block *types.Block) {
+	td := pm.blockchain.GetTd(block.Hash())
+	if td == nil {
+		return
+	}
+	ann := &announceData{Hash: block.Hash(), Number: block.NumberU64(), TD: td}
+	for _, p := range pm.peers.AllPeers() {
+		p.AsyncSendAnnounce(ann)
+	}
+}
+
+// status returns the local chain status sent in the handshake.
+func (pm *ProtocolManager) status() (td *big.Int, head common.Hash, headNum uint64, genesis common.Hash) {
+	if pm.serve {
+		td, head, genesis = pm.blockchain.Status()
+		headNum = pm.blockchain.GetHeader(head).Number.Uint64()
+	} else {
+		td, head, genesis = pm.lightchain.Status()
+		headNum = pm.lightchain.GetHeader(head).Number.Uint64()
+	}
+	return td, head, headNum, genesis
+}
+
+// handle is the callback invoked to manage the life cycle of a les peer. When
+// this function terminates, the peer is disconnected.
+func (pm *ProtocolManager) handle(p *peer) error {
+	// Ignore maxPeers if this is a trusted peer
+	if l := pm.peers.Len(); l >= pm.maxPeers && !p.Peer.Info().Network.Trusted {
+		return p2p.DiscTooManyPeers
+	}
+	glog.V(logger.Debug).Infof("handler: %s ->connected", p)
+
+	// Execute the light protocol handshake
+	td, head, headNum, genesis := pm.status()
+	if err := p.Handshake(pm.networkId, td, head, headNum, genesis, pm.serve); err != nil {
+		glog.V(logger.Debug).Infof("handler: %s ->handshakefailed err=%v", p, err)
+		return err
+	}
+	// Servers talk to clients and clients to servers, anything else is useless
+	if p.serve == pm.serve {
+		return errResp(ErrUselessPeer, "serve %v (== %v)", p.serve, pm.serve)
+	}
+	// Register the peer locally
+	if err := pm.peers.Register(p); err != nil {
+		glog.V(logger.Error).Errorf("handler: %s ->addpeer err=%v", p, err)
+		return err
+	}
+	defer pm.removePeer(p.id)
+
+	// Register the server in the downloader. If the downloader considers it banned, we disconnect
+	if pm.downloader != nil {
+		requestHeadersByHash := func(origin common.Hash, amount int, skip int, reverse bool) error {
+			return p.RequestHeadersByHash(pm.getNextReqID(), origin, amount, skip, reverse)
+		}
+		requestHeadersByNumber := func(origin uint64, amount int, skip int, reverse bool) error {
+			return p.RequestHeadersByNumber(pm.getNextReqID(), origin, amount, skip, reverse)
+		}
+		if err := pm.downloader.RegisterPeer(p.id, ethVersion, p.Name(), p.Head,
+			requestHeadersByHash, requestHeadersByNumber, nil, nil, nil); err != nil {
+			return err
+		}
+	}
+	// main loop. handle incoming messages.
+	for {
+		if err := pm.handleMsg(p); err != nil {
+			glog.V(logger.Debug).Infof("handler: %s ->msghandlefailed err=%v", p, err)
+			return err
+		}
+	}
+}
+
+// handleMsg is invoked whenever an inbound message is received from a remote
+// peer. The remote connection is torn down upon returning any error.
+func (pm *ProtocolManager) handleMsg(p *peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	// Handle the message depending on its contents
+	switch {
+	case msg.Code == StatusMsg:
+		// Status messages should never arrive after the handshake
+		return errResp(ErrExtraStatusMsg, "uncontrolled status message")
+
+	// Block header query, collect the requested headers and reply
+	case pm.serve && msg.Code == GetBlockHeadersMsg:
+		var req getBlockHeadersPacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		query := req.Query
+		hashMode := query.Origin.Hash != (common.Hash{})
+
+		// Gather headers until the fetch or network limits is reached
+		var (
+			bytes   common.StorageSize
+			headers []*types.Header
+			unknown bool
+		)
+		for !unknown && len(headers) < int(query.Amount) && bytes < softResponseLimit && len(headers) < MaxHeaderFetch {
+			// Retrieve the next header satisfying the query
+			var origin *types.Header
+			if hashMode {
+				origin = pm.blockchain.GetHeader(query.Origin.Hash)
+			} else {
+				origin = pm.blockchain.GetHeaderByNumber(query.Origin.Number)
+			}
+			if origin == nil {
+				break
+			}
+			headers = append(headers, origin)
+			bytes += estHeaderRlpSize
+
+			// Advance to the next header of the query
+			switch {
+			case hashMode && query.Reverse:
+				// Hash based traversal towards the genesis block
+				for i := 0; i < int(query.Skip)+1; i++ {
+					if header := pm.blockchain.GetHeader(query.Origin.Hash); header != nil {
+						query.Origin.Hash = header.ParentHash
+					} else {
+						unknown = true
+						break
+					}
+				}
+			case hashMode && !query.Reverse:
+				// Hash based traversal towards the leaf block
+				var (
+					current = origin.Number.Uint64()
+					next    = current + query.Skip + 1
+				)
+				if next <= current {
+					glog.V(logger.Warn).Infof("%v: GetBlockHeaders skip overflow attack (current %v, skip %v, next %v)", p, current, query.Skip, next)
+					unknown = true
+				} else {
+					if header := pm.blockchain.GetHeaderByNumber(next); header != nil {
+						if pm.blockchain.GetBlockHashesFromHash(header.Hash(), query.Skip+1)[query.Skip] == query.Origin.Hash {
+							query.Origin.Hash = header.Hash()
+						} else {
+							unknown = true
+						}
+					} else {
+						unknown = true
+					}
+				}
+			case query.Reverse:
+				// Number based traversal towards the genesis block
+				if query.Origin.Number >= query.Skip+1 {
+					query.Origin.Number -= (query.Skip + 1)
+				} else {
+					unknown = true
+				}
+
+			case !query.Reverse:
+				// Number based traversal towards the leaf block
+				query.Origin.Number += (query.Skip + 1)
+			}
+		}
+		return p.SendBlockHeaders(req.ReqID, headers)
+
+	case pm.serve && msg.Code == GetBlockBodiesMsg:
+		var req getByHashPacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		// Gather bodies until the fetch limit is reached
+		var bodies []*types.Body
+		for _, hash := range req.Hashes {
+			if len(bodies) >= MaxBodyFetch {
+				break
+			}
+			if body := pm.blockchain.GetBody(hash); body != nil {
+				bodies = append(bodies, body)
+			}
+		}
+		return p.SendBlockBodies(req.ReqID, bodies)
+
+	case pm.serve && msg.Code == GetReceiptsMsg:
+		var req getByHashPacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		// Gather receipts until the fetch limit is reached
+		var receipts []types.Receipts
+		for _, hash := range req.Hashes {
+			if len(receipts) >= MaxReceiptFetch {
+				break
+			}
+			// Retrieve the requested block's receipts, skipping if unknown to us
+			results := core.GetBlockReceipts(pm.chainDb, hash)
+			if results == nil {
+				if header := pm.blockchain.GetHeader(hash); header == nil || header.ReceiptHash != types.EmptyRootHash {
+					continue
+				}
+			}
+			receipts = append(receipts, results)
+		}
+		return p.SendReceipts(req.ReqID, receipts)
+
+	case pm.serve && msg.Code == GetProofsMsg:
+		var req getProofsPacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		// Gather proofs until the fetch limit or the flow control buffer of the
+		// peer is reached. An entry that cannot be proven gets an empty proof,
+		// keeping the replies in request order.
+		reqs := req.Reqs
+		if len(reqs) > MaxProofsFetch {
+			reqs = reqs[:MaxProofsFetch]
+		}
+		reqs = reqs[:p.acquireProofs(len(reqs))]
+
+		var (
+			proofs [][][]byte
+			states = make(map[common.Hash]*state.StateDB)
+		)
+		for _, r := range reqs {
+			proofs = append(proofs, pm.getProof(r, states))
+		}
+		return p.SendProofs(req.ReqID, proofs)
+
+	case !pm.serve && msg.Code == AnnounceMsg:
+		var ann announceData
+		if err := msg.Decode(&ann); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		if ann.TD == nil {
+			return errResp(ErrDecode, "%v: missing total difficulty", msg)
+		}
+		p.SetHead(ann.Hash, ann.Number, ann.TD)
+
+		// Sync right away if the announced head is ahead of our own
+		head := pm.lightchain.CurrentHeader()
+		if td := pm.lightchain.GetTd(head.Hash()); td != nil && ann.TD.Cmp(td) > 0 {
+			go pm.synchronise(p)
+		}
+
+	case !pm.serve && msg.Code == BlockHeadersMsg:
+		// A batch of headers arrived to one of our previous requests
+		var resp blockHeadersPacket
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if err := pm.downloader.DeliverHeaders(p.id, resp.Headers); err != nil {
+			glog.V(logger.Debug).Infoln("peer", p.id, err)
+		}
+
+	case !pm.serve && msg.Code == BlockBodiesMsg:
+		var resp blockBodiesPacket
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		pm.deliver(p, &Msg{MsgType: msg.Code, ReqID: resp.ReqID, Obj: resp.Bodies})
+
+	case !pm.serve && msg.Code == ReceiptsMsg:
+		var resp receiptsPacket
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		pm.deliver(p, &Msg{MsgType: msg.Code, ReqID: resp.ReqID, Obj: resp.Receipts})
+
+	case !pm.serve && msg.Code == ProofsMsg:
+		var resp proofsPacket
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		pm.deliver(p, &Msg{MsgType: msg.Code, ReqID: resp.ReqID, Obj: resp.Proofs})
+
+	default:
+		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
+	}
+	return nil
+}
+
+// getProof returns the Merkle proof of the state or storage trie entry r asks
+// for, or nil if the block or its state is not available. The states opened
+// are cached in states by block hash, for the entries of the same request.
+func (pm *ProtocolManager) getProof(r proofReq, states map[common.Hash]*state.StateDB) [][]byte {
+	statedb, ok := states[r.BHash]
+	if !ok {
+		if header := pm.blockchain.GetHeader(r.BHash); header != nil {
+			statedb, _ = pm.blockchain.StateAt(header.Root)
+		}
+		states[r.BHash] = statedb
+	}
+	if statedb == nil {
+		return nil
+	}
+	var (
+		proof [][]byte
+		err   error
+	)
+	if len(r.AccKey) == 0 {
+		proof, err = statedb.GetProof(common.BytesToAddress(r.Key))
+	} else {
+		proof, err = statedb.GetStorageProof(common.BytesToAddress(r.AccKey), common.BytesToHash(r.Key))
+	}
+	if err != nil {
+		return nil
+	}
+	return proof
+}
+
+// deliver hands a response to the on-demand retrieval waiting for it. Late or
+// unsolicited responses are dropped.
+func (pm *ProtocolManager) deliver(p *peer, msg *Msg) {
+	if err := pm.odr.Deliver(p, msg); err != nil {
+		glog.V(logger.Debug).Infoln("peer", p.id, err)
+	}
+}
+
+// LesNodeInfo represents a short summary of the light sub-protocol metadata
+// known about the host peer.
+type LesNodeInfo struct {
+	Network    int         `json:"network"`    // Ethereum network ID (1=Mainnet, 2=Morden)
+	Difficulty *big.Int    `json:"difficulty"` // Total difficulty of the host's blockchain
+	Genesis    common.Hash `json:"genesis"`    // SHA3 hash of the host's genesis block
+	Head       common.Hash `json:"head"`       // SHA3 hash of the host's best owned block
+	Serve      bool        `json:"serve"`      // Whether the host serves light clients
+}
+
+// NodeInfo retrieves some protocol metadata about the running host node.
+func (pm *ProtocolManager) NodeInfo() *LesNodeInfo {
+	td, head, _, genesis := pm.status()
+	return &LesNodeInfo{
+		Network:    int(pm.networkId),
+		Difficulty: td,
+		Genesis:    genesis,
+		Head:       head,
+		Serve:      pm.serve,
+	}
+}
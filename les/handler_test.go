@@ -0,0 +1,216 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/light"
+	"github.com/ethereumproject/go-ethereum/p2p"
+	"github.com/ethereumproject/go-ethereum/p2p/discover"
+)
+
+// Tests that a light client syncs the header chain of a light server.
+func TestHeaderSync(t *testing.T) {
+	server, client, blockchain := newSyncedTestClient(t, 8)
+	defer server.Stop()
+	defer client.Stop()
+
+	for i := uint64(0); i <= blockchain.CurrentBlock().NumberU64(); i++ {
+		if have, want := client.lightchain.GetHeaderByNumber(i).Hash(), blockchain.GetBlockByNumber(i).Hash(); have != want {
+			t.Errorf("header #%d mismatch: have %x, want %x", i, have, want)
+		}
+	}
+}
+
+// Tests that two light servers or two light clients refuse each other.
+func TestUselessPeer(t *testing.T) {
+	server1, _ := newTestServer(t, 0)
+	server2, _ := newTestServer(t, 0)
+
+	for i, pms := range [][2]*ProtocolManager{
+		{server1, server2},
+		{newTestClient(t), newTestClient(t)},
+	} {
+		var id1, id2 discover.NodeID
+		rand.Read(id1[:])
+		rand.Read(id2[:])
+
+		rw1, rw2 := p2p.MsgPipe()
+		errc1 := newTestPeer(pms[0], id2, rw1)
+		newTestPeer(pms[1], id1, rw2)
+
+		select {
+		case err := <-errc1:
+			if err == nil {
+				t.Errorf("test %d: peer accepted", i)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("test %d: useless peer not dropped", i)
+		}
+		pms[0].Stop()
+		pms[1].Stop()
+	}
+}
+
+// Tests that block bodies and receipts are retrieved on demand and verified
+// against the synced headers.
+func TestOdrGetBlockAndReceipts(t *testing.T) {
+	server, client, blockchain := newSyncedTestClient(t, 8)
+	defer server.Stop()
+	defer client.Stop()
+
+	for i := uint64(0); i <= blockchain.CurrentBlock().NumberU64(); i++ {
+		want := blockchain.GetBlockByNumber(i)
+
+		block, err := light.GetBlock(light.NoOdr, client.odr, want.Hash())
+		if err != nil {
+			t.Fatalf("block #%d: retrieval failed: %v", i, err)
+		}
+		if block.Hash() != want.Hash() || len(block.Transactions()) != len(want.Transactions()) || len(block.Uncles()) != len(want.Uncles()) {
+			t.Errorf("block #%d: content mismatch", i)
+		}
+		receipts, err := light.GetBlockReceipts(light.NoOdr, client.odr, want.Hash())
+		if err != nil {
+			t.Fatalf("block #%d: receipt retrieval failed: %v", i, err)
+		}
+		if have := types.DeriveSha(receipts); have != want.ReceiptHash() {
+			t.Errorf("block #%d: receipt root mismatch: have %x, want %x", i, have, want.ReceiptHash())
+		}
+	}
+}
+
+// Tests that accounts and storage slots are retrieved on demand with proofs
+// against the state root of the synced headers.
+func TestOdrGetAccountAndStorage(t *testing.T) {
+	server, client, blockchain := newSyncedTestClient(t, 4)
+	defer server.Stop()
+	defer client.Stop()
+
+	head := client.lightchain.CurrentHeader()
+	statedb, _ := blockchain.State()
+
+	for _, addr := range []common.Address{testBank.Address, acc1Addr, testContractAddr, {0xff}} {
+		account, err := light.GetAccount(light.NoOdr, client.odr, head, addr)
+		if err != nil {
+			t.Fatalf("account %x: retrieval failed: %v", addr, err)
+		}
+		if !statedb.Exist(addr) {
+			if account != nil {
+				t.Errorf("account %x: have %v, want none", addr, account)
+			}
+			continue
+		}
+		if account == nil {
+			t.Fatalf("account %x: missing", addr)
+		}
+		if account.Balance.Cmp(statedb.GetBalance(addr)) != 0 || account.Nonce != statedb.GetNonce(addr) {
+			t.Errorf("account %x: have balance %v nonce %d, want balance %v nonce %d", addr, account.Balance, account.Nonce, statedb.GetBalance(addr), statedb.GetNonce(addr))
+		}
+	}
+	value, err := light.GetStorage(light.NoOdr, client.odr, head, testContractAddr, common.Hash{})
+	if err != nil {
+		t.Fatalf("storage retrieval failed: %v", err)
+	}
+	if want := common.BigToHash(big.NewInt(42)); value != want {
+		t.Errorf("storage mismatch: have %x, want %x", value, want)
+	}
+}
+
+// Tests that bodies not matching the header they were requested for are
+// rejected.
+func TestBlockRequestValidation(t *testing.T) {
+	server, client, blockchain := newSyncedTestClient(t, 4)
+	defer server.Stop()
+	defer client.Stop()
+
+	block1, block2 := blockchain.GetBlockByNumber(1), blockchain.GetBlockByNumber(2)
+	req := &BlockRequest{Hash: block1.Hash()}
+
+	msg := &Msg{MsgType: BlockBodiesMsg, Obj: []*types.Body{{Transactions: block2.Transactions(), Uncles: block2.Uncles()}}}
+	if err := req.Validate(client.chainDb, msg); err != errTxHashMismatch {
+		t.Errorf("foreign body: have error %v, want %v", err, errTxHashMismatch)
+	}
+	msg = &Msg{MsgType: BlockBodiesMsg, Obj: []*types.Body{}}
+	if err := req.Validate(client.chainDb, msg); err != errEmptyResponse {
+		t.Errorf("empty response: have error %v, want %v", err, errEmptyResponse)
+	}
+	msg = &Msg{MsgType: BlockBodiesMsg, Obj: []*types.Body{{Transactions: block1.Transactions(), Uncles: block1.Uncles()}}}
+	if err := req.Validate(client.chainDb, msg); err != nil {
+		t.Errorf("valid body rejected: %v", err)
+	}
+	if req.Body == nil || len(req.Body.Transactions) != 1 {
+		t.Errorf("body not set on valid response")
+	}
+}
+
+// Tests that light servers limit the proofs served to a peer flooding them with
+// requests to the flow control buffer of the peer.
+func TestProofsFlowControl(t *testing.T) {
+	server, blockchain := newTestServer(t, 4)
+	defer server.Stop()
+
+	var id1, id2 discover.NodeID
+	rand.Read(id1[:])
+	rand.Read(id2[:])
+
+	rw1, rw2 := p2p.MsgPipe()
+	defer rw2.Close()
+	newTestPeer(server, id2, rw1)
+
+	p := newPeer(lpv1, p2p.NewPeer(id1, "test", nil), rw2)
+	td, head, headNum, genesis := server.status()
+	if err := p.Handshake(testNetworkId, td, head, headNum, genesis, false); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	reqs := make([]proofReq, MaxProofsFetch)
+	for i := range reqs {
+		reqs[i] = proofReq{BHash: blockchain.CurrentBlock().Hash(), Key: testBank.Address[:]}
+	}
+	served := 0
+	for i := 0; i < proofsBufLimit/MaxProofsFetch+2; i++ {
+		if err := p.RequestProofs(uint64(i), reqs); err != nil {
+			t.Fatalf("request %d: failed to send: %v", i, err)
+		}
+		msg, err := rw2.ReadMsg()
+		if err != nil {
+			t.Fatalf("request %d: failed to read reply: %v", i, err)
+		}
+		if msg.Code != ProofsMsg {
+			t.Fatalf("request %d: reply code mismatch: have %d, want %d", i, msg.Code, ProofsMsg)
+		}
+		var resp proofsPacket
+		if err := msg.Decode(&resp); err != nil {
+			t.Fatalf("request %d: failed to decode reply: %v", i, err)
+		}
+		for j, proof := range resp.Proofs {
+			if len(proof) == 0 {
+				t.Fatalf("request %d: proof %d missing", i, j)
+			}
+		}
+		served += len(resp.Proofs)
+	}
+	// Allow for the buffer recharging for a second while the requests are served
+	if served < proofsBufLimit || served > proofsBufLimit+proofsRecharge {
+		t.Errorf("served proofs mismatch: have %d, want %d", served, proofsBufLimit)
+	}
+}
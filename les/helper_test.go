@@ -0,0 +1,169 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// This file contains some shares testing functionality, common to multiple
+// different files and modules being tested.
+
+package les
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+	"github.com/ethereumproject/go-ethereum/light"
+	"github.com/ethereumproject/go-ethereum/p2p"
+	"github.com/ethereumproject/go-ethereum/p2p/discover"
+)
+
+const testNetworkId = 1
+
+var (
+	testBankKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testBank       = core.GenesisAccount{
+		Address: crypto.PubkeyToAddress(testBankKey.PublicKey),
+		Balance: big.NewInt(1000000),
+	}
+
+	acc1Key, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	acc1Addr   = crypto.PubkeyToAddress(acc1Key.PublicKey)
+
+	// testContractCode stores 42 in slot 0 and deploys no code.
+	testContractCode = common.Hex2Bytes("602a600055")
+	testContractAddr = crypto.CreateAddress(testBank.Address, 1)
+
+	testChainConfig = core.DefaultConfigMorden.ChainConfig
+)
+
+// testChainGen fills the test chain with a value transfer, a contract storing
+// a value and an empty block with an uncle.
+func testChainGen(i int, block *core.BlockGen) {
+	switch i {
+	case 0:
+		tx, _ := types.NewTransaction(block.TxNonce(testBank.Address), acc1Addr, big.NewInt(10000), core.TxGas, nil, nil).SignECDSA(testBankKey)
+		block.AddTx(tx)
+	case 1:
+		tx, _ := types.NewContractCreation(block.TxNonce(testBank.Address), new(big.Int), big.NewInt(100000), new(big.Int), testContractCode).SignECDSA(testBankKey)
+		block.AddTx(tx)
+	case 3:
+		uncle := block.PrevBlock(1).Header()
+		uncle.Extra = []byte("foo")
+		block.AddUncle(uncle)
+	}
+}
+
+// newTestServer creates a light server protocol manager on top of a full chain
+// of the given number of blocks.
+func newTestServer(t *testing.T, blocks int) (*ProtocolManager, *core.BlockChain) {
+	var (
+		evmux         = new(event.TypeMux)
+		db, _         = ethdb.NewMemDatabase()
+		genesis       = core.WriteGenesisBlockForTesting(db, testBank)
+		blockchain, _ = core.NewBlockChain(db, testChainConfig, new(core.FakePow), evmux)
+	)
+	chain, _ := core.GenerateChain(testChainConfig, genesis, db, blocks, testChainGen)
+	if res := blockchain.InsertChain(chain); res.Error != nil {
+		t.Fatalf("failed to insert test chain: %v", res.Error)
+	}
+	pm := NewServerProtocolManager(testChainConfig, testNetworkId, evmux, blockchain, db)
+	pm.Start(1000)
+	return pm, blockchain
+}
+
+// newTestClient creates a light client protocol manager with an empty header
+// chain sharing the genesis of the test server.
+func newTestClient(t *testing.T) *ProtocolManager {
+	var (
+		evmux = new(event.TypeMux)
+		db, _ = ethdb.NewMemDatabase()
+		odr   = NewLesOdr(db)
+	)
+	core.WriteGenesisBlockForTesting(db, testBank)
+	lightchain, err := light.NewLightChain(odr, testChainConfig, new(core.FakePow), evmux)
+	if err != nil {
+		t.Fatalf("failed to create light chain: %v", err)
+	}
+	pm := NewClientProtocolManager(testChainConfig, testNetworkId, evmux, lightchain, odr)
+	pm.Start(1000)
+	return pm
+}
+
+// newTestPeer runs a new peer on pm over the given end of a message pipe.
+func newTestPeer(pm *ProtocolManager, id discover.NodeID, rw p2p.MsgReadWriter) <-chan error {
+	p := newPeer(lpv1, p2p.NewPeer(id, "test", nil), rw)
+
+	errc := make(chan error, 1)
+	go func() {
+		select {
+		case pm.newPeerCh <- p:
+			errc <- pm.handle(p)
+		case <-pm.quitSync:
+			errc <- p2p.DiscQuitting
+		}
+	}()
+	return errc
+}
+
+// connect links two protocol managers through a message pipe and waits until
+// both registered the other end, failing if either side rejects the link.
+func connect(t *testing.T, pm1, pm2 *ProtocolManager) {
+	var id1, id2 discover.NodeID
+	rand.Read(id1[:])
+	rand.Read(id2[:])
+
+	rw1, rw2 := p2p.MsgPipe()
+	errc1 := newTestPeer(pm1, id2, rw1)
+	errc2 := newTestPeer(pm2, id1, rw2)
+
+	deadline := time.After(time.Second)
+	for pm1.peers.Len() == 0 || pm2.peers.Len() == 0 {
+		select {
+		case err := <-errc1:
+			t.Fatalf("first end dropped the link: %v", err)
+		case err := <-errc2:
+			t.Fatalf("second end dropped the link: %v", err)
+		case <-deadline:
+			t.Fatalf("link not established in time")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// newSyncedTestClient connects a fresh light client to a light server with the
+// given number of blocks and syncs its header chain.
+func newSyncedTestClient(t *testing.T, blocks int) (server *ProtocolManager, client *ProtocolManager, blockchain *core.BlockChain) {
+	server, blockchain = newTestServer(t, blocks)
+	client = newTestClient(t)
+	connect(t, server, client)
+
+	head := blockchain.CurrentBlock().Hash()
+	deadline := time.Now().Add(3 * time.Second)
+	for client.lightchain.CurrentHeader().Hash() != head {
+		if time.Now().After(deadline) {
+			t.Fatalf("light chain head mismatch: have #%d, want #%d", client.lightchain.CurrentHeader().Number, blockchain.CurrentBlock().Number())
+		}
+		client.synchronise(client.peers.BestPeer())
+		time.Sleep(10 * time.Millisecond)
+	}
+	return server, client, blockchain
+}
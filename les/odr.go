@@ -0,0 +1,179 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/light"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+)
+
+var (
+	// ErrNoPeers is returned if no peer could answer an on-demand request.
+	ErrNoPeers = errors.New("no suitable peers available")
+
+	errOdrStopped       = errors.New("on-demand retrieval stopped")
+	errUnsupportedReq   = errors.New("unsupported on-demand request")
+	errUnsolicitedReply = errors.New("unsolicited or late response")
+)
+
+// retrieveTimeout is the time allowance for a single peer to answer a request
+// before it is retried with another one.
+var retrieveTimeout = 5 * time.Second
+
+// Msg is a response to an on-demand request, as delivered by the protocol
+// manager.
+type Msg struct {
+	MsgType uint64
+	ReqID   uint64
+	Obj     interface{}
+}
+
+// pendingReq tracks an on-demand request sent to a peer until it is answered.
+type pendingReq struct {
+	peer *peer
+	resp chan *Msg
+}
+
+// LesOdr implements light.OdrBackend by retrieving and validating data from the
+// connected light servers.
+type LesOdr struct {
+	db ethdb.Database
+	pm *ProtocolManager
+
+	pending map[uint64]*pendingReq
+	lock    sync.Mutex
+	stop    chan struct{}
+}
+
+// NewLesOdr creates an on-demand retrieval backend storing its results in db.
+func NewLesOdr(db ethdb.Database) *LesOdr {
+	return &LesOdr{
+		db:      db,
+		pending: make(map[uint64]*pendingReq),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Database returns the database retrieved data is stored in.
+func (odr *LesOdr) Database() ethdb.Database {
+	return odr.db
+}
+
+// Stop aborts all pending retrievals.
+func (odr *LesOdr) Stop() {
+	close(odr.stop)
+}
+
+// Deliver hands a response received from p to the request it answers.
+func (odr *LesOdr) Deliver(p *peer, msg *Msg) error {
+	odr.lock.Lock()
+	req, ok := odr.pending[msg.ReqID]
+	if ok && req.peer == p {
+		delete(odr.pending, msg.ReqID)
+	}
+	odr.lock.Unlock()
+
+	if !ok || req.peer != p {
+		return errUnsolicitedReply
+	}
+	req.resp <- msg
+	return nil
+}
+
+// Retrieve sends a request to the light servers one by one until one of them
+// answers with valid data, which is then stored in the local database.
+func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) error {
+	lreq := lesRequest(req)
+	if lreq == nil {
+		return errUnsupportedReq
+	}
+	tried := make(map[*peer]bool)
+	for {
+		p := odr.nextPeer(tried)
+		if p == nil {
+			return ErrNoPeers
+		}
+		tried[p] = true
+
+		reqID := odr.pm.getNextReqID()
+		resp := make(chan *Msg, 1)
+		odr.lock.Lock()
+		odr.pending[reqID] = &pendingReq{peer: p, resp: resp}
+		odr.lock.Unlock()
+
+		if err := lreq.Request(reqID, p); err != nil {
+			odr.cancel(reqID)
+			continue
+		}
+		select {
+		case msg := <-resp:
+			if err := lreq.Validate(odr.db, msg); err != nil {
+				glog.V(logger.Debug).Infof("%v: invalid on-demand response: %v", p, err)
+				if err != errEmptyResponse {
+					odr.pm.removePeer(p.id)
+				}
+				continue
+			}
+			req.StoreResult(odr.db)
+			return nil
+
+		case <-time.After(retrieveTimeout):
+			odr.cancel(reqID)
+
+		case <-ctx.Done():
+			odr.cancel(reqID)
+			return ctx.Err()
+
+		case <-odr.stop:
+			return errOdrStopped
+		}
+	}
+}
+
+// nextPeer returns the connected server with the highest total difficulty that
+// has not been tried yet.
+func (odr *LesOdr) nextPeer(tried map[*peer]bool) *peer {
+	var (
+		best   *peer
+		bestTd *big.Int
+	)
+	for _, p := range odr.pm.peers.AllPeers() {
+		if tried[p] {
+			continue
+		}
+		if _, td := p.Head(); best == nil || td.Cmp(bestTd) > 0 {
+			best, bestTd = p, td
+		}
+	}
+	return best
+}
+
+// cancel forgets about a pending request, dropping any late response.
+func (odr *LesOdr) cancel(reqID uint64) {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	delete(odr.pending, reqID)
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/light"
+	"github.com/ethereumproject/go-ethereum/trie"
+)
+
+var (
+	errInvalidMessageType  = errors.New("invalid message type")
+	errInvalidEntryCount   = errors.New("invalid number of response entries")
+	errEmptyResponse       = errors.New("requested data not available")
+	errHeaderUnavailable   = errors.New("header unavailable")
+	errTxHashMismatch      = errors.New("transaction hash mismatch")
+	errUncleHashMismatch   = errors.New("uncle hash mismatch")
+	errReceiptHashMismatch = errors.New("receipt hash mismatch")
+)
+
+// lesOdrRequest is a light.OdrRequest that can be sent to and validated against
+// the reply of a light server.
+type lesOdrRequest interface {
+	Request(reqID uint64, p *peer) error
+	Validate(db ethdb.Database, msg *Msg) error
+}
+
+// lesRequest returns the les counterpart of an ODR request, or nil if the
+// request type is not supported.
+func lesRequest(req light.OdrRequest) lesOdrRequest {
+	switch r := req.(type) {
+	case *light.BlockRequest:
+		return (*BlockRequest)(r)
+	case *light.ReceiptsRequest:
+		return (*ReceiptsRequest)(r)
+	case *light.TrieRequest:
+		return (*TrieRequest)(r)
+	}
+	return nil
+}
+
+// BlockRequest is the ODR request type for block bodies
+type BlockRequest light.BlockRequest
+
+// Request sends an ODR request to the given peer
+func (r *BlockRequest) Request(reqID uint64, p *peer) error {
+	return p.RequestBodies(reqID, []common.Hash{r.Hash})
+}
+
+// Validate checks the received body against the transaction and uncle hashes
+// of the locally stored header, and sets it as the result if it matches.
+func (r *BlockRequest) Validate(db ethdb.Database, msg *Msg) error {
+	if msg.MsgType != BlockBodiesMsg {
+		return errInvalidMessageType
+	}
+	bodies := msg.Obj.([]*types.Body)
+	if len(bodies) == 0 {
+		return errEmptyResponse
+	}
+	if len(bodies) != 1 {
+		return errInvalidEntryCount
+	}
+	header := core.GetHeader(db, r.Hash)
+	if header == nil {
+		return errHeaderUnavailable
+	}
+	body := bodies[0]
+	if types.DeriveSha(types.Transactions(body.Transactions)) != header.TxHash {
+		return errTxHashMismatch
+	}
+	if types.CalcUncleHash(body.Uncles) != header.UncleHash {
+		return errUncleHashMismatch
+	}
+	r.Body = body
+	return nil
+}
+
+// ReceiptsRequest is the ODR request type for the receipts of a block
+type ReceiptsRequest light.ReceiptsRequest
+
+// Request sends an ODR request to the given peer
+func (r *ReceiptsRequest) Request(reqID uint64, p *peer) error {
+	return p.RequestReceipts(reqID, []common.Hash{r.Hash})
+}
+
+// Validate checks the received receipts against the receipt root of the locally
+// stored header, and sets them as the result if they match.
+func (r *ReceiptsRequest) Validate(db ethdb.Database, msg *Msg) error {
+	if msg.MsgType != ReceiptsMsg {
+		return errInvalidMessageType
+	}
+	receipts := msg.Obj.([]types.Receipts)
+	if len(receipts) == 0 {
+		return errEmptyResponse
+	}
+	if len(receipts) != 1 {
+		return errInvalidEntryCount
+	}
+	header := core.GetHeader(db, r.Hash)
+	if header == nil {
+		return errHeaderUnavailable
+	}
+	if types.DeriveSha(receipts[0]) != header.ReceiptHash {
+		return errReceiptHashMismatch
+	}
+	r.Receipts = receipts[0]
+	return nil
+}
+
+// TrieRequest is the ODR request type for state/storage trie entries
+type TrieRequest light.TrieRequest
+
+// Request sends an ODR request to the given peer
+func (r *TrieRequest) Request(reqID uint64, p *peer) error {
+	return p.RequestProofs(reqID, []proofReq{{BHash: r.Id.BlockHash, AccKey: r.Id.AccKey, Key: r.Key}})
+}
+
+// Validate verifies the received Merkle proof against the root of the requested
+// trie, and sets it as the result if it proves either the entry or its absence.
+func (r *TrieRequest) Validate(db ethdb.Database, msg *Msg) error {
+	if msg.MsgType != ProofsMsg {
+		return errInvalidMessageType
+	}
+	proofs := msg.Obj.([][][]byte)
+	if len(proofs) != 1 {
+		return errInvalidEntryCount
+	}
+	proof := proofs[0]
+	if len(proof) == 0 {
+		return errEmptyResponse
+	}
+	proofDb, _ := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		proofDb.Put(crypto.Keccak256(node), node)
+	}
+	if _, err, _ := trie.VerifyProof(r.Id.Root, crypto.Keccak256(r.Key), proofDb); err != nil {
+		return err
+	}
+	r.Proof = proof
+	return nil
+}
@@ -0,0 +1,430 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/p2p"
+)
+
+var (
+	errClosed            = errors.New("peer set is closed")
+	errAlreadyRegistered = errors.New("peer is already registered")
+	errNotRegistered     = errors.New("peer is not registered")
+)
+
+const (
+	// maxQueuedAnns is the maximum number of head announcements to queue up
+	// before dropping broadcasts. Only the latest head matters to a light
+	// client, so a short queue is enough.
+	maxQueuedAnns = 4
+
+	handshakeTimeout = 5 * time.Second
+)
+
+// PeerInfo represents a short summary of the light sub-protocol metadata known
+// about a connected peer.
+type PeerInfo struct {
+	Version    int      `json:"version"`    // Light protocol version negotiated
+	Difficulty *big.Int `json:"difficulty"` // Total difficulty of the peer's blockchain
+	Head       string   `json:"head"`       // SHA3 hash of the peer's best owned block
+	Serve      bool     `json:"serve"`      // Whether the peer serves light clients
+}
+
+type peer struct {
+	id string
+
+	*p2p.Peer
+	rw p2p.MsgReadWriter
+
+	version int  // Protocol version negotiated
+	serve   bool // Whether the remote end serves light clients
+
+	head       common.Hash
+	number     uint64
+	td         *big.Int
+	proofsBuf  float64   // Number of proofs which may still be served to the peer
+	proofsTime time.Time // Time the proofs buffer was last recharged
+	lock       sync.RWMutex
+
+	queuedAnns chan *announceData // Queue of head announcements to send to the peer
+	term       chan struct{}      // Termination channel to stop the broadcaster
+}
+
+func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
+	id := p.ID()
+
+	return &peer{
+		Peer:       p,
+		rw:         rw,
+		version:    version,
+		id:         fmt.Sprintf("%x", id[:8]),
+		td:         new(big.Int),
+		proofsBuf:  proofsBufLimit,
+		proofsTime: time.Now(),
+		queuedAnns: make(chan *announceData, maxQueuedAnns),
+		term:       make(chan struct{}),
+	}
+}
+
+// broadcast is a write loop that sends queued head announcements to the remote
+// peer, so that chain events do not block on the network.
+func (p *peer) broadcast() {
+	for {
+		select {
+		case ann := <-p.queuedAnns:
+			if err := p.SendAnnounce(ann); err != nil {
+				return
+			}
+			glog.V(logger.Detail).Infoln("Announced head", "number", ann.Number, "hash", ann.Hash.Hex())
+
+		case <-p.term:
+			return
+		}
+	}
+}
+
+// close signals the broadcast goroutine to terminate.
+func (p *peer) close() {
+	close(p.term)
+}
+
+// Info gathers and returns a collection of metadata known about a peer.
+func (p *peer) Info() *PeerInfo {
+	hash, td := p.Head()
+
+	return &PeerInfo{
+		Version:    p.version,
+		Difficulty: td,
+		Head:       hash.Hex(),
+		Serve:      p.serve,
+	}
+}
+
+// Head retrieves a copy of the current head hash and total difficulty of the
+// peer.
+func (p *peer) Head() (hash common.Hash, td *big.Int) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	copy(hash[:], p.head[:])
+	return hash, new(big.Int).Set(p.td)
+}
+
+// acquireProofs recharges the proofs buffer of the peer for the time passed, and
+// takes up to n proofs from it, returning how many may be served.
+func (p *peer) acquireProofs(n int) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	p.proofsBuf += now.Sub(p.proofsTime).Seconds() * proofsRecharge
+	if p.proofsBuf > proofsBufLimit {
+		p.proofsBuf = proofsBufLimit
+	}
+	p.proofsTime = now
+
+	if float64(n) > p.proofsBuf {
+		n = int(p.proofsBuf)
+	}
+	p.proofsBuf -= float64(n)
+	return n
+}
+
+// HeadNumber retrieves the number of the current head block of the peer.
+func (p *peer) HeadNumber() uint64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.number
+}
+
+// SetHead updates the head hash, number and total difficulty of the peer.
+func (p *peer) SetHead(hash common.Hash, number uint64, td *big.Int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	copy(p.head[:], hash[:])
+	p.number = number
+	p.td.Set(td)
+}
+
+// send writes a single message to the remote peer, discarding its size.
+func (p *peer) send(msgcode uint64, data interface{}) error {
+	_, err := p2p.Send(p.rw, msgcode, data)
+	return err
+}
+
+// SendAnnounce announces the availability of a new chain head.
+func (p *peer) SendAnnounce(ann *announceData) error {
+	return p.send(AnnounceMsg, ann)
+}
+
+// AsyncSendAnnounce queues a head announcement for the remote peer. If the
+// peer's broadcast queue is full, the event is silently dropped.
+func (p *peer) AsyncSendAnnounce(ann *announceData) {
+	select {
+	case p.queuedAnns <- ann:
+	default:
+		glog.V(logger.Debug).Infoln("Dropping head announcement", "number", ann.Number, "hash", ann.Hash.Hex())
+	}
+}
+
+// SendBlockHeaders sends a batch of block headers to the remote peer.
+func (p *peer) SendBlockHeaders(reqID uint64, headers []*types.Header) error {
+	return p.send(BlockHeadersMsg, &blockHeadersPacket{ReqID: reqID, Headers: headers})
+}
+
+// SendBlockBodies sends a batch of block contents to the remote peer.
+func (p *peer) SendBlockBodies(reqID uint64, bodies []*types.Body) error {
+	return p.send(BlockBodiesMsg, &blockBodiesPacket{ReqID: reqID, Bodies: bodies})
+}
+
+// SendReceipts sends a batch of transaction receipts, corresponding to the
+// blocks requested.
+func (p *peer) SendReceipts(reqID uint64, receipts []types.Receipts) error {
+	return p.send(ReceiptsMsg, &receiptsPacket{ReqID: reqID, Receipts: receipts})
+}
+
+// SendProofs sends a batch of Merkle proofs, corresponding to the entries
+// requested.
+func (p *peer) SendProofs(reqID uint64, proofs [][][]byte) error {
+	return p.send(ProofsMsg, &proofsPacket{ReqID: reqID, Proofs: proofs})
+}
+
+// RequestHeadersByHash fetches a batch of blocks' headers corresponding to the
+// specified header query, based on the hash of an origin block.
+func (p *peer) RequestHeadersByHash(reqID uint64, origin common.Hash, amount int, skip int, reverse bool) error {
+	glog.V(logger.Debug).Infof("fetching from: %v req=headersbyhash n=%d origin=%x, skipping=%d reverse=%v", p, amount, origin[:4], skip, reverse)
+	query := getBlockHeadersData{Origin: hashOrNumber{Hash: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse}
+	return p.send(GetBlockHeadersMsg, &getBlockHeadersPacket{ReqID: reqID, Query: query})
+}
+
+// RequestHeadersByNumber fetches a batch of blocks' headers corresponding to the
+// specified header query, based on the number of an origin block.
+func (p *peer) RequestHeadersByNumber(reqID uint64, origin uint64, amount int, skip int, reverse bool) error {
+	glog.V(logger.Debug).Infof("fetching from: %v req=headersbynumber n=%d origin=%d, skipping=%d reverse=%v", p, amount, origin, skip, reverse)
+	query := getBlockHeadersData{Origin: hashOrNumber{Number: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse}
+	return p.send(GetBlockHeadersMsg, &getBlockHeadersPacket{ReqID: reqID, Query: query})
+}
+
+// RequestBodies fetches a batch of blocks' bodies corresponding to the hashes
+// specified.
+func (p *peer) RequestBodies(reqID uint64, hashes []common.Hash) error {
+	glog.V(logger.Debug).Infof("fetching from: %v req=blockbodies n=%d first=%s", p, len(hashes), hashes[0].Hex())
+	return p.send(GetBlockBodiesMsg, &getByHashPacket{ReqID: reqID, Hashes: hashes})
+}
+
+// RequestReceipts fetches a batch of transaction receipts from a remote node.
+func (p *peer) RequestReceipts(reqID uint64, hashes []common.Hash) error {
+	glog.V(logger.Debug).Infof("fetching from: %v req=receipts n=%d first=%s", p, len(hashes), hashes[0].Hex())
+	return p.send(GetReceiptsMsg, &getByHashPacket{ReqID: reqID, Hashes: hashes})
+}
+
+// RequestProofs fetches a batch of Merkle proofs of state or storage trie
+// entries from a remote node.
+func (p *peer) RequestProofs(reqID uint64, reqs []proofReq) error {
+	glog.V(logger.Debug).Infof("fetching from: %v req=proofs n=%d", p, len(reqs))
+	return p.send(GetProofsMsg, &getProofsPacket{ReqID: reqID, Reqs: reqs})
+}
+
+// Handshake executes the les protocol handshake, negotiating version number,
+// network IDs, difficulties, head and genesis blocks, and whether the two ends
+// serve light clients.
+func (p *peer) Handshake(network uint64, td *big.Int, head common.Hash, headNum uint64, genesis common.Hash, serve bool) error {
+	// Send out own handshake in a new thread
+	errc := make(chan error, 2)
+	var status statusData // safe to read after two values have been received from errc
+
+	go func() {
+		errc <- p.send(StatusMsg, &statusData{
+			ProtocolVersion: uint32(p.version),
+			NetworkId:       uint32(network),
+			TD:              td,
+			Head:            head,
+			HeadNum:         headNum,
+			Genesis:         genesis,
+			Serve:           serve,
+		})
+	}()
+	go func() {
+		errc <- p.readStatus(network, &status, genesis)
+	}()
+	timeout := time.NewTimer(handshakeTimeout)
+	defer timeout.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != nil {
+				return err
+			}
+		case <-timeout.C:
+			return p2p.DiscReadTimeout
+		}
+	}
+	p.td, p.head, p.number, p.serve = status.TD, status.Head, status.HeadNum, status.Serve
+	return nil
+}
+
+func (p *peer) readStatus(network uint64, status *statusData, genesis common.Hash) error {
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Code != StatusMsg {
+		return errResp(ErrNoStatusMsg, "first msg has code %x (!= %x)", msg.Code, StatusMsg)
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	// Decode the handshake and make sure everything matches
+	if err := msg.Decode(&status); err != nil {
+		return errResp(ErrDecode, "msg %v: %v", msg, err)
+	}
+	if status.Genesis != genesis {
+		return errResp(ErrGenesisBlockMismatch, "%x (!= %x…)", status.Genesis, genesis.Bytes()[:8])
+	}
+	if status.NetworkId != uint32(network) {
+		return errResp(ErrNetworkIdMismatch, "%d (!= %d)", status.NetworkId, network)
+	}
+	if int(status.ProtocolVersion) != p.version {
+		return errResp(ErrProtocolVersionMismatch, "%d (!= %d)", status.ProtocolVersion, p.version)
+	}
+	if status.TD == nil {
+		return errResp(ErrDecode, "missing total difficulty")
+	}
+	return nil
+}
+
+// String implements fmt.Stringer.
+func (p *peer) String() string {
+	return fmt.Sprintf("peer:%s@[%s] les/%d", p.id, p.Name(), p.version)
+}
+
+// peerSet represents the collection of active peers currently participating in
+// the light sub-protocol.
+type peerSet struct {
+	peers  map[string]*peer
+	lock   sync.RWMutex
+	closed bool
+}
+
+// newPeerSet creates a new peer set to track the active participants.
+func newPeerSet() *peerSet {
+	return &peerSet{
+		peers: make(map[string]*peer),
+	}
+}
+
+// Register injects a new peer into the working set, or returns an error if the
+// peer is already known.
+func (ps *peerSet) Register(p *peer) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if ps.closed {
+		return errClosed
+	}
+	if _, ok := ps.peers[p.id]; ok {
+		return errAlreadyRegistered
+	}
+	ps.peers[p.id] = p
+	go p.broadcast()
+	return nil
+}
+
+// Unregister removes a remote peer from the active set, disabling any further
+// actions to/from that particular entity.
+func (ps *peerSet) Unregister(id string) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	p, ok := ps.peers[id]
+	if !ok {
+		return errNotRegistered
+	}
+	delete(ps.peers, id)
+	p.close()
+
+	return nil
+}
+
+// Peer retrieves the registered peer with the given id.
+func (ps *peerSet) Peer(id string) *peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return ps.peers[id]
+}
+
+// Len returns if the current number of peers in the set.
+func (ps *peerSet) Len() int {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return len(ps.peers)
+}
+
+// AllPeers returns all the peers in the set.
+func (ps *peerSet) AllPeers() []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		list = append(list, p)
+	}
+	return list
+}
+
+// BestPeer retrieves the known peer with the currently highest total difficulty.
+func (ps *peerSet) BestPeer() *peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	var (
+		bestPeer *peer
+		bestTd   *big.Int
+	)
+	for _, p := range ps.peers {
+		if _, td := p.Head(); bestPeer == nil || td.Cmp(bestTd) > 0 {
+			bestPeer, bestTd = p, td
+		}
+	}
+	return bestPeer
+}
+
+// Close disconnects all peers.
+// No new peers can be registered after Close has returned.
+func (ps *peerSet) Close() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	for _, p := range ps.peers {
+		p.Disconnect(p2p.DiscQuitting)
+	}
+	ps.closed = true
+}
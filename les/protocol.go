@@ -0,0 +1,213 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package les implements the Light Ethereum Subprotocol.
+package les
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/rlp"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	lpv1 = 1
+)
+
+// Official short name of the protocol used during capability negotiation.
+var ProtocolName = "les"
+
+// Supported versions of the les protocol (first is primary).
+var ProtocolVersions = []uint{lpv1}
+
+// Number of implemented message corresponding to different protocol versions.
+var ProtocolLengths = []uint64{10}
+
+const (
+	ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
+
+	MaxHeaderFetch  = 192 // Amount of block headers to be fetched per retrieval request
+	MaxBodyFetch    = 32  // Amount of block bodies to be fetched per retrieval request
+	MaxReceiptFetch = 128 // Amount of transaction receipts to allow fetching per request
+	MaxProofsFetch  = 64  // Amount of merkle proofs to be fetched per retrieval request
+
+	// Proofs are served to every peer from a buffer recharging over time, as
+	// each of them is built from the state at a block of the peer's choosing.
+	// Requests beyond the buffer are cut short.
+	proofsBufLimit = 4 * MaxProofsFetch // Maximum number of proofs served to a peer in a burst
+	proofsRecharge = 32                 // Number of proofs per second the buffer of a peer recharges by
+)
+
+// les protocol message codes
+const (
+	StatusMsg          = 0x00
+	AnnounceMsg        = 0x01
+	GetBlockHeadersMsg = 0x02
+	BlockHeadersMsg    = 0x03
+	GetBlockBodiesMsg  = 0x04
+	BlockBodiesMsg     = 0x05
+	GetReceiptsMsg     = 0x06
+	ReceiptsMsg        = 0x07
+	GetProofsMsg       = 0x08
+	ProofsMsg          = 0x09
+)
+
+type errCode int
+
+const (
+	ErrMsgTooLarge = iota
+	ErrDecode
+	ErrInvalidMsgCode
+	ErrProtocolVersionMismatch
+	ErrNetworkIdMismatch
+	ErrGenesisBlockMismatch
+	ErrNoStatusMsg
+	ErrExtraStatusMsg
+	ErrUselessPeer
+	ErrInvalidResponse
+)
+
+func (e errCode) String() string {
+	return errorToString[int(e)]
+}
+
+var errorToString = map[int]string{
+	ErrMsgTooLarge:             "Message too long",
+	ErrDecode:                  "Invalid message",
+	ErrInvalidMsgCode:          "Invalid message code",
+	ErrProtocolVersionMismatch: "Protocol version mismatch",
+	ErrNetworkIdMismatch:       "NetworkId mismatch",
+	ErrGenesisBlockMismatch:    "Genesis block mismatch",
+	ErrNoStatusMsg:             "No status message",
+	ErrExtraStatusMsg:          "Extra status message",
+	ErrUselessPeer:             "Useless peer",
+	ErrInvalidResponse:         "Invalid response",
+}
+
+func errResp(code errCode, format string, v ...interface{}) error {
+	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+}
+
+// statusData is the network packet for the status message.
+type statusData struct {
+	ProtocolVersion uint32
+	NetworkId       uint32
+	TD              *big.Int
+	Head            common.Hash
+	HeadNum         uint64
+	Genesis         common.Hash
+	Serve           bool // Whether the sender serves light clients
+}
+
+// announceData is the network packet for the announcement of a new chain head.
+type announceData struct {
+	Hash   common.Hash // Hash of the new head block
+	Number uint64      // Number of the new head block
+	TD     *big.Int    // Total difficulty of the new head block
+}
+
+// getBlockHeadersData represents a block header query.
+type getBlockHeadersData struct {
+	Origin  hashOrNumber // Block from which to retrieve headers
+	Amount  uint64       // Maximum number of headers to retrieve
+	Skip    uint64       // Blocks to skip between consecutive headers
+	Reverse bool         // Query direction (false = rising towards latest, true = falling towards genesis)
+}
+
+// hashOrNumber is a combined field for specifying an origin block.
+type hashOrNumber struct {
+	Hash   common.Hash // Block hash from which to retrieve headers (excludes Number)
+	Number uint64      // Block hash from which to retrieve headers (excludes Hash)
+}
+
+// EncodeRLP is a specialized encoder for hashOrNumber to encode only one of the
+// two contained union fields.
+func (hn *hashOrNumber) EncodeRLP(w io.Writer) error {
+	if hn.Hash == (common.Hash{}) {
+		return rlp.Encode(w, hn.Number)
+	}
+	if hn.Number != 0 {
+		return fmt.Errorf("both origin hash (%x) and number (%d) provided", hn.Hash, hn.Number)
+	}
+	return rlp.Encode(w, hn.Hash)
+}
+
+// DecodeRLP is a specialized decoder for hashOrNumber to decode the contents
+// into either a block hash or a block number.
+func (hn *hashOrNumber) DecodeRLP(s *rlp.Stream) error {
+	_, size, _ := s.Kind()
+	origin, err := s.Raw()
+	if err == nil {
+		switch {
+		case size == 32:
+			err = rlp.DecodeBytes(origin, &hn.Hash)
+		case size <= 8:
+			err = rlp.DecodeBytes(origin, &hn.Number)
+		default:
+			err = fmt.Errorf("invalid input size %d for origin", size)
+		}
+	}
+	return err
+}
+
+// proofReq is a request for the Merkle proof of a state or storage trie entry.
+type proofReq struct {
+	BHash  common.Hash // Block whose state the entry is proven in
+	AccKey []byte      // Address of the account owning the storage trie, empty for the state trie
+	Key    []byte      // Address of the account, or storage slot, to prove
+}
+
+// Request packets. Every request carries an ID which the response echoes, so
+// that it can be matched to the request.
+type (
+	getBlockHeadersPacket struct {
+		ReqID uint64
+		Query getBlockHeadersData
+	}
+	getByHashPacket struct {
+		ReqID  uint64
+		Hashes []common.Hash
+	}
+	getProofsPacket struct {
+		ReqID uint64
+		Reqs  []proofReq
+	}
+)
+
+// Response packets.
+type (
+	blockHeadersPacket struct {
+		ReqID   uint64
+		Headers []*types.Header
+	}
+	blockBodiesPacket struct {
+		ReqID  uint64
+		Bodies []*types.Body
+	}
+	receiptsPacket struct {
+		ReqID    uint64
+		Receipts []types.Receipts
+	}
+	proofsPacket struct {
+		ReqID  uint64
+		Proofs [][][]byte
+	}
+)
@@ -0,0 +1,59 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"github.com/ethereumproject/go-ethereum/eth"
+	"github.com/ethereumproject/go-ethereum/p2p"
+	"github.com/ethereumproject/go-ethereum/rpc"
+)
+
+// LesServer is a service serving light clients from the blockchain of a full
+// Ethereum node, running next to the eth protocol.
+type LesServer struct {
+	protocolManager *ProtocolManager
+	maxPeers        int
+}
+
+// NewLesServer creates a light server backed by the given full node, accepting
+// at most maxPeers light clients.
+func NewLesServer(e *eth.Ethereum, maxPeers int) *LesServer {
+	pm := NewServerProtocolManager(e.ChainConfig(), uint64(e.NetVersion()), e.EventMux(), e.BlockChain(), e.ChainDb())
+	return &LesServer{protocolManager: pm, maxPeers: maxPeers}
+}
+
+// Protocols implements node.Service, returning the light server protocols.
+func (s *LesServer) Protocols() []p2p.Protocol {
+	return s.protocolManager.SubProtocols
+}
+
+// APIs implements node.Service. The light server adds no RPC services.
+func (s *LesServer) APIs() []rpc.API {
+	return nil
+}
+
+// Start implements node.Service, starting to serve light clients.
+func (s *LesServer) Start(srvr *p2p.Server) error {
+	s.protocolManager.Start(s.maxPeers)
+	return nil
+}
+
+// Stop implements node.Service, disconnecting all light clients.
+func (s *LesServer) Stop() error {
+	s.protocolManager.Stop()
+	return nil
+}
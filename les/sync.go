@@ -0,0 +1,79 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/eth/downloader"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+)
+
+const (
+	forceSyncCycle      = 10 * time.Second // Time interval to force syncs, even if few peers are available
+	minDesiredPeerCount = 1                // Amount of peers desired to start syncing, servers are scarce
+)
+
+// syncer is responsible for periodically synchronising the header chain with
+// the light servers.
+func (pm *ProtocolManager) syncer() {
+	// Start and ensure cleanup of sync mechanisms
+	defer pm.downloader.Terminate()
+
+	// Wait for different events to fire synchronisation operations
+	forceSync := time.NewTicker(forceSyncCycle)
+	defer forceSync.Stop()
+
+	for {
+		select {
+		case <-pm.newPeerCh:
+			// Make sure we have peers to select from, then sync
+			if pm.peers.Len() < minDesiredPeerCount {
+				break
+			}
+			go pm.synchronise(pm.peers.BestPeer())
+
+		case <-forceSync.C:
+			// Force a sync even if not enough peers are present
+			if !pm.downloader.Synchronising() {
+				go pm.synchronise(pm.peers.BestPeer())
+			}
+
+		case <-pm.noMorePeers:
+			return
+		}
+	}
+}
+
+// synchronise tries to sync up our local header chain with a remote server.
+func (pm *ProtocolManager) synchronise(peer *peer) {
+	// Short circuit if no peers are available
+	if peer == nil {
+		return
+	}
+	// Make sure the peer's TD is higher than our own
+	head := pm.lightchain.CurrentHeader()
+	td := pm.lightchain.GetTd(head.Hash())
+	pHead, pTd := peer.Head()
+	if td != nil && pTd.Cmp(td) <= 0 {
+		return
+	}
+	if err := pm.downloader.Synchronise(peer.id, pHead, pTd, downloader.LightSync); err != nil {
+		glog.V(logger.Debug).Infoln("downloader failed to synchronise", "peer=", peer.String(), "err=", err.Error())
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package light implements on-demand retrieval capable state and chain objects
+// for the Ethereum Light Client.
+package light
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/event"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/ethereumproject/go-ethereum/pow"
+)
+
+// LightChain represents a canonical chain that by default only handles block
+// headers, downloading block bodies, receipts and state on demand through an
+// ODR interface. It only does header validation during chain insertion.
+type LightChain struct {
+	hc           *core.HeaderChain
+	chainDb      ethdb.Database
+	odr          OdrBackend
+	eventMux     *event.TypeMux
+	genesisBlock *types.Block
+
+	mu      sync.RWMutex // protects the current head
+	chainmu sync.RWMutex // serializes chain insertions
+
+	procInterrupt int32 // interrupt signaler for header processing
+	wg            sync.WaitGroup
+}
+
+// NewLightChain returns a fully initialised light chain using information
+// available in the database. It initialises the default Ethereum header
+// validator.
+func NewLightChain(odr OdrBackend, config *core.ChainConfig, pow pow.PoW, mux *event.TypeMux) (*LightChain, error) {
+	bc := &LightChain{
+		chainDb:  odr.Database(),
+		odr:      odr,
+		eventMux: mux,
+	}
+	var validator core.HeaderValidator
+	gv := func() core.HeaderValidator { return validator }
+
+	var err error
+	bc.hc, err = core.NewHeaderChain(bc.chainDb, config, mux, gv, bc.getProcInterrupt)
+	if err != nil {
+		return nil, err
+	}
+	validator = core.NewHeaderValidator(config, bc.hc, pow)
+
+	bc.genesisBlock = core.GetBlock(bc.chainDb, core.GetCanonicalHash(bc.chainDb, 0))
+	if bc.genesisBlock == nil {
+		return nil, core.ErrNoGenesis
+	}
+	// The header chain restores the head block, a light chain only has headers
+	if head := core.GetHeadHeaderHash(bc.chainDb); head != (common.Hash{}) {
+		if header := bc.hc.GetHeader(head); header != nil {
+			bc.hc.SetCurrentHeader(header)
+		}
+	}
+	// Check the current state of the header hashes and make sure that we do not
+	// have any of the bad blocks in our chain
+	for _, bad := range config.BadHashes {
+		if header := bc.GetHeader(bad.Hash); header != nil && header.Number.Cmp(bad.Block) == 0 {
+			glog.V(logger.Error).Infof("Found bad hash, rewinding chain to block #%d [%s]", header.Number, header.ParentHash.Hex())
+			bc.SetHead(header.Number.Uint64() - 1)
+			glog.V(logger.Error).Infoln("Chain rewind was successful, resuming normal operation")
+		}
+	}
+	return bc, nil
+}
+
+func (bc *LightChain) getProcInterrupt() bool {
+	return atomic.LoadInt32(&bc.procInterrupt) == 1
+}
+
+// Odr returns the ODR backend of the chain.
+func (bc *LightChain) Odr() OdrBackend {
+	return bc.odr
+}
+
+// Genesis returns the genesis block.
+func (bc *LightChain) Genesis() *types.Block {
+	return bc.genesisBlock
+}
+
+// Status returns status information about the current chain, as needed by the
+// light protocol handshake.
+func (bc *LightChain) Status() (td *big.Int, currentBlock common.Hash, genesisBlock common.Hash) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	header := bc.hc.CurrentHeader()
+	hash := header.Hash()
+	return bc.GetTd(hash), hash, bc.genesisBlock.Hash()
+}
+
+// SetHead rewinds the local chain to a new head. Everything above the new head
+// will be deleted and the new one set.
+func (bc *LightChain) SetHead(head uint64) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	delFn := func(hash common.Hash) {
+		core.DeleteBody(bc.chainDb, hash)
+		core.DeleteBlockReceipts(bc.chainDb, hash)
+	}
+	bc.hc.SetHead(head, delFn)
+}
+
+// Stop stops the light chain service. If any imports are currently in progress
+// it will abort them using the procInterrupt.
+func (bc *LightChain) Stop() {
+	atomic.StoreInt32(&bc.procInterrupt, 1)
+	bc.wg.Wait()
+
+	glog.V(logger.Info).Infoln("Light chain manager stopped")
+}
+
+// Rollback is designed to remove a chain of links from the database that aren't
+// certain enough to be valid.
+func (bc *LightChain) Rollback(chain []common.Hash) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		hash := chain[i]
+
+		if head := bc.hc.CurrentHeader(); head.Hash() == hash {
+			bc.hc.SetCurrentHeader(bc.GetHeader(head.ParentHash))
+		}
+	}
+}
+
+// InsertHeaderChain attempts to insert the given header chain in to the local
+// chain, possibly creating a reorg. If an error is returned, it will return the
+// index number of the failing header as well an error describing what went wrong.
+//
+// The verify parameter can be used to fine tune whether nonce verification
+// should be done or not. The reason behind the optional check is because some
+// of the header retrieval mechanisms already need to verfy nonces, as well as
+// because nonces can be verified sparsely, not needing to check each.
+func (bc *LightChain) InsertHeaderChain(chain []*types.Header, checkFreq int) *core.HeaderChainInsertResult {
+	// Make sure only one thread manipulates the chain at once
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	whFunc := func(header *types.Header) error {
+		bc.mu.Lock()
+		defer bc.mu.Unlock()
+
+		_, err := bc.hc.WriteHeader(header)
+		return err
+	}
+	return bc.hc.InsertHeaderChain(chain, checkFreq, whFunc)
+}
+
+// CurrentHeader retrieves the current head header of the canonical chain. The
+// header is retrieved from the HeaderChain's internal cache.
+func (bc *LightChain) CurrentHeader() *types.Header {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.hc.CurrentHeader()
+}
+
+// GetTd retrieves a block's total difficulty in the canonical chain from the
+// database by hash, caching it if found.
+func (bc *LightChain) GetTd(hash common.Hash) *big.Int {
+	return bc.hc.GetTd(hash)
+}
+
+// GetHeader retrieves a block header from the database by hash, caching it if
+// found.
+func (bc *LightChain) GetHeader(hash common.Hash) *types.Header {
+	return bc.hc.GetHeader(hash)
+}
+
+// GetHeaderByHash retrieves a block header from the database by hash, as
+// required by the downloader.
+func (bc *LightChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return bc.hc.GetHeader(hash)
+}
+
+// HasHeader checks if a block header is present in the database or not, caching
+// it if present.
+func (bc *LightChain) HasHeader(hash common.Hash) bool {
+	return bc.hc.HasHeader(hash)
+}
+
+// GetHeaderByNumber retrieves a block header from the database by number,
+// caching it (associated with its hash) if found.
+func (bc *LightChain) GetHeaderByNumber(number uint64) *types.Header {
+	return bc.hc.GetHeaderByNumber(number)
+}
+
+// GetBlockHashesFromHash retrieves a number of block hashes starting at a given
+// hash, fetching towards the genesis block.
+func (bc *LightChain) GetBlockHashesFromHash(hash common.Hash, max uint64) []common.Hash {
+	return bc.hc.GetBlockHashesFromHash(hash, max)
+}
+
+// GetBlock retrieves a block from the database or ODR service by hash.
+func (bc *LightChain) GetBlock(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return GetBlock(ctx, bc.odr, hash)
+}
+
+// GetBlockByNumber retrieves a canonical block from the database or ODR service
+// by number.
+func (bc *LightChain) GetBlockByNumber(ctx context.Context, number uint64) (*types.Block, error) {
+	hash := core.GetCanonicalHash(bc.chainDb, number)
+	if hash == (common.Hash{}) {
+		return nil, nil
+	}
+	return bc.GetBlock(ctx, hash)
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+)
+
+// NoOdr is the default context passed to an ODR capable function when the ODR
+// service is not required.
+var NoOdr = context.Background()
+
+// OdrBackend is an interface to a backend service that handles ODR retrievals
+type OdrBackend interface {
+	Database() ethdb.Database
+	Retrieve(ctx context.Context, req OdrRequest) error
+}
+
+// OdrRequest is an interface for retrieval requests. The backend validates the
+// retrieved data before storing it.
+type OdrRequest interface {
+	StoreResult(db ethdb.Database)
+}
+
+// TrieID identifies a state or account storage trie
+type TrieID struct {
+	BlockHash common.Hash // Block whose state the trie belongs to
+	Root      common.Hash // Root hash the entries are proven against
+	AccKey    []byte      // Address of the account owning the storage trie, nil for the state trie
+}
+
+// StateTrieID returns a TrieID for a state trie belonging to a certain block
+// header.
+func StateTrieID(header *types.Header) *TrieID {
+	return &TrieID{
+		BlockHash: header.Hash(),
+		Root:      header.Root,
+	}
+}
+
+// StorageTrieID returns a TrieID for a contract storage trie at a given account
+// of a given state trie.
+func StorageTrieID(state *TrieID, addr common.Address, root common.Hash) *TrieID {
+	return &TrieID{
+		BlockHash: state.BlockHash,
+		Root:      root,
+		AccKey:    addr[:],
+	}
+}
+
+// TrieRequest is the ODR request type for state/storage trie entries
+type TrieRequest struct {
+	Id    *TrieID
+	Key   []byte   // Unhashed key of the entry: an address or a storage slot
+	Proof [][]byte // Merkle proof of the entry, the nodes on the path to it
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *TrieRequest) StoreResult(db ethdb.Database) {
+	for _, node := range req.Proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+}
+
+// BlockRequest is the ODR request type for block bodies
+type BlockRequest struct {
+	Hash common.Hash
+	Body *types.Body
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *BlockRequest) StoreResult(db ethdb.Database) {
+	core.WriteBody(db, req.Hash, req.Body)
+}
+
+// ReceiptsRequest is the ODR request type for the receipts of a block
+type ReceiptsRequest struct {
+	Hash     common.Hash
+	Receipts types.Receipts
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *ReceiptsRequest) StoreResult(db ethdb.Database) {
+	core.WriteBlockReceipts(db, req.Hash, req.Receipts)
+}
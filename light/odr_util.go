@@ -0,0 +1,146 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/core"
+	"github.com/ethereumproject/go-ethereum/core/state"
+	"github.com/ethereumproject/go-ethereum/core/types"
+	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/rlp"
+	"github.com/ethereumproject/go-ethereum/trie"
+)
+
+// ErrNoHeader is returned when the header of a requested block is not in the
+// local chain, so the retrieved data could not be verified.
+var ErrNoHeader = errors.New("header for the requested block not found")
+
+// GetBody retrieves the block body (transactions and uncles) of the block with
+// the given hash, from the local database or the ODR service.
+func GetBody(ctx context.Context, odr OdrBackend, hash common.Hash) (*types.Body, error) {
+	db := odr.Database()
+	if body := core.GetBody(db, hash); body != nil {
+		return body, nil
+	}
+	header := core.GetHeader(db, hash)
+	if header == nil {
+		return nil, ErrNoHeader
+	}
+	if header.TxHash == types.EmptyRootHash && header.UncleHash == types.EmptyUncleHash {
+		return &types.Body{}, nil
+	}
+	r := &BlockRequest{Hash: hash}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	return r.Body, nil
+}
+
+// GetBlock retrieves an entire block corresponding to the hash, assembling it
+// from the local header and the body retrieved from the database or the ODR
+// service.
+func GetBlock(ctx context.Context, odr OdrBackend, hash common.Hash) (*types.Block, error) {
+	header := core.GetHeader(odr.Database(), hash)
+	if header == nil {
+		return nil, ErrNoHeader
+	}
+	body, err := GetBody(ctx, odr, hash)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles), nil
+}
+
+// GetBlockReceipts retrieves the receipts generated by the transactions included
+// in the block with the given hash, from the local database or the ODR service.
+func GetBlockReceipts(ctx context.Context, odr OdrBackend, hash common.Hash) (types.Receipts, error) {
+	db := odr.Database()
+	if receipts := core.GetBlockReceipts(db, hash); receipts != nil {
+		return receipts, nil
+	}
+	header := core.GetHeader(db, hash)
+	if header == nil {
+		return nil, ErrNoHeader
+	}
+	if header.ReceiptHash == types.EmptyRootHash {
+		return types.Receipts{}, nil
+	}
+	r := &ReceiptsRequest{Hash: hash}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	return r.Receipts, nil
+}
+
+// GetAccount retrieves the account at addr in the state of the block with the
+// given header, proven against its state root. It returns nil if the account
+// does not exist.
+func GetAccount(ctx context.Context, odr OdrBackend, header *types.Header, addr common.Address) (*state.Account, error) {
+	enc, err := trieGet(ctx, odr, StateTrieID(header), addr[:])
+	if err != nil || len(enc) == 0 {
+		return nil, err
+	}
+	account := new(state.Account)
+	if err := rlp.DecodeBytes(enc, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// GetStorage retrieves the value of the storage slot key of the account at addr
+// in the state of the block with the given header, proven against its state
+// root and the account's storage root.
+func GetStorage(ctx context.Context, odr OdrBackend, header *types.Header, addr common.Address, key common.Hash) (common.Hash, error) {
+	var value common.Hash
+
+	account, err := GetAccount(ctx, odr, header, addr)
+	if err != nil || account == nil {
+		return value, err
+	}
+	enc, err := trieGet(ctx, odr, StorageTrieID(StateTrieID(header), addr, account.Root), key[:])
+	if err != nil || len(enc) == 0 {
+		return value, err
+	}
+	_, content, _, err := rlp.Split(enc)
+	if err != nil {
+		return value, err
+	}
+	value.SetBytes(content)
+	return value, nil
+}
+
+// trieGet returns the value of key in the trie identified by id. The proof of
+// the entry is looked up in the local database first, where the nodes of earlier
+// retrieved proofs are kept, and retrieved from the ODR service if incomplete.
+func trieGet(ctx context.Context, odr OdrBackend, id *TrieID, key []byte) ([]byte, error) {
+	if id.Root == types.EmptyRootHash || id.Root == (common.Hash{}) {
+		return nil, nil
+	}
+	hkey := crypto.Keccak256(key)
+	if value, err, _ := trie.VerifyProof(id.Root, hkey, odr.Database()); err == nil {
+		return value, nil
+	}
+	if err := odr.Retrieve(ctx, &TrieRequest{Id: id, Key: key}); err != nil {
+		return nil, err
+	}
+	value, err, _ := trie.VerifyProof(id.Root, hkey, odr.Database())
+	return value, err
+}
@@ -113,6 +113,19 @@ var (
 	FetchBroadcastDOS   = metrics.NewRegisteredMeter("fetch/broadcast/dos", reg)
 )
 
+// Block import metrics. Durations are accumulated in nanoseconds by counters
+// rather than timers, whose samples would draw from the global random source.
+var (
+	ChainInsertBlocks       = metrics.NewRegisteredMeter("chain/insert", reg)
+	ChainInsertTime         = metrics.NewRegisteredCounter("chain/insert/time", reg)
+	ChainExecutionTime      = metrics.NewRegisteredCounter("chain/execution/time", reg)
+	ChainSenderTxs          = metrics.NewRegisteredMeter("chain/senders", reg)
+	ChainSenderTime         = metrics.NewRegisteredCounter("chain/senders/time", reg)
+	ChainPrefetchBlocks     = metrics.NewRegisteredMeter("chain/prefetch", reg)
+	ChainPrefetchTime       = metrics.NewRegisteredCounter("chain/prefetch/time", reg)
+	ChainPrefetchInterrupts = metrics.NewRegisteredMeter("chain/prefetch/interrupt", reg)
+)
+
 var (
 	P2PIn       = metrics.NewRegisteredMeter("p2p/in", reg)
 	P2PInBytes  = metrics.NewRegisteredMeter("p2p/in/bytes", reg)
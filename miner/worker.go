@@ -267,7 +267,10 @@ func (self *worker) wait() {
 				}
 				go self.mux.Post(core.NewMinedBlockEvent{Block: block})
 			} else {
-				work.state.CommitTo(self.chainDb, false)
+				if err := self.chain.CommitState(work.state, block.NumberU64()); err != nil {
+					glog.V(logger.Error).Infoln("error committing mined block state", err)
+					continue
+				}
 				parent := self.chain.GetBlock(block.ParentHash())
 				if parent == nil {
 					glog.V(logger.Error).Infoln("Invalid block found during mining")
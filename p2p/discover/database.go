@@ -62,6 +62,12 @@ var (
 	nodeDBDiscoverPing      = nodeDBDiscoverRoot + ":lastping"
 	nodeDBDiscoverPong      = nodeDBDiscoverRoot + ":lastpong"
 	nodeDBDiscoverFindFails = nodeDBDiscoverRoot + ":findfail"
+
+	nodeDBScoreRoot     = ":score"
+	nodeDBScoreValue    = nodeDBScoreRoot + ":value"
+	nodeDBScoreOffences = nodeDBScoreRoot + ":offences"
+	nodeDBScoreBanned   = nodeDBScoreRoot + ":banned"
+	nodeDBScoreUpdated  = nodeDBScoreRoot + ":updated"
 )
 
 // newNodeDB creates a new node database for storing and retrieving infos about
@@ -245,23 +251,44 @@ func (db *nodeDB) expirer() {
 }
 
 // expireNodes iterates over the database and deletes all nodes that have not
-// been seen (i.e. received a pong from) for some alloted time.
+// been seen (i.e. received a pong from) for some alloted time. Nodes that are
+// still banned are kept, so that their ban outlives their discovery record.
+// Nodes with only a score record expire when it was not updated for the same
+// allotted time.
 func (db *nodeDB) expireNodes() error {
-	threshold := time.Now().Add(-nodeDBNodeExpiration)
+	now := time.Now()
+	threshold := now.Add(-nodeDBNodeExpiration)
 
-	// Find discovered nodes that are older than the allowance
+	// Find discovered or scored nodes that are older than the allowance
 	it := db.lvl.NewIterator(nil, nil)
 	defer it.Release()
 
 	for it.Next() {
-		// Skip the item if not a discovery node
+		// Skip the item if neither a discovery node nor a scored one
 		id, field := splitKey(it.Key())
-		if field != nodeDBDiscoverRoot {
+
+		var seen time.Time
+		switch field {
+		case nodeDBDiscoverRoot:
+			seen = db.lastPong(id)
+
+		case nodeDBScoreValue:
+			// Nodes only connecting inbound are never discovered, expire
+			// their scores on their own by the time they were last updated
+			if discovered, _ := db.lvl.Has(makeKey(id, nodeDBDiscoverRoot), nil); discovered {
+				continue
+			}
+			seen = db.scoreUpdated(id)
+
+		default:
 			continue
 		}
 		// Skip the node if not expired yet (and not self)
 		if bytes.Compare(id[:], db.self[:]) != 0 {
-			if seen := db.lastPong(id); seen.After(threshold) {
+			if seen.After(threshold) {
+				continue
+			}
+			if db.bannedUntil(id).After(now) {
 				continue
 			}
 		}
@@ -302,6 +329,48 @@ func (db *nodeDB) updateFindFails(id NodeID, fails int) error {
 	return db.storeInt64(makeKey(id, nodeDBDiscoverFindFails), int64(fails))
 }
 
+// score retrieves the reputation score of a remote node.
+func (db *nodeDB) score(id NodeID) int64 {
+	return db.fetchInt64(makeKey(id, nodeDBScoreValue))
+}
+
+// updateScore updates the reputation score of a remote node.
+func (db *nodeDB) updateScore(id NodeID, score int64) error {
+	return db.storeInt64(makeKey(id, nodeDBScoreValue), score)
+}
+
+// scoreUpdated retrieves the time the reputation of a remote node was last
+// updated.
+func (db *nodeDB) scoreUpdated(id NodeID) time.Time {
+	return time.Unix(db.fetchInt64(makeKey(id, nodeDBScoreUpdated)), 0)
+}
+
+// updateScoreUpdated updates the last time the reputation of a remote node
+// changed.
+func (db *nodeDB) updateScoreUpdated(id NodeID, instance time.Time) error {
+	return db.storeInt64(makeKey(id, nodeDBScoreUpdated), instance.Unix())
+}
+
+// offences retrieves the number of times a remote node was banned.
+func (db *nodeDB) offences(id NodeID) int64 {
+	return db.fetchInt64(makeKey(id, nodeDBScoreOffences))
+}
+
+// updateOffences updates the number of times a remote node was banned.
+func (db *nodeDB) updateOffences(id NodeID, offences int64) error {
+	return db.storeInt64(makeKey(id, nodeDBScoreOffences), offences)
+}
+
+// bannedUntil retrieves the time until which a remote node is banned.
+func (db *nodeDB) bannedUntil(id NodeID) time.Time {
+	return time.Unix(db.fetchInt64(makeKey(id, nodeDBScoreBanned)), 0)
+}
+
+// updateBannedUntil updates the time until which a remote node is banned.
+func (db *nodeDB) updateBannedUntil(id NodeID, instance time.Time) error {
+	return db.storeInt64(makeKey(id, nodeDBScoreBanned), instance.Unix())
+}
+
 // querySeeds retrieves random nodes to be used as potential seed nodes
 // for bootstrapping.
 func (db *nodeDB) querySeeds(n int, maxAge time.Duration) []*Node {
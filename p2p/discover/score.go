@@ -0,0 +1,107 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// NodeScore is the reputation of a remote node, as collected by the protocols
+// running on top of the discovered connections.
+type NodeScore struct {
+	ID          NodeID
+	Score       int64     // Accumulated reputation of the node
+	Offences    int64     // Number of times the node was banned
+	BannedUntil time.Time // Time until which the node is banned
+}
+
+// Banned returns whether the node is banned at the given time.
+func (s *NodeScore) Banned(now time.Time) bool {
+	return s.BannedUntil.After(now)
+}
+
+// ScoreDB persists the reputation of remote nodes in the node database, next to
+// their discovery records. Scores of nodes that are not seen for a while expire
+// together with the rest of their records, unless the nodes are still banned.
+// Scores of nodes never discovered, eg. inbound only peers, expire when not
+// updated for the same while.
+//
+// ScoreDB does not synchronise read-modify-write cycles, that is left to the
+// caller.
+type ScoreDB struct {
+	db *nodeDB
+}
+
+// NewMemoryScoreDB creates a score database backed by a temporary, in-memory
+// node database, for use when node discovery is not running.
+func NewMemoryScoreDB() (*ScoreDB, error) {
+	db, err := newMemoryNodeDB(nodeDBNilNodeID)
+	if err != nil {
+		return nil, err
+	}
+	return &ScoreDB{db: db}, nil
+}
+
+// ScoreDB returns the score database backed by the table's node database.
+func (tab *Table) ScoreDB() *ScoreDB {
+	return &ScoreDB{db: tab.db}
+}
+
+// Get retrieves the reputation of a node. Unknown nodes have a zero score.
+func (s *ScoreDB) Get(id NodeID) *NodeScore {
+	score := &NodeScore{
+		ID:       id,
+		Score:    s.db.score(id),
+		Offences: s.db.offences(id),
+	}
+	if banned := s.db.bannedUntil(id); banned.Unix() > 0 {
+		score.BannedUntil = banned
+	}
+	return score
+}
+
+// Put stores the reputation of a node.
+func (s *ScoreDB) Put(score *NodeScore) error {
+	if err := s.db.updateScore(score.ID, score.Score); err != nil {
+		return err
+	}
+	if err := s.db.updateOffences(score.ID, score.Offences); err != nil {
+		return err
+	}
+	if err := s.db.updateScoreUpdated(score.ID, time.Now()); err != nil {
+		return err
+	}
+	return s.db.updateBannedUntil(score.ID, score.BannedUntil)
+}
+
+// All retrieves the reputation of every node with a score record.
+func (s *ScoreDB) All() []*NodeScore {
+	it := s.db.lvl.NewIterator(util.BytesPrefix(nodeDBItemPrefix), nil)
+	defer it.Release()
+
+	var scores []*NodeScore
+	for it.Next() {
+		id, field := splitKey(it.Key())
+		if field != nodeDBScoreValue {
+			continue
+		}
+		scores = append(scores, s.Get(id))
+	}
+	return scores
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoreDBStoreRetrieve(t *testing.T) {
+	sdb, err := NewMemoryScoreDB()
+	if err != nil {
+		t.Fatalf("failed to create score database: %v", err)
+	}
+	defer sdb.db.close()
+
+	id := nodeDBExpirationNodes[0].node.ID
+
+	// An unknown node has a blank reputation
+	if score := sdb.Get(id); score.Score != 0 || score.Offences != 0 || !score.BannedUntil.IsZero() {
+		t.Fatalf("unknown node score mismatch: have %+v, want blank", score)
+	}
+	if scores := sdb.All(); len(scores) != 0 {
+		t.Fatalf("score count mismatch: have %d, want 0", len(scores))
+	}
+	// Store a ban and check it's retrieved
+	banned := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	if err := sdb.Put(&NodeScore{ID: id, Score: -42, Offences: 2, BannedUntil: banned}); err != nil {
+		t.Fatalf("failed to store score: %v", err)
+	}
+	score := sdb.Get(id)
+	if score.Score != -42 || score.Offences != 2 || !score.BannedUntil.Equal(banned) {
+		t.Fatalf("score mismatch: have %+v", score)
+	}
+	if !score.Banned(time.Now()) {
+		t.Fatalf("node not banned")
+	}
+	if score.Banned(banned.Add(time.Second)) {
+		t.Fatalf("node banned after ban expiry")
+	}
+	scores := sdb.All()
+	if len(scores) != 1 || scores[0].ID != id {
+		t.Fatalf("listed scores mismatch: have %v, want [%x]", scores, id[:8])
+	}
+}
+
+func TestScoreDBBanExpiration(t *testing.T) {
+	db, _ := newNodeDB("", Version, NodeID{})
+	defer db.close()
+
+	// Add all the test nodes as expired, banning the first one
+	for i, seed := range nodeDBExpirationNodes {
+		if err := db.updateNode(seed.node); err != nil {
+			t.Fatalf("node %d: failed to insert: %v", i, err)
+		}
+		if err := db.updateLastPong(seed.node.ID, time.Now().Add(-2*nodeDBNodeExpiration)); err != nil {
+			t.Fatalf("node %d: failed to update pong: %v", i, err)
+		}
+	}
+	banned := nodeDBExpirationNodes[0].node.ID
+	if err := db.updateBannedUntil(banned, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to ban node: %v", err)
+	}
+	// Expire them and ensure the banned one is retained
+	if err := db.expireNodes(); err != nil {
+		t.Fatalf("failed to expire nodes: %v", err)
+	}
+	for i, seed := range nodeDBExpirationNodes {
+		node := db.node(seed.node.ID)
+		if keep := seed.node.ID == banned; (node != nil) != keep {
+			t.Errorf("node %d: retention mismatch: have %v, want %v", i, node != nil, keep)
+		}
+	}
+}
+
+func TestScoreDBUndiscoveredExpiration(t *testing.T) {
+	db, _ := newNodeDB("", Version, NodeID{})
+	defer db.close()
+
+	// Score a few nodes that were never discovered, eg. inbound only peers
+	var (
+		fresh  = MustHexID("0x1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439")
+		stale  = MustHexID("0x2dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439")
+		banned = MustHexID("0x3dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439")
+	)
+	sdb := &ScoreDB{db: db}
+	for _, id := range []NodeID{fresh, stale, banned} {
+		if err := sdb.Put(&NodeScore{ID: id, Score: -10}); err != nil {
+			t.Fatalf("node %x: failed to store score: %v", id[:8], err)
+		}
+	}
+	if err := db.updateBannedUntil(banned, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to ban node: %v", err)
+	}
+	for _, id := range []NodeID{stale, banned} {
+		if err := db.updateScoreUpdated(id, time.Now().Add(-2*nodeDBNodeExpiration)); err != nil {
+			t.Fatalf("node %x: failed to age score: %v", id[:8], err)
+		}
+	}
+	// Expire them and ensure only the stale, unbanned score is dropped
+	if err := db.expireNodes(); err != nil {
+		t.Fatalf("failed to expire nodes: %v", err)
+	}
+	for _, id := range []NodeID{fresh, stale, banned} {
+		if have, want := db.score(id) != 0, id != stale; have != want {
+			t.Errorf("node %x: retention mismatch: have %v, want %v", id[:8], have, want)
+		}
+	}
+}
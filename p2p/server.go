@@ -276,6 +276,39 @@ func (srv *Server) RemovePeer(node *discover.Node) {
 	}
 }
 
+// SetBootstrapNodes replaces the bootstrap nodes of the server. While it is
+// running, they become the fallback nodes of its node table, used to connect
+// to the network when the table is empty.
+func (srv *Server) SetBootstrapNodes(nodes []*discover.Node) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if tab, ok := srv.ntab.(interface {
+		SetFallbackNodes([]*discover.Node) error
+	}); ok && srv.running {
+		if err := tab.SetFallbackNodes(nodes); err != nil {
+			return err
+		}
+	}
+	srv.BootstrapNodes = nodes
+	return nil
+}
+
+// ScoreDB returns the database persisting the reputation of remote nodes next
+// to their discovery records. It is nil if the server is not running or node
+// discovery is disabled.
+func (srv *Server) ScoreDB() *discover.ScoreDB {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if tab, ok := srv.ntab.(interface {
+		ScoreDB() *discover.ScoreDB
+	}); ok && srv.running {
+		return tab.ScoreDB()
+	}
+	return nil
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -36,6 +36,10 @@ var (
 	vmTestDir          = filepath.Join(baseDir, "VMTests")
 	rlpTestDir         = filepath.Join(baseDir, "RLPTests")
 
+	// testVM is the VM running the tests, selected with the GETH_TEST_VM
+	// environment variable, or core.DefaultTxExecutor if not set.
+	testVM = setTestVM()
+
 	BlockSkipTests = initBlockSkipTests()
 
 	/* Go client does not support transaction (account) nonces above 2^64. This
@@ -48,8 +52,19 @@ var (
 	VmSkipTests    = []string{}
 )
 
+func setTestVM() string {
+	vm := os.Getenv("GETH_TEST_VM")
+	if vm == "" {
+		vm = core.DefaultTxExecutor
+	}
+	if err := core.SetTxExecutor(vm); err != nil {
+		panic(err)
+	}
+	return vm
+}
+
 func initBlockSkipTests() []string {
-	if core.UseSputnikVM == "true" {
+	if testVM == "sputnikvm" {
 		return []string{
 			// These tests are not valid, as they are out of scope for RLP and
 			// the consensus protocol.
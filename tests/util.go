@@ -151,11 +151,21 @@ type RuleSet struct {
 	HomesteadGasRepriceBlock *big.Int
 	DiehardBlock             *big.Int
 	ExplosionBlock           *big.Int
+	ByzantiumBlock           *big.Int
 }
 
 func (r RuleSet) IsHomestead(n *big.Int) bool {
 	return n.Cmp(r.HomesteadBlock) >= 0
 }
+func (r RuleSet) IsByzantium(n *big.Int) bool {
+	return r.ByzantiumBlock != nil && n.Cmp(r.ByzantiumBlock) >= 0
+}
+func (r RuleSet) Precompiled(num *big.Int) map[string]*vm.PrecompiledAccount {
+	if r.IsByzantium(num) {
+		return vm.PrecompiledByzantium
+	}
+	return vm.Precompiled
+}
 func (r RuleSet) GasTable(num *big.Int) *vm.GasTable {
 	if r.HomesteadGasRepriceBlock == nil || num == nil || num.Cmp(r.HomesteadGasRepriceBlock) < 0 {
 		return &vm.GasTable{
@@ -325,6 +335,15 @@ func (self *Env) DelegateCall(caller vm.ContractRef, addr common.Address, data [
 	return core.DelegateCall(self, caller, addr, data, gas, price)
 }
 
+func (self *Env) StaticCall(caller vm.ContractRef, addr common.Address, data []byte, gas, price *big.Int) ([]byte, error) {
+	if self.vmTest && self.depth > 0 {
+		caller.ReturnGas(gas, price)
+
+		return nil, nil
+	}
+	return core.StaticCall(self, caller, addr, data, gas, price)
+}
+
 func (self *Env) Create(caller vm.ContractRef, data []byte, gas, price, value *big.Int) ([]byte, common.Address, error) {
 	if self.vmTest {
 		caller.ReturnGas(gas, price)
@@ -17,11 +17,13 @@
 package trie
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"strings"
 
 	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/crypto"
 	"github.com/ethereumproject/go-ethereum/rlp"
 )
 
@@ -222,3 +224,12 @@ func wrapError(err error, ctx string) error {
 func (err *decodeError) Error() string {
 	return fmt.Sprintf("%v (decode path: %s)", err.what, strings.Join(err.stack, "<-"))
 }
+
+// IsNode reports whether blob is the encoding of a trie node stored under hash.
+func IsNode(hash, blob []byte) bool {
+	if !bytes.Equal(crypto.Keccak256(blob), hash) {
+		return false
+	}
+	_, err := decodeNode(hash, blob, 0)
+	return err == nil
+}
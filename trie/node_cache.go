@@ -0,0 +1,356 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/logger"
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+	"github.com/rcrowley/go-metrics"
+)
+
+var (
+	nodeCacheGCNodesCounter    = metrics.NewRegisteredCounter("trie/nodecache/gc/nodes", nil)
+	nodeCacheGCSizeCounter     = metrics.NewRegisteredCounter("trie/nodecache/gc/size", nil)
+	nodeCacheFlushNodesCounter = metrics.NewRegisteredCounter("trie/nodecache/flush/nodes", nil)
+	nodeCacheFlushSizeCounter  = metrics.NewRegisteredCounter("trie/nodecache/flush/size", nil)
+)
+
+// NodeCache is an intermediate write layer between the tries and the disk
+// database. Committed trie nodes are kept in memory, reference counted, until
+// they are either flushed to disk by Commit or garbage collected once no longer
+// referenced by any root, so that the intermediate states of a chain need not
+// ever hit the disk.
+//
+// Nodes are referenced by the nodes of the tries containing them. Roots must be
+// referenced with Reference(root, common.Hash{}) to be kept, and are released with
+// Dereference. Nodes referenced from the leaves of a trie, eg. storage tries from
+// the accounts of the state trie, are tracked by referencing them from the node
+// holding the leaf, see LeafWriter.
+//
+// NodeCache is safe for concurrent use.
+type NodeCache struct {
+	diskdb Database // Persistent storage for flushed nodes
+
+	lock  sync.RWMutex
+	nodes map[common.Hash]*cachedNode // Nodes in memory, the zero hash being the meta root of all roots
+	size  common.StorageSize          // Storage size of the nodes in memory
+}
+
+// cachedNode is a trie node, or other blob such as contract code, kept in memory.
+type cachedNode struct {
+	blob     []byte                 // Encoded node
+	parents  int                    // Number of live nodes referencing this one
+	children []common.Hash          // Hashes of the nodes this one references in its trie
+	external map[common.Hash]uint16 // Nodes referenced by this one with Reference
+}
+
+// NewNodeCache creates a node cache on top of the given disk database.
+func NewNodeCache(diskdb Database) *NodeCache {
+	return &NodeCache{
+		diskdb: diskdb,
+		nodes:  map[common.Hash]*cachedNode{{}: {}},
+	}
+}
+
+// DiskDB returns the persistent storage of the cache.
+func (c *NodeCache) DiskDB() Database {
+	return c.diskdb
+}
+
+// Get retrieves a node from memory, falling back to the disk database.
+func (c *NodeCache) Get(key []byte) ([]byte, error) {
+	c.lock.RLock()
+	node := c.nodes[common.BytesToHash(key)]
+	c.lock.RUnlock()
+
+	if node != nil {
+		return common.CopyBytes(node.blob), nil
+	}
+	return c.diskdb.Get(key)
+}
+
+// Has reports whether a node is in memory or in the disk database.
+func (c *NodeCache) Has(key []byte) (bool, error) {
+	c.lock.RLock()
+	_, ok := c.nodes[common.BytesToHash(key)]
+	c.lock.RUnlock()
+
+	if ok {
+		return true, nil
+	}
+	return c.diskdb.Has(key)
+}
+
+// Put inserts a node in memory. Blobs which are not trie nodes, eg. contract code,
+// may be inserted too and are handled as nodes without children. Entries not keyed
+// by hash, eg. the preimages of secure trie keys, are written straight to disk.
+func (c *NodeCache) Put(key, value []byte) error {
+	if len(key) != common.HashLength {
+		return c.diskdb.Put(key, value)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.insert(common.BytesToHash(key), value)
+	return nil
+}
+
+// LeafWriter returns a writer inserting nodes in the cache like Put, and invoking
+// onleaf for every leaf of the inserted nodes with the hash of the node holding it,
+// eg. to reference the storage trie of an account from the state trie.
+func (c *NodeCache) LeafWriter(onleaf LeafCallback) DatabaseWriter {
+	return &leafWriter{cache: c, onleaf: onleaf}
+}
+
+type leafWriter struct {
+	cache  *NodeCache
+	onleaf LeafCallback
+}
+
+func (w *leafWriter) Put(key, value []byte) error {
+	if len(key) != common.HashLength {
+		return w.cache.diskdb.Put(key, value)
+	}
+	hash := common.BytesToHash(key)
+
+	w.cache.lock.Lock()
+	leaves := w.cache.insert(hash, value)
+	w.cache.lock.Unlock()
+
+	for _, leaf := range leaves {
+		if err := w.onleaf(leaf, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert stores a node in memory, referencing its children already there, and
+// returns its leaves. It must be called with the lock held.
+func (c *NodeCache) insert(hash common.Hash, blob []byte) [][]byte {
+	if _, ok := c.nodes[hash]; ok {
+		return nil
+	}
+	var (
+		node   = &cachedNode{blob: common.CopyBytes(blob)}
+		leaves [][]byte
+	)
+	if n, err := decodeNode(hash[:], node.blob, 0); err == nil {
+		node.children, leaves = gatherChildren(n, nil, nil)
+	}
+	for _, child := range node.children {
+		if c := c.nodes[child]; c != nil {
+			c.parents++
+		}
+	}
+	c.nodes[hash] = node
+	c.size += common.StorageSize(common.HashLength + len(node.blob))
+	return leaves
+}
+
+// gatherChildren collects the hashes of the children and the leaves of a decoded
+// node, embedded nodes included.
+func gatherChildren(n node, children []common.Hash, leaves [][]byte) ([]common.Hash, [][]byte) {
+	switch n := n.(type) {
+	case *shortNode:
+		return gatherChildren(n.Val, children, leaves)
+	case *fullNode:
+		for _, child := range n.Children {
+			if child != nil {
+				children, leaves = gatherChildren(child, children, leaves)
+			}
+		}
+	case hashNode:
+		children = append(children, common.BytesToHash(n))
+	case valueNode:
+		leaves = append(leaves, n)
+	}
+	return children, leaves
+}
+
+// Reference adds a reference from a parent node to a child one, the zero hash
+// standing for roots. Nothing is done if the child is not in memory.
+func (c *NodeCache) Reference(child, parent common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.reference(child, parent)
+}
+
+// reference is the lock free version of Reference.
+func (c *NodeCache) reference(child, parent common.Hash) {
+	node, ok := c.nodes[child]
+	if !ok {
+		return
+	}
+	p := c.nodes[parent]
+	if p == nil {
+		return
+	}
+	// Only roots may be referenced more than once by the same parent
+	if p.external[child] > 0 && parent != (common.Hash{}) {
+		return
+	}
+	if p.external == nil {
+		p.external = make(map[common.Hash]uint16)
+	}
+	p.external[child]++
+	node.parents++
+}
+
+// Dereference releases a root, removing from memory all of its nodes no longer
+// referenced by any other root.
+func (c *NodeCache) Dereference(root common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	nodes, size, start := len(c.nodes), c.size, time.Now()
+	c.dereference(root, common.Hash{})
+
+	nodeCacheGCNodesCounter.Inc(int64(nodes - len(c.nodes)))
+	nodeCacheGCSizeCounter.Inc(int64(size - c.size))
+	glog.V(logger.Detail).Infof("dereferenced trie root %x…: %d nodes (%v) collected in %v, %d nodes (%v) in memory", root[:4], nodes-len(c.nodes), size-c.size, time.Since(start), len(c.nodes)-1, c.size)
+}
+
+func (c *NodeCache) dereference(child, parent common.Hash) {
+	if p := c.nodes[parent]; p != nil && p.external[child] > 0 {
+		p.external[child]--
+		if p.external[child] == 0 {
+			delete(p.external, child)
+		}
+	}
+	node, ok := c.nodes[child]
+	if !ok {
+		return
+	}
+	if node.parents > 0 {
+		node.parents--
+	}
+	if node.parents == 0 {
+		for _, hash := range node.children {
+			c.dereference(hash, child)
+		}
+		for hash := range node.external {
+			c.dereference(hash, child)
+		}
+		delete(c.nodes, child)
+		c.size -= common.StorageSize(common.HashLength + len(node.blob))
+	}
+}
+
+// Commit flushes the nodes reachable from the given root to disk and removes them
+// from memory. The nodes of other roots sharing them are thereby persisted too.
+func (c *NodeCache) Commit(root common.Hash) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	nodes, size, start := len(c.nodes), c.size, time.Now()
+
+	f := &nodeFlusher{db: c.diskdb}
+	if db, ok := c.diskdb.(ethdb.Database); ok {
+		f.batchdb = db
+		f.batch = db.NewBatch()
+	}
+	if err := c.commit(root, f); err != nil {
+		return err
+	}
+	if f.batch != nil {
+		if err := f.batch.Write(); err != nil {
+			return err
+		}
+	}
+	c.uncache(root)
+
+	nodeCacheFlushNodesCounter.Inc(int64(nodes - len(c.nodes)))
+	nodeCacheFlushSizeCounter.Inc(int64(size - c.size))
+	glog.V(logger.Debug).Infof("flushed trie root %x…: %d nodes (%v) in %v, %d nodes (%v) in memory", root[:4], nodes-len(c.nodes), size-c.size, time.Since(start), len(c.nodes)-1, c.size)
+	return nil
+}
+
+// commit writes a node and its children in memory to disk.
+func (c *NodeCache) commit(hash common.Hash, f *nodeFlusher) error {
+	node, ok := c.nodes[hash]
+	if !ok || hash == (common.Hash{}) {
+		return nil
+	}
+	for _, child := range node.children {
+		if err := c.commit(child, f); err != nil {
+			return err
+		}
+	}
+	for child := range node.external {
+		if err := c.commit(child, f); err != nil {
+			return err
+		}
+	}
+	return f.put(hash[:], node.blob)
+}
+
+// nodeFlusher writes flushed nodes to disk, in batches if the disk database
+// supports them.
+type nodeFlusher struct {
+	db      DatabaseWriter
+	batchdb ethdb.Database
+	batch   ethdb.Batch
+}
+
+func (f *nodeFlusher) put(key, value []byte) error {
+	if f.batch == nil {
+		return f.db.Put(key, value)
+	}
+	if err := f.batch.Put(key, value); err != nil {
+		return err
+	}
+	// Don't let the batch grow unbounded
+	if f.batch.ValueSize() >= ethdb.IdealBatchSize {
+		if err := f.batch.Write(); err != nil {
+			return err
+		}
+		f.batch = f.batchdb.NewBatch()
+	}
+	return nil
+}
+
+// uncache removes a flushed node and its children from memory.
+func (c *NodeCache) uncache(hash common.Hash) {
+	node, ok := c.nodes[hash]
+	if !ok || hash == (common.Hash{}) {
+		return
+	}
+	delete(c.nodes, hash)
+	c.size -= common.StorageSize(common.HashLength + len(node.blob))
+
+	for _, child := range node.children {
+		c.uncache(child)
+	}
+	for child := range node.external {
+		c.uncache(child)
+	}
+}
+
+// Size returns the number of nodes in memory and their storage size.
+func (c *NodeCache) Size() (int, common.StorageSize) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return len(c.nodes) - 1, c.size
+}
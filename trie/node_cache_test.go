@@ -0,0 +1,128 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/ethdb"
+)
+
+// makeCachedTries commits to the cache a "storage" trie and two versions of an
+// "account" trie holding its root in a leaf.
+func makeCachedTries(t *testing.T, cache *NodeCache) (storage, root1, root2 common.Hash) {
+	st, _ := New(common.Hash{}, cache)
+	for i := 0; i < 100; i++ {
+		st.Update([]byte(fmt.Sprintf("slot-%d", i)), common.LeftPadBytes([]byte{byte(i)}, 32))
+	}
+	storage, err := st.CommitTo(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onleaf := func(leaf []byte, parent common.Hash) error {
+		if len(leaf) == common.HashLength {
+			cache.Reference(common.BytesToHash(leaf), parent)
+		}
+		return nil
+	}
+	at, _ := New(common.Hash{}, cache)
+	for i := 0; i < 100; i++ {
+		at.Update([]byte(fmt.Sprintf("account-%d", i)), []byte(fmt.Sprintf("balance-%d-xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx", i)))
+	}
+	at.Update([]byte("contract"), storage.Bytes())
+	if root1, err = at.CommitTo(cache.LeafWriter(onleaf)); err != nil {
+		t.Fatal(err)
+	}
+	cache.Reference(root1, common.Hash{})
+
+	at.Update([]byte("account-0"), []byte("changed-xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"))
+	if root2, err = at.CommitTo(cache.LeafWriter(onleaf)); err != nil {
+		t.Fatal(err)
+	}
+	cache.Reference(root2, common.Hash{})
+	return storage, root1, root2
+}
+
+func TestNodeCacheGC(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	cache := NewNodeCache(diskdb)
+	storage, root1, root2 := makeCachedTries(t, cache)
+
+	if len(diskdb.Keys()) != 0 {
+		t.Fatalf("nodes written to disk: %d", len(diskdb.Keys()))
+	}
+	nodes, _ := cache.Size()
+
+	// Releasing the first version only collects the nodes it does not share.
+	cache.Dereference(root1)
+	if n, _ := cache.Size(); n == 0 || n >= nodes {
+		t.Fatalf("nodes after first dereference: have %d, had %d", n, nodes)
+	}
+	if _, err := New(root1, cache); err == nil {
+		t.Error("released root still available")
+	}
+	tr, err := New(root2, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := tr.Get([]byte("account-1")); string(v) != "balance-1-xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx" {
+		t.Errorf("account-1 mismatch: have %q", v)
+	}
+	st, err := New(storage, cache)
+	if err != nil {
+		t.Fatal("storage trie collected:", err)
+	}
+	if v := st.Get([]byte("slot-7")); len(v) != 32 || v[31] != 7 {
+		t.Errorf("slot-7 mismatch: have %x", v)
+	}
+
+	// Releasing the second one collects everything.
+	cache.Dereference(root2)
+	if n, size := cache.Size(); n != 0 || size != 0 {
+		t.Errorf("nodes after second dereference: have %d (%v), want 0", n, size)
+	}
+}
+
+func TestNodeCacheCommit(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	cache := NewNodeCache(diskdb)
+	storage, _, root2 := makeCachedTries(t, cache)
+
+	if err := cache.Commit(root2); err != nil {
+		t.Fatal(err)
+	}
+	// The storage trie, referenced from a leaf, is flushed too.
+	for _, root := range []common.Hash{storage, root2} {
+		tr, err := New(root, diskdb)
+		if err != nil {
+			t.Fatalf("root %x not flushed: %v", root, err)
+		}
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+		}
+		if it.Error() != nil {
+			t.Fatalf("trie %x incomplete on disk: %v", root, it.Error())
+		}
+	}
+	// Only the nodes of the first version not shared with the second remain.
+	nodes, _ := cache.Size()
+	if nodes == 0 {
+		t.Fatal("all nodes flushed")
+	}
+}
@@ -18,10 +18,12 @@ package trie
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/crypto"
+	"github.com/ethereumproject/go-ethereum/ethdb"
 	"github.com/ethereumproject/go-ethereum/logger/glog"
 	"github.com/ethereumproject/go-ethereum/rlp"
 )
@@ -105,7 +107,7 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) (valu
 		if err != nil {
 			return nil, fmt.Errorf("bad proof node %d: %v", i, err), i
 		}
-		keyrest, cld := get(n, key)
+		keyrest, cld := get(n, key, true)
 		switch cld := cld.(type) {
 		case nil:
 			// The trie doesn't contain the key.
@@ -119,7 +121,10 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) (valu
 	}
 }
 
-func get(tn node, key []byte) ([]byte, node) {
+// get walks down the given node along key. If skipResolved is set, already
+// resolved children are traversed until an unresolved (hash) node, a value or
+// a dead end is reached, otherwise it stops after a single step.
+func get(tn node, key []byte, skipResolved bool) ([]byte, node) {
 	for {
 		switch n := tn.(type) {
 		case *shortNode:
@@ -128,9 +133,15 @@ func get(tn node, key []byte) ([]byte, node) {
 			}
 			tn = n.Val
 			key = key[len(n.Key):]
+			if !skipResolved {
+				return key, tn
+			}
 		case *fullNode:
 			tn = n.Children[key[0]]
 			key = key[1:]
+			if !skipResolved {
+				return key, tn
+			}
 		case hashNode:
 			return key, n
 		case nil:
@@ -142,3 +153,415 @@ func get(tn node, key []byte) ([]byte, node) {
 		}
 	}
 }
+
+// VerifyRangeProof checks that keys and values are the complete, consecutive
+// list of the entries of the trie with the given root hash, starting at origin
+// and ending at the last key. The proof must contain the merkle proofs of both
+// origin (which may be absent from the trie) and the last key. If proofDb is
+// nil, the entries are expected to be the entire content of the trie, and
+// origin must be empty or zero.
+//
+// The returned flag reports whether the trie holds further entries after the
+// last key.
+//
+// If nodeDb is not nil, the nodes of the subtries entirely within the proven
+// range are written to it. The nodes on the paths to origin and the last key
+// are not written, as their children outside the range are not known, so every
+// node written is the root of a complete subtrie.
+func VerifyRangeProof(rootHash common.Hash, origin []byte, keys [][]byte, values [][]byte, proofDb DatabaseReader, nodeDb DatabaseWriter) (bool, error) {
+	if len(keys) != len(values) {
+		return false, fmt.Errorf("inconsistent proof data, keys: %d, values: %d", len(keys), len(values))
+	}
+	// Ensure the received batch is monotonically increasing and contains no deletions
+	for i := 0; i < len(keys)-1; i++ {
+		if bytes.Compare(keys[i], keys[i+1]) >= 0 {
+			return false, errors.New("range is not monotonically increasing")
+		}
+	}
+	for _, value := range values {
+		if len(value) == 0 {
+			return false, errors.New("range contains deletion")
+		}
+	}
+	if len(keys) > 0 && bytes.Compare(keys[0], origin) < 0 {
+		return false, errors.New("range starts before origin")
+	}
+	// Without any proof, the range must be the whole trie.
+	if proofDb == nil {
+		if len(bytes.Trim(origin, "\x00")) > 0 {
+			return false, errors.New("missing proof of non-zero origin")
+		}
+		tr := &Trie{db: emptyDatabase}
+		for i, key := range keys {
+			if err := tr.TryUpdate(key, values[i]); err != nil {
+				return false, err
+			}
+		}
+		if have := tr.Hash(); have != rootHash {
+			return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+		}
+		if nodeDb != nil && tr.root != nil {
+			if _, _, err := newHasher(0, 0).hash(tr.root, nodeDb, true); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+	// Without any entries, the proof must show that nothing follows origin.
+	if len(keys) == 0 {
+		root, val, err := proofToPath(rootHash, nil, origin, proofDb)
+		if err != nil {
+			return false, err
+		}
+		more, err := hasRightElement(root, origin)
+		if err != nil {
+			return false, err
+		}
+		if val != nil || more {
+			return false, errors.New("more entries available")
+		}
+		return false, nil
+	}
+	last := keys[len(keys)-1]
+
+	// A single entry at origin has a single edge path, which must hold the value.
+	if len(keys) == 1 && bytes.Equal(origin, last) {
+		root, val, err := proofToPath(rootHash, nil, origin, proofDb)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(val, values[0]) {
+			return false, errors.New("correct proof but invalid data")
+		}
+		return hasRightElement(root, origin)
+	}
+	if len(origin) != len(last) {
+		return false, errors.New("inconsistent edge keys")
+	}
+	// Rebuild the two edge paths from the proof, then drop everything between
+	// them and fill it in again from the entries. The result must hash to the
+	// root if (and only if) the entries are the complete range.
+	root, _, err := proofToPath(rootHash, nil, origin, proofDb)
+	if err != nil {
+		return false, err
+	}
+	root, _, err = proofToPath(rootHash, root, last, proofDb)
+	if err != nil {
+		return false, err
+	}
+	empty, err := unsetInternal(root, origin, last)
+	if err != nil {
+		return false, err
+	}
+	tr := &Trie{root: root, db: emptyDatabase}
+	if empty {
+		tr.root = nil
+	}
+	for i, key := range keys {
+		if err := tr.TryUpdate(key, values[i]); err != nil {
+			return false, err
+		}
+	}
+	if have := tr.Hash(); have != rootHash {
+		return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+	}
+	if nodeDb != nil {
+		if err := storeInternal(tr.root, nil, keybytesToHex(origin), keybytesToHex(last), nodeDb); err != nil {
+			return false, err
+		}
+	}
+	return hasRightElement(tr.root, last)
+}
+
+// emptyDatabase backs the tries rebuilt from range proofs. Resolving a node
+// from it always fails, as any node not in the proof is outside of the range.
+var emptyDatabase, _ = ethdb.NewMemDatabase()
+
+// proofToPath resolves the nodes on the path to key from the proof, linking
+// them into root (resolving the root from the proof first if nil). Children off
+// the path are left as hash nodes. The key may be absent from the trie, in
+// which case the path ends at the node proving its absence and the returned
+// value is nil.
+func proofToPath(rootHash common.Hash, root node, key []byte, proofDb DatabaseReader) (node, []byte, error) {
+	resolveNode := func(hash []byte) (node, error) {
+		buf, _ := proofDb.Get(hash)
+		if buf == nil {
+			return nil, fmt.Errorf("proof node (hash %064x) missing", hash)
+		}
+		n, err := decodeNode(hash, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %v", err)
+		}
+		return n, nil
+	}
+	if root == nil {
+		n, err := resolveNode(rootHash[:])
+		if err != nil {
+			return nil, nil, err
+		}
+		root = n
+	}
+	var (
+		err           error
+		child, parent node
+		keyrest       []byte
+		valnode       []byte
+	)
+	key, parent = keybytesToHex(key), root
+	for {
+		keyrest, child = get(parent, key, false)
+		switch cld := child.(type) {
+		case nil:
+			// The trie doesn't contain the key, but all the nodes resolved so
+			// far are proven, which is enough to prove the range.
+			return root, nil, nil
+		case *shortNode, *fullNode:
+			key, parent = keyrest, child // Already resolved
+			continue
+		case hashNode:
+			child, err = resolveNode(cld)
+			if err != nil {
+				return nil, nil, err
+			}
+		case valueNode:
+			valnode = cld
+		}
+		// Link the parent and child.
+		switch pnode := parent.(type) {
+		case *shortNode:
+			pnode.Val = child
+		case *fullNode:
+			pnode.Children[key[0]] = child
+		default:
+			return nil, nil, fmt.Errorf("%T: invalid node on the proof path", pnode)
+		}
+		if len(valnode) > 0 {
+			return root, valnode, nil // The whole path is resolved
+		}
+		key, parent = keyrest, child
+	}
+}
+
+// unsetInternal removes all the nodes between the edge paths to left and right
+// (where left is smaller than right) from a trie constructed by proofToPath,
+// so that they can be filled in again from the entries of the range. It
+// returns true if the whole trie lies within the range.
+func unsetInternal(n node, left []byte, right []byte) (bool, error) {
+	left, right = keybytesToHex(left), keybytesToHex(right)
+
+	// Step down to the fork point of the two paths. It's either a short node
+	// whose key doesn't match one of the paths, or a full node where the paths
+	// take different children (or a missing one).
+	var (
+		pos    = 0
+		parent node
+
+		// -1 if the path is smaller than the short node's key, 1 if greater
+		shortForkLeft, shortForkRight int
+	)
+findFork:
+	for {
+		switch rn := (n).(type) {
+		case *shortNode:
+			rn.flags = nodeFlag{dirty: true}
+
+			if len(left)-pos < len(rn.Key) {
+				shortForkLeft = bytes.Compare(left[pos:], rn.Key)
+			} else {
+				shortForkLeft = bytes.Compare(left[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if len(right)-pos < len(rn.Key) {
+				shortForkRight = bytes.Compare(right[pos:], rn.Key)
+			} else {
+				shortForkRight = bytes.Compare(right[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if shortForkLeft != 0 || shortForkRight != 0 {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Val, pos+len(rn.Key)
+		case *fullNode:
+			rn.flags = nodeFlag{dirty: true}
+
+			if pos >= len(left) || pos >= len(right) {
+				return false, errors.New("edge paths end at a full node")
+			}
+			if left[pos] != right[pos] || rn.Children[left[pos]] == nil {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Children[left[pos]], pos+1
+		default:
+			return false, fmt.Errorf("%T: invalid node on the edge paths", n)
+		}
+	}
+	// Nodes on the edge paths below a full node are removed from it, so the
+	// fork point must hang off one (or be the root).
+	removeChild := func(key []byte) (bool, error) {
+		if parent == nil {
+			return true, nil
+		}
+		fn, ok := parent.(*fullNode)
+		if !ok {
+			return false, fmt.Errorf("%T: invalid parent of the edge paths' fork point", parent)
+		}
+		fn.Children[key[pos-1]] = nil
+		return false, nil
+	}
+	switch rn := n.(type) {
+	case *shortNode:
+		// Both paths on the same side of the short node leave nothing in range.
+		if shortForkLeft == -1 && shortForkRight == -1 {
+			return false, errors.New("empty range")
+		}
+		if shortForkLeft == 1 && shortForkRight == 1 {
+			return false, errors.New("empty range")
+		}
+		// The short node lies entirely in the range, remove it.
+		if shortForkLeft != 0 && shortForkRight != 0 {
+			return removeChild(left)
+		}
+		// Only one of the paths passes through the short node.
+		if shortForkRight != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				return removeChild(left)
+			}
+			return false, unset(rn, rn.Val, left[pos:], len(rn.Key), false)
+		}
+		if shortForkLeft != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				return removeChild(right)
+			}
+			return false, unset(rn, rn.Val, right[pos:], len(rn.Key), true)
+		}
+		return false, nil
+	case *fullNode:
+		// Remove the children between the paths, and everything right of the
+		// left path and left of the right path below them.
+		for i := left[pos] + 1; i < right[pos]; i++ {
+			rn.Children[i] = nil
+		}
+		if err := unset(rn, rn.Children[left[pos]], left[pos:], 1, false); err != nil {
+			return false, err
+		}
+		if err := unset(rn, rn.Children[right[pos]], right[pos:], 1, true); err != nil {
+			return false, err
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("%T: invalid node at the edge paths' fork point", n)
+	}
+}
+
+// unset removes all the nodes left (if removeLeft is set) or right of the path
+// key below child, which is linked into parent.
+func unset(parent node, child node, key []byte, pos int, removeLeft bool) error {
+	// Removing a node on the path unlinks it from its parent full node
+	removeChild := func() error {
+		fn, ok := parent.(*fullNode)
+		if !ok {
+			return fmt.Errorf("%T: invalid parent of %T on the edge path", parent, child)
+		}
+		fn.Children[key[pos-1]] = nil
+		return nil
+	}
+	switch cld := child.(type) {
+	case *fullNode:
+		if pos >= len(key) {
+			return errors.New("edge path ends at a full node")
+		}
+		if removeLeft {
+			for i := 0; i < int(key[pos]); i++ {
+				cld.Children[i] = nil
+			}
+		} else {
+			for i := key[pos] + 1; i < 16; i++ {
+				cld.Children[i] = nil
+			}
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Children[key[pos]], key, pos+1, removeLeft)
+	case *shortNode:
+		if len(key[pos:]) < len(cld.Key) || !bytes.Equal(cld.Key, key[pos:pos+len(cld.Key)]) {
+			// The path ends here. The short node lies in the range, and must be
+			// removed, if it's on the inner side of the path.
+			if removeLeft {
+				if bytes.Compare(cld.Key, key[pos:]) < 0 {
+					return removeChild()
+				}
+			} else {
+				if bytes.Compare(cld.Key, key[pos:]) > 0 {
+					return removeChild()
+				}
+			}
+			return nil
+		}
+		if _, ok := cld.Val.(valueNode); ok {
+			return removeChild()
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Val, key, pos+len(cld.Key), removeLeft)
+	case nil:
+		// The path ends at a missing child of a full node.
+		return nil
+	default:
+		return fmt.Errorf("%T: unexpected node on the edge path", child)
+	}
+}
+
+// hasRightElement reports whether the trie holds entries right of the path
+// key, which must be resolved.
+func hasRightElement(node node, key []byte) (bool, error) {
+	pos, key := 0, keybytesToHex(key)
+	for node != nil {
+		switch rn := node.(type) {
+		case *fullNode:
+			if pos >= len(key) {
+				return false, errors.New("edge path ends at a full node")
+			}
+			for i := key[pos] + 1; i < 16; i++ {
+				if rn.Children[i] != nil {
+					return true, nil
+				}
+			}
+			node, pos = rn.Children[key[pos]], pos+1
+		case *shortNode:
+			if len(key)-pos < len(rn.Key) || !bytes.Equal(rn.Key, key[pos:pos+len(rn.Key)]) {
+				return bytes.Compare(rn.Key, key[pos:]) > 0, nil
+			}
+			node, pos = rn.Val, pos+len(rn.Key)
+		case valueNode:
+			return false, nil // We have resolved the whole path
+		default:
+			return false, fmt.Errorf("%T: unresolved node on the edge path", node)
+		}
+	}
+	return false, nil
+}
+
+// storeInternal writes the subtries of n which are off the edge paths left and
+// right to db.
+func storeInternal(n node, path, left, right []byte, db DatabaseWriter) error {
+	if !bytes.HasPrefix(left, path) && !bytes.HasPrefix(right, path) {
+		switch n.(type) {
+		case *shortNode, *fullNode:
+			_, _, err := newHasher(0, 0).hash(n, db, false)
+			return err
+		}
+		return nil
+	}
+	switch n := n.(type) {
+	case *shortNode:
+		return storeInternal(n.Val, concat(path, n.Key...), left, right, db)
+	case *fullNode:
+		for i, child := range n.Children[:16] {
+			if child == nil {
+				continue
+			}
+			if err := storeInternal(child, concat(path, byte(i)), left, right, db); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -20,12 +20,14 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/ethereumproject/go-ethereum/common"
 	"github.com/ethereumproject/go-ethereum/crypto"
 	"github.com/ethereumproject/go-ethereum/ethdb"
+	"github.com/ethereumproject/go-ethereum/rlp"
 )
 
 func init() {
@@ -89,6 +91,249 @@ func TestVerifyBadProof(t *testing.T) {
 	}
 }
 
+// sortedEntries returns the entries of a random trie in key order.
+func sortedEntries(vals map[string]*kv) []*kv {
+	entries := make([]*kv, 0, len(vals))
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Sort(entrySlice(entries))
+	return entries
+}
+
+type entrySlice []*kv
+
+func (s entrySlice) Len() int           { return len(s) }
+func (s entrySlice) Less(i, j int) bool { return bytes.Compare(s[i].k, s[j].k) < 0 }
+func (s entrySlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// rangeProof returns the keys and values of entries[start:end] along with the
+// proofs of origin and the last key.
+func rangeProof(t *testing.T, trie *Trie, entries []*kv, origin []byte, start, end int) ([][]byte, [][]byte, *ethdb.MemDatabase) {
+	proof, _ := ethdb.NewMemDatabase()
+	if err := trie.Prove(origin, 0, proof); err != nil {
+		t.Fatalf("failed to prove origin %x: %v", origin, err)
+	}
+	if end > start {
+		if err := trie.Prove(entries[end-1].k, 0, proof); err != nil {
+			t.Fatalf("failed to prove last key %x: %v", entries[end-1].k, err)
+		}
+	}
+	var keys, vals [][]byte
+	for _, kv := range entries[start:end] {
+		keys = append(keys, kv.k)
+		vals = append(vals, kv.v)
+	}
+	return keys, vals, proof
+}
+
+func TestRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	root, entries := trie.Hash(), sortedEntries(vals)
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries))
+		end := start + 1 + mrand.Intn(len(entries)-start)
+
+		keys, values, proof := rangeProof(t, trie, entries, entries[start].k, start, end)
+		more, err := VerifyRangeProof(root, entries[start].k, keys, values, proof, nil)
+		if err != nil {
+			t.Fatalf("range [%d, %d): failed to verify: %v", start, end, err)
+		}
+		if more != (end < len(entries)) {
+			t.Fatalf("range [%d, %d): more flag mismatch: have %v, want %v", start, end, more, end < len(entries))
+		}
+	}
+}
+
+func TestRangeProofNonExistentOrigin(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	root, entries := trie.Hash(), sortedEntries(vals)
+
+	for i := 0; i < 500; i++ {
+		start := 1 + mrand.Intn(len(entries)-1)
+		end := start + 1 + mrand.Intn(len(entries)-start)
+
+		// Pick an origin between the previous and the first key of the range.
+		origin := common.CopyBytes(entries[start].k)
+		for j := len(origin) - 1; j >= 0; j-- {
+			if origin[j] > 0 {
+				origin[j]--
+				break
+			}
+			origin[j] = 0xff
+		}
+		if bytes.Equal(origin, entries[start-1].k) {
+			continue
+		}
+		keys, values, proof := rangeProof(t, trie, entries, origin, start, end)
+		if _, err := VerifyRangeProof(root, origin, keys, values, proof, nil); err != nil {
+			t.Fatalf("range [%d, %d): failed to verify: %v", start, end, err)
+		}
+	}
+}
+
+func TestBadRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	root, entries := trie.Hash(), sortedEntries(vals)
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries) - 2)
+		end := start + 2 + mrand.Intn(len(entries)-start-1)
+
+		keys, values, proof := rangeProof(t, trie, entries, entries[start].k, start, end)
+		switch mrand.Intn(4) {
+		case 0: // Drop an entry (dropping the last one leaves a valid, shorter range)
+			index := mrand.Intn(len(keys) - 1)
+			keys = append(keys[:index:index], keys[index+1:]...)
+			values = append(values[:index:index], values[index+1:]...)
+		case 1: // Modify a value
+			index := mrand.Intn(len(values))
+			values[index] = randBytes(20)
+		case 2: // Modify a key inside the range
+			if len(keys) < 3 {
+				continue
+			}
+			index := 1 + mrand.Intn(len(keys)-2)
+			keys[index] = common.CopyBytes(keys[index])
+			keys[index][len(keys[index])-1]++
+			if bytes.Compare(keys[index], keys[index+1]) >= 0 {
+				continue
+			}
+		case 3: // Swap two entries
+			index := mrand.Intn(len(keys) - 1)
+			keys[index], keys[index+1] = keys[index+1], keys[index]
+		}
+		if _, err := VerifyRangeProof(root, entries[start].k, keys, values, proof, nil); err == nil {
+			t.Fatalf("range [%d, %d): tampered range verified", start, end)
+		}
+	}
+}
+
+// Tests that range proofs made of nodes which can't occur in a trie are
+// rejected, rather than crashing the verifier.
+func TestMalformedRangeProof(t *testing.T) {
+	tests := []struct {
+		root         []interface{}
+		origin       []byte
+		keys, values [][]byte
+	}{
+		// A value node ending the path to origin, but with an empty value
+		{
+			root:   []interface{}{hexToCompact([]byte{1, 0, 16}), []byte{}},
+			origin: []byte{0x10},
+		},
+		// A short node forking the edge paths, hanging off another short node
+		{
+			root: []interface{}{
+				hexToCompact([]byte{1}),
+				[]interface{}{hexToCompact([]byte{5, 16}), []byte{1}},
+			},
+			origin: []byte{0x10},
+			keys:   [][]byte{{0x1f}},
+			values: [][]byte{{1}},
+		},
+	}
+	for i, tt := range tests {
+		enc, err := rlp.EncodeToBytes(tt.root)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode root: %v", i, err)
+		}
+		proof, _ := ethdb.NewMemDatabase()
+		root := crypto.Keccak256Hash(enc)
+		proof.Put(root[:], enc)
+
+		if _, err := VerifyRangeProof(root, tt.origin, tt.keys, tt.values, proof, nil); err == nil {
+			t.Errorf("test %d: malformed proof verified", i)
+		}
+	}
+}
+
+func TestRangeProofWholeTrie(t *testing.T) {
+	trie, vals := randomTrie(500)
+	root, entries := trie.Hash(), sortedEntries(vals)
+
+	var keys, values [][]byte
+	for _, kv := range entries {
+		keys = append(keys, kv.k)
+		values = append(values, kv.v)
+	}
+	db, _ := ethdb.NewMemDatabase()
+	more, err := VerifyRangeProof(root, nil, keys, values, nil, db)
+	if err != nil {
+		t.Fatalf("failed to verify whole trie: %v", err)
+	}
+	if more {
+		t.Fatal("more entries reported after the whole trie")
+	}
+	// The written nodes must form the complete trie.
+	synced, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open written trie: %v", err)
+	}
+	for _, kv := range entries {
+		if have := synced.Get(kv.k); !bytes.Equal(have, kv.v) {
+			t.Fatalf("entry %x: value mismatch: have %x, want %x", kv.k, have, kv.v)
+		}
+	}
+	// Dropping an entry must be detected.
+	if _, err := VerifyRangeProof(root, nil, keys[1:], values[1:], nil, nil); err == nil {
+		t.Fatal("incomplete trie verified without proof")
+	}
+}
+
+func TestRangeProofEmptyTail(t *testing.T) {
+	trie, vals := randomTrie(500)
+	root, entries := trie.Hash(), sortedEntries(vals)
+
+	// Nothing follows a key past the last entry.
+	origin := common.CopyBytes(entries[len(entries)-1].k)
+	origin[len(origin)-1]++
+
+	proof, _ := ethdb.NewMemDatabase()
+	if err := trie.Prove(origin, 0, proof); err != nil {
+		t.Fatalf("failed to prove origin: %v", err)
+	}
+	if more, err := VerifyRangeProof(root, origin, nil, nil, proof, nil); err != nil || more {
+		t.Fatalf("empty tail: have more %v, err %v", more, err)
+	}
+	// The last entry does follow its own predecessor.
+	origin = entries[len(entries)-2].k
+	proof, _ = ethdb.NewMemDatabase()
+	trie.Prove(origin, 0, proof)
+	if _, err := VerifyRangeProof(root, origin, nil, nil, proof, nil); err == nil {
+		t.Fatal("non-empty tail verified as empty")
+	}
+}
+
+func TestRangeProofNodeStore(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	root, entries := trie.Hash(), sortedEntries(vals)
+
+	// Every node written for a range must be the root of a complete subtrie.
+	start, end := len(entries)/4, len(entries)/2
+	keys, values, proof := rangeProof(t, trie, entries, entries[start].k, start, end)
+	db, _ := ethdb.NewMemDatabase()
+	if _, err := VerifyRangeProof(root, entries[start].k, keys, values, proof, db); err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if len(db.Keys()) == 0 {
+		t.Fatal("no nodes written")
+	}
+	for _, key := range db.Keys() {
+		sub, err := New(common.BytesToHash(key), db)
+		if err != nil {
+			t.Fatalf("failed to open subtrie %x: %v", key, err)
+		}
+		it := sub.NodeIterator(nil)
+		for it.Next(true) {
+		}
+		if it.Error() != nil {
+			t.Fatalf("subtrie %x incomplete: %v", key, it.Error())
+		}
+	}
+}
+
 // mutateByte changes one byte in b.
 func mutateByte(b []byte) {
 	for r := mrand.Intn(len(b)); ; {